@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// readSecretFile reads a password, API key or token from path. Secret files
+// are read whenever the secret is used, so that they can be rotated, e.g. as
+// mounted Kubernetes secrets, without restarting the exporter.
+func readSecretFile(path string) (string, error) {
+	secret, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %s", err)
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
+
+// cloneRequest returns a shallow copy of req with a copy of its header, since
+// RoundTrippers must not modify the original request
+func cloneRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	return r
+}
+
+// apiKeyRoundTripper adds an Elasticsearch API key to every request, read
+// from apiKeyFile if set
+type apiKeyRoundTripper struct {
+	apiKey     string
+	apiKeyFile string
+	next       http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *apiKeyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	apiKey := rt.apiKey
+	if rt.apiKeyFile != "" {
+		var err error
+		if apiKey, err = readSecretFile(rt.apiKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	r := cloneRequest(req)
+	r.Header.Set("Authorization", "ApiKey "+apiKey)
+	return rt.next.RoundTrip(r)
+}
+
+// passwordFileRoundTripper replaces the password of the basic auth credentials
+// of every request, i.e. of the user of the URL, by that read from
+// passwordFile. Requests without credentials are passed on unchanged.
+type passwordFileRoundTripper struct {
+	passwordFile string
+	next         http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *passwordFileRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	username, _, ok := req.BasicAuth()
+	if !ok {
+		return rt.next.RoundTrip(req)
+	}
+	password, err := readSecretFile(rt.passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	r := cloneRequest(req)
+	r.SetBasicAuth(username, password)
+	return rt.next.RoundTrip(r)
+}
+
+// headerRoundTripper sets extra headers on every request, e.g. the token of an
+// authenticating proxy or the tenant of a multi-tenant gateway
+type headerRoundTripper struct {
+	header http.Header
+	next   http.RoundTripper
+}
+
+// newHeaderRoundTripper returns next if no headers are given
+func newHeaderRoundTripper(headers map[string]string, next http.RoundTripper) http.RoundTripper {
+	if len(headers) == 0 {
+		return next
+	}
+	header := make(http.Header, len(headers))
+	for name, value := range headers {
+		header.Set(name, value)
+	}
+	return &headerRoundTripper{header: header, next: next}
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := cloneRequest(req)
+	for name, values := range rt.header {
+		r.Header[name] = values
+	}
+	return rt.next.RoundTrip(r)
+}
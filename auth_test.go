@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func writeSecretFile(t *testing.T, secret string) string {
+	f, err := ioutil.TempFile("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(secret); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestPasswordFileRoundTripper(t *testing.T) {
+	var username, password string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ = r.BasicAuth()
+	}))
+	defer ts.Close()
+
+	path := writeSecretFile(t, "first\n")
+	defer os.Remove(path)
+	client := &http.Client{Transport: &passwordFileRoundTripper{passwordFile: path, next: http.DefaultTransport}}
+	get := func() {
+		req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("exporter", "")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	get()
+	if username != "exporter" || password != "first" {
+		t.Errorf("expected exporter:first, got %s:%s", username, password)
+	}
+	// the password is rotated without recreating the client
+	if err := ioutil.WriteFile(path, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	get()
+	if username != "exporter" || password != "second" {
+		t.Errorf("expected exporter:second, got %s:%s", username, password)
+	}
+
+	os.Remove(path)
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.SetBasicAuth("exporter", "")
+	if _, err := client.Do(req); err == nil {
+		t.Error("expected a missing password file to fail the request")
+	}
+}
+
+func TestAPIKeyRoundTripperFile(t *testing.T) {
+	var authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	path := writeSecretFile(t, "a2V5\n")
+	defer os.Remove(path)
+	client := &http.Client{Transport: &apiKeyRoundTripper{apiKeyFile: path, next: http.DefaultTransport}}
+	res, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if authorization != "ApiKey a2V5" {
+		t.Errorf("expected the API key of the file, got %q", authorization)
+	}
+}
+
+func TestHeaderRoundTripper(t *testing.T) {
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer ts.Close()
+
+	if rt := newHeaderRoundTripper(nil, http.DefaultTransport); rt != http.DefaultTransport {
+		t.Error("expected no headers to return the next RoundTripper")
+	}
+	client := &http.Client{Transport: newHeaderRoundTripper(map[string]string{
+		"x-proxy-token": "secret",
+		"X-Tenant":      "logging",
+	}, http.DefaultTransport)}
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Tenant", "default")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if header.Get("X-Proxy-Token") != "secret" || header.Get("X-Tenant") != "logging" {
+		t.Errorf("unexpected headers %v", header)
+	}
+	if req.Header.Get("X-Tenant") != "default" {
+		t.Error("expected the original request to be unchanged")
+	}
+}
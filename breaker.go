@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// errCollectorDisabled is returned for scrapes skipped by a breakerCollector
+var errCollectorDisabled = errors.New("collector disabled after consecutive failures")
+
+// breakerCollector disables a collector for a cooldown period once it failed
+// threshold consecutive times, instead of hammering Elasticsearch with
+// requests which are known to fail, e.g. due to missing privileges. The first
+// scrape after the cooldown decides whether the collector is enabled again.
+type breakerCollector struct {
+	logger    log.Logger
+	name      string
+	threshold int
+	cooldown  time.Duration
+	metrics   *exporterMetrics
+	c         prometheus.Collector
+
+	mtx           sync.Mutex
+	failures      int
+	disabledUntil time.Time
+}
+
+// withBreaker wraps c in a breakerCollector, a threshold of 0 disables the
+// breaker
+func withBreaker(logger log.Logger, name string, threshold int, cooldown time.Duration, metrics *exporterMetrics, c prometheus.Collector) prometheus.Collector {
+	if threshold <= 0 {
+		return c
+	}
+	metrics.collectorDisabled.WithLabelValues(name).Set(0)
+	return &breakerCollector{
+		logger:    logger,
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		metrics:   metrics,
+		c:         c,
+	}
+}
+
+// Describe implements the prometheus.Collector interface
+func (b *breakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	b.c.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (b *breakerCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = b.CollectContext(context.Background(), ch)
+}
+
+// CollectContext implements the collector.ContextCollector interface
+func (b *breakerCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	b.mtx.Lock()
+	disabled := time.Now().Before(b.disabledUntil)
+	b.mtx.Unlock()
+	if disabled {
+		b.metrics.skippedScrapes.WithLabelValues(b.name).Inc()
+		return errCollectorDisabled
+	}
+
+	err := collector.CollectWithContext(ctx, b.c, ch)
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if err == nil {
+		b.failures = 0
+		b.metrics.collectorDisabled.WithLabelValues(b.name).Set(0)
+		return nil
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.disabledUntil = time.Now().Add(b.cooldown)
+		b.metrics.collectorDisabled.WithLabelValues(b.name).Set(1)
+		_ = level.Warn(b.logger).Log(
+			"msg", "disabling collector after consecutive failures",
+			"collector", b.name,
+			"failures", b.failures,
+			"cooldown", b.cooldown.String(),
+			"err", err,
+		)
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type failingCollector struct {
+	scrapes int
+	err     error
+}
+
+func (f *failingCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (f *failingCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = f.CollectContext(context.Background(), ch)
+}
+
+func (f *failingCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	f.scrapes++
+	return f.err
+}
+
+func TestBreakerCollector(t *testing.T) {
+	c := &failingCollector{err: errors.New("forbidden")}
+	b := withBreaker(log.NewNopLogger(), "snapshots", 2, time.Hour, newExporterMetrics(log.NewNopLogger()), c).(*breakerCollector)
+	ch := make(chan prometheus.Metric, 1)
+
+	for i := 0; i < 5; i++ {
+		_ = b.CollectContext(context.Background(), ch)
+	}
+	if c.scrapes != 2 {
+		t.Errorf("expected collector to be disabled after 2 scrapes, got %d scrapes", c.scrapes)
+	}
+
+	// the first scrape after the cooldown decides
+	b.disabledUntil = time.Time{}
+	c.err = nil
+	if err := b.CollectContext(context.Background(), ch); err != nil {
+		t.Errorf("expected scrape after cooldown to succeed, got %s", err)
+	}
+	c.err = errors.New("forbidden")
+	if err := b.CollectContext(context.Background(), ch); err == errCollectorDisabled {
+		t.Errorf("expected collector to be enabled again")
+	}
+	if c.scrapes != 4 {
+		t.Errorf("expected 4 scrapes, got %d", c.scrapes)
+	}
+
+	if _, ok := withBreaker(log.NewNopLogger(), "snapshots", 0, time.Hour, newExporterMetrics(log.NewNopLogger()), c).(*failingCollector); !ok {
+		t.Errorf("expected breaker to be disabled for threshold 0")
+	}
+}
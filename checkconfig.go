@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
+)
+
+// checkConfig checks config beyond what loadConfig validates: the credentials
+// of every auth module and cluster are resolved, i.e. their TLS files are
+// loaded. With dryRun the cluster info of es.uri, fetched by esInfo, and of
+// every cluster is retrieved as well. The problems are logged, their number
+// is returned.
+func checkConfig(ctx context.Context, logger log.Logger, config *Config, probe *probeHandler, esInfo *clusterinfo.Retriever, dryRun bool) int {
+	problems := 0
+	problem := func(logger log.Logger, keyvals ...interface{}) {
+		problems++
+		_ = level.Error(logger).Log(keyvals...)
+	}
+
+	for name, am := range config.AuthModules {
+		if _, err := createAuthModuleTLSConfig(am.TLS); err != nil {
+			problem(logger, "msg", "invalid auth module", "auth_module", name, "err", err)
+		}
+	}
+
+	fetch := func(logger log.Logger, r *clusterinfo.Retriever) {
+		ctx, cancel := context.WithTimeout(ctx, probe.timeout)
+		defer cancel()
+		info, err := r.Fetch(ctx)
+		if err != nil {
+			problem(logger, "msg", "failed to connect to target", "err", err)
+			return
+		}
+		_ = level.Info(logger).Log(
+			"msg", "connected to target",
+			"cluster_name", info.ClusterName,
+			"version", info.Version.Number.String(),
+		)
+	}
+
+	if dryRun {
+		fetch(log.With(logger, "target", "es.uri"), esInfo)
+	}
+	for _, cl := range config.Clusters {
+		logger := log.With(logger, "cluster", cl.Name)
+		cluster, auth, _ := config.cluster(cl.Name)
+		u, err := parseTargetURI(cluster.URI)
+		if err != nil {
+			problem(logger, "msg", "invalid cluster uri", "err", err)
+			continue
+		}
+		client, u, transport, err := probe.client(target{url: u, auth: auth})
+		if err != nil {
+			problem(logger, "msg", "invalid cluster credentials", "err", err)
+			continue
+		}
+		if dryRun {
+			fetch(logger, clusterinfo.New(logger, client, u, 0))
+		}
+		transport.CloseIdleConnections()
+	}
+	return problems
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
+)
+
+func TestCheckConfig(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if user, _, _ := r.BasicAuth(); user != "elastic" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"cluster_name":"elasticsearch","version":{"number":"7.3.0","lucene_version":"8.1.0"}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	esURL := *u
+	esURL.User = url.UserPassword("elastic", "changeme")
+
+	config := &Config{
+		AuthModules: map[string]AuthModule{
+			"elastic": {Username: "elastic", Password: "changeme"},
+		},
+		Clusters: []ClusterConfig{
+			{Name: "ok", URI: ts.URL, AuthModule: "elastic"},
+			{Name: "unauthorized", URI: ts.URL},
+		},
+	}
+	logger := log.NewNopLogger()
+	probe := &probeHandler{logger: logger, timeout: 5 * time.Second, metrics: newExporterMetrics(logger)}
+	esInfo := clusterinfo.New(logger, http.DefaultClient, &esURL, 0)
+
+	if problems := checkConfig(context.Background(), logger, config, probe, esInfo, false); problems != 0 {
+		t.Errorf("expected no problems without dry run, got %d", problems)
+	}
+	if problems := checkConfig(context.Background(), logger, config, probe, esInfo, true); problems != 1 {
+		t.Errorf("expected the unauthorized cluster to fail the dry run, got %d problems", problems)
+	}
+
+	config.AuthModules["tls"] = AuthModule{TLS: TLSConfig{CAFile: "/nonexistent/ca.pem"}}
+	if problems := checkConfig(context.Background(), logger, config, probe, esInfo, false); problems != 1 {
+		t.Errorf("expected the missing CA file to be a problem, got %d problems", problems)
+	}
+}
@@ -0,0 +1,170 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// auditLogTimestampField is the field holding the time of the audit events,
+// as shipped by Filebeat
+const auditLogTimestampField = "@timestamp"
+
+// auditLogResponse is a representation of the search for the newest audit
+// event, the sort value of a date field is its epoch millis
+type auditLogResponse struct {
+	Hits struct {
+		Hits []struct {
+			Sort []float64 `json:"sort"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// AuditLog information struct, the ingestion lag of the security audit log
+// shipped to the indices of a pattern
+type AuditLog struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+	pattern string
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	newestTimestamp, lag *prometheus.Desc
+}
+
+// NewAuditLog defines Audit Log Prometheus metrics for the audit log indices
+// matching pattern, e.g. "filebeat-*"
+func NewAuditLog(logger log.Logger, client *http.Client, url *url.URL, pattern string) *AuditLog {
+	subsystem := "audit_log"
+
+	return &AuditLog{
+		logger:  logger,
+		client:  client,
+		url:     url,
+		pattern: pattern,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch audit log indices successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch audit log scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		newestTimestamp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "newest_timestamp_seconds"),
+			"Time of the newest audit event indexed.",
+			[]string{"pattern"}, nil,
+		),
+		lag: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "lag_seconds"),
+			"Time since the newest audit event indexed.",
+			[]string{"pattern"}, nil,
+		),
+	}
+}
+
+// Describe add Audit Log metrics descriptions
+func (a *AuditLog) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.newestTimestamp
+	ch <- a.lag
+	ch <- a.up
+	ch <- a.totalScrapes.Desc()
+	ch <- a.jsonParseFailures.Desc()
+}
+
+func (a *AuditLog) fetchAndDecodeNewestEvent(ctx context.Context) (auditLogResponse, error) {
+	var alr auditLogResponse
+
+	u := *a.url
+	u.Path = path.Join(u.Path, a.pattern, "/_search")
+	// only the sort value of the newest event is returned, a pattern without
+	// indices isn't an error
+	q := url.Values{}
+	q.Set("size", "1")
+	q.Set("sort", auditLogTimestampField+":desc")
+	q.Set("_source", "false")
+	q.Set("filter_path", "hits.hits.sort")
+	q.Set("ignore_unavailable", "true")
+	q.Set("allow_no_indices", "true")
+	u.RawQuery = q.Encode()
+	res, err := get(ctx, a.client, u.String())
+	if err != nil {
+		return alr, fmt.Errorf("failed to get newest audit event from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(a.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return alr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := a.decodeJSON(a.logger, res.Body, "audit_log", &alr); err != nil {
+		a.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("audit_log").Inc()
+		return alr, err
+	}
+	return alr, nil
+}
+
+// Collect gets Audit Log metric values
+func (a *AuditLog) Collect(ch chan<- prometheus.Metric) {
+	_ = a.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects AuditLog metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape. The
+// metrics are omitted as long as no audit event was indexed.
+func (a *AuditLog) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	a.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(a.up, prometheus.GaugeValue, up)
+		ch <- a.totalScrapes
+		ch <- a.jsonParseFailures
+	}()
+
+	alr, err := a.fetchAndDecodeNewestEvent(ctx)
+	if err != nil {
+		_ = level.Warn(a.logger).Log(
+			"msg", "failed to fetch and decode newest audit event",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	if len(alr.Hits.Hits) == 0 || len(alr.Hits.Hits[0].Sort) == 0 {
+		return nil
+	}
+	newest := alr.Hits.Hits[0].Sort[0] / 1000
+	now := float64(time.Now().UnixNano()) / 1e9
+	ch <- prometheus.MustNewConstMetric(a.newestTimestamp, prometheus.GaugeValue, newest, a.pattern)
+	ch <- prometheus.MustNewConstMetric(a.lag, prometheus.GaugeValue, now-newest, a.pattern)
+	return nil
+}
@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAuditLog(t *testing.T) {
+	newest := time.Now().Add(-90 * time.Second)
+	empty := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/audit-*/_search" || r.URL.Query().Get("sort") != "@timestamp:desc" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if empty {
+			fmt.Fprintln(w, `{}`)
+			return
+		}
+		fmt.Fprintf(w, `{"hits":{"hits":[{"sort":[%d]}]}}`, newest.UnixNano()/int64(time.Millisecond))
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewAuditLog(log.NewNopLogger(), http.DefaultClient, u, "audit-*"))
+	gather := func() map[string]float64 {
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %s", err)
+		}
+		values := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				values[mf.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+		return values
+	}
+
+	values := gather()
+	if want := float64(newest.UnixNano()/int64(time.Millisecond)) / 1000; values["elasticsearch_audit_log_newest_timestamp_seconds"] != want {
+		t.Errorf("expected newest timestamp %v, got %v", want, values["elasticsearch_audit_log_newest_timestamp_seconds"])
+	}
+	if lag := values["elasticsearch_audit_log_lag_seconds"]; lag < 90 || lag > 120 {
+		t.Errorf("expected a lag of about 90s, got %v", lag)
+	}
+
+	// without audit events the lag is unknown
+	empty = true
+	values = gather()
+	if _, ok := values["elasticsearch_audit_log_lag_seconds"]; ok {
+		t.Error("expected the lag to be omitted without audit events")
+	}
+	if values["elasticsearch_audit_log_up"] != 1 {
+		t.Error("expected the scrape to succeed without audit events")
+	}
+}
@@ -0,0 +1,263 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CatEndpoint declares the metrics taken from the rows of a cat API, e.g.
+// _cat/recovery
+type CatEndpoint struct {
+	// Name is the part of the metric names following elasticsearch_cat_
+	Name string
+	// Path is the path of the cat API below _cat, e.g. recovery
+	Path string
+	// Params are additional query parameters, e.g. bytes=b for sizes in
+	// bytes. The columns requested default to those of Labels and Metrics.
+	Params map[string]string
+	// Labels are the columns identifying the rows, which are exported as
+	// labels with dots replaced by underscores
+	Labels  []string
+	Metrics []CatMetric
+}
+
+// CatMetric maps a column of a cat API to a metric
+type CatMetric struct {
+	Column string
+	// Name is the last part of the metric name, e.g. elasticsearch_cat_<endpoint>_<name>
+	Name string
+	Help string
+	Type prometheus.ValueType
+}
+
+type catMetric struct {
+	Type   prometheus.ValueType
+	Desc   *prometheus.Desc
+	Column string
+}
+
+type catEndpoint struct {
+	CatEndpoint
+	metrics []*catMetric
+}
+
+// Cat information struct, the metrics of the cat APIs declared in the
+// configuration
+type Cat struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	endpoints []*catEndpoint
+}
+
+// NewCat defines the Prometheus metrics of the cat endpoints
+func NewCat(logger log.Logger, client *http.Client, url *url.URL, endpoints []CatEndpoint) *Cat {
+	subsystem := "cat"
+
+	c := &Cat{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch cat endpoints successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch cat scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+	}
+	for _, endpoint := range endpoints {
+		labels := make([]string, 0, len(endpoint.Labels))
+		for _, column := range endpoint.Labels {
+			labels = append(labels, catLabelName(column))
+		}
+		e := &catEndpoint{CatEndpoint: endpoint}
+		for _, metric := range endpoint.Metrics {
+			help := metric.Help
+			if help == "" {
+				help = fmt.Sprintf("Column %s of _cat/%s.", metric.Column, endpoint.Path)
+			}
+			e.metrics = append(e.metrics, &catMetric{
+				Type: metric.Type,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, endpoint.Name+"_"+metric.Name),
+					help,
+					labels, nil,
+				),
+				Column: metric.Column,
+			})
+		}
+		c.endpoints = append(c.endpoints, e)
+	}
+	return c
+}
+
+// catLabelName returns the label name of a column, e.g. disk_used for
+// disk.used
+func catLabelName(column string) string {
+	return strings.Replace(column, ".", "_", -1)
+}
+
+// Describe add Cat metrics descriptions
+func (c *Cat) Describe(ch chan<- *prometheus.Desc) {
+	for _, endpoint := range c.endpoints {
+		for _, metric := range endpoint.metrics {
+			ch <- metric.Desc
+		}
+	}
+	ch <- c.up
+	ch <- c.totalScrapes.Desc()
+	ch <- c.jsonParseFailures.Desc()
+}
+
+func (c *Cat) fetchAndDecodeRows(ctx context.Context, e *catEndpoint) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+
+	u := *c.url
+	u.Path = path.Join(u.Path, "/_cat", e.Path)
+	q := url.Values{}
+	for name, value := range e.Params {
+		q.Set(name, value)
+	}
+	q.Set("format", "json")
+	if _, ok := e.Params["h"]; !ok {
+		columns := append([]string{}, e.Labels...)
+		for _, metric := range e.metrics {
+			columns = append(columns, metric.Column)
+		}
+		q.Set("h", strings.Join(columns, ","))
+	}
+	u.RawQuery = q.Encode()
+	res, err := get(ctx, c.client, u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get _cat/%s from %s://%s:%s%s: %s",
+			e.Path, u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(c.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := c.decodeJSON(c.logger, res.Body, "cat", &rows); err != nil {
+		c.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("cat").Inc()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// catValue parses the value of a column, cat APIs report numbers as strings
+// and percentages with a % suffix. It returns false for empty values.
+func catValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Collect gets Cat metric values
+func (c *Cat) Collect(ch chan<- prometheus.Metric) {
+	_ = c.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects Cat metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape, the
+// metrics of the other endpoints are collected regardless. Columns without
+// numeric value are omitted, as are rows whose labels aren't unique, which
+// would fail the whole scrape of the registry.
+func (c *Cat) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	c.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up)
+		ch <- c.totalScrapes
+		ch <- c.jsonParseFailures
+	}()
+
+	var scrapeErr error
+	for _, e := range c.endpoints {
+		rows, err := c.fetchAndDecodeRows(ctx, e)
+		if err != nil {
+			_ = level.Warn(c.logger).Log(
+				"msg", "failed to fetch and decode cat endpoint",
+				"endpoint", e.Name,
+				"err", err,
+			)
+			scrapeErr = err
+			continue
+		}
+		seen := make(map[string]bool, len(rows))
+		duplicates := 0
+		for _, row := range rows {
+			labels := make([]string, 0, len(e.Labels))
+			for _, column := range e.Labels {
+				if v, ok := row[column]; ok && v != nil {
+					labels = append(labels, fmt.Sprint(v))
+				} else {
+					labels = append(labels, "")
+				}
+			}
+			key := strings.Join(labels, "\xff")
+			if seen[key] {
+				duplicates++
+				continue
+			}
+			seen[key] = true
+			for _, metric := range e.metrics {
+				value, ok := catValue(row[metric.Column])
+				if !ok {
+					continue
+				}
+				ch <- prometheus.MustNewConstMetric(metric.Desc, metric.Type, value, labels...)
+			}
+		}
+		if duplicates > 0 {
+			err := fmt.Errorf("skipped %d rows with duplicate labels, the label columns must identify the rows", duplicates)
+			_ = level.Warn(c.logger).Log(
+				"msg", "failed to collect cat endpoint",
+				"endpoint", e.Name,
+				"err", err,
+			)
+			scrapeErr = err
+		}
+	}
+	if scrapeErr == nil {
+		up = 1
+	}
+	return scrapeErr
+}
@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_cat/recovery":
+			if q := r.URL.Query(); q.Get("format") != "json" || q.Get("bytes") != "b" || q.Get("h") != "index,shard,bytes_percent,bytes_recovered" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			fmt.Fprintln(w, `[{"index":"a","shard":"0","bytes_percent":"50.0%","bytes_recovered":"100"},`+
+				`{"index":"a","shard":"1","bytes_percent":"100.0%","bytes_recovered":null}]`)
+		case "/_cat/shards":
+			fmt.Fprintln(w, `[{"index":"a","docs":"1"},{"index":"a","docs":"2"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewCat(log.NewNopLogger(), http.DefaultClient, u, []CatEndpoint{
+		{
+			Name:   "recovery",
+			Path:   "recovery",
+			Params: map[string]string{"bytes": "b"},
+			Labels: []string{"index", "shard"},
+			Metrics: []CatMetric{
+				{Column: "bytes_percent", Name: "bytes_percent", Type: prometheus.GaugeValue},
+				{Column: "bytes_recovered", Name: "recovered_bytes_total", Type: prometheus.CounterValue},
+			},
+		},
+		{
+			// index doesn't identify the rows of the shards
+			Name:    "shards",
+			Path:    "shards",
+			Labels:  []string{"index"},
+			Metrics: []CatMetric{{Column: "docs", Name: "docs", Type: prometheus.GaugeValue}},
+		},
+		{
+			Name:    "missing",
+			Path:    "missing",
+			Metrics: []CatMetric{{Column: "count", Name: "count", Type: prometheus.GaugeValue}},
+		},
+	}))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_cat_recovery_bytes_percent a 0":         50,
+		"elasticsearch_cat_recovery_bytes_percent a 1":         100,
+		"elasticsearch_cat_recovery_recovered_bytes_total a 0": 100,
+		// the first row of duplicate labels is kept
+		"elasticsearch_cat_shards_docs a": 1,
+		// the failure of an endpoint fails the scrape
+		"elasticsearch_cat_up": 0,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, got)
+		}
+	}
+	if _, ok := values["elasticsearch_cat_recovery_recovered_bytes_total a 1"]; ok {
+		t.Error("expected null values to be omitted")
+	}
+}
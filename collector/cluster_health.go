@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -39,27 +39,31 @@ type ClusterHealth struct {
 	logger log.Logger
 	client *http.Client
 	url    *url.URL
+	decoder
 
-	up                              prometheus.Gauge
+	up                              *prometheus.Desc
 	totalScrapes, jsonParseFailures prometheus.Counter
 
 	metrics      []*clusterHealthMetric
 	statusMetric *clusterHealthStatusMetric
 }
 
-// NewClusterHealth returns a new Collector exposing ClusterHealth stats.
-func NewClusterHealth(logger log.Logger, client *http.Client, url *url.URL) *ClusterHealth {
+// NewClusterHealth returns a new Collector exposing ClusterHealth stats. If
+// legacyMillis is set, durations are also exported in milliseconds under
+// their former names.
+func NewClusterHealth(logger log.Logger, client *http.Client, url *url.URL, legacyMillis bool) *ClusterHealth {
 	subsystem := "cluster_health"
 
-	return &ClusterHealth{
+	c := &ClusterHealth{
 		logger: logger,
 		client: client,
 		url:    url,
 
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "up"),
-			Help: "Was the last scrape of the ElasticSearch cluster health endpoint successful.",
-		}),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch cluster health endpoint successful.",
+			nil, nil,
+		),
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
 			Help: "Current total ElasticSearch cluster health scrapes.",
@@ -139,12 +143,12 @@ func NewClusterHealth(logger log.Logger, client *http.Client, url *url.URL) *Clu
 			{
 				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
-					prometheus.BuildFQName(namespace, subsystem, "task_max_waiting_in_queue_millis"),
-					"Tasks max time waiting in queue.",
+					prometheus.BuildFQName(namespace, subsystem, "task_max_waiting_in_queue_seconds"),
+					"Tasks max time waiting in queue in seconds.",
 					defaultClusterHealthLabels, nil,
 				),
 				Value: func(clusterHealth clusterHealthResponse) float64 {
-					return float64(clusterHealth.TaskMaxWaitingInQueueMillis)
+					return float64(clusterHealth.TaskMaxWaitingInQueueMillis) / 1000
 				},
 			},
 			{
@@ -207,6 +211,21 @@ func NewClusterHealth(logger log.Logger, client *http.Client, url *url.URL) *Clu
 			},
 		},
 	}
+
+	if legacyMillis {
+		c.metrics = append(c.metrics, &clusterHealthMetric{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, subsystem, "task_max_waiting_in_queue_millis"),
+				"Tasks max time waiting in queue. Deprecated, use task_max_waiting_in_queue_seconds.",
+				defaultClusterHealthLabels, nil,
+			),
+			Value: func(clusterHealth clusterHealthResponse) float64 {
+				return float64(clusterHealth.TaskMaxWaitingInQueueMillis)
+			},
+		})
+	}
+	return c
 }
 
 // Describe set Prometheus metrics descriptions.
@@ -216,17 +235,17 @@ func (c *ClusterHealth) Describe(ch chan<- *prometheus.Desc) {
 	}
 	ch <- c.statusMetric.Desc
 
-	ch <- c.up.Desc()
+	ch <- c.up
 	ch <- c.totalScrapes.Desc()
 	ch <- c.jsonParseFailures.Desc()
 }
 
-func (c *ClusterHealth) fetchAndDecodeClusterHealth() (clusterHealthResponse, error) {
+func (c *ClusterHealth) fetchAndDecodeClusterHealth(ctx context.Context) (clusterHealthResponse, error) {
 	var chr clusterHealthResponse
 
 	u := *c.url
 	u.Path = path.Join(u.Path, "/_cluster/health")
-	res, err := c.client.Get(u.String())
+	res, err := get(ctx, c.client, u.String())
 	if err != nil {
 		return chr, fmt.Errorf("failed to get cluster health from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -246,8 +265,9 @@ func (c *ClusterHealth) fetchAndDecodeClusterHealth() (clusterHealthResponse, er
 		return chr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&chr); err != nil {
+	if err := c.decodeJSON(c.logger, res.Body, "cluster_health", &chr); err != nil {
 		c.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("cluster_health").Inc()
 		return chr, err
 	}
 
@@ -256,24 +276,30 @@ func (c *ClusterHealth) fetchAndDecodeClusterHealth() (clusterHealthResponse, er
 
 // Collect collects ClusterHealth metrics.
 func (c *ClusterHealth) Collect(ch chan<- prometheus.Metric) {
+	_ = c.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects ClusterHealth metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape.
+func (c *ClusterHealth) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
 	var err error
+	var up float64
 	c.totalScrapes.Inc()
 	defer func() {
-		ch <- c.up
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up)
 		ch <- c.totalScrapes
 		ch <- c.jsonParseFailures
 	}()
 
-	clusterHealthResp, err := c.fetchAndDecodeClusterHealth()
+	clusterHealthResp, err := c.fetchAndDecodeClusterHealth(ctx)
 	if err != nil {
-		c.up.Set(0)
 		_ = level.Warn(c.logger).Log(
 			"msg", "failed to fetch and decode cluster health",
 			"err", err,
 		)
-		return
+		return err
 	}
-	c.up.Set(1)
+	up = 1
 
 	for _, metric := range c.metrics {
 		ch <- prometheus.MustNewConstMetric(
@@ -292,4 +318,5 @@ func (c *ClusterHealth) Collect(ch chan<- prometheus.Metric) {
 			clusterHealthResp.ClusterName, color,
 		)
 	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestClusterHealth(t *testing.T) {
@@ -30,8 +32,8 @@ func TestClusterHealth(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to parse URL: %s", err)
 		}
-		c := NewClusterHealth(log.NewNopLogger(), http.DefaultClient, u)
-		chr, err := c.fetchAndDecodeClusterHealth()
+		c := NewClusterHealth(log.NewNopLogger(), http.DefaultClient, u, false)
+		chr, err := c.fetchAndDecodeClusterHealth(context.Background())
 		if err != nil {
 			t.Fatalf("Failed to fetch or decode cluster health: %s", err)
 		}
@@ -58,3 +60,37 @@ func TestClusterHealth(t *testing.T) {
 		}
 	}
 }
+
+func TestClusterHealthLegacyMillis(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","status":"green","task_max_waiting_in_queue_millis":1500}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	for _, legacyMillis := range []bool{false, true} {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(NewClusterHealth(log.NewNopLogger(), http.DefaultClient, u, legacyMillis))
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather metrics: %s", err)
+		}
+		values := map[string]float64{}
+		for _, mf := range mfs {
+			values[mf.GetName()] = mf.Metric[0].GetGauge().GetValue()
+		}
+		if v := values["elasticsearch_cluster_health_task_max_waiting_in_queue_seconds"]; v != 1.5 {
+			t.Errorf("legacyMillis=%t: expected 1.5 seconds waiting in queue, got %v", legacyMillis, v)
+		}
+		v, ok := values["elasticsearch_cluster_health_task_max_waiting_in_queue_millis"]
+		if ok != legacyMillis {
+			t.Errorf("legacyMillis=%t: legacy metric exported: %t", legacyMillis, ok)
+		}
+		if legacyMillis && v != 1500 {
+			t.Errorf("expected 1500 millis waiting in queue, got %v", v)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -19,10 +19,11 @@ type ClusterSettings struct {
 	logger log.Logger
 	client *http.Client
 	url    *url.URL
+	decoder
 
-	up                              prometheus.Gauge
-	shardAllocationEnabled          prometheus.Gauge
-	maxShardsPerNode                prometheus.Gauge
+	up                              *prometheus.Desc
+	shardAllocationEnabled          *prometheus.Desc
+	maxShardsPerNode                *prometheus.Desc
 	totalScrapes, jsonParseFailures prometheus.Counter
 }
 
@@ -33,22 +34,25 @@ func NewClusterSettings(logger log.Logger, client *http.Client, url *url.URL) *C
 		client: client,
 		url:    url,
 
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "up"),
-			Help: "Was the last scrape of the ElasticSearch cluster settings endpoint successful.",
-		}),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "clustersettings_stats", "up"),
+			"Was the last scrape of the ElasticSearch cluster settings endpoint successful.",
+			nil, nil,
+		),
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "total_scrapes"),
 			Help: "Current total ElasticSearch cluster settings scrapes.",
 		}),
-		shardAllocationEnabled: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "shard_allocation_enabled"),
-			Help: "Current mode of cluster wide shard routing allocation settings.",
-		}),
-		maxShardsPerNode: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "max_shards_per_node"),
-			Help: "Current maximum number of shards per node setting.",
-		}),
+		shardAllocationEnabled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "clustersettings_stats", "shard_allocation_enabled"),
+			"Current mode of cluster wide shard routing allocation settings.",
+			nil, nil,
+		),
+		maxShardsPerNode: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "clustersettings_stats", "max_shards_per_node"),
+			"Current maximum number of shards per node setting.",
+			nil, nil,
+		),
 		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "json_parse_failures"),
 			Help: "Number of errors while parsing JSON.",
@@ -58,15 +62,15 @@ func NewClusterSettings(logger log.Logger, client *http.Client, url *url.URL) *C
 
 // Describe add Snapshots metrics descriptions
 func (cs *ClusterSettings) Describe(ch chan<- *prometheus.Desc) {
-	ch <- cs.up.Desc()
+	ch <- cs.up
 	ch <- cs.totalScrapes.Desc()
-	ch <- cs.shardAllocationEnabled.Desc()
-	ch <- cs.maxShardsPerNode.Desc()
+	ch <- cs.shardAllocationEnabled
+	ch <- cs.maxShardsPerNode
 	ch <- cs.jsonParseFailures.Desc()
 }
 
-func (cs *ClusterSettings) getAndParseURL(u *url.URL, data interface{}) error {
-	res, err := cs.client.Get(u.String())
+func (cs *ClusterSettings) getAndParseURL(ctx context.Context, u *url.URL, data interface{}) error {
+	res, err := get(ctx, cs.client, u.String())
 	if err != nil {
 		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -86,24 +90,26 @@ func (cs *ClusterSettings) getAndParseURL(u *url.URL, data interface{}) error {
 		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(data); err != nil {
+	if err := cs.decodeJSON(cs.logger, res.Body, "cluster_settings", data); err != nil {
 		cs.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("cluster_settings").Inc()
 		return err
 	}
 	return nil
 }
 
-func (cs *ClusterSettings) fetchAndDecodeClusterSettingsStats() (ClusterSettingsResponse, error) {
+func (cs *ClusterSettings) fetchAndDecodeClusterSettingsStats(ctx context.Context) (ClusterSettingsResponse, error) {
 
 	u := *cs.url
 	u.Path = path.Join(u.Path, "/_cluster/settings")
 	q := u.Query()
 	q.Set("include_defaults", "true")
+	// the defaults are huge, only the exported settings are requested
+	q.Set("filter_path", "*.cluster.routing.allocation.enable,*.cluster.max_shards_per_node")
 	u.RawQuery = q.Encode()
-	u.RawPath = q.Encode()
 	var csfr ClusterSettingsFullResponse
 	var csr ClusterSettingsResponse
-	err := cs.getAndParseURL(&u, &csfr)
+	err := cs.getAndParseURL(ctx, &u, &csfr)
 	if err != nil {
 		return csr, err
 	}
@@ -122,27 +128,30 @@ func (cs *ClusterSettings) fetchAndDecodeClusterSettingsStats() (ClusterSettings
 
 // Collect gets cluster settings  metric values
 func (cs *ClusterSettings) Collect(ch chan<- prometheus.Metric) {
+	_ = cs.CollectContext(context.Background(), ch)
+}
 
+// CollectContext collects ClusterSettings metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape.
+func (cs *ClusterSettings) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+
+	var up float64
 	cs.totalScrapes.Inc()
 	defer func() {
-		ch <- cs.up
+		ch <- prometheus.MustNewConstMetric(cs.up, prometheus.GaugeValue, up)
 		ch <- cs.totalScrapes
 		ch <- cs.jsonParseFailures
-		ch <- cs.shardAllocationEnabled
-		ch <- cs.maxShardsPerNode
 	}()
 
-	csr, err := cs.fetchAndDecodeClusterSettingsStats()
+	csr, err := cs.fetchAndDecodeClusterSettingsStats(ctx)
 	if err != nil {
-		cs.shardAllocationEnabled.Set(0)
-		cs.up.Set(0)
 		_ = level.Warn(cs.logger).Log(
 			"msg", "failed to fetch and decode cluster settings stats",
 			"err", err,
 		)
-		return
+		return err
 	}
-	cs.up.Set(1)
+	up = 1
 
 	shardAllocationMap := map[string]int{
 		"all":           0,
@@ -151,10 +160,15 @@ func (cs *ClusterSettings) Collect(ch chan<- prometheus.Metric) {
 		"none":          3,
 	}
 
-	cs.shardAllocationEnabled.Set(float64(shardAllocationMap[csr.Cluster.Routing.Allocation.Enabled]))
+	ch <- prometheus.MustNewConstMetric(
+		cs.shardAllocationEnabled,
+		prometheus.GaugeValue,
+		float64(shardAllocationMap[csr.Cluster.Routing.Allocation.Enabled]),
+	)
 
 	maxShardsPerNode, err := strconv.ParseInt(csr.Cluster.MaxShardsPerNode, 10, 64)
 	if err == nil {
-		cs.maxShardsPerNode.Set(float64(maxShardsPerNode))
+		ch <- prometheus.MustNewConstMetric(cs.maxShardsPerNode, prometheus.GaugeValue, float64(maxShardsPerNode))
 	}
+	return nil
 }
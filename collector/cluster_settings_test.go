@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -21,6 +22,9 @@ func TestClusterSettingsStats(t *testing.T) {
 		defer f.Close()
 		for hn, handler := range map[string]http.Handler{
 			"plain": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("filter_path") == "" {
+					t.Errorf("Expected the settings to be filtered, got query %q", r.URL.RawQuery)
+				}
 				io.Copy(w, f)
 			}),
 		} {
@@ -32,7 +36,7 @@ func TestClusterSettingsStats(t *testing.T) {
 				t.Fatalf("Failed to parse URL: %s", err)
 			}
 			c := NewClusterSettings(log.NewNopLogger(), http.DefaultClient, u)
-			nsr, err := c.fetchAndDecodeClusterSettingsStats()
+			nsr, err := c.fetchAndDecodeClusterSettingsStats(context.Background())
 			if err != nil {
 				t.Fatalf("Failed to fetch or decode cluster settings stats: %s", err)
 			}
@@ -67,7 +71,7 @@ func TestClusterMaxShardsPerNode(t *testing.T) {
 				t.Fatalf("Failed to parse URL: %s", err)
 			}
 			c := NewClusterSettings(log.NewNopLogger(), http.DefaultClient, u)
-			nsr, err := c.fetchAndDecodeClusterSettingsStats()
+			nsr, err := c.fetchAndDecodeClusterSettingsStats(context.Background())
 			if err != nil {
 				t.Fatalf("Failed to fetch or decode cluster settings stats: %s", err)
 			}
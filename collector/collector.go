@@ -0,0 +1,38 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ContextCollector is implemented by collectors whose requests to
+// Elasticsearch can be bound to a context, e.g. to honor the scrape timeout.
+// Collect is equivalent to CollectContext with a background context.
+type ContextCollector interface {
+	prometheus.Collector
+	// CollectContext collects the metrics and returns the error of the scrape
+	CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error
+}
+
+// get issues a GET request for u which is cancelled once ctx is done
+func get(ctx context.Context, client *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req.WithContext(ctx))
+}
+
+// post issues a POST request of the JSON body for u which is cancelled once
+// ctx is done
+func post(ctx context.Context, client *http.Client, u string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return client.Do(req.WithContext(ctx))
+}
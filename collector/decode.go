@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxPooledBufferSize caps the buffers kept for reuse. The buffers of
+// exceptionally large responses are left to the garbage collector.
+const maxPooledBufferSize = 64 << 20
+
+// bufferPool holds the buffers the responses are read into, so that the
+// memory of large responses, e.g. the node stats of big clusters, is reused
+// across scrapes instead of being allocated by every scrape.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// NewUnknownFields returns the counter of the fields of the responses of
+// Elasticsearch the collectors don't know by collector, see
+// Config.UnknownFields
+func NewUnknownFields() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "elasticsearch_exporter_json_unknown_fields_total",
+			Help: "Number of fields of JSON responses of Elasticsearch not known to the exporter.",
+		},
+		[]string{"collector"},
+	)
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// decoder decodes the responses of Elasticsearch. The collectors embed it,
+// NewElasticsearchCollector sets it up from Config.StrictParsing and
+// Config.UnknownFields.
+type decoder struct {
+	strict        bool
+	unknownFields *prometheus.CounterVec
+}
+
+// setDecoder replaces the decoder embedding it
+func (d *decoder) setDecoder(o decoder) {
+	*d = o
+}
+
+// decodeJSON decodes the JSON response r of the collector into data. If
+// strict, the fields data has no place for are counted and logged.
+func (d *decoder) decodeJSON(logger log.Logger, r io.Reader, collector string, data interface{}) error {
+	// a json.Decoder buffers the whole response as well, but in a buffer of
+	// its own
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			bufferPool.Put(buf)
+		}
+	}()
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	// data doesn't refer to body once decoded, strings and raw messages are
+	// copied
+	body := buf.Bytes()
+	if err := json.Unmarshal(body, data); err != nil {
+		return err
+	}
+	if !d.strict {
+		return nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return err
+	}
+
+	fields := map[string]bool{}
+	unknownFields(v, reflect.TypeOf(data), "", fields)
+	if len(fields) == 0 {
+		return nil
+	}
+	if d.unknownFields != nil {
+		d.unknownFields.WithLabelValues(collector).Add(float64(len(fields)))
+	}
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	_ = level.Debug(logger).Log(
+		"msg", "unknown fields in response",
+		"collector", collector,
+		"fields", strings.Join(paths, ","),
+	)
+	return nil
+}
+
+// unknownFields adds the paths of the fields of v which t has no place for
+// to fields. The keys of maps are written as * in the paths, so that a field
+// unknown for all nodes or indices is counted once.
+func unknownFields(v interface{}, t reflect.Type, path string, fields map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == rawMessageType || t.Kind() == reflect.Interface {
+		return
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Map:
+			for _, e := range v {
+				unknownFields(e, t.Elem(), path+".*", fields)
+			}
+		case reflect.Struct:
+			for k, e := range v {
+				f, ok := fieldByJSONName(t, k)
+				if !ok {
+					fields[strings.TrimPrefix(path+"."+k, ".")] = true
+					continue
+				}
+				unknownFields(e, f.Type, path+"."+k, fields)
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, e := range v {
+				unknownFields(e, t.Elem(), path+"[]", fields)
+			}
+		}
+	}
+}
+
+// fieldByJSONName returns the field of the struct type t name is decoded
+// into, matching names like encoding/json does
+func fieldByJSONName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			if ef, ok := fieldByJSONName(f.Type, name); ok {
+				return ef, true
+			}
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func unknownFieldsCount(t *testing.T, unknownFields *prometheus.CounterVec, collector string) float64 {
+	var m dto.Metric
+	if err := unknownFields.WithLabelValues(collector).Write(&m); err != nil {
+		t.Fatalf("Failed to write metric: %s", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestDecodeJSONUnknownFields(t *testing.T) {
+	d := decoder{strict: true, unknownFields: NewUnknownFields()}
+
+	const out = `{
+		"cluster_name": "elasticsearch",
+		"nodes": {
+			"a": {"name": "a", "indices": {"docs": {"count": 1, "new_docs_stat": 2}}, "ingest": {"total": {}}},
+			"b": {"name": "b", "indices": {"docs": {"count": 1, "new_docs_stat": 2}}, "fs": {"data": [{"path": "/", "new_fs_stat": 3}]}}
+		}
+	}`
+	var nsr nodeStatsResponse
+	if err := d.decodeJSON(log.NewNopLogger(), strings.NewReader(out), "test", &nsr); err != nil {
+		t.Fatalf("Failed to decode: %s", err)
+	}
+	if nsr.Nodes["a"].Indices.Docs.Count != 1 {
+		t.Errorf("expected the known fields to be decoded")
+	}
+	// the unknown docs stat of both nodes is counted once
+	if got := unknownFieldsCount(t, d.unknownFields, "test"); got != 3 {
+		t.Errorf("expected 3 unknown fields, got %v", got)
+	}
+
+	fields := map[string]bool{}
+	var v interface{} = map[string]interface{}{
+		"cluster_name": "elasticsearch",
+		"Cluster_Name": "elasticsearch",
+		"unknown":      map[string]interface{}{"nested": 1},
+	}
+	unknownFields(v, reflect.TypeOf(&nsr), "", fields)
+	if want := map[string]bool{"unknown": true}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("expected %v, got %v", want, fields)
+	}
+}
+
+func TestDecodeJSONReusesBuffers(t *testing.T) {
+	outs := []string{
+		`{"cluster_name":"a-long-cluster-name","nodes":{"id":{"name":"node-with-a-long-name"}}}`,
+		`{"cluster_name":"b","nodes":{"id":{"name":"c"}}}`,
+	}
+	var d decoder
+	nsrs := make([]nodeStatsResponse, len(outs))
+	for i, out := range outs {
+		if err := d.decodeJSON(log.NewNopLogger(), strings.NewReader(out), "test", &nsrs[i]); err != nil {
+			t.Fatalf("Failed to decode %s: %s", out, err)
+		}
+	}
+	// the decoded values don't refer to the reused buffer
+	if nsrs[0].ClusterName != "a-long-cluster-name" || nsrs[0].Nodes["id"].Name != "node-with-a-long-name" {
+		t.Errorf("expected the first response to be intact, got %+v", nsrs[0])
+	}
+	if nsrs[1].ClusterName != "b" || nsrs[1].Nodes["id"].Name != "c" {
+		t.Errorf("unexpected second response %+v", nsrs[1])
+	}
+
+	var nsr nodeStatsResponse
+	if err := d.decodeJSON(log.NewNopLogger(), strings.NewReader(`{"cluster_name":`), "test", &nsr); err == nil {
+		t.Error("expected an error for a truncated response")
+	}
+}
@@ -0,0 +1,311 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type desiredBalanceMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(stats desiredBalanceStats) float64
+}
+
+type desiredBalanceNodeMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(node desiredBalanceNodeStats) float64
+	// Present reports whether the node stats contain the metric, it always
+	// does if nil
+	Present func(node desiredBalanceNodeStats) bool
+}
+
+// DesiredBalance information struct, the desired balance is computed by the
+// shard balancer of Elasticsearch 8.6+
+type DesiredBalance struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	metrics     []*desiredBalanceMetric
+	nodeMetrics []*desiredBalanceNodeMetric
+}
+
+// NewDesiredBalance defines Desired Balance Prometheus metrics
+func NewDesiredBalance(logger log.Logger, client *http.Client, url *url.URL) *DesiredBalance {
+	subsystem := "desired_balance"
+	nodeLabels := []string{"node"}
+
+	return &DesiredBalance{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch desired balance endpoint successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch desired balance scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		metrics: []*desiredBalanceMetric{
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "computation_active"),
+					"Whether the desired balance is being computed.",
+					nil, nil,
+				),
+				Value: func(stats desiredBalanceStats) float64 {
+					if stats.ComputationActive {
+						return 1
+					}
+					return 0
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "computations_submitted_total"),
+					"Number of desired balance computations submitted.",
+					nil, nil,
+				),
+				Value: func(stats desiredBalanceStats) float64 {
+					return float64(stats.ComputationSubmitted)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "computations_executed_total"),
+					"Number of desired balance computations executed.",
+					nil, nil,
+				),
+				Value: func(stats desiredBalanceStats) float64 {
+					return float64(stats.ComputationExecuted)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "computations_converged_total"),
+					"Number of desired balance computations which converged.",
+					nil, nil,
+				),
+				Value: func(stats desiredBalanceStats) float64 {
+					return float64(stats.ComputationConverged)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "computation_iterations_total"),
+					"Number of iterations of the desired balance computations.",
+					nil, nil,
+				),
+				Value: func(stats desiredBalanceStats) float64 {
+					return float64(stats.ComputationIterations)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "computed_shard_movements_total"),
+					"Number of shard movements computed for the desired balance.",
+					nil, nil,
+				),
+				Value: func(stats desiredBalanceStats) float64 {
+					return float64(stats.ComputedShardMovements)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "computation_seconds_total"),
+					"Time spent computing the desired balance.",
+					nil, nil,
+				),
+				Value: func(stats desiredBalanceStats) float64 {
+					return float64(stats.ComputationTime) / 1000
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "reconciliation_seconds_total"),
+					"Time spent moving shards towards the desired balance.",
+					nil, nil,
+				),
+				Value: func(stats desiredBalanceStats) float64 {
+					return float64(stats.ReconciliationTime) / 1000
+				},
+			},
+		},
+		nodeMetrics: []*desiredBalanceNodeMetric{
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "node_shards"),
+					"Number of shards the balancer allocates to the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node desiredBalanceNodeStats) float64 {
+					return float64(node.ShardCount)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "node_undesired_shards"),
+					"Number of shards allocated to the node which the balancer wants to move.",
+					nodeLabels, nil,
+				),
+				Value: func(node desiredBalanceNodeStats) float64 {
+					return float64(*node.UndesiredShardAllocationCount)
+				},
+				Present: func(node desiredBalanceNodeStats) bool {
+					return node.UndesiredShardAllocationCount != nil
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "node_forecast_write_load"),
+					"Sum of the forecast write loads of the shards of the node, in indexing threads.",
+					nodeLabels, nil,
+				),
+				Value: func(node desiredBalanceNodeStats) float64 {
+					return node.ForecastWriteLoad
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "node_forecast_disk_usage_bytes"),
+					"Sum of the forecast disk usage of the shards of the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node desiredBalanceNodeStats) float64 {
+					return float64(node.ForecastDiskUsageBytes)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "node_actual_disk_usage_bytes"),
+					"Sum of the actual disk usage of the shards of the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node desiredBalanceNodeStats) float64 {
+					return float64(node.ActualDiskUsageBytes)
+				},
+			},
+		},
+	}
+}
+
+// Describe add Desired Balance metrics descriptions
+func (db *DesiredBalance) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range db.metrics {
+		ch <- metric.Desc
+	}
+	for _, metric := range db.nodeMetrics {
+		ch <- metric.Desc
+	}
+	ch <- db.up
+	ch <- db.totalScrapes.Desc()
+	ch <- db.jsonParseFailures.Desc()
+}
+
+func (db *DesiredBalance) fetchAndDecodeDesiredBalance(ctx context.Context) (desiredBalanceResponse, error) {
+	var dbr desiredBalanceResponse
+
+	u := *db.url
+	u.Path = path.Join(u.Path, "/_internal/desired_balance")
+	// the routing table is huge, only the stats are requested
+	u.RawQuery = "filter_path=stats,cluster_balance_stats.nodes"
+	res, err := get(ctx, db.client, u.String())
+	if err != nil {
+		return dbr, fmt.Errorf("failed to get desired balance from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(db.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return dbr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := db.decodeJSON(db.logger, res.Body, "desired_balance", &dbr); err != nil {
+		db.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("desired_balance").Inc()
+		return dbr, err
+	}
+	return dbr, nil
+}
+
+// Collect gets Desired Balance metric values
+func (db *DesiredBalance) Collect(ch chan<- prometheus.Metric) {
+	_ = db.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects DesiredBalance metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape.
+func (db *DesiredBalance) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	db.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(db.up, prometheus.GaugeValue, up)
+		ch <- db.totalScrapes
+		ch <- db.jsonParseFailures
+	}()
+
+	dbr, err := db.fetchAndDecodeDesiredBalance(ctx)
+	if err != nil {
+		_ = level.Warn(db.logger).Log(
+			"msg", "failed to fetch and decode desired balance",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	for _, metric := range db.metrics {
+		ch <- prometheus.MustNewConstMetric(metric.Desc, metric.Type, metric.Value(dbr.Stats))
+	}
+	for name, node := range dbr.ClusterBalanceStats.Nodes {
+		for _, metric := range db.nodeMetrics {
+			if metric.Present != nil && !metric.Present(node) {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(metric.Desc, metric.Type, metric.Value(node), name)
+		}
+	}
+	return nil
+}
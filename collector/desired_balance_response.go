@@ -0,0 +1,31 @@
+package collector
+
+// desiredBalanceResponse is a representation of the Elasticsearch desired
+// balance API of the balancer of 8.6+, without the routing table
+type desiredBalanceResponse struct {
+	Stats               desiredBalanceStats `json:"stats"`
+	ClusterBalanceStats struct {
+		Nodes map[string]desiredBalanceNodeStats `json:"nodes"`
+	} `json:"cluster_balance_stats"`
+}
+
+// desiredBalanceStats are the stats of the computation of the desired balance
+type desiredBalanceStats struct {
+	ComputationActive      bool  `json:"computation_active"`
+	ComputationSubmitted   int64 `json:"computation_submitted"`
+	ComputationExecuted    int64 `json:"computation_executed"`
+	ComputationConverged   int64 `json:"computation_converged"`
+	ComputationIterations  int64 `json:"computation_iterations"`
+	ComputedShardMovements int64 `json:"computed_shard_movements"`
+	ComputationTime        int64 `json:"computation_time_in_millis"`
+	ReconciliationTime     int64 `json:"reconciliation_time_in_millis"`
+}
+
+// desiredBalanceNodeStats is the view of the balancer on a node
+type desiredBalanceNodeStats struct {
+	ShardCount                    int64   `json:"shard_count"`
+	ForecastWriteLoad             float64 `json:"forecast_write_load"`
+	ForecastDiskUsageBytes        int64   `json:"forecast_disk_usage_bytes"`
+	ActualDiskUsageBytes          int64   `json:"actual_disk_usage_bytes"`
+	UndesiredShardAllocationCount *int64  `json:"undesired_shard_allocation_count"`
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDesiredBalance(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_internal/desired_balance" || r.URL.Query().Get("filter_path") == "" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprintln(w, `{"stats":{"computation_active":false,"computation_submitted":50,"computation_executed":48,`+
+			`"computation_converged":47,"computation_iterations":300,"computed_shard_movements":12,"computation_time_in_millis":2500,"reconciliation_time_in_millis":400},`+
+			`"cluster_balance_stats":{"nodes":{"node-1":{"shard_count":10,"undesired_shard_allocation_count":2,"forecast_write_load":1.5,`+
+			`"forecast_disk_usage_bytes":1000,"actual_disk_usage_bytes":900},"node-2":{"shard_count":8,"forecast_write_load":0.5,`+
+			`"forecast_disk_usage_bytes":800,"actual_disk_usage_bytes":850}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewDesiredBalance(log.NewNopLogger(), http.DefaultClient, u))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_desired_balance_up":                                  1,
+		"elasticsearch_desired_balance_computations_executed_total":         48,
+		"elasticsearch_desired_balance_computation_seconds_total":           2.5,
+		"elasticsearch_desired_balance_node_shards node-1":                  10,
+		"elasticsearch_desired_balance_node_undesired_shards node-1":        2,
+		"elasticsearch_desired_balance_node_forecast_write_load node-2":     0.5,
+		"elasticsearch_desired_balance_node_actual_disk_usage_bytes node-2": 850,
+	} {
+		if v, ok := values[key]; !ok || v != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, v)
+		}
+	}
+	// 8.6 to 8.11 don't report the undesired shards
+	if _, ok := values["elasticsearch_desired_balance_node_undesired_shards node-2"]; ok {
+		t.Error("expected no undesired shards for node-2")
+	}
+}
@@ -0,0 +1,354 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// downsampleStatuses are the values of the index.downsample.status
+	// setting of the target indices of downsampling
+	downsampleStatuses = []string{"unknown", "started", "success", "failed"}
+	// rollupJobStates are the states of the legacy rollup jobs
+	rollupJobStates = []string{"started", "indexing", "stopping", "stopped", "aborting"}
+)
+
+type rollupJobMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(stats rollupJobStats) float64
+}
+
+// Downsampling information struct, the downsampling of the backing indices
+// of time series data streams and the legacy rollup jobs
+type Downsampling struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	downsampleStatus, downsampleDocs *prometheus.Desc
+	rollupJobState                   *prometheus.Desc
+	rollupJobMetrics                 []*rollupJobMetric
+}
+
+// NewDownsampling defines Downsampling Prometheus metrics
+func NewDownsampling(logger log.Logger, client *http.Client, url *url.URL) *Downsampling {
+	subsystem := "downsample"
+	indexLabels := []string{"index", "source_index"}
+	jobLabels := []string{"job_id"}
+
+	return &Downsampling{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch downsampling and rollup endpoints successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch downsampling scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		downsampleStatus: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "index_status"),
+			"Whether the downsampling to the index is in the status.",
+			append(indexLabels, "status"), nil,
+		),
+		downsampleDocs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "index_docs"),
+			"Number of documents of the downsampled index.",
+			indexLabels, nil,
+		),
+		rollupJobState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "rollup_job", "state"),
+			"Whether the rollup job is in the state.",
+			append(jobLabels, "state"), nil,
+		),
+		rollupJobMetrics: []*rollupJobMetric{
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup_job", "documents_processed_total"),
+					"Number of documents read by the rollup job.",
+					jobLabels, nil,
+				),
+				Value: func(stats rollupJobStats) float64 {
+					return float64(stats.DocumentsProcessed)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup_job", "pages_processed_total"),
+					"Number of pages of composite aggregations processed by the rollup job.",
+					jobLabels, nil,
+				),
+				Value: func(stats rollupJobStats) float64 {
+					return float64(stats.PagesProcessed)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup_job", "rollups_indexed_total"),
+					"Number of rollup documents indexed by the rollup job.",
+					jobLabels, nil,
+				),
+				Value: func(stats rollupJobStats) float64 {
+					return float64(stats.RollupsIndexed)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup_job", "triggers_total"),
+					"Number of times the rollup job was triggered.",
+					jobLabels, nil,
+				),
+				Value: func(stats rollupJobStats) float64 {
+					return float64(stats.TriggerCount)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup_job", "index_failures_total"),
+					"Number of failures indexing rollup documents.",
+					jobLabels, nil,
+				),
+				Value: func(stats rollupJobStats) float64 {
+					return float64(stats.IndexFailures)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup_job", "search_failures_total"),
+					"Number of failures searching the source documents.",
+					jobLabels, nil,
+				),
+				Value: func(stats rollupJobStats) float64 {
+					return float64(stats.SearchFailures)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup_job", "processing_seconds_total"),
+					"Time spent processing the source documents by the rollup job.",
+					jobLabels, nil,
+				),
+				Value: func(stats rollupJobStats) float64 {
+					return float64(stats.ProcessingTime) / 1000
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup_job", "index_seconds_total"),
+					"Time spent indexing rollup documents by the rollup job.",
+					jobLabels, nil,
+				),
+				Value: func(stats rollupJobStats) float64 {
+					return float64(stats.IndexTime) / 1000
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup_job", "search_seconds_total"),
+					"Time spent searching the source documents by the rollup job.",
+					jobLabels, nil,
+				),
+				Value: func(stats rollupJobStats) float64 {
+					return float64(stats.SearchTime) / 1000
+				},
+			},
+		},
+	}
+}
+
+// Describe add Downsampling metrics descriptions
+func (d *Downsampling) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.downsampleStatus
+	ch <- d.downsampleDocs
+	ch <- d.rollupJobState
+	for _, metric := range d.rollupJobMetrics {
+		ch <- metric.Desc
+	}
+	ch <- d.up
+	ch <- d.totalScrapes.Desc()
+	ch <- d.jsonParseFailures.Desc()
+}
+
+func (d *Downsampling) getAndParseURL(ctx context.Context, u *url.URL, data interface{}) error {
+	res, err := get(ctx, d.client, u.String())
+	if err != nil {
+		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(d.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := d.decodeJSON(d.logger, res.Body, "downsampling", data); err != nil {
+		d.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("downsampling").Inc()
+		return err
+	}
+	return nil
+}
+
+// fetchAndDecodeDownsampleSettings returns the downsample settings of all
+// indices, the backing indices of data streams are hidden
+func (d *Downsampling) fetchAndDecodeDownsampleSettings(ctx context.Context) (downsampleSettingsResponse, error) {
+	u := *d.url
+	u.Path = path.Join(u.Path, "/_all/_settings/index.downsample.*")
+	u.RawQuery = "flat_settings=true&expand_wildcards=all"
+	var dsr downsampleSettingsResponse
+	err := d.getAndParseURL(ctx, &u, &dsr)
+	return dsr, err
+}
+
+// fetchDocsPerIndex returns the number of documents of all indices by index
+// name
+func (d *Downsampling) fetchDocsPerIndex(ctx context.Context) (map[string]int64, error) {
+	u := *d.url
+	u.Path = path.Join(u.Path, "/_cat/indices")
+	u.RawQuery = "format=json&h=index,docs.count&expand_wildcards=all"
+	var cir catIndicesDocsResponse
+	if err := d.getAndParseURL(ctx, &u, &cir); err != nil {
+		return nil, err
+	}
+	docs := make(map[string]int64, len(cir))
+	for _, index := range cir {
+		// the documents of closed indices are unknown
+		n, err := strconv.ParseInt(index.DocsCount, 10, 64)
+		if err != nil {
+			continue
+		}
+		docs[index.Index] = n
+	}
+	return docs, nil
+}
+
+func (d *Downsampling) fetchAndDecodeRollupJobs(ctx context.Context) (rollupJobsResponse, error) {
+	u := *d.url
+	u.Path = path.Join(u.Path, "/_rollup/job/_all")
+	var rjr rollupJobsResponse
+	err := d.getAndParseURL(ctx, &u, &rjr)
+	return rjr, err
+}
+
+// Collect gets Downsampling metric values
+func (d *Downsampling) Collect(ch chan<- prometheus.Metric) {
+	_ = d.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects Downsampling metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape.
+func (d *Downsampling) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	d.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(d.up, prometheus.GaugeValue, up)
+		ch <- d.totalScrapes
+		ch <- d.jsonParseFailures
+	}()
+
+	dsr, err := d.fetchAndDecodeDownsampleSettings(ctx)
+	if err != nil {
+		_ = level.Warn(d.logger).Log(
+			"msg", "failed to fetch and decode downsample settings",
+			"err", err,
+		)
+		return err
+	}
+	var docs map[string]int64
+	for _, index := range dsr {
+		if index.Settings["index.downsample.status"] != "" {
+			// the documents are only requested if there are downsampled
+			// indices
+			docs, err = d.fetchDocsPerIndex(ctx)
+			break
+		}
+	}
+	if err != nil {
+		_ = level.Warn(d.logger).Log(
+			"msg", "failed to fetch documents per index",
+			"err", err,
+		)
+		return err
+	}
+	rjr, err := d.fetchAndDecodeRollupJobs(ctx)
+	if err != nil {
+		_ = level.Warn(d.logger).Log(
+			"msg", "failed to fetch and decode rollup jobs",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	for name, index := range dsr {
+		status := index.Settings["index.downsample.status"]
+		if status == "" {
+			continue
+		}
+		source := index.Settings["index.downsample.source.name"]
+		for _, s := range downsampleStatuses {
+			var value float64
+			if status == s {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(d.downsampleStatus, prometheus.GaugeValue, value, name, source, s)
+		}
+		if n, ok := docs[name]; ok {
+			ch <- prometheus.MustNewConstMetric(d.downsampleDocs, prometheus.GaugeValue, float64(n), name, source)
+		}
+	}
+
+	for _, job := range rjr.Jobs {
+		for _, state := range rollupJobStates {
+			var value float64
+			if job.Status.JobState == state {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(d.rollupJobState, prometheus.GaugeValue, value, job.Config.ID, state)
+		}
+		for _, metric := range d.rollupJobMetrics {
+			ch <- prometheus.MustNewConstMetric(metric.Desc, metric.Type, metric.Value(job.Stats), job.Config.ID)
+		}
+	}
+	return nil
+}
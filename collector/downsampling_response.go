@@ -0,0 +1,42 @@
+package collector
+
+// downsampleSettingsResponse is a representation of the downsample settings
+// of the indices by index name, the settings are flat, e.g.
+// index.downsample.status. Indices which aren't downsampled have none.
+type downsampleSettingsResponse map[string]struct {
+	Settings map[string]string `json:"settings"`
+}
+
+// catIndicesDocsResponse is a representation of the documents of the indices
+// reported by _cat/indices
+type catIndicesDocsResponse []struct {
+	Index     string `json:"index"`
+	DocsCount string `json:"docs.count"`
+}
+
+// rollupJobsResponse is a representation of the Elasticsearch rollup jobs API
+type rollupJobsResponse struct {
+	Jobs []rollupJob `json:"jobs"`
+}
+
+type rollupJob struct {
+	Config struct {
+		ID string `json:"id"`
+	} `json:"config"`
+	Status struct {
+		JobState string `json:"job_state"`
+	} `json:"status"`
+	Stats rollupJobStats `json:"stats"`
+}
+
+type rollupJobStats struct {
+	PagesProcessed     int64 `json:"pages_processed"`
+	DocumentsProcessed int64 `json:"documents_processed"`
+	RollupsIndexed     int64 `json:"rollups_indexed"`
+	TriggerCount       int64 `json:"trigger_count"`
+	IndexFailures      int64 `json:"index_failures"`
+	SearchFailures     int64 `json:"search_failures"`
+	ProcessingTime     int64 `json:"processing_time_in_ms"`
+	IndexTime          int64 `json:"index_time_in_ms"`
+	SearchTime         int64 `json:"search_time_in_ms"`
+}
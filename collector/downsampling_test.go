@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDownsampling(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_all/_settings/index.downsample.*":
+			fmt.Fprintln(w, `{"logs":{"settings":{}},`+
+				`"downsample-1h-.ds-metrics-2024.01.01-000001":{"settings":{"index.downsample.status":"success","index.downsample.source.name":".ds-metrics-2024.01.01-000001"}},`+
+				`"downsample-1d-.ds-metrics-2024.01.01-000001":{"settings":{"index.downsample.status":"started","index.downsample.source.name":"downsample-1h-.ds-metrics-2024.01.01-000001"}}}`)
+		case "/_cat/indices":
+			fmt.Fprintln(w, `[{"index":"logs","docs.count":"10"},{"index":"downsample-1h-.ds-metrics-2024.01.01-000001","docs.count":"240"},`+
+				`{"index":"downsample-1d-.ds-metrics-2024.01.01-000001","docs.count":null}]`)
+		case "/_rollup/job/_all":
+			fmt.Fprintln(w, `{"jobs":[{"config":{"id":"sensor"},"status":{"job_state":"indexing"},`+
+				`"stats":{"pages_processed":3,"documents_processed":300,"rollups_indexed":30,"trigger_count":5,`+
+				`"index_failures":1,"search_failures":0,"processing_time_in_ms":1500,"index_time_in_ms":200,"search_time_in_ms":700}}]}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewDownsampling(log.NewNopLogger(), http.DefaultClient, u))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_downsample_up": 1,
+		"elasticsearch_downsample_index_status downsample-1h-.ds-metrics-2024.01.01-000001 .ds-metrics-2024.01.01-000001 success":               1,
+		"elasticsearch_downsample_index_status downsample-1h-.ds-metrics-2024.01.01-000001 .ds-metrics-2024.01.01-000001 failed":                0,
+		"elasticsearch_downsample_index_status downsample-1d-.ds-metrics-2024.01.01-000001 downsample-1h-.ds-metrics-2024.01.01-000001 started": 1,
+		"elasticsearch_downsample_index_docs downsample-1h-.ds-metrics-2024.01.01-000001 .ds-metrics-2024.01.01-000001":                         240,
+		"elasticsearch_rollup_job_state sensor indexing":            1,
+		"elasticsearch_rollup_job_state sensor stopped":             0,
+		"elasticsearch_rollup_job_documents_processed_total sensor": 300,
+		"elasticsearch_rollup_job_index_failures_total sensor":      1,
+		"elasticsearch_rollup_job_processing_seconds_total sensor":  1.5,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, got)
+		}
+	}
+	if _, ok := values["elasticsearch_downsample_index_docs downsample-1d-.ds-metrics-2024.01.01-000001 downsample-1h-.ds-metrics-2024.01.01-000001"]; ok {
+		t.Error("expected no documents of the index being downsampled")
+	}
+}
@@ -0,0 +1,455 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config configures the collectors of an ElasticsearchCollector
+type Config struct {
+	// Logger defaults to a logger discarding the logs
+	Logger log.Logger
+	// Client sends the requests to Elasticsearch, it defaults to
+	// http.DefaultClient
+	Client *http.Client
+	// URL is the URL of Elasticsearch including its credentials
+	URL *url.URL
+
+	// AllNodes exports the stats of all nodes of the cluster instead of Node
+	AllNodes bool
+	// Node is the node whose stats are exported, it defaults to _local
+	Node string
+	// Sniff fetches the stats of every node from the node itself
+	Sniff bool
+	// Shard restricts the nodes of AllNodes and Sniff to those assigned to
+	// this replica of the exporter, nil exports all nodes
+	Shard *ScrapeShard
+	// LegacyMillisMetrics exports durations in milliseconds under their
+	// former names along with the _seconds metrics
+	LegacyMillisMetrics bool
+	// DerivedLatencies exports the average latencies of the operations of
+	// every node between two collections
+	DerivedLatencies bool
+	// HotSpots exports the ratios of the indexing and search rates and of
+	// the store size of every node to the mean of the nodes holding shards
+	HotSpots bool
+	// NodeShards exports the number of shards allocated to every node and
+	// data tier from the cat allocation API
+	NodeShards bool
+	// NodeStatsSections are the sections of the node stats requested, all
+	// if empty, see ParseNodeStatsSections
+	NodeStatsSections []string
+
+	// Indices, Shards, Snapshots, ClusterSettings, IndicesSettings,
+	// DesiredBalance, Security, ShardStores, Usage, ML, Downsampling and
+	// TSDS enable the optional collectors of Elasticsearch, ISM, KNN and
+	// SecurityPlugin those of OpenSearch. Shards implies Indices.
+	Indices         bool
+	Shards          bool
+	Snapshots       bool
+	ClusterSettings bool
+	IndicesSettings bool
+	DesiredBalance  bool
+	Security        bool
+	ShardStores     bool
+	Usage           bool
+	ML              bool
+	Downsampling    bool
+	TSDS            bool
+	ISM             bool
+	KNN             bool
+	SecurityPlugin  bool
+	// UnreplicatedShards exports the number of shards every node holds the
+	// only active copy of
+	UnreplicatedShards bool
+	// IncludeHiddenIndices exports the hidden and dot-prefixed system
+	// indices by Indices
+	IncludeHiddenIndices bool
+	// IndexPatterns aggregate the stats of the matching indices by Indices
+	IndexPatterns []IndexPattern
+	// ShardLatency exports the search and indexing times of every shard by
+	// Indices, enabled by Indices or Shards
+	ShardLatency bool
+	// TopIndices limits the detailed metrics of Indices to the first
+	// TopIndices indices ordered by TopIndicesBy, 0 exports all indices
+	TopIndices   int
+	TopIndicesBy string
+	// IndexTotals keep the indexing operations of the indices ordered by
+	// indexing rate across collectors of the same target. Nil keeps them
+	// in the collector.
+	IndexTotals *IndexTotals
+	// SnapshotSizes exports the sizes of the snapshots by Snapshots
+	SnapshotSizes bool
+	// APIKeyExpiryWindow is the window of the API keys counted as expiring
+	// by the Security collector
+	APIKeyExpiryWindow time.Duration
+	// AuditLogIndexPattern enables the AuditLog collector for the audit
+	// log indices matching the pattern if not empty
+	AuditLogIndexPattern string
+	// CatEndpoints enables the Cat collector for the endpoints if not empty
+	CatEndpoints []CatEndpoint
+	// Queries and CountQueries enable the Queries collector if not empty
+	Queries      []Query
+	CountQueries []CountQuery
+
+	// StrictParsing looks for the fields of the responses of Elasticsearch
+	// the collectors don't know, e.g. stats added by an upgrade of
+	// Elasticsearch. It decodes the responses twice, so that it's off by
+	// default.
+	StrictParsing bool
+	// UnknownFields counts the unknown fields of StrictParsing by
+	// collector if set, see NewUnknownFields
+	UnknownFields *prometheus.CounterVec
+
+	// Wrap wraps the collector of the given name if set, e.g. to bound its
+	// scrapes by a timeout
+	Wrap func(name string, c prometheus.Collector) prometheus.Collector
+}
+
+// unsupportedCollectors are the optional collectors of APIs a distribution
+// lacks, e.g. of X-Pack, which are skipped for its clusters
+var unsupportedCollectors = map[string]map[string]bool{
+	clusterinfo.DistributionElasticsearch: {
+		"ism":             true,
+		"knn":             true,
+		"security_plugin": true,
+	},
+	clusterinfo.DistributionOpenSearch: {
+		"desired_balance": true,
+		"security":        true,
+		"usage":           true,
+		"ml":              true,
+		"downsampling":    true,
+	},
+}
+
+// ElasticsearchCollector collects the metrics of an Elasticsearch cluster
+// with the collectors enabled by its Config. It allows to embed the exporter
+// in other binaries.
+type ElasticsearchCollector struct {
+	logger     log.Logger
+	collectors []prometheus.Collector
+	// names are the names of the collectors
+	names   []string
+	nodes   *Nodes
+	indices *Indices
+
+	up, success *prometheus.Desc
+
+	clusterInfoCh   chan *clusterinfo.Response
+	clusterInfoOnce sync.Once
+	clusterName     string
+	clusterUUID     string
+	// distribution is empty until the cluster info was received
+	distribution   string
+	clusterNameMtx sync.RWMutex
+	// skippedOnce logs the collectors skipped for the distribution once
+	skippedOnce sync.Once
+}
+
+// NewElasticsearchCollector returns an ElasticsearchCollector for config
+func NewElasticsearchCollector(config Config) (*ElasticsearchCollector, error) {
+	if config.URL == nil {
+		return nil, errors.New("the URL of Elasticsearch is required")
+	}
+	if config.Logger == nil {
+		config.Logger = log.NewNopLogger()
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.Node == "" {
+		config.Node = "_local"
+	}
+	if err := checkNodeStatsSections(config.NodeStatsSections); err != nil {
+		return nil, err
+	}
+	if config.TopIndicesBy == "" {
+		config.TopIndicesBy = TopIndicesByStoreSize
+	}
+	if err := checkTopIndicesBy(config.TopIndicesBy); err != nil {
+		return nil, err
+	}
+
+	e := &ElasticsearchCollector{
+		logger: config.Logger,
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "up"),
+			"Whether any collector of the cluster succeeded, 0 if the cluster is unreachable.",
+			[]string{"cluster"}, nil,
+		),
+		success: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "collector", "success"),
+			"Whether the last scrape of the collector succeeded.",
+			[]string{"collector"}, nil,
+		),
+		clusterInfoCh: make(chan *clusterinfo.Response),
+		clusterName:   "unknown_cluster",
+	}
+	d := decoder{strict: config.StrictParsing, unknownFields: config.UnknownFields}
+	add := func(name string, c prometheus.Collector) {
+		if dc, ok := c.(interface{ setDecoder(decoder) }); ok {
+			dc.setDecoder(d)
+		}
+		if config.Wrap != nil {
+			c = config.Wrap(name, c)
+		}
+		e.collectors = append(e.collectors, c)
+		e.names = append(e.names, name)
+	}
+	logger, client, u := config.Logger, config.Client, config.URL
+
+	add("cluster_health", NewClusterHealth(logger, client, u, config.LegacyMillisMetrics))
+	e.nodes = NewNodes(logger, client, u, config.AllNodes, config.Node, config.Sniff, config.DerivedLatencies, config.HotSpots, config.NodeStatsSections)
+	e.nodes.shard = config.Shard
+	e.nodes.shardsPerNode = config.NodeShards
+	add("nodes", e.nodes)
+
+	if config.Indices || config.Shards {
+		e.indices = NewIndices(logger, client, u, config.Shards)
+		e.indices.includeHidden = config.IncludeHiddenIndices
+		e.indices.shardLatency = config.ShardLatency
+		e.indices.patterns = config.IndexPatterns
+		e.indices.topN, e.indices.topBy = config.TopIndices, config.TopIndicesBy
+		if config.IndexTotals != nil {
+			e.indices.indexTotals = config.IndexTotals
+		}
+		add("indices", e.indices)
+	}
+
+	if config.Snapshots {
+		snapshots := NewSnapshots(logger, client, u)
+		snapshots.sizes = config.SnapshotSizes
+		add("snapshots", snapshots)
+	}
+
+	if config.ClusterSettings {
+		add("cluster_settings", NewClusterSettings(logger, client, u))
+	}
+
+	if config.IndicesSettings {
+		add("indices_settings", NewIndicesSettings(logger, client, u))
+	}
+
+	if config.DesiredBalance {
+		add("desired_balance", NewDesiredBalance(logger, client, u))
+	}
+
+	if config.Security {
+		add("security", NewSecurity(logger, client, u, config.APIKeyExpiryWindow))
+	}
+
+	if config.ShardStores {
+		add("shard_stores", NewShardStores(logger, client, u))
+	}
+
+	if config.UnreplicatedShards {
+		add("unreplicated_shards", NewUnreplicatedShards(logger, client, u))
+	}
+
+	if config.Usage {
+		add("usage", NewUsage(logger, client, u))
+	}
+
+	if config.ML {
+		add("ml", NewML(logger, client, u))
+	}
+
+	if config.Downsampling {
+		add("downsampling", NewDownsampling(logger, client, u))
+	}
+
+	if config.TSDS {
+		add("tsds", NewTSDS(logger, client, u))
+	}
+
+	if config.ISM {
+		add("ism", NewISM(logger, client, u))
+	}
+
+	if config.KNN {
+		add("knn", NewKNN(logger, client, u))
+	}
+
+	if config.SecurityPlugin {
+		add("security_plugin", NewSecurityPlugin(logger, client, u))
+	}
+
+	if config.AuditLogIndexPattern != "" {
+		add("audit_log", NewAuditLog(logger, client, u, config.AuditLogIndexPattern))
+	}
+
+	if len(config.CatEndpoints) > 0 {
+		add("cat", NewCat(logger, client, u, config.CatEndpoints))
+	}
+
+	if len(config.Queries) > 0 || len(config.CountQueries) > 0 {
+		add("query", NewQueries(logger, client, u, config.Queries, config.CountQueries))
+	}
+	return e, nil
+}
+
+// RegisterConsumers registers the collectors depending on the cluster info,
+// e.g. on the version of Elasticsearch, with r
+func (e *ElasticsearchCollector) RegisterConsumers(r *clusterinfo.Retriever) error {
+	if err := r.RegisterConsumer(e); err != nil {
+		return err
+	}
+	if err := r.RegisterConsumer(e.nodes); err != nil {
+		return err
+	}
+	if e.indices != nil {
+		return r.RegisterConsumer(e.indices)
+	}
+	return nil
+}
+
+// SetClusterInfo sets the cluster info of the collectors directly. It's an
+// alternative to RegisterConsumers.
+func (e *ElasticsearchCollector) SetClusterInfo(ci *clusterinfo.Response) {
+	e.setClusterName(ci)
+	e.nodes.SetClusterInfo(ci)
+	if e.indices != nil {
+		e.indices.SetClusterInfo(ci)
+	}
+}
+
+// ClusterLabelUpdates returns a pointer to a channel to receive cluster info
+// updates, which carry the name of the cluster of the up metric. It
+// implements the (not exported) clusterinfo.consumer interface.
+func (e *ElasticsearchCollector) ClusterLabelUpdates() *chan *clusterinfo.Response {
+	e.clusterInfoOnce.Do(func() {
+		go func() {
+			for ci := range e.clusterInfoCh {
+				e.setClusterName(ci)
+			}
+		}()
+	})
+	return &e.clusterInfoCh
+}
+
+// String implements the stringer interface. It is part of the clusterinfo.consumer interface
+func (e *ElasticsearchCollector) String() string {
+	return namespace
+}
+
+func (e *ElasticsearchCollector) setClusterName(ci *clusterinfo.Response) {
+	if ci == nil || ci.ClusterName == "" {
+		return
+	}
+	e.clusterNameMtx.Lock()
+	e.clusterName = ci.ClusterName
+	e.clusterUUID = ci.ClusterUUID
+	e.distribution = ci.Version.GetDistribution()
+	e.clusterNameMtx.Unlock()
+}
+
+// ClusterUUID returns the UUID of the cluster, empty until the cluster info
+// was received
+func (e *ElasticsearchCollector) ClusterUUID() string {
+	e.clusterNameMtx.RLock()
+	defer e.clusterNameMtx.RUnlock()
+	return e.clusterUUID
+}
+
+// Describe implements the prometheus.Collector interface
+func (e *ElasticsearchCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range e.collectors {
+		c.Describe(ch)
+	}
+	ch <- e.up
+	ch <- e.success
+}
+
+// Collect implements the prometheus.Collector interface
+func (e *ElasticsearchCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = e.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects all collectors concurrently, aborting their
+// requests once ctx is done. It returns the first error of the collectors.
+// The success of every collector is reported, so that partial failures, e.g.
+// of a forbidden snapshots API, can be told apart from outages. Collectors of
+// APIs the distribution of the cluster lacks, e.g. OpenSearch, are skipped
+// once the distribution is known.
+func (e *ElasticsearchCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	e.clusterNameMtx.RLock()
+	distribution := e.distribution
+	e.clusterNameMtx.RUnlock()
+
+	var (
+		wg      sync.WaitGroup
+		skipped []string
+	)
+	errs := make([]error, len(e.collectors))
+	skip := make([]bool, len(e.collectors))
+	for i, c := range e.collectors {
+		if unsupportedCollectors[distribution][e.names[i]] {
+			skip[i] = true
+			skipped = append(skipped, e.names[i])
+			continue
+		}
+		wg.Add(1)
+		go func(i int, c prometheus.Collector) {
+			defer wg.Done()
+			errs[i] = CollectWithContext(ctx, c, ch)
+		}(i, c)
+	}
+	wg.Wait()
+
+	var (
+		up       float64
+		firstErr error
+	)
+	if len(skipped) > 0 {
+		e.skippedOnce.Do(func() {
+			_ = level.Warn(e.logger).Log(
+				"msg", "skipping collectors not supported by the distribution",
+				"distribution", distribution,
+				"collectors", strings.Join(skipped, ","),
+			)
+		})
+	}
+
+	for i, err := range errs {
+		if skip[i] {
+			continue
+		}
+		success := 1.0
+		if err != nil {
+			success = 0
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		up = math.Max(up, success)
+		ch <- prometheus.MustNewConstMetric(e.success, prometheus.GaugeValue, success, e.names[i])
+	}
+	e.clusterNameMtx.RLock()
+	cluster := e.clusterName
+	e.clusterNameMtx.RUnlock()
+	ch <- prometheus.MustNewConstMetric(e.up, prometheus.GaugeValue, up, cluster)
+	return firstErr
+}
+
+// CollectWithContext collects c, binding its requests to ctx if it is a
+// ContextCollector. The error of the scrape is only known for
+// ContextCollectors.
+func CollectWithContext(ctx context.Context, c prometheus.Collector, ch chan<- prometheus.Metric) error {
+	if cc, ok := c.(ContextCollector); ok {
+		return cc.CollectContext(ctx, ch)
+	}
+	c.Collect(ch)
+	return nil
+}
@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestElasticsearchCollector(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/_cluster/health"):
+			fmt.Fprintln(w, `{"cluster_name":"elasticsearch","status":"green"}`)
+		case strings.HasPrefix(r.URL.Path, "/_nodes"):
+			fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{}}`)
+		case strings.HasPrefix(r.URL.Path, "/_snapshot"):
+			fmt.Fprintln(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	if _, err := NewElasticsearchCollector(Config{}); err == nil {
+		t.Error("expected an error without URL")
+	}
+
+	var (
+		mtx     sync.Mutex
+		wrapped []string
+	)
+	c, err := NewElasticsearchCollector(Config{
+		URL:       u,
+		Snapshots: true,
+		Wrap: func(name string, c prometheus.Collector) prometheus.Collector {
+			mtx.Lock()
+			defer mtx.Unlock()
+			wrapped = append(wrapped, name)
+			return c
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %s", err)
+	}
+	if want := "cluster_health,nodes,snapshots"; strings.Join(wrapped, ",") != want {
+		t.Errorf("expected %s to be wrapped, got %v", want, wrapped)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	up := map[string]float64{}
+	for _, mf := range mfs {
+		if strings.HasSuffix(mf.GetName(), "_up") {
+			up[mf.GetName()] = mf.Metric[0].GetGauge().GetValue()
+		}
+	}
+	for _, name := range []string{"elasticsearch_cluster_health_up", "elasticsearch_node_stats_up", "elasticsearch_snapshot_stats_up"} {
+		if up[name] != 1 {
+			t.Errorf("expected %s to be 1, got %v", name, up[name])
+		}
+	}
+}
+
+func TestElasticsearchCollectorSuccess(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/_cluster/health"):
+			fmt.Fprintln(w, `{"cluster_name":"elasticsearch","status":"green"}`)
+		case strings.HasPrefix(r.URL.Path, "/_nodes"):
+			fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{}}`)
+		default:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c, err := NewElasticsearchCollector(Config{URL: u, Snapshots: true})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %s", err)
+	}
+	c.SetClusterInfo(&clusterinfo.Response{ClusterName: "test"})
+
+	gather := func() (map[string]float64, map[string]float64) {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(c)
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %s", err)
+		}
+		up, success := map[string]float64{}, map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				switch mf.GetName() {
+				case "elasticsearch_up":
+					up[m.Label[0].GetValue()] = m.GetGauge().GetValue()
+				case "elasticsearch_collector_success":
+					success[m.Label[0].GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+		return up, success
+	}
+
+	up, success := gather()
+	if up["test"] != 1 {
+		t.Errorf("expected the cluster to be up, got %v", up)
+	}
+	for name, want := range map[string]float64{"cluster_health": 1, "nodes": 1, "snapshots": 0} {
+		if v, ok := success[name]; !ok || v != want {
+			t.Errorf("expected success of %s to be %v, got %v", name, want, success)
+		}
+	}
+
+	ts.Close()
+	up, success = gather()
+	if up["test"] != 0 {
+		t.Errorf("expected the cluster to be down, got %v", up)
+	}
+	for name, v := range success {
+		if v != 0 {
+			t.Errorf("expected %s to fail, got %v", name, v)
+		}
+	}
+}
+
+func TestElasticsearchCollectorOpenSearch(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		paths []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		paths = append(paths, r.URL.Path)
+		mtx.Unlock()
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/_cluster/health"):
+			fmt.Fprintln(w, `{"cluster_name":"opensearch","status":"green"}`)
+		case strings.HasPrefix(r.URL.Path, "/_nodes"):
+			fmt.Fprintln(w, `{"cluster_name":"opensearch","nodes":{}}`)
+		case r.URL.Path == "/_plugins/_ism/explain":
+			fmt.Fprintln(w, `{"total_managed_indices":0}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c, err := NewElasticsearchCollector(Config{URL: u, Security: true, ML: true, ISM: true})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %s", err)
+	}
+	gather := func() map[string]float64 {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(c)
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %s", err)
+		}
+		success := map[string]float64{}
+		for _, mf := range mfs {
+			if mf.GetName() != "elasticsearch_collector_success" {
+				continue
+			}
+			for _, m := range mf.Metric {
+				success[m.Label[0].GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+		return success
+	}
+
+	// the ISM collector of OpenSearch is skipped for Elasticsearch
+	c.SetClusterInfo(&clusterinfo.Response{
+		ClusterName: "elasticsearch",
+		Version:     clusterinfo.VersionInfo{Number: semver.MustParse("7.10.2")},
+	})
+	if success := gather(); len(success) != 4 {
+		t.Errorf("expected all collectors but ism, got %v", success)
+	} else if _, ok := success["ism"]; ok {
+		t.Errorf("expected ism to be skipped, got %v", success)
+	}
+
+	c.SetClusterInfo(&clusterinfo.Response{
+		ClusterName: "opensearch",
+		Version:     clusterinfo.VersionInfo{Number: semver.MustParse("2.11.0"), Distribution: clusterinfo.DistributionOpenSearch},
+	})
+	mtx.Lock()
+	paths = nil
+	mtx.Unlock()
+	if success, want := gather(), map[string]float64{"cluster_health": 1, "nodes": 1, "ism": 1}; !reflect.DeepEqual(success, want) {
+		t.Errorf("expected the success of %v, got %v", want, success)
+	}
+	for _, p := range paths {
+		if strings.HasPrefix(p, "/_xpack") || strings.HasPrefix(p, "/_ml") {
+			t.Errorf("unexpected request of %s", p)
+		}
+	}
+	// the node stats of OpenSearch are those of Elasticsearch 7.10
+	for _, p := range paths {
+		if strings.HasPrefix(p, "/_nodes") && !strings.Contains(p, "indexing_pressure") {
+			t.Errorf("expected the indexing pressure to be requested, got %s", p)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/blang/semver"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
@@ -32,29 +36,89 @@ type shardMetric struct {
 	Labels labels
 }
 
+// IndexPattern aggregates the stats of the indices matching Pattern, a glob
+// like logs-*-2024.*, into the series with the index_pattern label Name, e.g.
+// logs, and an empty index label
+type IndexPattern struct {
+	Name    string
+	Pattern string
+}
+
+// Orders of the top indices, see Indices.topN
+const (
+	TopIndicesByStoreSize    = "store_size"
+	TopIndicesByIndexingRate = "indexing_rate"
+)
+
+// otherIndex is the index label of the aggregate of the indices beyond the top
+// indices. Index names can't start with an underscore, so it doesn't clash
+// with an index.
+const otherIndex = "_other"
+
+// checkTopIndicesBy returns an error for unknown orders of the top indices
+func checkTopIndicesBy(by string) error {
+	if by != TopIndicesByStoreSize && by != TopIndicesByIndexingRate {
+		return fmt.Errorf("unknown order of the top indices %q, expected one of %s,%s", by, TopIndicesByStoreSize, TopIndicesByIndexingRate)
+	}
+	return nil
+}
+
+// IndexTotals are the indexing operations of the indices as of the previous
+// scrape, their increase orders the indices by indexing rate. Collectors built
+// for every scrape of a target, e.g. by /probe, share the IndexTotals of the
+// target via Config.IndexTotals.
+type IndexTotals struct {
+	mtx    sync.Mutex
+	totals map[string]int64
+}
+
 // Indices information struct
 type Indices struct {
-	logger          log.Logger
-	client          *http.Client
-	url             *url.URL
-	shards          bool
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+	shards bool
+	// shardLatency exports the search and indexing times of every shard
+	shardLatency bool
+	// includeHidden exports hidden and dot-prefixed system indices, which
+	// are skipped otherwise
+	includeHidden bool
+	// patterns aggregate the stats of the matching indices, the first
+	// matching pattern applies
+	patterns []IndexPattern
+	// topN limits the detailed metrics to the first topN indices ordered
+	// by topBy, the others are aggregated into the index _other. 0 exports
+	// all indices.
+	topN  int
+	topBy string
+	// indexTotals order the indices by indexing rate
+	indexTotals     *IndexTotals
 	clusterInfoCh   chan *clusterinfo.Response
+	clusterInfoOnce sync.Once
 	lastClusterInfo *clusterinfo.Response
 
-	up                prometheus.Gauge
+	up                *prometheus.Desc
 	totalScrapes      prometheus.Counter
 	jsonParseFailures prometheus.Counter
+	skippedIndices    *prometheus.Desc
+	otherIndices      *prometheus.Desc
 
 	indexMetrics []*indexMetric
 	shardMetrics []*shardMetric
+	// shardLatencyMetrics are the search and indexing times of the shards,
+	// exported with shardLatency
+	shardLatencyMetrics []*shardMetric
 }
 
 // NewIndices defines Indices Prometheus metrics
 func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards bool) *Indices {
 
+	// index_pattern is empty but for the aggregates of the index patterns,
+	// whose index is empty instead
 	indexLabels := labels{
 		keys: func(...string) []string {
-			return []string{"index", "cluster"}
+			return []string{"index", "index_pattern", "cluster"}
 		},
 		values: func(lastClusterinfo *clusterinfo.Response, s ...string) []string {
 			if lastClusterinfo != nil {
@@ -85,15 +149,17 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 		client:        client,
 		url:           url,
 		shards:        shards,
+		indexTotals:   &IndexTotals{},
 		clusterInfoCh: make(chan *clusterinfo.Response),
 		lastClusterInfo: &clusterinfo.Response{
 			ClusterName: "unknown_cluster",
 		},
 
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "index_stats", "up"),
-			Help: "Was the last scrape of the ElasticSearch index endpoint successful.",
-		}),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "index_stats", "up"),
+			"Was the last scrape of the ElasticSearch index endpoint successful.",
+			nil, nil,
+		),
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: prometheus.BuildFQName(namespace, "index_stats", "total_scrapes"),
 			Help: "Current total ElasticSearch index scrapes.",
@@ -102,6 +168,16 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 			Name: prometheus.BuildFQName(namespace, "index_stats", "json_parse_failures"),
 			Help: "Number of errors while parsing JSON.",
 		}),
+		skippedIndices: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "index_stats", "skipped_indices"),
+			"Number of dot-prefixed system indices skipped by the last scrape.",
+			nil, nil,
+		),
+		otherIndices: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "index_stats", "other_indices"),
+			"Number of indices beyond the top indices aggregated into the index _other by the last scrape.",
+			nil, nil,
+		),
 
 		indexMetrics: []*indexMetric{
 			{
@@ -801,7 +877,7 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 				Labels: indexLabels,
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "index_stats", "query_cache_memory_bytes_total"),
 					"Total query cache memory bytes",
@@ -873,7 +949,7 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 				Labels: indexLabels,
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "index_stats", "request_cache_memory_bytes_total"),
 					"Total request cache memory bytes",
@@ -921,7 +997,7 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 				Labels: indexLabels,
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "index_stats", "fielddata_memory_bytes_total"),
 					"Total fielddata memory bytes",
@@ -971,28 +1047,114 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 				Labels: shardLabels,
 			},
 		},
+		shardLatencyMetrics: []*shardMetric{
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices", "shards_search_query_time_seconds_total"),
+					"Total search query time of this shard in seconds",
+					shardLabels.keys(), nil,
+				),
+				Value: func(data IndexStatsIndexShardsDetailResponse) float64 {
+					return float64(data.Search.QueryTimeInMillis) / 1000
+				},
+				Labels: shardLabels,
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices", "shards_search_query_total"),
+					"Total number of search queries of this shard",
+					shardLabels.keys(), nil,
+				),
+				Value: func(data IndexStatsIndexShardsDetailResponse) float64 {
+					return float64(data.Search.QueryTotal)
+				},
+				Labels: shardLabels,
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices", "shards_search_fetch_time_seconds_total"),
+					"Total search fetch time of this shard in seconds",
+					shardLabels.keys(), nil,
+				),
+				Value: func(data IndexStatsIndexShardsDetailResponse) float64 {
+					return float64(data.Search.FetchTimeInMillis) / 1000
+				},
+				Labels: shardLabels,
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices", "shards_search_fetch_total"),
+					"Total number of search fetches of this shard",
+					shardLabels.keys(), nil,
+				),
+				Value: func(data IndexStatsIndexShardsDetailResponse) float64 {
+					return float64(data.Search.FetchTotal)
+				},
+				Labels: shardLabels,
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices", "shards_indexing_index_time_seconds_total"),
+					"Total indexing time of this shard in seconds",
+					shardLabels.keys(), nil,
+				),
+				Value: func(data IndexStatsIndexShardsDetailResponse) float64 {
+					return float64(data.Indexing.IndexTimeInMillis) / 1000
+				},
+				Labels: shardLabels,
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices", "shards_indexing_index_total"),
+					"Total number of indexing operations of this shard",
+					shardLabels.keys(), nil,
+				),
+				Value: func(data IndexStatsIndexShardsDetailResponse) float64 {
+					return float64(data.Indexing.IndexTotal)
+				},
+				Labels: shardLabels,
+			},
+		},
 	}
 
-	// start go routine to fetch clusterinfo updates and save them to lastClusterinfo
-	go func() {
-		_ = level.Debug(logger).Log("msg", "starting cluster info receive loop")
-		for ci := range indices.clusterInfoCh {
-			_ = level.Debug(logger).Log("msg", "received cluster info update", "cluster", ci.ClusterName)
-			if ci != nil {
-				indices.lastClusterInfo = ci
-			}
-		}
-		_ = level.Debug(logger).Log("msg", "exiting cluster info receive loop")
-	}()
 	return indices
 }
 
 // ClusterLabelUpdates returns a pointer to a channel to receive cluster info updates. It implements the
 // (not exported) clusterinfo.consumer interface
 func (i *Indices) ClusterLabelUpdates() *chan *clusterinfo.Response {
+	// start go routine to fetch clusterinfo updates and save them to lastClusterinfo.
+	// It's only started once the collector is registered as consumer, so short-lived
+	// collectors (e.g. for /probe requests) don't leak it.
+	i.clusterInfoOnce.Do(func() {
+		go func() {
+			_ = level.Debug(i.logger).Log("msg", "starting cluster info receive loop")
+			for ci := range i.clusterInfoCh {
+				if ci != nil {
+					_ = level.Debug(i.logger).Log("msg", "received cluster info update", "cluster", ci.ClusterName)
+					i.lastClusterInfo = ci
+				}
+			}
+			_ = level.Debug(i.logger).Log("msg", "exiting cluster info receive loop")
+		}()
+	})
 	return &i.clusterInfoCh
 }
 
+// SetClusterInfo sets the cluster info used for the cluster label directly. It's
+// an alternative to receiving updates from a clusterinfo.Retriever.
+func (i *Indices) SetClusterInfo(ci *clusterinfo.Response) {
+	if ci != nil {
+		i.lastClusterInfo = ci
+	}
+}
+
 // String implements the stringer interface. It is part of the clusterinfo.consumer interface
 func (i *Indices) String() string {
 	return namespace + "indices"
@@ -1003,21 +1165,84 @@ func (i *Indices) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range i.indexMetrics {
 		ch <- metric.Desc
 	}
-	ch <- i.up.Desc()
+	for _, metric := range i.shardMetrics {
+		ch <- metric.Desc
+	}
+	for _, metric := range i.shardLatencyMetrics {
+		ch <- metric.Desc
+	}
+	ch <- i.up
+	ch <- i.skippedIndices
+	ch <- i.otherIndices
 	ch <- i.totalScrapes.Desc()
 	ch <- i.jsonParseFailures.Desc()
 }
 
-func (i *Indices) fetchAndDecodeIndexStats() (indexStatsResponse, error) {
+// hiddenIndicesVersion is the first version of Elasticsearch knowing hidden
+// indices, which are only requested on demand
+var hiddenIndicesVersion = semver.MustParse("7.7.0")
+
+// isSystemIndex reports whether the index is a system index by its name, i.e.
+// dot-prefixed. The backing indices of data streams hold regular data, they
+// aren't system indices.
+func isSystemIndex(name string) bool {
+	return strings.HasPrefix(name, ".") && !strings.HasPrefix(name, ".ds-")
+}
+
+// pattern returns the name of the first pattern matching the index
+func (i *Indices) pattern(index string) (string, bool) {
+	for _, p := range i.patterns {
+		if ok, _ := path.Match(p.Pattern, index); ok {
+			return p.Name, true
+		}
+	}
+	return "", false
+}
+
+// rankKeys returns the keys ordering the indices by topBy, the largest first
+func (i *Indices) rankKeys(indices map[string]IndexStatsIndexResponse) map[string]float64 {
+	keys := make(map[string]float64, len(indices))
+	if i.topBy != TopIndicesByIndexingRate {
+		for name, stats := range indices {
+			keys[name] = float64(stats.Total.Store.SizeInBytes)
+		}
+		return keys
+	}
+
+	// the scrape interval is the same for all indices, so the increase of
+	// the indexing operations orders them like the rate. Indices unknown to
+	// the previous scrape, e.g. all on the first one, rank last.
+	i.indexTotals.mtx.Lock()
+	defer i.indexTotals.mtx.Unlock()
+	totals := make(map[string]int64, len(indices))
+	for name, stats := range indices {
+		total := stats.Total.Indexing.IndexTotal
+		totals[name] = total
+		if last, ok := i.indexTotals.totals[name]; ok && total >= last {
+			keys[name] = float64(total - last)
+		}
+	}
+	i.indexTotals.totals = totals
+	return keys
+}
+
+func (i *Indices) fetchAndDecodeIndexStats(ctx context.Context) (indexStatsResponse, error) {
 	var isr indexStatsResponse
 
 	u := *i.url
 	u.Path = path.Join(u.Path, "/_all/_stats")
-	if i.shards {
-		u.RawQuery = "level=shards"
+	query := url.Values{}
+	if i.shards || i.shardLatency {
+		query.Set("level", "shards")
+	}
+	// the hidden indices are requested unless the cluster is known to
+	// predate them, i.e. also before the cluster info arrived
+	if version := i.lastClusterInfo.Version.CompatibleVersion(); i.includeHidden && (version.EQ(semver.Version{}) || version.GTE(hiddenIndicesVersion)) {
+		query.Set("expand_wildcards", "open,hidden")
 	}
+	u.RawQuery = query.Encode()
 
-	res, err := i.client.Get(u.String())
+	res, err := get(ctx, i.client, u.String())
 	if err != nil {
 		return isr, fmt.Errorf("failed to get index stats from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -1037,8 +1262,9 @@ func (i *Indices) fetchAndDecodeIndexStats() (indexStatsResponse, error) {
 		return isr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&isr); err != nil {
+	if err := i.decodeJSON(i.logger, res.Body, "indices", &isr); err != nil {
 		i.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("indices").Inc()
 		return isr, err
 	}
 
@@ -1047,51 +1273,125 @@ func (i *Indices) fetchAndDecodeIndexStats() (indexStatsResponse, error) {
 
 // Collect gets Indices metric values
 func (i *Indices) Collect(ch chan<- prometheus.Metric) {
+	_ = i.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects Indices metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape.
+func (i *Indices) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
 	i.totalScrapes.Inc()
 	defer func() {
-		ch <- i.up
+		ch <- prometheus.MustNewConstMetric(i.up, prometheus.GaugeValue, up)
 		ch <- i.totalScrapes
 		ch <- i.jsonParseFailures
 	}()
 
 	// indices
-	indexStatsResp, err := i.fetchAndDecodeIndexStats()
+	indexStatsResp, err := i.fetchAndDecodeIndexStats(ctx)
 	if err != nil {
-		i.up.Set(0)
 		_ = level.Warn(i.logger).Log(
 			"msg", "failed to fetch and decode index stats",
 			"err", err,
 		)
-		return
+		return err
 	}
-	i.totalScrapes.Inc()
-	i.up.Set(1)
+	up = 1
 
 	// Index stats
+	var skipped float64
+	// aggregates holds the sums of the index metrics by pattern and of the
+	// indices beyond the top indices, keyed by the index and index_pattern
+	// labels
+	aggregates := map[[2]string][]float64{}
+	aggregate := func(index, pattern string, indexStats IndexStatsIndexResponse) {
+		key := [2]string{index, pattern}
+		sums, ok := aggregates[key]
+		if !ok {
+			sums = make([]float64, len(i.indexMetrics))
+			aggregates[key] = sums
+		}
+		for k, metric := range i.indexMetrics {
+			sums[k] += metric.Value(indexStats)
+		}
+	}
+	indices := make(map[string]IndexStatsIndexResponse, len(indexStatsResp.Indices))
 	for indexName, indexStats := range indexStatsResp.Indices {
+		if !i.includeHidden && isSystemIndex(indexName) {
+			skipped++
+			continue
+		}
+		if name, ok := i.pattern(indexName); ok {
+			aggregate("", name, indexStats)
+			continue
+		}
+		indices[indexName] = indexStats
+	}
+	var other float64
+	// the indices are ranked on every scrape to keep the totals of the
+	// indexing rate current while there are no more than topN
+	var keys map[string]float64
+	if i.topN > 0 {
+		keys = i.rankKeys(indices)
+	}
+	if i.topN > 0 && len(indices) > i.topN {
+		names := make([]string, 0, len(indices))
+		for name := range indices {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(a, b int) bool {
+			if keys[names[a]] != keys[names[b]] {
+				return keys[names[a]] > keys[names[b]]
+			}
+			return names[a] < names[b]
+		})
+		for _, name := range names[i.topN:] {
+			aggregate(otherIndex, "", indices[name])
+			delete(indices, name)
+			other++
+		}
+	}
+	for indexName, indexStats := range indices {
 		for _, metric := range i.indexMetrics {
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
 				metric.Value(indexStats),
-				metric.Labels.values(i.lastClusterInfo, indexName)...,
+				metric.Labels.values(i.lastClusterInfo, indexName, "")...,
 			)
 
 		}
+		var shardMetrics []*shardMetric
 		if i.shards {
-			for _, metric := range i.shardMetrics {
-				// gaugeVec := prometheus.NewGaugeVec(metric.Opts, metric.Labels)
-				for shardNumber, shards := range indexStats.Shards {
-					for _, shard := range shards {
-						ch <- prometheus.MustNewConstMetric(
-							metric.Desc,
-							metric.Type,
-							metric.Value(shard),
-							metric.Labels.values(i.lastClusterInfo, indexName, shardNumber, shard.Routing.Node)...,
-						)
-					}
+			shardMetrics = append(shardMetrics, i.shardMetrics...)
+		}
+		if i.shardLatency {
+			shardMetrics = append(shardMetrics, i.shardLatencyMetrics...)
+		}
+		for _, metric := range shardMetrics {
+			for shardNumber, shards := range indexStats.Shards {
+				for _, shard := range shards {
+					ch <- prometheus.MustNewConstMetric(
+						metric.Desc,
+						metric.Type,
+						metric.Value(shard),
+						metric.Labels.values(i.lastClusterInfo, indexName, shardNumber, shard.Routing.Node)...,
+					)
 				}
 			}
 		}
 	}
+	for key, sums := range aggregates {
+		for k, metric := range i.indexMetrics {
+			ch <- prometheus.MustNewConstMetric(
+				metric.Desc,
+				metric.Type,
+				sums[k],
+				metric.Labels.values(i.lastClusterInfo, key[0], key[1])...,
+			)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(i.skippedIndices, prometheus.GaugeValue, skipped)
+	ch <- prometheus.MustNewConstMetric(i.otherIndices, prometheus.GaugeValue, other)
+	return nil
 }
@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -17,9 +17,10 @@ type IndicesSettings struct {
 	logger log.Logger
 	client *http.Client
 	url    *url.URL
+	decoder
 
-	up                              prometheus.Gauge
-	readOnlyIndices                 prometheus.Gauge
+	up                              *prometheus.Desc
+	readOnlyIndices                 *prometheus.Desc
 	totalScrapes, jsonParseFailures prometheus.Counter
 }
 
@@ -30,18 +31,20 @@ func NewIndicesSettings(logger log.Logger, client *http.Client, url *url.URL) *I
 		client: client,
 		url:    url,
 
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "up"),
-			Help: "Was the last scrape of the ElasticSearch Indices Settings endpoint successful.",
-		}),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "indices_settings_stats", "up"),
+			"Was the last scrape of the ElasticSearch Indices Settings endpoint successful.",
+			nil, nil,
+		),
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "total_scrapes"),
 			Help: "Current total ElasticSearch Indices Settings scrapes.",
 		}),
-		readOnlyIndices: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "read_only_indices"),
-			Help: "Current number of read only indices within cluster",
-		}),
+		readOnlyIndices: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "indices_settings_stats", "read_only_indices"),
+			"Current number of read only indices within cluster",
+			nil, nil,
+		),
 		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "json_parse_failures"),
 			Help: "Number of errors while parsing JSON.",
@@ -51,14 +54,14 @@ func NewIndicesSettings(logger log.Logger, client *http.Client, url *url.URL) *I
 
 // Describe add Snapshots metrics descriptions
 func (cs *IndicesSettings) Describe(ch chan<- *prometheus.Desc) {
-	ch <- cs.up.Desc()
+	ch <- cs.up
 	ch <- cs.totalScrapes.Desc()
-	ch <- cs.readOnlyIndices.Desc()
+	ch <- cs.readOnlyIndices
 	ch <- cs.jsonParseFailures.Desc()
 }
 
-func (cs *IndicesSettings) getAndParseURL(u *url.URL, data interface{}) error {
-	res, err := cs.client.Get(u.String())
+func (cs *IndicesSettings) getAndParseURL(ctx context.Context, u *url.URL, data interface{}) error {
+	res, err := get(ctx, cs.client, u.String())
 	if err != nil {
 		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -78,19 +81,22 @@ func (cs *IndicesSettings) getAndParseURL(u *url.URL, data interface{}) error {
 		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(data); err != nil {
+	if err := cs.decodeJSON(cs.logger, res.Body, "indices_settings", data); err != nil {
 		cs.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("indices_settings").Inc()
 		return err
 	}
 	return nil
 }
 
-func (cs *IndicesSettings) fetchAndDecodeIndicesSettings() (IndicesSettingsResponse, error) {
+func (cs *IndicesSettings) fetchAndDecodeIndicesSettings(ctx context.Context) (IndicesSettingsResponse, error) {
 
 	u := *cs.url
 	u.Path = path.Join(u.Path, "/_all/_settings")
+	// only the blocks of the indices are exported
+	u.RawQuery = "filter_path=*.settings.index.blocks.read_only_allow_delete"
 	var asr IndicesSettingsResponse
-	err := cs.getAndParseURL(&u, &asr)
+	err := cs.getAndParseURL(ctx, &u, &asr)
 	if err != nil {
 		return asr, err
 	}
@@ -100,26 +106,30 @@ func (cs *IndicesSettings) fetchAndDecodeIndicesSettings() (IndicesSettingsRespo
 
 // Collect gets all indices settings metric values
 func (cs *IndicesSettings) Collect(ch chan<- prometheus.Metric) {
+	_ = cs.CollectContext(context.Background(), ch)
+}
 
+// CollectContext collects IndicesSettings metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape.
+func (cs *IndicesSettings) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+
+	var up float64
 	cs.totalScrapes.Inc()
 	defer func() {
-		ch <- cs.up
+		ch <- prometheus.MustNewConstMetric(cs.up, prometheus.GaugeValue, up)
 		ch <- cs.totalScrapes
 		ch <- cs.jsonParseFailures
-		ch <- cs.readOnlyIndices
 	}()
 
-	asr, err := cs.fetchAndDecodeIndicesSettings()
+	asr, err := cs.fetchAndDecodeIndicesSettings(ctx)
 	if err != nil {
-		cs.readOnlyIndices.Set(0)
-		cs.up.Set(0)
 		_ = level.Warn(cs.logger).Log(
 			"msg", "failed to fetch and decode cluster settings stats",
 			"err", err,
 		)
-		return
+		return err
 	}
-	cs.up.Set(1)
+	up = 1
 
 	var c int
 	for _, value := range asr {
@@ -127,5 +137,6 @@ func (cs *IndicesSettings) Collect(ch chan<- prometheus.Metric) {
 			c++
 		}
 	}
-	cs.readOnlyIndices.Set(float64(c))
+	ch <- prometheus.MustNewConstMetric(cs.readOnlyIndices, prometheus.GaugeValue, float64(c))
+	return nil
 }
@@ -1,13 +1,18 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"testing"
 
+	"github.com/blang/semver"
 	"github.com/go-kit/kit/log"
+	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestIndices(t *testing.T) {
@@ -36,7 +41,7 @@ func TestIndices(t *testing.T) {
 			t.Fatalf("Failed to parse URL: %s", err)
 		}
 		i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false)
-		stats, err := i.fetchAndDecodeIndexStats()
+		stats, err := i.fetchAndDecodeIndexStats(context.Background())
 		if err != nil {
 			t.Fatalf("Failed to fetch or decode indices stats: %s", err)
 		}
@@ -58,3 +63,269 @@ func TestIndices(t *testing.T) {
 		}
 	}
 }
+
+func TestIndicesHidden(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"indices":{"logs":{},".kibana_1":{},".security-7":{},".ds-logs-2024.01.01-000001":{}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	for _, includeHidden := range []bool{false, true} {
+		i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false)
+		i.includeHidden = includeHidden
+		i.SetClusterInfo(&clusterinfo.Response{ClusterName: "test", Version: clusterinfo.VersionInfo{Number: semver.MustParse("7.10.0")}})
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(i)
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %s", err)
+		}
+
+		indices := map[string]bool{}
+		var skipped float64
+		for _, mf := range mfs {
+			switch mf.GetName() {
+			case "elasticsearch_indices_docs_primary":
+				for _, m := range mf.GetMetric() {
+					for _, l := range m.GetLabel() {
+						if l.GetName() == "index" {
+							indices[l.GetValue()] = true
+						}
+					}
+				}
+			case "elasticsearch_index_stats_skipped_indices":
+				skipped = mf.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		if !indices["logs"] || !indices[".ds-logs-2024.01.01-000001"] {
+			t.Errorf("expected the regular and data stream indices to be exported, got %v", indices)
+		}
+		if includeHidden {
+			if !indices[".kibana_1"] || skipped != 0 || query != "expand_wildcards=open%2Chidden" {
+				t.Errorf("expected the system indices to be exported, got %v, %v skipped, query %q", indices, skipped, query)
+			}
+		} else if indices[".kibana_1"] || indices[".security-7"] || skipped != 2 || query != "" {
+			t.Errorf("expected the system indices to be skipped, got %v, %v skipped, query %q", indices, skipped, query)
+		}
+	}
+}
+
+func TestIndicesHiddenVersion(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"indices":{}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	for _, tc := range []struct {
+		version string
+		query   string
+	}{
+		{"", "expand_wildcards=open%2Chidden"},
+		{"7.6.2", ""},
+		{"7.7.0", "expand_wildcards=open%2Chidden"},
+	} {
+		i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false)
+		i.includeHidden = true
+		if tc.version != "" {
+			i.SetClusterInfo(&clusterinfo.Response{ClusterName: "test", Version: clusterinfo.VersionInfo{Number: semver.MustParse(tc.version)}})
+		}
+		if _, err := i.fetchAndDecodeIndexStats(context.Background()); err != nil {
+			t.Fatalf("Failed to fetch index stats: %s", err)
+		}
+		if query != tc.query {
+			t.Errorf("version %q: expected query %q, got %q", tc.version, tc.query, query)
+		}
+	}
+}
+
+func TestIndicesPatterns(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"indices":{
+			"logs-app-2024.01.01":{"primaries":{"docs":{"count":10}}},
+			"logs-web-2024.01.02":{"primaries":{"docs":{"count":5}}},
+			"logs-app-2023.12.31":{"primaries":{"docs":{"count":3}}},
+			"metrics":{"primaries":{"docs":{"count":7}}},
+			"logs":{"primaries":{"docs":{"count":1}}}
+		}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false)
+	i.patterns = []IndexPattern{
+		{Name: "logs-2024", Pattern: "logs-*-2024.*"},
+		{Name: "logs", Pattern: "logs-*"},
+	}
+	i.SetClusterInfo(&clusterinfo.Response{ClusterName: "test", Version: clusterinfo.VersionInfo{Number: semver.MustParse("7.10.0")}})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(i)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	// the index logs doesn't clash with the pattern logs
+	docs := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "elasticsearch_indices_docs_primary" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			var index, pattern string
+			for _, l := range m.GetLabel() {
+				switch l.GetName() {
+				case "index":
+					index = l.GetValue()
+				case "index_pattern":
+					pattern = l.GetValue()
+				}
+			}
+			docs[index+"/"+pattern] = m.GetGauge().GetValue()
+		}
+	}
+	expected := map[string]float64{"/logs-2024": 15, "/logs": 3, "metrics/": 7, "logs/": 1}
+	if !reflect.DeepEqual(docs, expected) {
+		t.Errorf("expected %v, got %v", expected, docs)
+	}
+}
+
+func TestIndicesTopN(t *testing.T) {
+	indexTotal := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// c is the largest index, b indexes the most documents between
+		// scrapes
+		fmt.Fprintf(w, `{"indices":{
+			"a":{"primaries":{"docs":{"count":1}},"total":{"store":{"size_in_bytes":200},"indexing":{"index_total":100}}},
+			"b":{"primaries":{"docs":{"count":2}},"total":{"store":{"size_in_bytes":100},"indexing":{"index_total":%d}}},
+			"c":{"primaries":{"docs":{"count":4}},"total":{"store":{"size_in_bytes":300},"indexing":{"index_total":100}}}
+		}}`, indexTotal)
+		indexTotal += 1000
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	scrape := func(i *Indices) (map[string]float64, float64) {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(i)
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %s", err)
+		}
+		docs := map[string]float64{}
+		var other float64
+		for _, mf := range mfs {
+			switch mf.GetName() {
+			case "elasticsearch_indices_docs_primary":
+				for _, m := range mf.GetMetric() {
+					for _, l := range m.GetLabel() {
+						if l.GetName() == "index" {
+							docs[l.GetValue()] = m.GetGauge().GetValue()
+						}
+					}
+				}
+			case "elasticsearch_index_stats_other_indices":
+				other = mf.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		return docs, other
+	}
+	newIndices := func(by string) *Indices {
+		i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false)
+		i.topN, i.topBy = 1, by
+		i.SetClusterInfo(&clusterinfo.Response{ClusterName: "test", Version: clusterinfo.VersionInfo{Number: semver.MustParse("7.10.0")}})
+		return i
+	}
+
+	docs, other := scrape(newIndices(TopIndicesByStoreSize))
+	if expected := map[string]float64{"c": 4, "_other": 3}; !reflect.DeepEqual(docs, expected) || other != 2 {
+		t.Errorf("expected %v and 2 other indices by store size, got %v and %v", expected, docs, other)
+	}
+
+	i := newIndices(TopIndicesByIndexingRate)
+	// the first scrape knows no rates and orders by name
+	if docs, _ := scrape(i); docs["a"] != 1 {
+		t.Errorf("expected index a on the first scrape, got %v", docs)
+	}
+	// a collector built for the next scrape, e.g. by /probe, shares the totals
+	next := newIndices(TopIndicesByIndexingRate)
+	next.indexTotals = i.indexTotals
+	docs, _ = scrape(next)
+	if expected := map[string]float64{"b": 2, "_other": 5}; !reflect.DeepEqual(docs, expected) {
+		t.Errorf("expected %v by indexing rate, got %v", expected, docs)
+	}
+}
+
+func TestIndicesShardLatency(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"indices":{"logs":{"shards":{"0":[
+			{"routing":{"node":"n1","primary":true},"search":{"query_total":4,"query_time_in_millis":2000},"indexing":{"index_total":10,"index_time_in_millis":500}},
+			{"routing":{"node":"n2","primary":false},"search":{"query_total":2,"query_time_in_millis":3000},"indexing":{"index_total":10,"index_time_in_millis":700}}
+		]}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false)
+	i.shardLatency = true
+	i.SetClusterInfo(&clusterinfo.Response{ClusterName: "test", Version: clusterinfo.VersionInfo{Number: semver.MustParse("7.10.0")}})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(i)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	if query != "level=shards" {
+		t.Errorf("expected the stats of the shards to be requested, got query %q", query)
+	}
+
+	queryTime, indexTime := map[string]float64{}, map[string]float64{}
+	for _, mf := range mfs {
+		var values map[string]float64
+		switch mf.GetName() {
+		case "elasticsearch_indices_shards_search_query_time_seconds_total":
+			values = queryTime
+		case "elasticsearch_indices_shards_indexing_index_time_seconds_total":
+			values = indexTime
+		case "elasticsearch_indices_shared_docs":
+			t.Errorf("expected no shard docs without es.shards")
+		default:
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "node" {
+					values[l.GetValue()] = m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	if expected := map[string]float64{"n1": 2, "n2": 3}; !reflect.DeepEqual(queryTime, expected) {
+		t.Errorf("expected search query times %v, got %v", expected, queryTime)
+	}
+	if expected := map[string]float64{"n1": 0.5, "n2": 0.7}; !reflect.DeepEqual(indexTime, expected) {
+		t.Errorf("expected indexing times %v, got %v", expected, indexTime)
+	}
+}
@@ -0,0 +1,193 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ismExplainPageSize is the number of indices requested per page of the ISM
+// explain API, which returns 20 by default
+const ismExplainPageSize = 1000
+
+// ISM information struct, the states of the indices managed by the Index
+// State Management of OpenSearch, its analogue of ILM
+type ISM struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+	pageSize int
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	managedIndices, indices, failedIndices *prometheus.Desc
+}
+
+// NewISM defines ISM Prometheus metrics
+func NewISM(logger log.Logger, client *http.Client, url *url.URL) *ISM {
+	subsystem := "ism"
+
+	return &ISM{
+		logger:   logger,
+		client:   client,
+		url:      url,
+		pageSize: ismExplainPageSize,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the OpenSearch ISM explain endpoint successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total OpenSearch ISM scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		managedIndices: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "managed_indices"),
+			"Number of indices managed by ISM policies.",
+			nil, nil,
+		),
+		indices: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "indices"),
+			"Number of indices in the state of the ISM policy.",
+			[]string{"policy", "state"}, nil,
+		),
+		failedIndices: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "indices_failed"),
+			"Number of indices in the state of the ISM policy whose action failed.",
+			[]string{"policy", "state"}, nil,
+		),
+	}
+}
+
+// Describe add ISM metrics descriptions
+func (i *ISM) Describe(ch chan<- *prometheus.Desc) {
+	ch <- i.managedIndices
+	ch <- i.indices
+	ch <- i.failedIndices
+	ch <- i.up
+	ch <- i.totalScrapes.Desc()
+	ch <- i.jsonParseFailures.Desc()
+}
+
+// fetchAndDecodeExplain pages through the ISM explain API until all
+// total_managed_indices are fetched
+func (i *ISM) fetchAndDecodeExplain(ctx context.Context) (ismExplainResponse, error) {
+	ier := ismExplainResponse{Indices: map[string]ismExplainIndex{}}
+	managed := int64(0)
+	for from := 0; ; from += i.pageSize {
+		page, err := i.fetchAndDecodeExplainPage(ctx, from)
+		if err != nil {
+			return ier, err
+		}
+		ier.TotalManaged = page.TotalManaged
+		for name, index := range page.Indices {
+			if _, ok := ier.Indices[name]; !ok && index.PolicyID != nil {
+				managed++
+			}
+			ier.Indices[name] = index
+		}
+		// an empty page ends the paging even if indices were deleted meanwhile
+		if managed >= ier.TotalManaged || len(page.Indices) == 0 {
+			return ier, nil
+		}
+	}
+}
+
+func (i *ISM) fetchAndDecodeExplainPage(ctx context.Context, from int) (ismExplainResponse, error) {
+	var ier ismExplainResponse
+
+	u := *i.url
+	u.Path = path.Join(u.Path, "/_plugins/_ism/explain")
+	q := u.Query()
+	q.Set("size", strconv.Itoa(i.pageSize))
+	q.Set("from", strconv.Itoa(from))
+	u.RawQuery = q.Encode()
+	res, err := get(ctx, i.client, u.String())
+	if err != nil {
+		return ier, fmt.Errorf("failed to get ISM explain from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(i.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return ier, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := i.decodeJSON(i.logger, res.Body, "ism", &ier); err != nil {
+		i.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("ism").Inc()
+		return ier, err
+	}
+	return ier, nil
+}
+
+// Collect gets ISM metric values
+func (i *ISM) Collect(ch chan<- prometheus.Metric) {
+	_ = i.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects ISM metrics, aborting the request to OpenSearch once
+// ctx is done. It returns the error of the scrape. Indices whose policy wasn't
+// initialized yet are counted in the state "".
+func (i *ISM) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	i.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(i.up, prometheus.GaugeValue, up)
+		ch <- i.totalScrapes
+		ch <- i.jsonParseFailures
+	}()
+
+	ier, err := i.fetchAndDecodeExplain(ctx)
+	if err != nil {
+		_ = level.Warn(i.logger).Log(
+			"msg", "failed to fetch and decode ISM explain",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	type policyState struct{ policy, state string }
+	indices, failed := map[policyState]int{}, map[policyState]int{}
+	for _, index := range ier.Indices {
+		if index.PolicyID == nil {
+			continue
+		}
+		key := policyState{*index.PolicyID, index.State.Name}
+		indices[key]++
+		if index.Action.Failed || index.RetryInfo.Failed {
+			failed[key]++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(i.managedIndices, prometheus.GaugeValue, float64(ier.TotalManaged))
+	for key, n := range indices {
+		ch <- prometheus.MustNewConstMetric(i.indices, prometheus.GaugeValue, float64(n), key.policy, key.state)
+		ch <- prometheus.MustNewConstMetric(i.failedIndices, prometheus.GaugeValue, float64(failed[key]), key.policy, key.state)
+	}
+	return nil
+}
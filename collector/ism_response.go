@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ismExplainResponse is a representation of the OpenSearch ISM explain API,
+// the managed indices by index name next to total_managed_indices
+type ismExplainResponse struct {
+	Indices      map[string]ismExplainIndex
+	TotalManaged int64
+}
+
+// ismExplainIndex is the state of the ISM policy managing an index, the
+// policy ID is null for indices which aren't managed
+type ismExplainIndex struct {
+	PolicyID *string `json:"policy_id"`
+	State    struct {
+		Name string `json:"name"`
+	} `json:"state"`
+	Action struct {
+		Name   string `json:"name"`
+		Failed bool   `json:"failed"`
+	} `json:"action"`
+	RetryInfo struct {
+		Failed bool `json:"failed"`
+	} `json:"retry_info"`
+}
+
+// UnmarshalJSON decodes the explain response, whose keys are the index names
+// besides total_managed_indices
+func (r *ismExplainResponse) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	r.Indices = make(map[string]ismExplainIndex, len(fields))
+	for key, value := range fields {
+		if key == "total_managed_indices" {
+			if err := json.Unmarshal(value, &r.TotalManaged); err != nil {
+				return fmt.Errorf("failed to decode %s: %s", key, err)
+			}
+			continue
+		}
+		var index ismExplainIndex
+		if err := json.Unmarshal(value, &index); err != nil {
+			return fmt.Errorf("failed to decode ISM state of %s: %s", key, err)
+		}
+		r.Indices[key] = index
+	}
+	return nil
+}
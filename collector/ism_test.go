@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestISM(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_plugins/_ism/explain" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprintln(w, `{`+
+			`"logs-1":{"index.plugins.index_state_management.policy_id":"rollover","index":"logs-1","policy_id":"rollover","enabled":true,`+
+			`"state":{"name":"hot","start_time":1700000000000},"action":{"name":"rollover","failed":false},"retry_info":{"failed":false,"consumed_retries":0}},`+
+			`"logs-2":{"policy_id":"rollover","enabled":true,"state":{"name":"hot"},"action":{"name":"rollover","failed":true},"retry_info":{"failed":true}},`+
+			`"logs-3":{"policy_id":"rollover","enabled":true,"state":{"name":"delete"},"action":{"name":"delete","failed":false}},`+
+			`"other":{"index.plugins.index_state_management.policy_id":null,"policy_id":null,"enabled":null},`+
+			`"total_managed_indices":3}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewISM(log.NewNopLogger(), http.DefaultClient, u))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_ism_up":                             1,
+		"elasticsearch_ism_managed_indices":                3,
+		"elasticsearch_ism_indices rollover hot":           2,
+		"elasticsearch_ism_indices_failed rollover hot":    1,
+		"elasticsearch_ism_indices rollover delete":        1,
+		"elasticsearch_ism_indices_failed rollover delete": 0,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, got)
+		}
+	}
+	if len(values) != 8 {
+		t.Errorf("expected no metrics of unmanaged indices, got %v", values)
+	}
+}
+
+func TestISMPages(t *testing.T) {
+	pages := map[string]string{
+		"0": `"logs-1":{"policy_id":"rollover","state":{"name":"hot"}},"logs-2":{"policy_id":"rollover","state":{"name":"hot"}}`,
+		"2": `"logs-3":{"policy_id":"rollover","state":{"name":"delete"}}`,
+	}
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if size := r.URL.Query().Get("size"); size != "2" {
+			t.Errorf("unexpected size %s", size)
+		}
+		fmt.Fprintln(w, `{`+pages[r.URL.Query().Get("from")]+`,"total_managed_indices":3}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	ism := NewISM(log.NewNopLogger(), http.DefaultClient, u)
+	ism.pageSize = 2
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(ism)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_ism_indices rollover hot":    2,
+		"elasticsearch_ism_indices rollover delete": 1,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, got)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
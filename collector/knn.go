@@ -0,0 +1,278 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type knnNodeMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(node knnNodeStats) float64
+}
+
+// KNN information struct, the stats of the k-NN plugin of OpenSearch for
+// vector search
+type KNN struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	circuitBreakerTriggered *prometheus.Desc
+	nodeMetrics             []*knnNodeMetric
+}
+
+// NewKNN defines k-NN Prometheus metrics
+func NewKNN(logger log.Logger, client *http.Client, url *url.URL) *KNN {
+	subsystem := "knn"
+	// the k-NN stats of the nodes are keyed by node ID without node name
+	nodeLabels := []string{"node_id"}
+
+	return &KNN{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the OpenSearch k-NN stats endpoint successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total OpenSearch k-NN scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		circuitBreakerTriggered: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "circuit_breaker_triggered"),
+			"Whether the k-NN circuit breaker is triggered, rejecting the loading of graphs.",
+			nil, nil,
+		),
+		nodeMetrics: []*knnNodeMetric{
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "graph_memory_usage_bytes"),
+					"Native memory used by the k-NN graphs of the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					// the usage is reported in kilobytes
+					return float64(node.GraphMemoryUsage) * 1024
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "graph_memory_usage_ratio"),
+					"Ratio of the k-NN graph cache of the node in use.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					return node.GraphMemoryUsagePercentage / 100
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "cache_capacity_reached"),
+					"Whether the k-NN graph cache of the node is full.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					if node.CacheCapacityReached {
+						return 1
+					}
+					return 0
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "cache_hits_total"),
+					"Number of k-NN graph cache hits of the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					return float64(node.HitCount)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "cache_misses_total"),
+					"Number of k-NN graph cache misses of the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					return float64(node.MissCount)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "cache_evictions_total"),
+					"Number of k-NN graphs evicted from the cache of the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					return float64(node.EvictionCount)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "graph_loads_total"),
+					"Number of k-NN graphs loaded into the cache of the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					return float64(node.LoadSuccessCount)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "graph_load_failures_total"),
+					"Number of k-NN graphs the node failed to load into the cache.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					return float64(node.LoadExceptionCount)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "graph_load_seconds_total"),
+					"Time spent by the node loading k-NN graphs into the cache.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					// the load time is reported in nanoseconds
+					return float64(node.TotalLoadTime) / 1e9
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "query_requests_total"),
+					"Number of k-NN queries of the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					return float64(node.KNNQueryRequests)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "graph_query_errors_total"),
+					"Number of errors querying the k-NN graphs of the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node knnNodeStats) float64 {
+					return float64(node.GraphQueryErrors)
+				},
+			},
+		},
+	}
+}
+
+// Describe add k-NN metrics descriptions
+func (k *KNN) Describe(ch chan<- *prometheus.Desc) {
+	ch <- k.circuitBreakerTriggered
+	for _, metric := range k.nodeMetrics {
+		ch <- metric.Desc
+	}
+	ch <- k.up
+	ch <- k.totalScrapes.Desc()
+	ch <- k.jsonParseFailures.Desc()
+}
+
+func (k *KNN) fetchAndDecodeStats(ctx context.Context) (knnStatsResponse, error) {
+	var ksr knnStatsResponse
+
+	u := *k.url
+	u.Path = path.Join(u.Path, "/_plugins/_knn/stats")
+	res, err := get(ctx, k.client, u.String())
+	if err != nil {
+		return ksr, fmt.Errorf("failed to get k-NN stats from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(k.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return ksr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := k.decodeJSON(k.logger, res.Body, "knn", &ksr); err != nil {
+		k.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("knn").Inc()
+		return ksr, err
+	}
+	return ksr, nil
+}
+
+// Collect gets k-NN metric values
+func (k *KNN) Collect(ch chan<- prometheus.Metric) {
+	_ = k.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects KNN metrics, aborting the request to OpenSearch once
+// ctx is done. It returns the error of the scrape.
+func (k *KNN) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	k.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(k.up, prometheus.GaugeValue, up)
+		ch <- k.totalScrapes
+		ch <- k.jsonParseFailures
+	}()
+
+	ksr, err := k.fetchAndDecodeStats(ctx)
+	if err != nil {
+		_ = level.Warn(k.logger).Log(
+			"msg", "failed to fetch and decode k-NN stats",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	var triggered float64
+	if ksr.CircuitBreakerTriggered {
+		triggered = 1
+	}
+	ch <- prometheus.MustNewConstMetric(k.circuitBreakerTriggered, prometheus.GaugeValue, triggered)
+	for id, node := range ksr.Nodes {
+		for _, metric := range k.nodeMetrics {
+			ch <- prometheus.MustNewConstMetric(metric.Desc, metric.Type, metric.Value(node), id)
+		}
+	}
+	return nil
+}
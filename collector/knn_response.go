@@ -0,0 +1,23 @@
+package collector
+
+// knnStatsResponse is a representation of the OpenSearch k-NN stats API
+type knnStatsResponse struct {
+	CircuitBreakerTriggered bool                    `json:"circuit_breaker_triggered"`
+	Nodes                   map[string]knnNodeStats `json:"nodes"`
+}
+
+// knnNodeStats are the k-NN stats of a node, the graphs are the native
+// memory structures of the vector indices
+type knnNodeStats struct {
+	GraphMemoryUsage           int64   `json:"graph_memory_usage"`
+	GraphMemoryUsagePercentage float64 `json:"graph_memory_usage_percentage"`
+	CacheCapacityReached       bool    `json:"cache_capacity_reached"`
+	HitCount                   int64   `json:"hit_count"`
+	MissCount                  int64   `json:"miss_count"`
+	EvictionCount              int64   `json:"eviction_count"`
+	LoadSuccessCount           int64   `json:"load_success_count"`
+	LoadExceptionCount         int64   `json:"load_exception_count"`
+	TotalLoadTime              int64   `json:"total_load_time"`
+	KNNQueryRequests           int64   `json:"knn_query_requests"`
+	GraphQueryErrors           int64   `json:"graph_query_errors"`
+}
@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestKNN(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_plugins/_knn/stats" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprintln(w, `{"_nodes":{"total":1,"successful":1,"failed":0},"cluster_name":"test",`+
+			`"circuit_breaker_triggered":true,"model_index_status":null,"nodes":{"abc":{`+
+			`"graph_memory_usage":2048,"graph_memory_usage_percentage":12.5,"cache_capacity_reached":false,`+
+			`"hit_count":10,"miss_count":3,"eviction_count":1,"load_success_count":3,"load_exception_count":0,`+
+			`"total_load_time":1500000000,"knn_query_requests":13,"graph_query_errors":2,"indices_in_cache":{}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewKNN(log.NewNopLogger(), http.DefaultClient, u))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			switch mf.GetType().String() {
+			case "COUNTER":
+				values[key] = m.GetCounter().GetValue()
+			default:
+				values[key] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_knn_up":                           1,
+		"elasticsearch_knn_circuit_breaker_triggered":    1,
+		"elasticsearch_knn_graph_memory_usage_bytes abc": 2048 * 1024,
+		"elasticsearch_knn_graph_memory_usage_ratio abc": 0.125,
+		"elasticsearch_knn_cache_capacity_reached abc":   0,
+		"elasticsearch_knn_cache_hits_total abc":         10,
+		"elasticsearch_knn_cache_misses_total abc":       3,
+		"elasticsearch_knn_cache_evictions_total abc":    1,
+		"elasticsearch_knn_graph_loads_total abc":        3,
+		"elasticsearch_knn_graph_load_seconds_total abc": 1.5,
+		"elasticsearch_knn_query_requests_total abc":     13,
+		"elasticsearch_knn_graph_query_errors_total abc": 2,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, got)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// deploymentStates are the states of the deployments of trained models
+var deploymentStates = []string{"starting", "started", "stopping", "failed"}
+
+type mlDeploymentNodeMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(node trainedModelDeploymentNodeStats) float64
+}
+
+// ML information struct, the stats of the trained models and their
+// deployments, e.g. of the models used for semantic search
+type ML struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	inferences, inferenceFailures, pipelines *prometheus.Desc
+	deploymentState                          *prometheus.Desc
+	allocations, targetAllocations           *prometheus.Desc
+	nodeMetrics                              []*mlDeploymentNodeMetric
+}
+
+// NewML defines ML Prometheus metrics
+func NewML(logger log.Logger, client *http.Client, url *url.URL) *ML {
+	subsystem := "ml_model"
+	modelLabels := []string{"model_id"}
+	deploymentLabels := []string{"model_id", "deployment_id"}
+	nodeLabels := []string{"model_id", "deployment_id", "node"}
+
+	return &ML{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch trained models stats endpoint successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch trained models scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		inferences: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "inferences_total"),
+			"Number of inferences of the model, e.g. by ingest pipelines.",
+			modelLabels, nil,
+		),
+		inferenceFailures: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "inference_failures_total"),
+			"Number of failed inferences of the model.",
+			modelLabels, nil,
+		),
+		pipelines: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "pipelines"),
+			"Number of ingest pipelines referencing the model.",
+			modelLabels, nil,
+		),
+		deploymentState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "deployment_state"),
+			"Whether the deployment of the model is in the state.",
+			append(deploymentLabels, "state"), nil,
+		),
+		allocations: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "deployment_allocations"),
+			"Number of allocations of the deployment started.",
+			deploymentLabels, nil,
+		),
+		targetAllocations: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "deployment_target_allocations"),
+			"Number of allocations of the deployment requested.",
+			deploymentLabels, nil,
+		),
+		nodeMetrics: []*mlDeploymentNodeMetric{
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "deployment_inferences_total"),
+					"Number of inferences of the deployment on the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node trainedModelDeploymentNodeStats) float64 {
+					return float64(node.InferenceCount)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "deployment_average_inference_seconds"),
+					"Average time of the inferences of the deployment on the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node trainedModelDeploymentNodeStats) float64 {
+					return node.AverageInferenceTime / 1000
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "deployment_errors_total"),
+					"Number of inferences of the deployment on the node which failed.",
+					nodeLabels, nil,
+				),
+				Value: func(node trainedModelDeploymentNodeStats) float64 {
+					return float64(node.ErrorCount)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "deployment_rejected_total"),
+					"Number of inference requests of the deployment on the node rejected as the queue was full.",
+					nodeLabels, nil,
+				),
+				Value: func(node trainedModelDeploymentNodeStats) float64 {
+					return float64(node.RejectedExecutionCount)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "deployment_timeouts_total"),
+					"Number of inference requests of the deployment on the node which timed out.",
+					nodeLabels, nil,
+				),
+				Value: func(node trainedModelDeploymentNodeStats) float64 {
+					return float64(node.TimeoutCount)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, "deployment_pending_requests"),
+					"Number of inference requests of the deployment queued on the node.",
+					nodeLabels, nil,
+				),
+				Value: func(node trainedModelDeploymentNodeStats) float64 {
+					return float64(node.NumberOfPendingRequests)
+				},
+			},
+		},
+	}
+}
+
+// Describe add ML metrics descriptions
+func (m *ML) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.inferences
+	ch <- m.inferenceFailures
+	ch <- m.pipelines
+	ch <- m.deploymentState
+	ch <- m.allocations
+	ch <- m.targetAllocations
+	for _, metric := range m.nodeMetrics {
+		ch <- metric.Desc
+	}
+	ch <- m.up
+	ch <- m.totalScrapes.Desc()
+	ch <- m.jsonParseFailures.Desc()
+}
+
+func (m *ML) fetchAndDecodeTrainedModelsStats(ctx context.Context) (trainedModelsStatsResponse, error) {
+	var tmr trainedModelsStatsResponse
+
+	u := *m.url
+	u.Path = path.Join(u.Path, "/_ml/trained_models/_stats")
+	// the API returns 100 models by default
+	u.RawQuery = "size=10000"
+	res, err := get(ctx, m.client, u.String())
+	if err != nil {
+		return tmr, fmt.Errorf("failed to get trained models stats from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(m.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return tmr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := m.decodeJSON(m.logger, res.Body, "ml", &tmr); err != nil {
+		m.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("ml").Inc()
+		return tmr, err
+	}
+	return tmr, nil
+}
+
+// Collect gets ML metric values
+func (m *ML) Collect(ch chan<- prometheus.Metric) {
+	_ = m.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects ML metrics, aborting the request to Elasticsearch
+// once ctx is done. It returns the error of the scrape. The deployment
+// metrics are omitted for models which aren't deployed.
+func (m *ML) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	m.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(m.up, prometheus.GaugeValue, up)
+		ch <- m.totalScrapes
+		ch <- m.jsonParseFailures
+	}()
+
+	tmr, err := m.fetchAndDecodeTrainedModelsStats(ctx)
+	if err != nil {
+		_ = level.Warn(m.logger).Log(
+			"msg", "failed to fetch and decode trained models stats",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	for _, model := range tmr.TrainedModelStats {
+		ch <- prometheus.MustNewConstMetric(m.pipelines, prometheus.GaugeValue, float64(model.PipelineCount), model.ModelID)
+		if stats := model.InferenceStats; stats != nil {
+			ch <- prometheus.MustNewConstMetric(m.inferences, prometheus.CounterValue, float64(stats.InferenceCount), model.ModelID)
+			ch <- prometheus.MustNewConstMetric(m.inferenceFailures, prometheus.CounterValue, float64(stats.FailureCount), model.ModelID)
+		}
+
+		deployment := model.DeploymentStats
+		if deployment == nil {
+			continue
+		}
+		for _, state := range deploymentStates {
+			var value float64
+			if deployment.State == state {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(m.deploymentState, prometheus.GaugeValue, value, model.ModelID, deployment.DeploymentID, state)
+		}
+		ch <- prometheus.MustNewConstMetric(m.allocations, prometheus.GaugeValue,
+			float64(deployment.AllocationStatus.AllocationCount), model.ModelID, deployment.DeploymentID)
+		ch <- prometheus.MustNewConstMetric(m.targetAllocations, prometheus.GaugeValue,
+			float64(deployment.AllocationStatus.TargetAllocationCount), model.ModelID, deployment.DeploymentID)
+		for _, node := range deployment.Nodes {
+			for _, n := range node.Node {
+				for _, metric := range m.nodeMetrics {
+					ch <- prometheus.MustNewConstMetric(metric.Desc, metric.Type, metric.Value(node), model.ModelID, deployment.DeploymentID, n.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package collector
+
+// trainedModelsStatsResponse is a representation of the Elasticsearch trained
+// models stats API
+type trainedModelsStatsResponse struct {
+	TrainedModelStats []trainedModelStats `json:"trained_model_stats"`
+}
+
+// trainedModelStats are the stats of a trained model, the deployment stats
+// are only reported for models deployed, e.g. for semantic search
+type trainedModelStats struct {
+	ModelID        string `json:"model_id"`
+	PipelineCount  int64  `json:"pipeline_count"`
+	InferenceStats *struct {
+		InferenceCount int64 `json:"inference_count"`
+		FailureCount   int64 `json:"failure_count"`
+	} `json:"inference_stats"`
+	DeploymentStats *trainedModelDeploymentStats `json:"deployment_stats"`
+}
+
+type trainedModelDeploymentStats struct {
+	DeploymentID     string `json:"deployment_id"`
+	State            string `json:"state"`
+	AllocationStatus struct {
+		AllocationCount       int64 `json:"allocation_count"`
+		TargetAllocationCount int64 `json:"target_allocation_count"`
+	} `json:"allocation_status"`
+	Nodes []trainedModelDeploymentNodeStats `json:"nodes"`
+}
+
+// trainedModelDeploymentNodeStats are the stats of the allocation of a
+// deployment on a node, the node is keyed by its id
+type trainedModelDeploymentNodeStats struct {
+	Node map[string]struct {
+		Name string `json:"name"`
+	} `json:"node"`
+	RoutingState struct {
+		RoutingState string `json:"routing_state"`
+	} `json:"routing_state"`
+	InferenceCount          int64   `json:"inference_count"`
+	AverageInferenceTime    float64 `json:"average_inference_time_ms"`
+	ErrorCount              int64   `json:"error_count"`
+	RejectedExecutionCount  int64   `json:"rejected_execution_count"`
+	TimeoutCount            int64   `json:"timeout_count"`
+	NumberOfPendingRequests int64   `json:"number_of_pending_requests"`
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestML(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_ml/trained_models/_stats" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprintln(w, `{"count":2,"trained_model_stats":[`+
+			`{"model_id":"lang_ident_model_1","pipeline_count":0,"inference_stats":{"failure_count":0,"inference_count":0,"cache_miss_count":0}},`+
+			`{"model_id":".elser_model_2","pipeline_count":1,"inference_stats":{"failure_count":3,"inference_count":120},`+
+			`"deployment_stats":{"deployment_id":"elser","model_id":".elser_model_2","state":"started",`+
+			`"allocation_status":{"allocation_count":1,"target_allocation_count":2,"state":"started"},`+
+			`"nodes":[{"node":{"sPa3OgxLSYGvQ4oPs-Tajw":{"name":"ml-1"}},"routing_state":{"routing_state":"started"},`+
+			`"inference_count":100,"average_inference_time_ms":25.5,"error_count":1,"rejected_execution_count":2,"timeout_count":0,"number_of_pending_requests":4}]}}]}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewML(log.NewNopLogger(), http.DefaultClient, u))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_ml_model_up":                                                             1,
+		"elasticsearch_ml_model_inferences_total lang_ident_model_1":                            0,
+		"elasticsearch_ml_model_inferences_total .elser_model_2":                                120,
+		"elasticsearch_ml_model_inference_failures_total .elser_model_2":                        3,
+		"elasticsearch_ml_model_pipelines .elser_model_2":                                       1,
+		"elasticsearch_ml_model_deployment_state elser .elser_model_2 started":                  1,
+		"elasticsearch_ml_model_deployment_state elser .elser_model_2 failed":                   0,
+		"elasticsearch_ml_model_deployment_allocations elser .elser_model_2":                    1,
+		"elasticsearch_ml_model_deployment_target_allocations elser .elser_model_2":             2,
+		"elasticsearch_ml_model_deployment_inferences_total elser .elser_model_2 ml-1":          100,
+		"elasticsearch_ml_model_deployment_average_inference_seconds elser .elser_model_2 ml-1": 0.0255,
+		"elasticsearch_ml_model_deployment_errors_total elser .elser_model_2 ml-1":              1,
+		"elasticsearch_ml_model_deployment_rejected_total elser .elser_model_2 ml-1":            2,
+		"elasticsearch_ml_model_deployment_pending_requests elser .elser_model_2 ml-1":          4,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, got)
+		}
+	}
+	if _, ok := values["elasticsearch_ml_model_deployment_allocations lang_ident_model_1"]; ok {
+		t.Error("expected no deployment metrics for models which aren't deployed")
+	}
+}
@@ -1,17 +1,47 @@
 package collector
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/blang/semver"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// adaptNodeStats moves the stats Elasticsearch versions before 5.0 report
+// elsewhere to where the metrics read them
+func adaptNodeStats(node *NodeStatsNodeResponse) {
+	os := node.OS
+	if os == nil {
+		return
+	}
+	if len(os.LoadAvg) > 0 {
+		var load1 float64
+		var loads []float64
+		if err := json.Unmarshal(os.LoadAvg, &load1); err == nil {
+			os.CPU.LoadAvg.Load1 = load1
+		} else if err := json.Unmarshal(os.LoadAvg, &loads); err == nil && len(loads) == 3 {
+			os.CPU.LoadAvg = NodeStatsOSCPULoadResponse{Load1: loads[0], Load5: loads[1], Load15: loads[2]}
+		}
+	}
+	if os.CPUPercent != 0 {
+		os.CPU.Percent = os.CPUPercent
+	}
+}
+
 func getRoles(node NodeStatsNodeResponse) map[string]bool {
 	// default settings (2.x) and map, which roles to consider
 	roles := map[string]bool{
@@ -64,14 +94,20 @@ func createRoleMetric(role string) *nodeMetric {
 				cluster,
 				node.Host,
 				node.Name,
+				node.Name,
+				node.ID,
 			}
 		},
 	}
 }
 
+// The node labels identify the node across restarts: node_id is stable as
+// long as the data path is kept. node repeats the node name of name, as the
+// other collectors label the node, e.g. the shards and the desired balance,
+// to join their metrics with the node metrics on node.
 var (
-	defaultNodeLabels               = []string{"cluster", "host", "name", "es_master_node", "es_data_node", "es_ingest_node", "es_client_node"}
-	defaultRoleLabels               = []string{"cluster", "host", "name"}
+	defaultNodeLabels               = []string{"cluster", "host", "name", "es_master_node", "es_data_node", "es_ingest_node", "es_client_node", "node", "node_id"}
+	defaultRoleLabels               = []string{"cluster", "host", "name", "node", "node_id"}
 	defaultThreadPoolLabels         = append(defaultNodeLabels, "type")
 	defaultBreakerLabels            = append(defaultNodeLabels, "breaker")
 	defaultFilesystemDataLabels     = append(defaultNodeLabels, "mount", "path")
@@ -88,6 +124,8 @@ var (
 			fmt.Sprintf("%t", roles["data"]),
 			fmt.Sprintf("%t", roles["ingest"]),
 			fmt.Sprintf("%t", roles["client"]),
+			node.Name,
+			node.ID,
 		}
 	}
 	defaultThreadPoolLabelValues = func(cluster string, node NodeStatsNodeResponse, pool string) []string {
@@ -112,6 +150,53 @@ type nodeMetric struct {
 	Desc   *prometheus.Desc
 	Value  func(node NodeStatsNodeResponse) float64
 	Labels func(cluster string, node NodeStatsNodeResponse) []string
+	// Present reports whether the node reported the section of the metric
+	Present func(node NodeStatsNodeResponse) bool
+	// Versions are the Elasticsearch versions reporting the metric
+	Versions versionRange
+}
+
+// The sections of the node stats are omitted by nodes not reporting them,
+// e.g. depending on the version or the role of the node. Their metrics are
+// omitted as well rather than exported as zero then.
+func hasIndices(node NodeStatsNodeResponse) bool   { return node.Indices != nil }
+func hasOS(node NodeStatsNodeResponse) bool        { return node.OS != nil }
+func hasJVM(node NodeStatsNodeResponse) bool       { return node.JVM != nil }
+func hasProcess(node NodeStatsNodeResponse) bool   { return node.Process != nil }
+func hasTransport(node NodeStatsNodeResponse) bool { return node.Transport != nil }
+func hasShards(node NodeStatsNodeResponse) bool    { return node.Shards != nil }
+
+// holdsShards returns whether a node of the roles and attributes can hold
+// shards, i.e. has the data role or a data tier role. Nodes before 5.x don't
+// report their roles, they hold shards unless their data attribute is false.
+func holdsShards(roles []string, attributes map[string]string) bool {
+	if len(roles) == 0 {
+		return attributes["data"] != "false"
+	}
+	for _, role := range roles {
+		if role == "data" || strings.HasPrefix(role, "data_") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPool returns whether the node reported the JVM memory pool, which
+// depends on its garbage collector
+func hasPool(pool string) func(node NodeStatsNodeResponse) bool {
+	return func(node NodeStatsNodeResponse) bool {
+		if node.JVM == nil {
+			return false
+		}
+		_, ok := node.JVM.Mem.Pools[pool]
+		return ok
+	}
+}
+
+// hasOldPool reports whether the node reported the old generation pool with
+// its maximum size
+func hasOldPool(node NodeStatsNodeResponse) bool {
+	return node.JVM != nil && node.JVM.Mem.Pools["old"].Max > 0
 }
 
 type gcCollectionMetric struct {
@@ -122,10 +207,19 @@ type gcCollectionMetric struct {
 }
 
 type breakerMetric struct {
-	Type   prometheus.ValueType
-	Desc   *prometheus.Desc
-	Value  func(breakerStats NodeStatsBreakersResponse) float64
-	Labels func(cluster string, node NodeStatsNodeResponse, breaker string) []string
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(breakerStats NodeStatsBreakersResponse) float64
+	// Present reports whether the metric applies to the breaker, it always
+	// does if nil
+	Present func(breakerStats NodeStatsBreakersResponse) bool
+	Labels  func(cluster string, node NodeStatsNodeResponse, breaker string) []string
+}
+
+type nodeRepositoryMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(repositoryStats NodeStatsRepositoryResponse) float64
 }
 
 type threadPoolMetric struct {
@@ -149,16 +243,132 @@ type filesystemIODeviceMetric struct {
 	Labels func(cluster string, node NodeStatsNodeResponse, device string) []string
 }
 
+// latencyMetric is the average latency of an operation between two scrapes,
+// derived from the time spent on the operation and the number of operations
+type latencyMetric struct {
+	Desc *prometheus.Desc
+	// Value returns the total time in milliseconds and the total number of
+	// operations
+	Value func(indices *NodeStatsIndicesResponse) (millis, count int64)
+}
+
+// latencyTotals are the totals of the latency metrics of a node at the
+// previous scrape
+type latencyTotals [][2]int64
+
+// hotSpotTotals are the totals of the operations of a node at the previous
+// scrape, by the node timestamp in milliseconds
+type hotSpotTotals struct {
+	timestamp, indexing, search int64
+}
+
+// gcPauseBuckets are the upper bounds of the buckets of the GC pause histogram
+var gcPauseBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// gcPauses approximates the histogram of the pauses of a garbage collector of
+// a node. Elasticsearch only reports the totals of the runs, so all runs
+// between two scrapes are counted with their average duration.
+type gcPauses struct {
+	// lastCount and lastMillis are the totals at the previous scrape
+	lastCount, lastMillis int64
+	// lastDuration is the average duration of the runs between the latest
+	// two scrapes with runs
+	lastDuration float64
+	count        uint64
+	sum          float64
+	buckets      []uint64
+}
+
+// observe adds the runs since the previous scrape given the current totals
+func (p *gcPauses) observe(count, millis int64) {
+	dCount, dMillis := count-p.lastCount, millis-p.lastMillis
+	p.lastCount, p.lastMillis = count, millis
+	// the totals are reset by restarts of the node
+	if dCount <= 0 || dMillis < 0 {
+		return
+	}
+	p.lastDuration = float64(dMillis) / float64(dCount) / 1000
+	p.count += uint64(dCount)
+	p.sum += float64(dMillis) / 1000
+	for i, bound := range gcPauseBuckets {
+		if p.lastDuration <= bound {
+			p.buckets[i] += uint64(dCount)
+		}
+	}
+}
+
+// histogram returns the cumulative counts of the buckets by upper bound
+func (p *gcPauses) histogram() map[float64]uint64 {
+	buckets := make(map[float64]uint64, len(gcPauseBuckets))
+	for i, bound := range gcPauseBuckets {
+		buckets[bound] = p.buckets[i]
+	}
+	return buckets
+}
+
+// transportHistogram converts a transport handling time histogram to the
+// cumulative buckets of a Prometheus histogram by upper bound in seconds.
+// Elasticsearch doesn't report the sum, it's approximated by the middle of
+// the buckets.
+func transportHistogram(buckets []NodeStatsTransportHistogramBucket) (count uint64, sum float64, cumulative map[float64]uint64) {
+	cumulative = make(map[float64]uint64, len(buckets))
+	for _, b := range buckets {
+		var lower float64
+		if b.GeMillis != nil {
+			lower = float64(*b.GeMillis)
+		}
+		count += b.Count
+		if b.LtMillis == nil {
+			// the last bucket is the +Inf bucket of Prometheus
+			sum += float64(b.Count) * lower / 1000
+			continue
+		}
+		upper := float64(*b.LtMillis)
+		sum += float64(b.Count) * (lower + upper) / 2 / 1000
+		cumulative[upper/1000] = count
+	}
+	return count, sum, cumulative
+}
+
 // Nodes information struct
 type Nodes struct {
 	logger log.Logger
 	client *http.Client
 	url    *url.URL
-	all    bool
-	node   string
+	decoder
+	all   bool
+	node  string
+	sniff bool
+	// shard restricts the nodes of es.all and es.sniff to those assigned to
+	// this replica, nil exports all nodes
+	shard *ScrapeShard
+	// sections are the sections of the node stats requested, see
+	// requestedSections
+	sections []string
+
+	clusterInfoCh   chan *clusterinfo.Response
+	clusterInfoOnce sync.Once
+	// version is the version of Elasticsearch, nil until it is known
+	version    *semver.Version
+	versionMtx sync.RWMutex
+	// withoutShards is whether the single node scraped without es.all holds
+	// no shards, as of the previous scrape
+	withoutShards    bool
+	withoutShardsMtx sync.Mutex
+	// forbidden are the sections of the node stats rejected with status 403,
+	// which aren't requested again until nodeStatsForbiddenRetry passed
+	// since forbiddenSince
+	forbidden      map[string]bool
+	forbiddenSince time.Time
+	forbiddenMtx   sync.Mutex
 
-	up                              prometheus.Gauge
+	up                              *prometheus.Desc
 	totalScrapes, jsonParseFailures prometheus.Counter
+	// sectionForbidden reports the sections of the node stats rejected with
+	// status 403, the others are still exported
+	sectionForbidden *prometheus.Desc
+	// sniffFailedNodes reports the sniffed nodes whose stats are missing
+	sniffFailedNodes *prometheus.Desc
 
 	nodeMetrics               []*nodeMetric
 	gcCollectionMetrics       []*gcCollectionMetric
@@ -166,21 +376,162 @@ type Nodes struct {
 	threadPoolMetrics         []*threadPoolMetric
 	filesystemDataMetrics     []*filesystemDataMetric
 	filesystemIODeviceMetrics []*filesystemIODeviceMetric
+	repositoryMetrics         []*nodeRepositoryMetric
+	// transport handling time histograms, they aren't nodeMetrics as they
+	// aren't single values
+	transportInboundHandlingTime, transportOutboundHandlingTime *prometheus.Desc
+	// cluster state application and update timings
+	clusterApplierExecutions, clusterApplierExecutionSeconds *prometheus.Desc
+	clusterStateUpdates, clusterStateUpdateSeconds           *prometheus.Desc
+	// requests rejected by the thread pools and the indexing pressure
+	rejections *prometheus.Desc
+	// data distribution by data tier, aggregated over the nodes
+	tierNodes, tierShards, tierStoreSize        *prometheus.Desc
+	tierFilesystemSize, tierFilesystemAvailable *prometheus.Desc
+
+	// latencies enables the latency metrics, which compare the totals of
+	// every node to those of the previous scrape
+	latencies      bool
+	latencyMetrics []*latencyMetric
+	lastTotals     map[string]latencyTotals
+	// gcPauses are the GC pauses of every node and collector, keyed by node
+	// ID and collector
+	gcPauses                   map[[2]string]*gcPauses
+	gcLastDuration, gcPauseSec *prometheus.Desc
+	// hotSpots enables the imbalance ratios, which compare the rates of
+	// every node between scrapes to the mean of the nodes holding shards
+	hotSpots          bool
+	lastHotSpotTotals map[string]hotSpotTotals
+	imbalanceRatio    *prometheus.Desc
+	lastTotalsMtx     sync.Mutex
+	// shardsPerNode enables the number of shards of every node and data
+	// tier, requested from the cat allocation API
+	shardsPerNode bool
 }
 
-// NewNodes defines Nodes Prometheus metrics
-func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, node string) *Nodes {
+// NewNodes defines Nodes Prometheus metrics. In sniff mode the nodes of the
+// cluster are discovered via the /_nodes/http endpoint and the stats of every
+// node are fetched from the node itself, all and node are ignored then.
+// latencies exports the average latencies of operations between scrapes for
+// consumers not able to divide rates themselves. hotSpots exports the ratios
+// of the rates and the store size of every node to the mean of the nodes
+// holding shards. Only the given sections of the node stats are requested,
+// all if sections is empty.
+func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, node string, sniff bool, latencies bool, hotSpots bool, sections []string) *Nodes {
+	if len(sections) == 0 {
+		sections = nodeStatsSections
+	}
 	return &Nodes{
-		logger: logger,
-		client: client,
-		url:    url,
-		all:    all,
-		node:   node,
-
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "node_stats", "up"),
-			Help: "Was the last scrape of the ElasticSearch nodes endpoint successful.",
-		}),
+		logger:     logger,
+		client:     client,
+		url:        url,
+		all:        all,
+		node:       node,
+		sniff:      sniff,
+		sections:   sections,
+		latencies:  latencies,
+		lastTotals: map[string]latencyTotals{},
+		gcPauses:   map[[2]string]*gcPauses{},
+
+		hotSpots:          hotSpots,
+		lastHotSpotTotals: map[string]hotSpotTotals{},
+		imbalanceRatio: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "node", "imbalance_ratio"),
+			"Ratio of the indexing and search rates between the latest two scrapes and of the store size of the node to the mean of the nodes holding shards",
+			append(defaultNodeLabels, "resource"), nil,
+		),
+
+		gcLastDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jvm_gc", "last_duration_seconds"),
+			"Average duration of the GC runs between the latest two scrapes with runs",
+			append(defaultNodeLabels, "gc"), nil,
+		),
+		gcPauseSec: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jvm_gc", "pause_seconds"),
+			"Approximate histogram of the GC pauses, the runs between two scrapes are counted with their average duration",
+			append(defaultNodeLabels, "gc"), nil,
+		),
+
+		transportInboundHandlingTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "transport", "inbound_handling_time_seconds"),
+			"Histogram of the time spent handling inbound transport messages, the sum is approximated",
+			defaultNodeLabels, nil,
+		),
+		transportOutboundHandlingTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "transport", "outbound_handling_time_seconds"),
+			"Histogram of the time spent sending outbound transport messages, the sum is approximated",
+			defaultNodeLabels, nil,
+		),
+
+		clusterApplierExecutions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cluster_applier", "executions_total"),
+			"Number of executions of the actions applying cluster states",
+			append(defaultNodeLabels, "action"), nil,
+		),
+		clusterApplierExecutionSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cluster_applier", "execution_seconds_total"),
+			"Time spent by the actions applying cluster states",
+			append(defaultNodeLabels, "action"), nil,
+		),
+		clusterStateUpdates: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cluster_state_update", "total"),
+			"Number of cluster state updates computed by the master service by outcome",
+			append(defaultNodeLabels, "outcome"), nil,
+		),
+		clusterStateUpdateSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cluster_state_update", "seconds_total"),
+			"Time spent by the master service on the phases of cluster state updates by outcome",
+			append(defaultNodeLabels, "outcome", "phase"), nil,
+		),
+		rejections: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "rejections_total"),
+			"Requests rejected by the node with 429 Too Many Requests by operation and stage",
+			append(defaultNodeLabels, "operation", "stage"), nil,
+		),
+
+		tierNodes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tier", "nodes"),
+			"Number of nodes of the data tier",
+			[]string{"cluster", "tier"}, nil,
+		),
+		tierShards: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tier", "shards"),
+			"Number of shards allocated to the nodes of the data tier",
+			[]string{"cluster", "tier"}, nil,
+		),
+		tierStoreSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tier", "store_size_bytes"),
+			"Size of the shards stored on the nodes of the data tier",
+			[]string{"cluster", "tier"}, nil,
+		),
+		tierFilesystemSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tier", "filesystem_size_bytes"),
+			"Size of the data paths of the nodes of the data tier",
+			[]string{"cluster", "tier"}, nil,
+		),
+		tierFilesystemAvailable: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tier", "filesystem_available_bytes"),
+			"Available space on the data paths of the nodes of the data tier",
+			[]string{"cluster", "tier"}, nil,
+		),
+
+		clusterInfoCh: make(chan *clusterinfo.Response),
+
+		sectionForbidden: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "node_stats", "section_forbidden"),
+			"Whether the section of the node stats was rejected with status 403 and its metrics are missing",
+			[]string{"section"}, nil,
+		),
+		sniffFailedNodes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "node_stats", "sniff_failed_nodes"),
+			"Number of sniffed nodes whose stats couldn't be fetched by the last scrape",
+			nil, nil,
+		),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "node_stats", "up"),
+			"Was the last scrape of the ElasticSearch nodes endpoint successful.",
+			nil, nil,
+		),
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: prometheus.BuildFQName(namespace, "node_stats", "total_scrapes"),
 			Help: "Current total ElasticSearch node scrapes.",
@@ -191,6 +542,19 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 		}),
 
 		nodeMetrics: []*nodeMetric{
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "node", "shards_total"),
+					"Number of shards allocated to the node",
+					defaultNodeLabels, nil,
+				),
+				Value: func(node NodeStatsNodeResponse) float64 {
+					return float64(*node.Shards)
+				},
+				Present: hasShards,
+				Labels:  defaultNodeLabelValues,
+			},
 			{
 				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
@@ -201,7 +565,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return node.OS.CPU.LoadAvg.Load1
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasOS,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -213,7 +578,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return node.OS.CPU.LoadAvg.Load5
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasOS,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -225,7 +591,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return node.OS.CPU.LoadAvg.Load15
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasOS,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -237,7 +604,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.OS.CPU.Percent)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasOS,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -249,7 +617,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.OS.Mem.Free)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasOS,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -261,7 +630,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.OS.Mem.Used)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasOS,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -273,7 +643,9 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.OS.Mem.ActualFree)
 				},
-				Labels: defaultNodeLabelValues,
+				Present:  hasOS,
+				Labels:   defaultNodeLabelValues,
+				Versions: versionRange{Until: "2.0.0"},
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -285,7 +657,9 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.OS.Mem.ActualUsed)
 				},
-				Labels: defaultNodeLabelValues,
+				Present:  hasOS,
+				Labels:   defaultNodeLabelValues,
+				Versions: versionRange{Until: "2.0.0"},
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -297,7 +671,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.FieldData.MemorySize)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -309,10 +684,11 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.FieldData.Evictions)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "indices", "completion_size_in_bytes"),
 					"Completion in bytes",
@@ -321,7 +697,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Completion.Size)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -333,7 +710,9 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.FilterCache.MemorySize)
 				},
-				Labels: defaultNodeLabelValues,
+				Present:  hasIndices,
+				Labels:   defaultNodeLabelValues,
+				Versions: versionRange{Until: "2.0.0"},
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -345,7 +724,9 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.FilterCache.Evictions)
 				},
-				Labels: defaultNodeLabelValues,
+				Present:  hasIndices,
+				Labels:   defaultNodeLabelValues,
+				Versions: versionRange{Until: "2.0.0"},
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -357,7 +738,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.QueryCache.MemorySize)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -369,7 +751,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.QueryCache.Evictions)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -381,7 +764,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.QueryCache.TotalCount)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -393,7 +777,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.QueryCache.CacheSize)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -405,7 +790,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.QueryCache.CacheCount)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -417,7 +803,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.QueryCache.HitCount)
 				},
-				Labels: defaultCacheHitLabelValues,
+				Present: hasIndices,
+				Labels:  defaultCacheHitLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -429,7 +816,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.QueryCache.MissCount)
 				},
-				Labels: defaultCacheMissLabelValues,
+				Present: hasIndices,
+				Labels:  defaultCacheMissLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -441,7 +829,9 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.RequestCache.MemorySize)
 				},
-				Labels: defaultNodeLabelValues,
+				Present:  hasIndices,
+				Labels:   defaultNodeLabelValues,
+				Versions: versionRange{Since: "2.0.0"},
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -453,7 +843,9 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.RequestCache.Evictions)
 				},
-				Labels: defaultNodeLabelValues,
+				Present:  hasIndices,
+				Labels:   defaultNodeLabelValues,
+				Versions: versionRange{Since: "2.0.0"},
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -465,7 +857,9 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.RequestCache.HitCount)
 				},
-				Labels: defaultCacheHitLabelValues,
+				Present:  hasIndices,
+				Labels:   defaultCacheHitLabelValues,
+				Versions: versionRange{Since: "2.0.0"},
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -477,10 +871,12 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.RequestCache.MissCount)
 				},
-				Labels: defaultCacheMissLabelValues,
+				Present:  hasIndices,
+				Labels:   defaultCacheMissLabelValues,
+				Versions: versionRange{Since: "2.0.0"},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "indices", "translog_operations"),
 					"Total translog operations",
@@ -489,10 +885,11 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Translog.Operations)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "indices", "translog_size_in_bytes"),
 					"Total translog size in bytes",
@@ -501,7 +898,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Translog.Size)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -513,7 +911,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Get.Time) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -525,7 +924,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Get.Total)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -537,7 +937,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Get.MissingTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -549,7 +950,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Get.MissingTotal)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -561,7 +963,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Get.ExistsTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -573,7 +976,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Get.ExistsTotal)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -585,7 +989,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Refresh.TotalTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -597,7 +1002,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Refresh.Total)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -609,7 +1015,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Search.QueryTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -621,7 +1028,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Search.QueryTotal)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -633,7 +1041,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Search.FetchTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -645,7 +1054,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Search.FetchTotal)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -657,7 +1067,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Search.SuggestTotal)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -669,7 +1080,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Search.SuggestTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -681,7 +1093,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Search.ScrollTotal)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -693,7 +1106,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Search.ScrollTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -705,7 +1119,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Docs.Count)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -717,7 +1132,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Docs.Deleted)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -729,7 +1145,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Store.Size)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -741,7 +1158,9 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Store.ThrottleTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present:  hasIndices,
+				Labels:   defaultNodeLabelValues,
+				Versions: versionRange{Until: "6.0.0"},
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -753,7 +1172,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.Memory)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -765,7 +1185,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.Count)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -777,7 +1198,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.TermsMemory)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -789,7 +1211,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.IndexWriterMemory)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -801,7 +1224,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.NormsMemory)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -813,7 +1237,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.StoredFieldsMemory)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -825,7 +1250,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.DocValuesMemory)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -837,7 +1263,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.FixedBitSet)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -849,7 +1276,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.TermVectorsMemory)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -861,7 +1289,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.PointsMemory)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -873,7 +1302,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Segments.VersionMapMemory)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -885,7 +1315,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Flush.Total)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -897,7 +1328,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Flush.Time) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -909,7 +1341,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Warmer.Total)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -921,7 +1354,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Warmer.TotalTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -933,7 +1367,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Indexing.IndexTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -945,7 +1380,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Indexing.IndexTotal)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -957,7 +1393,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Indexing.DeleteTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -969,7 +1406,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Indexing.DeleteTotal)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -984,7 +1422,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 					}
 					return 0
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -996,7 +1435,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Indexing.ThrottleTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -1008,7 +1448,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Merges.Total)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1020,7 +1461,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Merges.Current)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1032,7 +1474,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Merges.CurrentSize)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -1044,7 +1487,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Merges.TotalDocs)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -1056,7 +1500,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Merges.TotalSize)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -1068,7 +1513,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Merges.TotalTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -1080,7 +1526,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.Merges.TotalThrottledTime) / 1000
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasIndices,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1092,6 +1539,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.HeapUsed)
 				},
+				Present: hasJVM,
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "heap")
 				},
@@ -1106,6 +1554,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.NonHeapUsed)
 				},
+				Present: hasJVM,
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "non-heap")
 				},
@@ -1120,10 +1569,38 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.HeapMax)
 				},
+				Present: hasJVM,
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "heap")
 				},
 			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "jvm_mem", "heap_used_percent"),
+					"JVM heap currently used in percent of the maximum heap",
+					defaultNodeLabels, nil,
+				),
+				Value: func(node NodeStatsNodeResponse) float64 {
+					return float64(node.JVM.Mem.HeapUsedPercent)
+				},
+				Present: hasJVM,
+				Labels:  defaultNodeLabelValues,
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "jvm_mem", "old_used_percent"),
+					"JVM old generation pool currently used in percent of its maximum, full GCs run as it fills up",
+					defaultNodeLabels, nil,
+				),
+				Value: func(node NodeStatsNodeResponse) float64 {
+					old := node.JVM.Mem.Pools["old"]
+					return float64(old.Used) / float64(old.Max) * 100
+				},
+				Present: hasOldPool,
+				Labels:  defaultNodeLabelValues,
+			},
 			{
 				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
@@ -1134,6 +1611,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.HeapCommitted)
 				},
+				Present: hasJVM,
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "heap")
 				},
@@ -1148,6 +1626,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.NonHeapCommitted)
 				},
+				Present: hasJVM,
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "non-heap")
 				},
@@ -1162,12 +1641,13 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["young"].Used)
 				},
+				Present: hasPool("young"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "young")
 				},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "jvm_memory_pool", "max_bytes"),
 					"JVM memory max by pool",
@@ -1176,12 +1656,13 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["young"].Max)
 				},
+				Present: hasPool("young"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "young")
 				},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "jvm_memory_pool", "peak_used_bytes"),
 					"JVM memory peak used by pool",
@@ -1190,12 +1671,13 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["young"].PeakUsed)
 				},
+				Present: hasPool("young"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "young")
 				},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "jvm_memory_pool", "peak_max_bytes"),
 					"JVM memory peak max by pool",
@@ -1204,6 +1686,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["young"].PeakMax)
 				},
+				Present: hasPool("young"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "young")
 				},
@@ -1218,12 +1701,13 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["survivor"].Used)
 				},
+				Present: hasPool("survivor"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "survivor")
 				},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "jvm_memory_pool", "max_bytes"),
 					"JVM memory max by pool",
@@ -1232,12 +1716,13 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["survivor"].Max)
 				},
+				Present: hasPool("survivor"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "survivor")
 				},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "jvm_memory_pool", "peak_used_bytes"),
 					"JVM memory peak used by pool",
@@ -1246,12 +1731,13 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["survivor"].PeakUsed)
 				},
+				Present: hasPool("survivor"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "survivor")
 				},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "jvm_memory_pool", "peak_max_bytes"),
 					"JVM memory peak max by pool",
@@ -1260,6 +1746,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["survivor"].PeakMax)
 				},
+				Present: hasPool("survivor"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "survivor")
 				},
@@ -1274,12 +1761,13 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["old"].Used)
 				},
+				Present: hasPool("old"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "old")
 				},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "jvm_memory_pool", "max_bytes"),
 					"JVM memory max by pool",
@@ -1288,12 +1776,13 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["old"].Max)
 				},
+				Present: hasPool("old"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "old")
 				},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "jvm_memory_pool", "peak_used_bytes"),
 					"JVM memory peak used by pool",
@@ -1302,12 +1791,13 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["old"].PeakUsed)
 				},
+				Present: hasPool("old"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "old")
 				},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "jvm_memory_pool", "peak_max_bytes"),
 					"JVM memory peak max by pool",
@@ -1316,6 +1806,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.Mem.Pools["old"].PeakMax)
 				},
+				Present: hasPool("old"),
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "old")
 				},
@@ -1330,6 +1821,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.BufferPools["direct"].Used)
 				},
+				Present: hasJVM,
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "direct")
 				},
@@ -1344,6 +1836,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.JVM.BufferPools["mapped"].Used)
 				},
+				Present: hasJVM,
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "mapped")
 				},
@@ -1358,7 +1851,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Process.CPU.Percent)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasProcess,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1370,7 +1864,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Process.Memory.Resident)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasProcess,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1382,7 +1877,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Process.Memory.Share)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasProcess,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1394,7 +1890,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Process.Memory.TotalVirtual)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasProcess,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1406,7 +1903,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Process.OpenFD)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasProcess,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1418,7 +1916,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Process.MaxFD)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasProcess,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -1430,6 +1929,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Process.CPU.Total) / 1000
 				},
+				Present: hasProcess,
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "total")
 				},
@@ -1444,6 +1944,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Process.CPU.Sys) / 1000
 				},
+				Present: hasProcess,
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "sys")
 				},
@@ -1458,6 +1959,7 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Process.CPU.User) / 1000
 				},
+				Present: hasProcess,
 				Labels: func(cluster string, node NodeStatsNodeResponse) []string {
 					return append(defaultNodeLabelValues(cluster, node), "user")
 				},
@@ -1472,7 +1974,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Transport.RxCount)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasTransport,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -1484,7 +1987,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Transport.RxSize)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasTransport,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -1496,7 +2000,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Transport.TxCount)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasTransport,
+				Labels:  defaultNodeLabelValues,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -1508,7 +2013,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Transport.TxSize)
 				},
-				Labels: defaultNodeLabelValues,
+				Present: hasTransport,
+				Labels:  defaultNodeLabelValues,
 			},
 		},
 		gcCollectionMetrics: []*gcCollectionMetric{
@@ -1585,7 +2091,25 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				},
 			},
 			{
-				Type: prometheus.CounterValue,
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "breakers", "used_percent"),
+					"Estimated size of breaker in percent of its limit. The parent breaker limits the sum of all breakers, on 7.x the real memory usage.",
+					defaultBreakerLabels, nil,
+				),
+				Value: func(breakerStats NodeStatsBreakersResponse) float64 {
+					return float64(breakerStats.EstimatedSize) / float64(breakerStats.LimitSize) * 100
+				},
+				Present: func(breakerStats NodeStatsBreakersResponse) bool {
+					// breakers without limit report -1 or 0
+					return breakerStats.LimitSize > 0
+				},
+				Labels: func(cluster string, node NodeStatsNodeResponse, breaker string) []string {
+					return append(defaultNodeLabelValues(cluster, node), breaker)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "breakers", "overhead"),
 					"Overhead of circuit breakers",
@@ -1599,6 +2123,63 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				},
 			},
 		},
+		repositoryMetrics: []*nodeRepositoryMetric{
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "repository", "shard_snapshots_started_total"),
+					"Number of shard snapshots started on the node by repository",
+					append(defaultNodeLabels, "repository"), nil,
+				),
+				Value: func(repositoryStats NodeStatsRepositoryResponse) float64 {
+					return float64(repositoryStats.ShardSnapshotsStarted)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "repository", "shard_snapshots_completed_total"),
+					"Number of shard snapshots completed on the node by repository",
+					append(defaultNodeLabels, "repository"), nil,
+				),
+				Value: func(repositoryStats NodeStatsRepositoryResponse) float64 {
+					return float64(repositoryStats.ShardSnapshotsCompleted)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "repository", "shard_snapshots_in_progress"),
+					"Number of shard snapshots in progress on the node by repository",
+					append(defaultNodeLabels, "repository"), nil,
+				),
+				Value: func(repositoryStats NodeStatsRepositoryResponse) float64 {
+					return float64(repositoryStats.ShardSnapshotsInProgress)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "repository", "read_throttled_seconds_total"),
+					"Time reads from the repository, e.g. by restores, were throttled by max_restore_bytes_per_sec",
+					append(defaultNodeLabels, "repository"), nil,
+				),
+				Value: func(repositoryStats NodeStatsRepositoryResponse) float64 {
+					return float64(repositoryStats.TotalReadThrottledTimeNanos) / 1e9
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "repository", "write_throttled_seconds_total"),
+					"Time writes to the repository by snapshots were throttled by max_snapshot_bytes_per_sec",
+					append(defaultNodeLabels, "repository"), nil,
+				),
+				Value: func(repositoryStats NodeStatsRepositoryResponse) float64 {
+					return float64(repositoryStats.TotalWriteThrottledTimeNanos) / 1e9
+				},
+			},
+		},
 		threadPoolMetrics: []*threadPoolMetric{
 			{
 				Type: prometheus.CounterValue,
@@ -1773,6 +2354,78 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Labels: defaultFilesystemIODeviceLabelValues,
 			},
 		},
+		latencyMetrics: []*latencyMetric{
+			{
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices_indexing", "index_latency_seconds"),
+					"Average latency of indexing operations since the previous scrape",
+					defaultNodeLabels, nil,
+				),
+				Value: func(indices *NodeStatsIndicesResponse) (int64, int64) {
+					return indices.Indexing.IndexTime, indices.Indexing.IndexTotal
+				},
+			},
+			{
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices_indexing", "delete_latency_seconds"),
+					"Average latency of delete operations since the previous scrape",
+					defaultNodeLabels, nil,
+				),
+				Value: func(indices *NodeStatsIndicesResponse) (int64, int64) {
+					return indices.Indexing.DeleteTime, indices.Indexing.DeleteTotal
+				},
+			},
+			{
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices_search", "query_latency_seconds"),
+					"Average latency of search queries since the previous scrape",
+					defaultNodeLabels, nil,
+				),
+				Value: func(indices *NodeStatsIndicesResponse) (int64, int64) {
+					return indices.Search.QueryTime, indices.Search.QueryTotal
+				},
+			},
+			{
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices_search", "fetch_latency_seconds"),
+					"Average latency of search fetches since the previous scrape",
+					defaultNodeLabels, nil,
+				),
+				Value: func(indices *NodeStatsIndicesResponse) (int64, int64) {
+					return indices.Search.FetchTime, indices.Search.FetchTotal
+				},
+			},
+			{
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices_get", "latency_seconds"),
+					"Average latency of get operations since the previous scrape",
+					defaultNodeLabels, nil,
+				),
+				Value: func(indices *NodeStatsIndicesResponse) (int64, int64) {
+					return indices.Get.Time, indices.Get.Total
+				},
+			},
+			{
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices_refresh", "latency_seconds"),
+					"Average latency of refreshes since the previous scrape",
+					defaultNodeLabels, nil,
+				),
+				Value: func(indices *NodeStatsIndicesResponse) (int64, int64) {
+					return indices.Refresh.TotalTime, indices.Refresh.Total
+				},
+			},
+			{
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "indices_flush", "latency_seconds"),
+					"Average latency of flushes since the previous scrape",
+					defaultNodeLabels, nil,
+				),
+				Value: func(indices *NodeStatsIndicesResponse) (int64, int64) {
+					return indices.Flush.Time, indices.Flush.Total
+				},
+			},
+		},
 	}
 }
 
@@ -1784,6 +2437,12 @@ func (c *Nodes) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range c.gcCollectionMetrics {
 		ch <- metric.Desc
 	}
+	for _, metric := range c.breakerMetrics {
+		ch <- metric.Desc
+	}
+	for _, metric := range c.repositoryMetrics {
+		ch <- metric.Desc
+	}
 	for _, metric := range c.threadPoolMetrics {
 		ch <- metric.Desc
 	}
@@ -1793,25 +2452,402 @@ func (c *Nodes) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range c.filesystemIODeviceMetrics {
 		ch <- metric.Desc
 	}
-	ch <- c.up.Desc()
+	for _, metric := range c.latencyMetrics {
+		ch <- metric.Desc
+	}
+	ch <- c.gcLastDuration
+	ch <- c.gcPauseSec
+	ch <- c.transportInboundHandlingTime
+	ch <- c.transportOutboundHandlingTime
+	ch <- c.clusterApplierExecutions
+	ch <- c.clusterApplierExecutionSeconds
+	ch <- c.clusterStateUpdates
+	ch <- c.clusterStateUpdateSeconds
+	ch <- c.rejections
+	ch <- c.tierNodes
+	ch <- c.tierShards
+	ch <- c.tierStoreSize
+	ch <- c.tierFilesystemSize
+	ch <- c.tierFilesystemAvailable
+	ch <- c.imbalanceRatio
+	ch <- c.sectionForbidden
+	ch <- c.sniffFailedNodes
+	ch <- c.up
 	ch <- c.totalScrapes.Desc()
 	ch <- c.jsonParseFailures.Desc()
 }
 
-func (c *Nodes) fetchAndDecodeNodeStats() (nodeStatsResponse, error) {
-	var nsr nodeStatsResponse
+// nodeStatsSections are the sections of the node stats the collector
+// exports, requesting only these spares Elasticsearch collecting the others
+var nodeStatsSections = []string{"indices", "os", "fs", "thread_pool", "jvm", "breaker", "http", "transport", "process", "discovery", "repositories", "indexing_pressure"}
+
+// nodeStatsSectionVersions are the versions of Elasticsearch knowing the
+// sections added lately. Elasticsearch rejects requests for unknown sections,
+// so these are only requested once the version is known to support them.
+var nodeStatsSectionVersions = map[string]versionRange{
+	"repositories":      {Since: "8.13.0"},
+	"indexing_pressure": {Since: "7.9.0"},
+}
+
+// requestedSections returns the comma separated sections to request from
+// the version of Elasticsearch
+func (c *Nodes) requestedSections() string {
+	return c.nodeSections(true)
+}
+
+// nodeSections returns the comma separated sections to request from a node.
+// The indices section is skipped for nodes without shards, e.g. coordinating
+// only nodes, unless it's the only section. It's empty if none of the sections
+// is supported by the version of Elasticsearch, see checkSectionsSupported.
+func (c *Nodes) nodeSections(holdsShards bool) string {
+	version := c.esVersion()
+	sections := make([]string, 0, len(c.sections))
+	for _, section := range c.sections {
+		if versions, ok := nodeStatsSectionVersions[section]; ok && (version == nil || !versions.contains(version)) {
+			continue
+		}
+		sections = append(sections, section)
+	}
+	if !holdsShards && len(sections) > 1 {
+		for i, section := range sections {
+			if section == "indices" {
+				sections = append(sections[:i], sections[i+1:]...)
+				break
+			}
+		}
+	}
+	return strings.Join(sections, ",")
+}
+
+// checkSectionsSupported returns an error if none of the sections is
+// supported by the version of Elasticsearch, or the version isn't known yet,
+// as requesting no section requests all of them
+func (c *Nodes) checkSectionsSupported() error {
+	if c.requestedSections() != "" {
+		return nil
+	}
+	version := c.esVersion()
+	if version == nil {
+		return fmt.Errorf("node stats sections %s are only requested once the version of Elasticsearch is known", strings.Join(c.sections, ","))
+	}
+	return fmt.Errorf("node stats sections %s aren't supported by Elasticsearch %s", strings.Join(c.sections, ","), version)
+}
+
+// ParseNodeStatsSections parses a comma separated list of node stats
+// sections, e.g. "jvm,os". An empty list selects all sections.
+func ParseNodeStatsSections(s string) ([]string, error) {
+	var sections []string
+	for _, section := range strings.Split(s, ",") {
+		section = strings.TrimSpace(section)
+		if section == "" {
+			continue
+		}
+		sections = append(sections, section)
+	}
+	return sections, checkNodeStatsSections(sections)
+}
+
+// checkNodeStatsSections returns an error for sections not exported by the
+// collector
+func checkNodeStatsSections(sections []string) error {
+	for _, section := range sections {
+		known := false
+		for _, s := range nodeStatsSections {
+			known = known || s == section
+		}
+		if !known {
+			return fmt.Errorf("unknown node stats section %q, expected one of %s", section, strings.Join(nodeStatsSections, ","))
+		}
+	}
+	return nil
+}
+
+// errNodeStatsForbidden is returned for node stats requests rejected with
+// status 403, e.g. due to the scope of an API key
+var errNodeStatsForbidden = errors.New("HTTP Request failed with code 403")
+
+// nodeStatsForbiddenRetry is the interval at which the sections of the node
+// stats rejected with status 403 are requested again, e.g. after the scope of
+// the API key was widened
+const nodeStatsForbiddenRetry = 10 * time.Minute
+
+// sniffConcurrency is the number of sniffed nodes whose stats are fetched at
+// once
+const sniffConcurrency = 8
+
+func (c *Nodes) fetchAndDecodeNodeStats(ctx context.Context) (nodeStatsResponse, error) {
+	if err := c.checkSectionsSupported(); err != nil {
+		return nodeStatsResponse{}, err
+	}
+	if c.sniff {
+		return c.sniffNodeStats(ctx)
+	}
 
 	u := *c.url
 
-	if c.all {
+	var sections string
+	if c.all && c.shard != nil {
+		// only the nodes of the replica are requested, dividing the load of
+		// the node stats among the replicas
+		ids, err := c.ownedNodes(ctx)
+		if err != nil {
+			return nodeStatsResponse{}, err
+		}
+		if len(ids) == 0 {
+			return nodeStatsResponse{Nodes: map[string]NodeStatsNodeResponse{}}, nil
+		}
+		u.Path = path.Join(u.Path, "_nodes", strings.Join(ids, ","), "stats")
+		sections = c.requestedSections()
+	} else if c.all {
 		u.Path = path.Join(u.Path, "/_nodes/stats")
+		sections = c.requestedSections()
 	} else {
+		c.withoutShardsMtx.Lock()
+		withoutShards := c.withoutShards
+		c.withoutShardsMtx.Unlock()
 		u.Path = path.Join(u.Path, "_nodes", c.node, "stats")
+		sections = c.nodeSections(!withoutShards)
+	}
+	base := u.Path
+
+	// the sections rejected by a previous scrape aren't requested again, the
+	// others are requested at once
+	forbidden := c.forbiddenSections()
+	var permitted []string
+	if sections != "" {
+		for _, section := range strings.Split(sections, ",") {
+			if !forbidden[section] {
+				permitted = append(permitted, section)
+			}
+		}
+	}
+
+	var nsr nodeStatsResponse
+	var err error
+	if sections != "" && len(permitted) == 0 {
+		err = errNodeStatsForbidden
+	} else {
+		u.Path = path.Join(base, strings.Join(permitted, ","))
+		err = c.getAndParseURL(ctx, &u, &nsr)
+		if err == errNodeStatsForbidden {
+			// API keys of narrow scopes may still access single sections
+			nsr, err = c.fetchNodeStatsSections(ctx, base, strings.Join(permitted, ","))
+			if err == nil || err == errNodeStatsForbidden {
+				for section := range forbidden {
+					nsr.forbidden[section] = true
+				}
+				c.setForbiddenSections(nsr.forbidden)
+			}
+		}
+	}
+	if sections != "" {
+		nsr.sections = strings.Split(sections, ",")
+	}
+	if len(forbidden) > 0 && nsr.forbidden == nil {
+		nsr.forbidden = forbidden
+	}
+	if err == nil && c.all {
+		for id := range nsr.Nodes {
+			if !c.shard.Owns(id) {
+				delete(nsr.Nodes, id)
+			}
+		}
+	}
+	if err == nil && !c.all && len(nsr.Nodes) == 1 {
+		for _, node := range nsr.Nodes {
+			c.withoutShardsMtx.Lock()
+			c.withoutShards = !holdsShards(node.Roles, node.Attributes)
+			c.withoutShardsMtx.Unlock()
+		}
+	}
+	return nsr, err
+}
+
+// ownedNodes returns the IDs of the nodes of the cluster assigned to the shard
+// of the replica
+func (c *Nodes) ownedNodes(ctx context.Context) ([]string, error) {
+	u := *c.url
+	u.Path = path.Join(u.Path, "/_nodes/http")
+	var nhr nodesHTTPResponse
+	if err := c.getAndParseURL(ctx, &u, &nhr); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for id := range nhr.Nodes {
+		if c.shard.Owns(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// fetchNodeStatsSections fetches the sections of the node stats one by one from
+// the endpoint at base and merges them. Sections rejected with status 403 are
+// skipped, the stats fail only if all of them are.
+func (c *Nodes) fetchNodeStatsSections(ctx context.Context, base string, sections string) (nodeStatsResponse, error) {
+	nsr := nodeStatsResponse{
+		Nodes:     map[string]NodeStatsNodeResponse{},
+		forbidden: map[string]bool{},
+	}
+	all := strings.Split(sections, ",")
+	for _, section := range all {
+		u := *c.url
+		u.Path = path.Join(base, section)
+		var r struct {
+			ClusterName string                     `json:"cluster_name"`
+			Nodes       map[string]json.RawMessage `json:"nodes"`
+		}
+		err := c.getAndParseURL(ctx, &u, &r)
+		if err == errNodeStatsForbidden {
+			nsr.forbidden[section] = true
+			continue
+		}
+		if err != nil {
+			return nsr, err
+		}
+		nsr.ClusterName = r.ClusterName
+		for id, raw := range r.Nodes {
+			// the sections of a node are decoded into the same struct
+			node := nsr.Nodes[id]
+			if err := json.Unmarshal(raw, &node); err != nil {
+				c.jsonParseFailures.Inc()
+				JSONParseFailures.WithLabelValues("nodes").Inc()
+				return nsr, err
+			}
+			nsr.Nodes[id] = node
+		}
+	}
+	if len(nsr.forbidden) == len(all) {
+		return nsr, errNodeStatsForbidden
+	}
+	forbidden := make([]string, 0, len(nsr.forbidden))
+	for _, section := range all {
+		if nsr.forbidden[section] {
+			forbidden = append(forbidden, section)
+		}
+	}
+	_ = level.Warn(c.logger).Log(
+		"msg", "node stats sections forbidden, exporting the others",
+		"sections", strings.Join(forbidden, ","),
+	)
+	return nsr, nil
+}
+
+// forbiddenSections returns the sections of the node stats rejected with
+// status 403 by a previous scrape, none once nodeStatsForbiddenRetry passed
+func (c *Nodes) forbiddenSections() map[string]bool {
+	c.forbiddenMtx.Lock()
+	defer c.forbiddenMtx.Unlock()
+	if len(c.forbidden) > 0 && time.Since(c.forbiddenSince) >= nodeStatsForbiddenRetry {
+		c.forbidden = nil
+	}
+	return c.forbidden
+}
+
+// setForbiddenSections remembers the sections of the node stats rejected
+// with status 403
+func (c *Nodes) setForbiddenSections(forbidden map[string]bool) {
+	c.forbiddenMtx.Lock()
+	defer c.forbiddenMtx.Unlock()
+	c.forbidden = forbidden
+	c.forbiddenSince = time.Now()
+}
+
+// fetchShardsPerNode returns the number of shards allocated to every node of
+// the cluster by node name
+func (c *Nodes) fetchShardsPerNode(ctx context.Context) (map[string]int64, error) {
+	u := *c.url
+	u.Path = path.Join(u.Path, "/_cat/allocation")
+	u.RawQuery = "format=json&h=node,shards"
+	var car catAllocationResponse
+	if err := c.getAndParseURL(ctx, &u, &car); err != nil {
+		return nil, err
 	}
+	shards := make(map[string]int64, len(car))
+	for _, allocation := range car {
+		n, err := strconv.ParseInt(allocation.Shards, 10, 64)
+		// unassigned shards are reported as node UNASSIGNED without node
+		// stats to attach them to
+		if err != nil {
+			continue
+		}
+		shards[allocation.Node] = n
+	}
+	return shards, nil
+}
+
+// sniffNodeStats discovers the nodes of the cluster and fetches the stats of
+// every node from the node itself. Nodes which can't be reached are skipped.
+func (c *Nodes) sniffNodeStats(ctx context.Context) (nodeStatsResponse, error) {
+	var nsr nodeStatsResponse
+
+	u := *c.url
+	u.Path = path.Join(u.Path, "/_nodes/http")
+	var nhr nodesHTTPResponse
+	if err := c.getAndParseURL(ctx, &u, &nhr); err != nil {
+		return nsr, err
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mtx  sync.Mutex
+		sema = make(chan struct{}, sniffConcurrency)
+	)
+	nsr.ClusterName = nhr.ClusterName
+	nsr.Nodes = make(map[string]NodeStatsNodeResponse, len(nhr.Nodes))
+	for id, node := range nhr.Nodes {
+		if !c.shard.Owns(id) {
+			continue
+		}
+		// the publish address is either <ip>:<port> or <hostname>/<ip>:<port>
+		address := node.HTTP.PublishAddress
+		if i := strings.LastIndex(address, "/"); i >= 0 {
+			address = address[i+1:]
+		}
+		if address == "" {
+			continue
+		}
+		nu := *c.url
+		nu.Host = address
+		nu.Path = path.Join(nu.Path, "/_nodes/_local/stats", c.nodeSections(holdsShards(node.Roles, node.Attributes)))
 
-	res, err := c.client.Get(u.String())
+		nsr.sniffed++
+		wg.Add(1)
+		go func(id string, nu url.URL) {
+			defer wg.Done()
+			sema <- struct{}{}
+			defer func() { <-sema }()
+			var r nodeStatsResponse
+			if err := c.getAndParseURL(ctx, &nu, &r); err != nil {
+				_ = level.Warn(c.logger).Log(
+					"msg", "failed to fetch node stats of sniffed node",
+					"node_id", id,
+					"err", err,
+				)
+				mtx.Lock()
+				nsr.sniffFailed++
+				mtx.Unlock()
+				return
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			for id, stats := range r.Nodes {
+				nsr.Nodes[id] = stats
+			}
+		}(id, nu)
+	}
+	wg.Wait()
+	if nsr.sniffed > 0 && nsr.sniffFailed == nsr.sniffed {
+		return nsr, fmt.Errorf("failed to fetch the node stats of all %d sniffed nodes", nsr.sniffed)
+	}
+	return nsr, nil
+}
+
+func (c *Nodes) getAndParseURL(ctx context.Context, u *url.URL, data interface{}) error {
+	res, err := get(ctx, c.client, u.String())
 	if err != nil {
-		return nsr, fmt.Errorf("failed to get cluster health from %s://%s:%s%s: %s",
+		return fmt.Errorf("failed to get node stats from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
 	}
 
@@ -1825,38 +2861,125 @@ func (c *Nodes) fetchAndDecodeNodeStats() (nodeStatsResponse, error) {
 		}
 	}()
 
+	if res.StatusCode == http.StatusForbidden {
+		return errNodeStatsForbidden
+	}
 	if res.StatusCode != http.StatusOK {
-		return nsr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&nsr); err != nil {
+	if err := c.decodeJSON(c.logger, res.Body, "nodes", data); err != nil {
 		c.jsonParseFailures.Inc()
-		return nsr, err
+		JSONParseFailures.WithLabelValues("nodes").Inc()
+		return err
 	}
-	return nsr, nil
+	return nil
 }
 
 // Collect gets nodes metric values
 func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
+	_ = c.CollectContext(context.Background(), ch)
+}
+
+// ClusterLabelUpdates returns a pointer to a channel to receive cluster info
+// updates, which carry the version of Elasticsearch. It implements the (not
+// exported) clusterinfo.consumer interface.
+func (c *Nodes) ClusterLabelUpdates() *chan *clusterinfo.Response {
+	c.clusterInfoOnce.Do(func() {
+		go func() {
+			for ci := range c.clusterInfoCh {
+				c.SetClusterInfo(ci)
+			}
+		}()
+	})
+	return &c.clusterInfoCh
+}
+
+// SetClusterInfo sets the cluster info the version of Elasticsearch is taken
+// from directly. It's an alternative to receiving updates from a
+// clusterinfo.Retriever. The stats of OpenSearch clusters are those of the
+// version of Elasticsearch OpenSearch was forked from.
+func (c *Nodes) SetClusterInfo(ci *clusterinfo.Response) {
+	if ci == nil {
+		return
+	}
+	version := ci.Version.CompatibleVersion()
+	c.versionMtx.Lock()
+	c.version = &version
+	c.versionMtx.Unlock()
+}
+
+// String implements the stringer interface. It is part of the clusterinfo.consumer interface
+func (c *Nodes) String() string {
+	return namespace + "nodes"
+}
+
+func (c *Nodes) esVersion() *semver.Version {
+	c.versionMtx.RLock()
+	defer c.versionMtx.RUnlock()
+	return c.version
+}
+
+// CollectContext collects Nodes metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape.
+func (c *Nodes) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
 	c.totalScrapes.Inc()
 	defer func() {
-		ch <- c.up
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up)
 		ch <- c.totalScrapes
 		ch <- c.jsonParseFailures
 	}()
 
-	nodeStatsResp, err := c.fetchAndDecodeNodeStats()
+	nodeStatsResp, err := c.fetchAndDecodeNodeStats(ctx)
 	if err != nil {
-		c.up.Set(0)
 		_ = level.Warn(c.logger).Log(
 			"msg", "failed to fetch and decode node stats",
 			"err", err,
 		)
-		return
+		return err
 	}
-	c.up.Set(1)
+	up = 1
+
+	for _, section := range nodeStatsResp.sections {
+		var forbidden float64
+		if nodeStatsResp.forbidden[section] {
+			forbidden = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.sectionForbidden, prometheus.GaugeValue, forbidden, section)
+	}
+	if c.sniff {
+		ch <- prometheus.MustNewConstMetric(c.sniffFailedNodes, prometheus.GaugeValue, float64(nodeStatsResp.sniffFailed))
+	}
+
+	for id, node := range nodeStatsResp.Nodes {
+		if node.Indices != nil && !holdsShards(node.Roles, node.Attributes) {
+			// the indices stats of nodes without shards are all zero
+			node.Indices = nil
+			nodeStatsResp.Nodes[id] = node
+		}
+	}
+
+	var shards map[string]int64
+	if c.shardsPerNode {
+		shards, err = c.fetchShardsPerNode(ctx)
+		if err != nil {
+			// the node stats are exported nevertheless
+			_ = level.Warn(c.logger).Log(
+				"msg", "failed to fetch the shards per node",
+				"err", err,
+			)
+		}
+	}
+
+	version := c.esVersion()
+	for id, node := range nodeStatsResp.Nodes {
+		node.ID = id
+		adaptNodeStats(&node)
+		if n, ok := shards[node.Name]; ok {
+			node.Shards = &n
+		}
 
-	for _, node := range nodeStatsResp.Nodes {
 		// Handle the node labels metric
 		roles := getRoles(node)
 
@@ -1873,6 +2996,9 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 		}
 
 		for _, metric := range c.nodeMetrics {
+			if !metric.Versions.contains(version) || !metric.Present(node) {
+				continue
+			}
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
@@ -1881,8 +3007,33 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 			)
 		}
 
+		// Transport handling time histograms
+		if node.Transport != nil {
+			for desc, buckets := range map[*prometheus.Desc][]NodeStatsTransportHistogramBucket{
+				c.transportInboundHandlingTime:  node.Transport.InboundHandlingTime,
+				c.transportOutboundHandlingTime: node.Transport.OutboundHandlingTime,
+			} {
+				if len(buckets) == 0 {
+					continue
+				}
+				count, sum, cumulative := transportHistogram(buckets)
+				ch <- prometheus.MustNewConstHistogram(desc, count, sum, cumulative,
+					defaultNodeLabelValues(nodeStatsResp.ClusterName, node)...)
+			}
+		}
+
+		if node.Discovery != nil {
+			c.collectDiscovery(ch, nodeStatsResp.ClusterName, node)
+		}
+
+		c.collectRejections(ch, nodeStatsResp.ClusterName, node)
+
 		// GC Stats
-		for collector, gcStats := range node.JVM.GC.Collectors {
+		var gcCollectors map[string]NodeStatsJVMGCCollectorResponse
+		if node.JVM != nil {
+			gcCollectors = node.JVM.GC.Collectors
+		}
+		for collector, gcStats := range gcCollectors {
 			for _, metric := range c.gcCollectionMetrics {
 				ch <- prometheus.MustNewConstMetric(
 					metric.Desc,
@@ -1893,9 +3044,12 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 			}
 		}
 
-		// Breaker stats
+		// Breaker stats, including the parent breaker
 		for breaker, bstats := range node.Breakers {
 			for _, metric := range c.breakerMetrics {
+				if metric.Present != nil && !metric.Present(bstats) {
+					continue
+				}
 				ch <- prometheus.MustNewConstMetric(
 					metric.Desc,
 					metric.Type,
@@ -1905,6 +3059,18 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 			}
 		}
 
+		// Snapshot repository stats
+		for repository, rstats := range node.Repositories {
+			for _, metric := range c.repositoryMetrics {
+				ch <- prometheus.MustNewConstMetric(
+					metric.Desc,
+					metric.Type,
+					metric.Value(rstats),
+					append(defaultNodeLabelValues(nodeStatsResp.ClusterName, node), repository)...,
+				)
+			}
+		}
+
 		// Thread Pool stats
 		for pool, pstats := range node.ThreadPool {
 			for _, metric := range c.threadPoolMetrics {
@@ -1917,6 +3083,10 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 			}
 		}
 
+		if node.FS == nil {
+			continue
+		}
+
 		// File System Data Stats
 		for _, fsDataStats := range node.FS.Data {
 			for _, metric := range c.filesystemDataMetrics {
@@ -1942,4 +3112,309 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 		}
 
 	}
+	// the tier totals of a single node would be wrong and clash with those
+	// of the exporters of the other nodes
+	if c.scrapesAllNodes() {
+		c.collectTiers(ch, nodeStatsResp, shards)
+	}
+
+	c.collectGCPauses(ch, nodeStatsResp)
+	if c.latencies {
+		c.collectLatencies(ch, nodeStatsResp)
+	}
+	if c.hotSpots && c.scrapesAllNodes() {
+		c.collectHotSpots(ch, nodeStatsResp)
+	}
+	return nil
+}
+
+// collectHotSpots sends the ratios of the indexing and search rates and of
+// the store size of every node holding shards to the mean of these nodes.
+// The rates are computed between the latest two scrapes. The ratios require
+// the stats of several nodes, i.e. es.all or es.sniff.
+func (c *Nodes) collectHotSpots(ch chan<- prometheus.Metric, nsr nodeStatsResponse) {
+	c.lastTotalsMtx.Lock()
+	defer c.lastTotalsMtx.Unlock()
+
+	type nodeValues struct {
+		node   NodeStatsNodeResponse
+		values map[string]float64
+	}
+	var nodes []nodeValues
+	// nodes gone since the previous scrape are forgotten
+	totals := make(map[string]hotSpotTotals, len(nsr.Nodes))
+	for id, node := range nsr.Nodes {
+		if node.Indices == nil || !holdsShards(node.Roles, node.Attributes) {
+			continue
+		}
+		node.ID = id
+		current := hotSpotTotals{
+			timestamp: node.Timestamp,
+			indexing:  node.Indices.Indexing.IndexTotal,
+			search:    node.Indices.Search.QueryTotal,
+		}
+		totals[id] = current
+		values := map[string]float64{"store": float64(node.Indices.Store.Size)}
+		// the totals are reset by restarts of the node
+		if last, ok := c.lastHotSpotTotals[id]; ok && current.timestamp > last.timestamp &&
+			current.indexing >= last.indexing && current.search >= last.search {
+			seconds := float64(current.timestamp-last.timestamp) / 1000
+			values["indexing"] = float64(current.indexing-last.indexing) / seconds
+			values["search"] = float64(current.search-last.search) / seconds
+		}
+		nodes = append(nodes, nodeValues{node: node, values: values})
+	}
+	c.lastHotSpotTotals = totals
+
+	if len(nodes) < 2 {
+		return
+	}
+	for _, resource := range []string{"indexing", "search", "store"} {
+		var sum float64
+		for _, n := range nodes {
+			v, ok := n.values[resource]
+			if !ok {
+				// the mean is only known once the rates of all nodes are
+				sum = -1
+				break
+			}
+			sum += v
+		}
+		if sum <= 0 {
+			continue
+		}
+		mean := sum / float64(len(nodes))
+		for _, n := range nodes {
+			ch <- prometheus.MustNewConstMetric(c.imbalanceRatio, prometheus.GaugeValue,
+				n.values[resource]/mean, append(defaultNodeLabelValues(nsr.ClusterName, n.node), resource)...)
+		}
+	}
+}
+
+// collectDiscovery sends the timings of the application of cluster states by
+// node and, on the elected master, of the cluster state updates
+func (c *Nodes) collectDiscovery(ch chan<- prometheus.Metric, cluster string, node NodeStatsNodeResponse) {
+	labels := defaultNodeLabelValues(cluster, node)
+	for _, r := range node.Discovery.ClusterApplierStats.Recordings {
+		ch <- prometheus.MustNewConstMetric(c.clusterApplierExecutions, prometheus.CounterValue,
+			float64(r.CumulativeExecutionCount), append(labels, r.Name)...)
+		ch <- prometheus.MustNewConstMetric(c.clusterApplierExecutionSeconds, prometheus.CounterValue,
+			float64(r.CumulativeExecutionTimeMillis)/1000, append(labels, r.Name)...)
+	}
+	for outcome, stats := range node.Discovery.ClusterStateUpdate {
+		for key, value := range stats {
+			if key == "count" {
+				ch <- prometheus.MustNewConstMetric(c.clusterStateUpdates, prometheus.CounterValue,
+					float64(value), append(labels, outcome)...)
+				continue
+			}
+			if !strings.HasSuffix(key, "_time_millis") {
+				continue
+			}
+			phase := strings.TrimSuffix(key, "_time_millis")
+			ch <- prometheus.MustNewConstMetric(c.clusterStateUpdateSeconds, prometheus.CounterValue,
+				float64(value)/1000, append(labels, outcome, phase)...)
+		}
+	}
+}
+
+// rejectionPools are the thread pools whose rejections are exported as
+// rejections by operation and stage. Bulk requests are executed by the bulk
+// thread pool before Elasticsearch 6.3.
+var rejectionPools = []struct {
+	pool, operation, stage string
+}{
+	{"search", "search", "thread_pool"},
+	{"search_coordination", "search", "coordinating"},
+	{"write", "bulk", "thread_pool"},
+	{"bulk", "bulk", "thread_pool"},
+}
+
+// collectRejections sends the requests rejected by the search and write
+// thread pools and by the indexing pressure of the node, which clients
+// receive as 429 Too Many Requests
+func (c *Nodes) collectRejections(ch chan<- prometheus.Metric, cluster string, node NodeStatsNodeResponse) {
+	labels := defaultNodeLabelValues(cluster, node)
+	for _, r := range rejectionPools {
+		pool, ok := node.ThreadPool[r.pool]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.rejections, prometheus.CounterValue,
+			float64(pool.Rejected), append(labels, r.operation, r.stage)...)
+	}
+	if node.IndexingPressure == nil {
+		return
+	}
+	total := node.IndexingPressure.Memory.Total
+	for stage, rejections := range map[string]int64{
+		"coordinating": total.CoordinatingRejections,
+		"primary":      total.PrimaryRejections,
+		"replica":      total.ReplicaRejections,
+	} {
+		ch <- prometheus.MustNewConstMetric(c.rejections, prometheus.CounterValue,
+			float64(rejections), append(labels, "bulk", stage)...)
+	}
+}
+
+// nodeTiers returns the data tiers of a node: the tiers of its data_* roles.
+// The generic data role of nodes without tier roles, and of nodes before 7.10,
+// is reported as the value of the data node attribute, the convention of hot
+// warm architectures with shard allocation filtering, or as tier "data".
+func nodeTiers(node NodeStatsNodeResponse) []string {
+	var tiers []string
+	data := false
+	for _, role := range node.Roles {
+		switch {
+		case role == "data":
+			data = true
+		case strings.HasPrefix(role, "data_"):
+			tiers = append(tiers, strings.TrimPrefix(role, "data_"))
+		}
+	}
+	if len(tiers) > 0 || !data && !getRoles(node)["data"] {
+		return tiers
+	}
+	if tier := node.Attributes["data"]; tier != "" && tier != "true" && tier != "false" {
+		return []string{tier}
+	}
+	return []string{"data"}
+}
+
+// tierTotals are the sums of the stats of the nodes of a data tier, the
+// optional stats are only exported if a node of the tier reported them
+type tierTotals struct {
+	nodes                              float64
+	shards, storeSize                  float64
+	filesystemSize, filesystemAvail    float64
+	hasShards, hasStore, hasFilesystem bool
+}
+
+// scrapesAllNodes reports whether the stats of every node of the cluster are
+// scraped, which the cluster wide aggregates over the nodes require. A replica
+// of a shard only scrapes its share of the nodes.
+func (c *Nodes) scrapesAllNodes() bool {
+	return (c.all || c.sniff) && (c.shard == nil || c.shard.Count <= 1)
+}
+
+// collectTiers sends the shards and the storage of the nodes by data tier.
+// The nodes are counted in each of their tiers.
+func (c *Nodes) collectTiers(ch chan<- prometheus.Metric, nsr nodeStatsResponse, shards map[string]int64) {
+	tiers := map[string]*tierTotals{}
+	for _, node := range nsr.Nodes {
+		for _, tier := range nodeTiers(node) {
+			t, ok := tiers[tier]
+			if !ok {
+				t = &tierTotals{}
+				tiers[tier] = t
+			}
+			t.nodes++
+			if n, ok := shards[node.Name]; ok {
+				t.shards += float64(n)
+				t.hasShards = true
+			}
+			if node.Indices != nil {
+				t.storeSize += float64(node.Indices.Store.Size)
+				t.hasStore = true
+			}
+			if node.FS != nil {
+				for _, data := range node.FS.Data {
+					t.filesystemSize += float64(data.Total)
+					t.filesystemAvail += float64(data.Available)
+				}
+				t.hasFilesystem = true
+			}
+		}
+	}
+	for tier, t := range tiers {
+		ch <- prometheus.MustNewConstMetric(c.tierNodes, prometheus.GaugeValue, t.nodes, nsr.ClusterName, tier)
+		if t.hasShards {
+			ch <- prometheus.MustNewConstMetric(c.tierShards, prometheus.GaugeValue, t.shards, nsr.ClusterName, tier)
+		}
+		if t.hasStore {
+			ch <- prometheus.MustNewConstMetric(c.tierStoreSize, prometheus.GaugeValue, t.storeSize, nsr.ClusterName, tier)
+		}
+		if t.hasFilesystem {
+			ch <- prometheus.MustNewConstMetric(c.tierFilesystemSize, prometheus.GaugeValue, t.filesystemSize, nsr.ClusterName, tier)
+			ch <- prometheus.MustNewConstMetric(c.tierFilesystemAvailable, prometheus.GaugeValue, t.filesystemAvail, nsr.ClusterName, tier)
+		}
+	}
+}
+
+// collectLatencies sends the average latencies of the operations of every
+// node since the previous scrape, and keeps the totals for the next scrape.
+// Latencies are omitted without previous scrape and without operations in
+// between.
+func (c *Nodes) collectLatencies(ch chan<- prometheus.Metric, nsr nodeStatsResponse) {
+	c.lastTotalsMtx.Lock()
+	defer c.lastTotalsMtx.Unlock()
+
+	// nodes gone since the previous scrape are forgotten
+	totals := make(map[string]latencyTotals, len(nsr.Nodes))
+	for id, node := range nsr.Nodes {
+		if node.Indices == nil {
+			continue
+		}
+		node.ID = id
+		last := c.lastTotals[id]
+		current := make(latencyTotals, len(c.latencyMetrics))
+		for i, metric := range c.latencyMetrics {
+			millis, count := metric.Value(node.Indices)
+			current[i] = [2]int64{millis, count}
+			if last == nil {
+				continue
+			}
+			// the totals are reset by restarts of the node
+			dMillis, dCount := millis-last[i][0], count-last[i][1]
+			if dCount <= 0 || dMillis < 0 {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				metric.Desc,
+				prometheus.GaugeValue,
+				float64(dMillis)/float64(dCount)/1000,
+				defaultNodeLabelValues(nsr.ClusterName, node)...,
+			)
+		}
+		totals[id] = current
+	}
+	c.lastTotals = totals
+}
+
+// collectGCPauses sends the duration of the latest GC runs and the
+// approximate histogram of the GC pauses of every node and collector. The
+// histogram starts with the first scrape, the runs before aren't counted.
+func (c *Nodes) collectGCPauses(ch chan<- prometheus.Metric, nsr nodeStatsResponse) {
+	c.lastTotalsMtx.Lock()
+	defer c.lastTotalsMtx.Unlock()
+
+	// nodes and collectors gone since the previous scrape are forgotten
+	pauses := make(map[[2]string]*gcPauses, len(c.gcPauses))
+	for id, node := range nsr.Nodes {
+		if node.JVM == nil {
+			continue
+		}
+		node.ID = id
+		for gc, stats := range node.JVM.GC.Collectors {
+			key := [2]string{id, gc}
+			p, ok := c.gcPauses[key]
+			if !ok {
+				p = &gcPauses{
+					lastCount:  stats.CollectionCount,
+					lastMillis: stats.CollectionTime,
+					buckets:    make([]uint64, len(gcPauseBuckets)),
+				}
+			} else {
+				p.observe(stats.CollectionCount, stats.CollectionTime)
+			}
+			pauses[key] = p
+
+			labels := append(defaultNodeLabelValues(nsr.ClusterName, node), gc)
+			if p.count > 0 {
+				ch <- prometheus.MustNewConstMetric(c.gcLastDuration, prometheus.GaugeValue, p.lastDuration, labels...)
+			}
+			ch <- prometheus.MustNewConstHistogram(c.gcPauseSec, p.count, p.sum, p.histogram(), labels...)
+		}
+	}
+	c.gcPauses = pauses
 }
@@ -6,27 +6,113 @@ import "encoding/json"
 type nodeStatsResponse struct {
 	ClusterName string `json:"cluster_name"`
 	Nodes       map[string]NodeStatsNodeResponse
+
+	// sections are the sections requested and forbidden those which were
+	// rejected with status 403, they aren't part of the response
+	sections  []string
+	forbidden map[string]bool
+	// sniffed and sniffFailed are the numbers of nodes requested and failed
+	// with es.sniff
+	sniffed, sniffFailed int
+}
+
+// nodesHTTPResponse is a representation of the Elasticsearch nodes info
+// of the http section, used to discover the nodes of the cluster
+type nodesHTTPResponse struct {
+	ClusterName string `json:"cluster_name"`
+	Nodes       map[string]struct {
+		Name       string            `json:"name"`
+		Roles      []string          `json:"roles"`
+		Attributes map[string]string `json:"attributes"`
+		HTTP       struct {
+			PublishAddress string `json:"publish_address"`
+		} `json:"http"`
+	} `json:"nodes"`
+}
+
+// catAllocationResponse is a representation of the Elasticsearch cat
+// allocation API, reduced to the number of shards of every node
+type catAllocationResponse []struct {
+	Node   string `json:"node"`
+	Shards string `json:"shards"`
 }
 
 // NodeStatsNodeResponse defines node stats information structure for nodes
 type NodeStatsNodeResponse struct {
-	Name             string                                     `json:"name"`
-	Host             string                                     `json:"host"`
-	Timestamp        int64                                      `json:"timestamp"`
-	TransportAddress string                                     `json:"transport_address"`
-	Hostname         string                                     `json:"hostname"`
-	Roles            []string                                   `json:"roles"`
-	Attributes       map[string]string                          `json:"attributes"`
-	Indices          NodeStatsIndicesResponse                   `json:"indices"`
-	OS               NodeStatsOSResponse                        `json:"os"`
-	Network          NodeStatsNetworkResponse                   `json:"network"`
-	FS               NodeStatsFSResponse                        `json:"fs"`
-	ThreadPool       map[string]NodeStatsThreadPoolPoolResponse `json:"thread_pool"`
-	JVM              NodeStatsJVMResponse                       `json:"jvm"`
-	Breakers         map[string]NodeStatsBreakersResponse       `json:"breakers"`
-	HTTP             map[string]int                             `json:"http"`
-	Transport        NodeStatsTransportResponse                 `json:"transport"`
-	Process          NodeStatsProcessResponse                   `json:"process"`
+	// ID is the key of the node in the response, it isn't part of the node object
+	ID               string            `json:"-"`
+	Name             string            `json:"name"`
+	Host             string            `json:"host"`
+	Timestamp        int64             `json:"timestamp"`
+	TransportAddress string            `json:"transport_address"`
+	Hostname         string            `json:"hostname"`
+	Roles            []string          `json:"roles"`
+	Attributes       map[string]string `json:"attributes"`
+	// The sections are nil if the node didn't report them
+	Indices    *NodeStatsIndicesResponse                  `json:"indices"`
+	OS         *NodeStatsOSResponse                       `json:"os"`
+	Network    NodeStatsNetworkResponse                   `json:"network"`
+	FS         *NodeStatsFSResponse                       `json:"fs"`
+	ThreadPool map[string]NodeStatsThreadPoolPoolResponse `json:"thread_pool"`
+	JVM        *NodeStatsJVMResponse                      `json:"jvm"`
+	Breakers   map[string]NodeStatsBreakersResponse       `json:"breakers"`
+	HTTP       map[string]int                             `json:"http"`
+	Transport  *NodeStatsTransportResponse                `json:"transport"`
+	Process    *NodeStatsProcessResponse                  `json:"process"`
+	Discovery  *NodeStatsDiscoveryResponse                `json:"discovery"`
+	// Repositories are reported since Elasticsearch 8.13
+	Repositories map[string]NodeStatsRepositoryResponse `json:"repositories"`
+	// IndexingPressure is reported since Elasticsearch 7.9
+	IndexingPressure *NodeStatsIndexingPressureResponse `json:"indexing_pressure"`
+	// Shards is the number of shards allocated to the node, it's taken from
+	// the cat allocation API and nil if that failed
+	Shards *int64 `json:"-"`
+}
+
+// NodeStatsIndexingPressureResponse is a representation of the indexing
+// pressure of a node, bulk requests are rejected at the coordinating, primary
+// or replica stage once the memory of the indexing requests exceeds
+// indexing_pressure.memory.limit
+type NodeStatsIndexingPressureResponse struct {
+	Memory struct {
+		Total struct {
+			CoordinatingRejections int64 `json:"coordinating_rejections"`
+			PrimaryRejections      int64 `json:"primary_rejections"`
+			ReplicaRejections      int64 `json:"replica_rejections"`
+		} `json:"total"`
+	} `json:"memory"`
+}
+
+// NodeStatsRepositoryResponse is a representation of the snapshot stats of a
+// repository on a node, the throttling is configured by the
+// max_snapshot_bytes_per_sec and max_restore_bytes_per_sec settings of the
+// repository
+type NodeStatsRepositoryResponse struct {
+	ShardSnapshotsStarted        int64 `json:"shard_snapshots_started"`
+	ShardSnapshotsCompleted      int64 `json:"shard_snapshots_completed"`
+	ShardSnapshotsInProgress     int64 `json:"shard_snapshots_in_progress"`
+	TotalReadThrottledTimeNanos  int64 `json:"total_read_throttled_time_nanos"`
+	TotalWriteThrottledTimeNanos int64 `json:"total_write_throttled_time_nanos"`
+}
+
+// NodeStatsDiscoveryResponse is a representation of the timing of the
+// cluster state updates, reported since Elasticsearch 7.16
+type NodeStatsDiscoveryResponse struct {
+	ClusterApplierStats struct {
+		Recordings []NodeStatsClusterApplierRecording `json:"recordings"`
+	} `json:"cluster_applier_stats"`
+	// ClusterStateUpdate holds the count and the *_time_millis timings of
+	// the phases of the cluster state updates of the master service by
+	// outcome, i.e. unchanged, success and failure
+	ClusterStateUpdate map[string]map[string]int64 `json:"cluster_state_update"`
+}
+
+// NodeStatsClusterApplierRecording is the time spent by an action applying
+// cluster states
+type NodeStatsClusterApplierRecording struct {
+	Name                          string `json:"name"`
+	CumulativeExecutionCount      int64  `json:"cumulative_execution_count"`
+	CumulativeExecutionTimeMillis int64  `json:"cumulative_execution_time_millis"`
 }
 
 // NodeStatsBreakersResponse is a representation of a statistics about the field data circuit breaker
@@ -67,6 +153,7 @@ type NodeStatsJVMMemResponse struct {
 	HeapCommitted    int64                                  `json:"heap_committed_in_bytes"`
 	HeapUsed         int64                                  `json:"heap_used_in_bytes"`
 	HeapMax          int64                                  `json:"heap_max_in_bytes"`
+	HeapUsedPercent  int64                                  `json:"heap_used_percent"`
 	NonHeapCommitted int64                                  `json:"non_heap_committed_in_bytes"`
 	NonHeapUsed      int64                                  `json:"non_heap_used_in_bytes"`
 	Pools            map[string]NodeStatsJVMMemPoolResponse `json:"pools"`
@@ -92,6 +179,17 @@ type NodeStatsTransportResponse struct {
 	RxSize     int64 `json:"rx_size_in_bytes"`
 	TxCount    int64 `json:"tx_count"`
 	TxSize     int64 `json:"tx_size_in_bytes"`
+	// The handling time histograms are reported since Elasticsearch 8.1
+	InboundHandlingTime  []NodeStatsTransportHistogramBucket `json:"inbound_handling_time_histogram"`
+	OutboundHandlingTime []NodeStatsTransportHistogramBucket `json:"outbound_handling_time_histogram"`
+}
+
+// NodeStatsTransportHistogramBucket is a bucket of a transport handling time
+// histogram. The first bucket has no lower bound, the last no upper bound.
+type NodeStatsTransportHistogramBucket struct {
+	GeMillis *int64 `json:"ge_millis"`
+	LtMillis *int64 `json:"lt_millis"`
+	Count    uint64 `json:"count"`
 }
 
 // NodeStatsThreadPoolPoolResponse is a representation of a statistics about each thread pool, including current size, queue and rejected tasks
@@ -259,12 +357,14 @@ type NodeStatsIndicesCacheResponse struct {
 type NodeStatsOSResponse struct {
 	Timestamp int64 `json:"timestamp"`
 	Uptime    int64 `json:"uptime_in_millis"`
-	// LoadAvg was an array of per-cpu values pre-2.0, and is a string in 2.0
-	// Leaving this here in case we want to implement parsing logic later
-	LoadAvg json.RawMessage         `json:"load_average"`
-	CPU     NodeStatsOSCPUResponse  `json:"cpu"`
-	Mem     NodeStatsOSMemResponse  `json:"mem"`
-	Swap    NodeStatsOSSwapResponse `json:"swap"`
+	// LoadAvg was an array of the 1m, 5m and 15m load averages pre-2.0, and is
+	// the 1m load average in 2.x. It moved to CPU in 5.0, see adaptNodeStats.
+	LoadAvg json.RawMessage `json:"load_average"`
+	// CPUPercent moved to CPU in 5.0
+	CPUPercent int64                   `json:"cpu_percent"`
+	CPU        NodeStatsOSCPUResponse  `json:"cpu"`
+	Mem        NodeStatsOSMemResponse  `json:"mem"`
+	Swap       NodeStatsOSSwapResponse `json:"swap"`
 }
 
 // NodeStatsOSMemResponse defines node stats operating system memory usage structure
@@ -1,15 +1,21 @@
 package collector
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/blang/semver"
 	"github.com/go-kit/kit/log"
+	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func TestNodesStats(t *testing.T) {
@@ -44,8 +50,8 @@ func TestNodesStats(t *testing.T) {
 				t.Fatalf("Failed to parse URL: %s", err)
 			}
 			u.User = url.UserPassword("elastic", "changeme")
-			c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local")
-			nsr, err := c.fetchAndDecodeNodeStats()
+			c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil)
+			nsr, err := c.fetchAndDecodeNodeStats(context.Background())
 			if err != nil {
 				t.Fatalf("Failed to fetch or decode node stats: %s", err)
 			}
@@ -160,3 +166,1060 @@ func (h *basicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	h.Next.ServeHTTP(w, r)
 }
+
+func TestNodesSniff(t *testing.T) {
+	var c *Nodes
+	node := func(id, name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/_nodes/_local/stats/"+c.requestedSections() {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprintf(w, `{"cluster_name":"elasticsearch","nodes":{"%s":{"name":"%s","host":"127.0.0.1"}}}`, id, name)
+		}))
+	}
+	n1, n2 := node("id1", "node-1"), node("id2", "node-2")
+	defer n1.Close()
+	defer n2.Close()
+	coordinator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_nodes/http" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"cluster_name":"elasticsearch","nodes":{
+			"id1":{"name":"node-1","http":{"publish_address":"%s"}},
+			"id2":{"name":"node-2","http":{"publish_address":"node-2/%s"}},
+			"id3":{"name":"node-3","http":{"publish_address":"127.0.0.1:1"}}}}`,
+			n1.Listener.Addr(), n2.Listener.Addr())
+	}))
+	defer coordinator.Close()
+
+	u, err := url.Parse(coordinator.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+	c = NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", true, false, false, nil)
+	nsr, err := c.fetchAndDecodeNodeStats(context.Background())
+	if err != nil {
+		t.Fatalf("failed to sniff node stats: %s", err)
+	}
+	if len(nsr.Nodes) != 2 {
+		t.Fatalf("expected stats of 2 reachable nodes, got %d", len(nsr.Nodes))
+	}
+	if nsr.Nodes["id1"].Name != "node-1" || nsr.Nodes["id2"].Name != "node-2" {
+		t.Errorf("unexpected nodes %+v", nsr.Nodes)
+	}
+	if nsr.sniffed != 3 || nsr.sniffFailed != 1 {
+		t.Errorf("expected 1 of 3 sniffed nodes to fail, got %d of %d", nsr.sniffFailed, nsr.sniffed)
+	}
+
+	// the scrape fails if no sniffed node is reachable
+	n1.Close()
+	n2.Close()
+	if _, err := c.fetchAndDecodeNodeStats(context.Background()); err == nil {
+		t.Error("expected an error if no sniffed node is reachable")
+	}
+}
+
+func TestNodesShard(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_nodes/http" {
+			fmt.Fprint(w, `{"cluster_name":"elasticsearch","nodes":{
+				"id1":{"name":"node-1"},"id2":{"name":"node-2"},"id3":{"name":"node-3"},"id4":{"name":"node-4"}}}`)
+			return
+		}
+		// only the stats of the nodes of the shard are requested
+		parts := strings.Split(r.URL.Path, "/")
+		if len(parts) < 4 || parts[1] != "_nodes" || parts[3] != "stats" {
+			http.NotFound(w, r)
+			return
+		}
+		var nodes []string
+		for _, id := range strings.Split(parts[2], ",") {
+			nodes = append(nodes, fmt.Sprintf(`"%s":{"name":"node-%s"}`, id, strings.TrimPrefix(id, "id")))
+		}
+		fmt.Fprintf(w, `{"cluster_name":"elasticsearch","nodes":{%s}}`, strings.Join(nodes, ","))
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+
+	owner := map[string]int{}
+	for index := 1; index <= 2; index++ {
+		c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil)
+		c.shard = &ScrapeShard{Index: index, Count: 2}
+		nsr, err := c.fetchAndDecodeNodeStats(context.Background())
+		if err != nil {
+			t.Fatalf("failed to fetch node stats: %s", err)
+		}
+		for id := range nsr.Nodes {
+			if _, ok := owner[id]; ok {
+				t.Errorf("node %s exported by both shards", id)
+			}
+			owner[id] = index
+		}
+	}
+	if len(owner) != 4 {
+		t.Errorf("expected every node to be exported by one shard, got %v", owner)
+	}
+}
+
+func TestNodesLabels(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"VCmx1AbRSYa":{"name":"es-1","host":"10.0.0.1","roles":["master","data"],"jvm":{"mem":{"heap_used_in_bytes":42}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", false, false, false, nil))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	want := map[string]string{"cluster": "elasticsearch", "host": "10.0.0.1", "name": "es-1", "node": "es-1", "node_id": "VCmx1AbRSYa"}
+	for _, name := range []string{"elasticsearch_jvm_memory_used_bytes", "elasticsearch_nodes_roles"} {
+		var found bool
+		for _, mf := range mfs {
+			if mf.GetName() != name {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				found = true
+				labels := map[string]string{}
+				for _, l := range m.GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+				for label, value := range want {
+					if labels[label] != value {
+						t.Errorf("expected label %s of %s to be %q, got %q", label, name, value, labels[label])
+					}
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected %s to be exported", name)
+		}
+	}
+}
+
+func TestNodesForbiddenSections(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/_nodes/_local/stats/jvm,os":
+			fmt.Fprint(w, `{"cluster_name":"elasticsearch","nodes":{"id1":{"name":"node-1","jvm":{"mem":{"heap_used_in_bytes":42}},"os":{"mem":{"free_in_bytes":7}}}}}`)
+		case "/_nodes/_local/stats/jvm":
+			fmt.Fprint(w, `{"cluster_name":"elasticsearch","nodes":{"id1":{"name":"node-1","jvm":{"mem":{"heap_used_in_bytes":42}}}}}`)
+		case "/_nodes/_local/stats/os":
+			fmt.Fprint(w, `{"cluster_name":"elasticsearch","nodes":{"id1":{"name":"node-1","os":{"mem":{"free_in_bytes":7}}}}}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+
+	c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", false, false, false, []string{"jvm", "os", "fs"})
+	nsr, err := c.fetchAndDecodeNodeStats(context.Background())
+	if err != nil {
+		t.Fatalf("expected the permitted sections to be fetched, got %s", err)
+	}
+	node := nsr.Nodes["id1"]
+	if node.JVM == nil || node.JVM.Mem.HeapUsed != 42 || node.OS == nil || node.OS.Mem.Free != 7 {
+		t.Errorf("expected the sections to be merged, got %+v", node)
+	}
+	if !nsr.forbidden["fs"] || nsr.forbidden["jvm"] || nsr.forbidden["os"] {
+		t.Errorf("expected only fs to be forbidden, got %v", nsr.forbidden)
+	}
+
+	// the forbidden sections aren't requested again until the retry
+	paths = nil
+	nsr, err = c.fetchAndDecodeNodeStats(context.Background())
+	if err != nil {
+		t.Fatalf("expected the permitted sections to be fetched, got %s", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/_nodes/_local/stats/jvm,os"}) {
+		t.Errorf("expected only the permitted sections to be requested, got %v", paths)
+	}
+	if !nsr.forbidden["fs"] || nsr.Nodes["id1"].JVM == nil {
+		t.Errorf("expected fs to be reported as forbidden, got %v", nsr.forbidden)
+	}
+	c.forbiddenSince = c.forbiddenSince.Add(-nodeStatsForbiddenRetry)
+	paths = nil
+	if _, err := c.fetchAndDecodeNodeStats(context.Background()); err != nil {
+		t.Fatalf("expected the permitted sections to be fetched, got %s", err)
+	}
+	if len(paths) == 0 || paths[0] != "/_nodes/_local/stats/jvm,os,fs" {
+		t.Errorf("expected all sections to be requested again after the retry interval, got %v", paths)
+	}
+
+	c = NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", false, false, false, []string{"fs"})
+	if _, err := c.fetchAndDecodeNodeStats(context.Background()); err == nil {
+		t.Error("expected an error if all sections are forbidden")
+	}
+	paths = nil
+	if _, err := c.fetchAndDecodeNodeStats(context.Background()); err == nil || len(paths) != 0 {
+		t.Errorf("expected an error without requests if all sections were forbidden, got %v, %v", err, paths)
+	}
+}
+
+func TestNodesVersionAdaption(t *testing.T) {
+	// the OS stats of 2.x and 5.x, and the caches of 1.x and 2.x
+	tcs := map[string]struct {
+		out     string
+		version string
+		present []string
+		absent  []string
+	}{
+		"1.7.6": {
+			out:     `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","os":{"load_average":[0.5,0.4,0.3]},"indices":{"filter_cache":{"memory_size_in_bytes":42}}}}}`,
+			version: "1.7.6",
+			present: []string{"elasticsearch_indices_filter_cache_memory_size_bytes", "elasticsearch_indices_store_throttle_time_seconds_total"},
+			absent:  []string{"elasticsearch_indices_request_cache_memory_size_bytes"},
+		},
+		"2.4.5": {
+			out:     `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","os":{"cpu_percent":7,"load_average":0.5},"indices":{}}}}`,
+			version: "2.4.5",
+			present: []string{"elasticsearch_indices_request_cache_memory_size_bytes", "elasticsearch_indices_store_throttle_time_seconds_total"},
+			absent:  []string{"elasticsearch_indices_filter_cache_memory_size_bytes", "elasticsearch_os_mem_actual_free_bytes"},
+		},
+		"7.3.0": {
+			out:     `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","os":{"cpu":{"percent":7,"load_average":{"1m":0.5,"5m":0.4,"15m":0.3}}},"indices":{}}}}`,
+			version: "7.3.0",
+			present: []string{"elasticsearch_indices_request_cache_memory_size_bytes"},
+			absent:  []string{"elasticsearch_indices_filter_cache_memory_size_bytes", "elasticsearch_indices_store_throttle_time_seconds_total"},
+		},
+		"unknown": {
+			out:     `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","os":{"cpu":{"percent":7,"load_average":{"1m":0.5}}},"indices":{}}}}`,
+			present: []string{"elasticsearch_indices_filter_cache_memory_size_bytes", "elasticsearch_indices_request_cache_memory_size_bytes"},
+		},
+	}
+	for name, tc := range tcs {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, tc.out)
+		}))
+		u, err := url.Parse(ts.URL)
+		if err != nil {
+			t.Fatalf("Failed to parse URL: %s", err)
+		}
+		c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil)
+		if tc.version != "" {
+			c.SetClusterInfo(&clusterinfo.Response{Version: clusterinfo.VersionInfo{Number: semver.MustParse(tc.version)}})
+		}
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(c)
+		mfs, err := registry.Gather()
+		ts.Close()
+		if err != nil {
+			t.Fatalf("%s: failed to gather: %s", name, err)
+		}
+
+		values := map[string]float64{}
+		for _, mf := range mfs {
+			values[mf.GetName()] = mf.Metric[0].GetGauge().GetValue() + mf.Metric[0].GetCounter().GetValue()
+		}
+		for _, metric := range tc.present {
+			if _, ok := values[metric]; !ok {
+				t.Errorf("%s: expected %s to be exported", name, metric)
+			}
+		}
+		for _, metric := range tc.absent {
+			if _, ok := values[metric]; ok {
+				t.Errorf("%s: expected %s to be omitted", name, metric)
+			}
+		}
+		if v := values["elasticsearch_os_load1"]; v != 0.5 {
+			t.Errorf("%s: expected 1m load average 0.5, got %v", name, v)
+		}
+		if name != "1.7.6" {
+			if v := values["elasticsearch_os_cpu_percent"]; v != 7 {
+				t.Errorf("%s: expected 7 percent CPU, got %v", name, v)
+			}
+		}
+	}
+}
+
+func TestNodesMissingSections(t *testing.T) {
+	// a node reporting nothing but its JVM, e.g. due to a filter
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","jvm":{"mem":{"heap_used_in_bytes":42},"gc":{"collectors":{"young":{"collection_count":1}}}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	names := map[string]bool{}
+	for _, mf := range mfs {
+		names[mf.GetName()] = true
+	}
+	for _, metric := range []string{"elasticsearch_jvm_memory_used_bytes", "elasticsearch_jvm_gc_collection_seconds_count"} {
+		if !names[metric] {
+			t.Errorf("expected %s to be exported", metric)
+		}
+	}
+	for _, metric := range []string{"elasticsearch_indices_docs", "elasticsearch_os_load1", "elasticsearch_process_open_files_count", "elasticsearch_transport_rx_packets_total"} {
+		if names[metric] {
+			t.Errorf("expected %s of a missing section to be omitted", metric)
+		}
+	}
+}
+
+func TestNodesLatencies(t *testing.T) {
+	var scrape int
+	outs := []string{
+		`{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","indices":{"indexing":{"index_total":10,"index_time_in_millis":100},"search":{"query_total":5,"query_time_in_millis":50}}}}}`,
+		`{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","indices":{"indexing":{"index_total":30,"index_time_in_millis":500},"search":{"query_total":5,"query_time_in_millis":50}}}}}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, outs[scrape])
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, true, false, nil))
+
+	latencies := func() map[string]float64 {
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %s", err)
+		}
+		values := map[string]float64{}
+		for _, mf := range mfs {
+			if strings.HasSuffix(mf.GetName(), "_latency_seconds") {
+				values[mf.GetName()] = mf.Metric[0].GetGauge().GetValue()
+			}
+		}
+		return values
+	}
+
+	// there is no previous scrape to compare to
+	if values := latencies(); len(values) != 0 {
+		t.Errorf("expected no latencies on the first scrape, got %v", values)
+	}
+	scrape++
+	values := latencies()
+	// 400ms for 20 index operations, no queries in between
+	want := map[string]float64{"elasticsearch_indices_indexing_index_latency_seconds": 0.02}
+	if len(values) != len(want) || values["elasticsearch_indices_indexing_index_latency_seconds"] != 0.02 {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+}
+
+func TestNodesHotSpots(t *testing.T) {
+	var scrape int
+	outs := []string{
+		`{"cluster_name":"elasticsearch","nodes":{` +
+			`"id1":{"name":"hot","timestamp":10000,"roles":["data"],"indices":{"indexing":{"index_total":100},"search":{"query_total":10},"store":{"size_in_bytes":300}}},` +
+			`"id2":{"name":"cold","timestamp":10000,"roles":["data"],"indices":{"indexing":{"index_total":100},"search":{"query_total":10},"store":{"size_in_bytes":100}}},` +
+			`"id3":{"name":"ingest","timestamp":10000,"roles":["ingest"],"indices":{"indexing":{"index_total":0},"search":{"query_total":0}}}}}`,
+		`{"cluster_name":"elasticsearch","nodes":{` +
+			`"id1":{"name":"hot","timestamp":20000,"roles":["data"],"indices":{"indexing":{"index_total":400},"search":{"query_total":10},"store":{"size_in_bytes":300}}},` +
+			`"id2":{"name":"cold","timestamp":20000,"roles":["data"],"indices":{"indexing":{"index_total":200},"search":{"query_total":10},"store":{"size_in_bytes":100}}},` +
+			`"id3":{"name":"ingest","timestamp":20000,"roles":["ingest"],"indices":{"indexing":{"index_total":0},"search":{"query_total":0}}}}}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, outs[scrape])
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, true, nil))
+
+	ratios := func() map[string]float64 {
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %s", err)
+		}
+		values := map[string]float64{}
+		for _, mf := range mfs {
+			if mf.GetName() != "elasticsearch_node_imbalance_ratio" {
+				continue
+			}
+			for _, m := range mf.Metric {
+				var name, resource string
+				for _, l := range m.Label {
+					switch l.GetName() {
+					case "name":
+						name = l.GetValue()
+					case "resource":
+						resource = l.GetValue()
+					}
+				}
+				values[name+" "+resource] = m.GetGauge().GetValue()
+			}
+		}
+		return values
+	}
+
+	// the rates are unknown on the first scrape
+	want := map[string]float64{"hot store": 1.5, "cold store": 0.5}
+	if values := ratios(); !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v on the first scrape, got %v", want, values)
+	}
+	scrape++
+	// 30/s and 10/s indexed, no searches in between
+	want = map[string]float64{"hot store": 1.5, "cold store": 0.5, "hot indexing": 1.5, "cold indexing": 0.5}
+	if values := ratios(); !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+}
+
+func TestNodesGCPauses(t *testing.T) {
+	var scrape int
+	outs := []string{
+		`{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","jvm":{"gc":{"collectors":{"young":{"collection_count":10,"collection_time_in_millis":100}}}}}}}`,
+		`{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","jvm":{"gc":{"collectors":{"young":{"collection_count":14,"collection_time_in_millis":300}}}}}}}`,
+		`{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","jvm":{"gc":{"collectors":{"young":{"collection_count":15,"collection_time_in_millis":1300}}}}}}}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, outs[scrape])
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	// the GC pauses are exported without es.derived-latencies
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil))
+
+	gather := func() (last *dto.Gauge, pauses *dto.Histogram) {
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %s", err)
+		}
+		for _, mf := range mfs {
+			switch mf.GetName() {
+			case "elasticsearch_jvm_gc_last_duration_seconds":
+				last = mf.Metric[0].GetGauge()
+			case "elasticsearch_jvm_gc_pause_seconds":
+				pauses = mf.Metric[0].GetHistogram()
+			}
+		}
+		return last, pauses
+	}
+	bucket := func(h *dto.Histogram, bound float64) uint64 {
+		for _, b := range h.Bucket {
+			if b.GetUpperBound() == bound {
+				return b.GetCumulativeCount()
+			}
+		}
+		t.Fatalf("no bucket %v", bound)
+		return 0
+	}
+
+	// the runs before the first scrape aren't counted
+	last, pauses := gather()
+	if last != nil || pauses.GetSampleCount() != 0 {
+		t.Errorf("expected no GC runs on the first scrape, got %v, %v", last, pauses)
+	}
+	scrape++
+	// 4 runs of 50ms on average
+	last, pauses = gather()
+	if last.GetValue() != 0.05 || pauses.GetSampleCount() != 4 || pauses.GetSampleSum() != 0.2 {
+		t.Errorf("unexpected GC pauses %v, %v", last, pauses)
+	}
+	if bucket(pauses, .025) != 0 || bucket(pauses, .05) != 4 {
+		t.Errorf("expected the runs in the 50ms bucket, got %v", pauses.Bucket)
+	}
+	scrape++
+	// a run of 1s
+	last, pauses = gather()
+	if last.GetValue() != 1 || pauses.GetSampleCount() != 5 {
+		t.Errorf("unexpected GC pauses %v, %v", last, pauses)
+	}
+	if bucket(pauses, .5) != 4 || bucket(pauses, 1) != 5 {
+		t.Errorf("expected a run in the 1s bucket, got %v", pauses.Bucket)
+	}
+}
+
+func TestNodesBreakers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","breakers":{`+
+			`"parent":{"limit_size_in_bytes":1000,"estimated_size_in_bytes":950,"overhead":1.0,"tripped":3},`+
+			`"fielddata":{"limit_size_in_bytes":400,"estimated_size_in_bytes":100,"overhead":1.03,"tripped":0},`+
+			`"accounting":{"limit_size_in_bytes":-1,"estimated_size_in_bytes":10,"overhead":1.0,"tripped":0}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	used := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "elasticsearch_breakers_used_percent" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "breaker" {
+					used[l.GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	// breakers without limit have no percentage
+	want := map[string]float64{"parent": 95, "fielddata": 25}
+	if len(used) != len(want) || used["parent"] != 95 || used["fielddata"] != 25 {
+		t.Errorf("expected %v, got %v", want, used)
+	}
+}
+
+func TestNodesShards(t *testing.T) {
+	var allocations int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_cat/allocation" {
+			allocations++
+			fmt.Fprintln(w, `[{"node":"n1","shards":"12"},{"node":"n2","shards":"3"},{"node":"UNASSIGNED","shards":null}]`)
+			return
+		}
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id1":{"name":"n1"},"id2":{"name":"n2"}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	// the allocation is only requested with es.node-shards
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil))
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	if allocations != 0 {
+		t.Errorf("expected no request of the allocation, got %d", allocations)
+	}
+
+	c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil)
+	c.shardsPerNode = true
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(c)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	shards := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "elasticsearch_node_shards_total" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "name" {
+					shards[l.GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	if len(shards) != 2 || shards["n1"] != 12 || shards["n2"] != 3 {
+		t.Errorf("unexpected shards per node %v", shards)
+	}
+}
+
+func TestNodesHeapUsedPercent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","jvm":{"mem":{"heap_used_percent":62,`+
+			`"pools":{"young":{"used_in_bytes":10,"max_in_bytes":0},"old":{"used_in_bytes":300,"max_in_bytes":400}}}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		if strings.HasPrefix(mf.GetName(), "elasticsearch_jvm_mem_") {
+			values[mf.GetName()] = mf.Metric[0].GetGauge().GetValue()
+		}
+	}
+	if values["elasticsearch_jvm_mem_heap_used_percent"] != 62 || values["elasticsearch_jvm_mem_old_used_percent"] != 75 {
+		t.Errorf("unexpected heap usage %v", values)
+	}
+}
+
+func TestNodesMemoryPools(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","jvm":{"mem":{"pools":{`+
+			`"young":{"used_in_bytes":10,"max_in_bytes":20,"peak_used_in_bytes":15,"peak_max_in_bytes":20},`+
+			`"old":{"used_in_bytes":300,"max_in_bytes":400,"peak_used_in_bytes":350,"peak_max_in_bytes":400}}}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	used := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "elasticsearch_jvm_memory_pool_used_bytes" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "pool" {
+					used[l.GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	// the survivor pool wasn't reported
+	if len(used) != 2 || used["young"] != 10 || used["old"] != 300 {
+		t.Errorf("unexpected pool usage %v", used)
+	}
+}
+
+func TestNodesTransportHistograms(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","transport":{`+
+			`"inbound_handling_time_histogram":[{"lt_millis":1,"count":6},{"ge_millis":1,"lt_millis":2,"count":3},{"ge_millis":2,"count":1}]}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	var inbound *dto.Histogram
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "elasticsearch_transport_inbound_handling_time_seconds":
+			inbound = mf.Metric[0].GetHistogram()
+		case "elasticsearch_transport_outbound_handling_time_seconds":
+			t.Error("expected no outbound histogram without buckets")
+		}
+	}
+	if inbound == nil {
+		t.Fatal("expected an inbound histogram")
+	}
+	// 6*0.5ms + 3*1.5ms + 1*2ms
+	if inbound.GetSampleCount() != 10 || inbound.GetSampleSum() != 0.0095 {
+		t.Errorf("unexpected count %d and sum %v", inbound.GetSampleCount(), inbound.GetSampleSum())
+	}
+	want := map[float64]uint64{0.001: 6, 0.002: 9}
+	if len(inbound.Bucket) != len(want) {
+		t.Fatalf("expected buckets %v, got %v", want, inbound.Bucket)
+	}
+	for _, b := range inbound.Bucket {
+		if want[b.GetUpperBound()] != b.GetCumulativeCount() {
+			t.Errorf("expected buckets %v, got %v", want, inbound.Bucket)
+		}
+	}
+}
+
+func TestNodesDiscovery(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","discovery":{`+
+			`"cluster_applier_stats":{"recordings":[{"name":"running applier","cumulative_execution_count":40,"cumulative_execution_time_millis":2500}]},`+
+			`"cluster_state_update":{"success":{"count":12,"computation_time_millis":300,"commit_time_millis":1200}}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				switch l.GetName() {
+				case "action", "outcome", "phase":
+					key += " " + l.GetValue()
+				}
+			}
+			values[key] = m.GetCounter().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_cluster_applier_executions_total running applier":        40,
+		"elasticsearch_cluster_applier_execution_seconds_total running applier": 2.5,
+		"elasticsearch_cluster_state_update_total success":                      12,
+		"elasticsearch_cluster_state_update_seconds_total success computation":  0.3,
+		"elasticsearch_cluster_state_update_seconds_total success commit":       1.2,
+	} {
+		if values[key] != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, values[key])
+		}
+	}
+}
+
+func TestNodesSections(t *testing.T) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	sections, err := ParseNodeStatsSections(" jvm, os ,")
+	if err != nil {
+		t.Fatalf("Failed to parse sections: %s", err)
+	}
+	c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", false, false, false, sections)
+	if _, err := c.fetchAndDecodeNodeStats(context.Background()); err != nil {
+		t.Fatalf("Failed to fetch node stats: %s", err)
+	}
+	if path != "/_nodes/_local/stats/jvm,os" {
+		t.Errorf("unexpected path %s", path)
+	}
+
+	if _, err := ParseNodeStatsSections("jvm,ingest"); err == nil {
+		t.Error("expected an error for an unknown section")
+	}
+	if sections, err := ParseNodeStatsSections(""); err != nil || sections != nil {
+		t.Errorf("expected no sections, got %v, %v", sections, err)
+	}
+}
+
+func TestNodesRepositories(t *testing.T) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n","repositories":{"backup":{`+
+			`"shard_snapshots_started":5,"shard_snapshots_completed":4,"shard_snapshots_in_progress":1,`+
+			`"total_read_throttled_time_nanos":1500000000,"total_write_throttled_time_nanos":250000000}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	sections := []string{"jvm", "repositories"}
+
+	// the section is only requested once the version is known to support it
+	for version, want := range map[string]string{
+		"":       "/_nodes/_local/stats/jvm",
+		"8.12.2": "/_nodes/_local/stats/jvm",
+		"8.13.0": "/_nodes/_local/stats/jvm,repositories",
+	} {
+		c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", false, false, false, sections)
+		if version != "" {
+			c.SetClusterInfo(&clusterinfo.Response{Version: clusterinfo.VersionInfo{Number: semver.MustParse(version)}})
+		}
+		if _, err := c.fetchAndDecodeNodeStats(context.Background()); err != nil {
+			t.Fatalf("Failed to fetch node stats: %s", err)
+		}
+		if path != want {
+			t.Errorf("expected path %s for version %q, got %s", want, version, path)
+		}
+	}
+
+	c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", false, false, false, sections)
+	c.SetClusterInfo(&clusterinfo.Response{Version: clusterinfo.VersionInfo{Number: semver.MustParse("8.13.0")}})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "repository" && l.GetValue() == "backup" {
+					values[mf.GetName()] = m.GetCounter().GetValue() + m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	for name, want := range map[string]float64{
+		"elasticsearch_repository_shard_snapshots_started_total":   5,
+		"elasticsearch_repository_shard_snapshots_completed_total": 4,
+		"elasticsearch_repository_shard_snapshots_in_progress":     1,
+		"elasticsearch_repository_read_throttled_seconds_total":    1.5,
+		"elasticsearch_repository_write_throttled_seconds_total":   0.25,
+	} {
+		if values[name] != want {
+			t.Errorf("expected %s to be %v, got %v", name, want, values[name])
+		}
+	}
+}
+
+func TestNodesVersionedSectionsOnly(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n"}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// all sections would be requested without any of the selected ones
+	c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", false, false, false, []string{"repositories"})
+	if _, err := c.fetchAndDecodeNodeStats(context.Background()); err == nil || len(paths) != 0 {
+		t.Errorf("expected an error without requests before the version is known, got %v, %v", err, paths)
+	}
+	c.SetClusterInfo(&clusterinfo.Response{Version: clusterinfo.VersionInfo{Number: semver.MustParse("8.12.2")}})
+	if _, err := c.fetchAndDecodeNodeStats(context.Background()); err == nil || len(paths) != 0 {
+		t.Errorf("expected an error without requests for an older version, got %v, %v", err, paths)
+	}
+	c.SetClusterInfo(&clusterinfo.Response{Version: clusterinfo.VersionInfo{Number: semver.MustParse("8.13.0")}})
+	if _, err := c.fetchAndDecodeNodeStats(context.Background()); err != nil {
+		t.Fatalf("Failed to fetch node stats: %s", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/_nodes/_local/stats/repositories"}) {
+		t.Errorf("expected only the repositories to be requested, got %v", paths)
+	}
+
+	// the indices section isn't skipped if it's the only one left
+	c = NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", false, false, false, []string{"indices", "repositories"})
+	if sections := c.nodeSections(false); sections != "indices" {
+		t.Errorf("expected the indices section, got %q", sections)
+	}
+}
+
+func TestNodesRejections(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id":{"name":"n",`+
+			`"thread_pool":{"search":{"rejected":7},"search_coordination":{"rejected":1},"write":{"rejected":3},"get":{"rejected":9}},`+
+			`"indexing_pressure":{"memory":{"total":{"coordinating_rejections":4,"primary_rejections":2,"replica_rejections":0}}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", false, false, false, nil))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "elasticsearch_rejections_total" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			var operation, stage string
+			for _, l := range m.Label {
+				switch l.GetName() {
+				case "operation":
+					operation = l.GetValue()
+				case "stage":
+					stage = l.GetValue()
+				}
+			}
+			values[operation+" "+stage] = m.GetCounter().GetValue()
+		}
+	}
+	want := map[string]float64{
+		"search thread_pool":  7,
+		"search coordinating": 1,
+		"bulk thread_pool":    3,
+		"bulk coordinating":   4,
+		"bulk primary":        2,
+		"bulk replica":        0,
+	}
+	if len(values) != len(want) {
+		t.Errorf("expected %d rejections, got %v", len(want), values)
+	}
+	for key, v := range want {
+		if got, ok := values[key]; !ok || got != v {
+			t.Errorf("expected rejections %s to be %v, got %v", key, v, got)
+		}
+	}
+}
+
+func TestNodesTiers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_cat/allocation" {
+			fmt.Fprintln(w, `[{"node":"hot1","shards":"10"},{"node":"hot2","shards":"6"},{"node":"warm","shards":"20"},{"node":"legacy","shards":"2"}]`)
+			return
+		}
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{`+
+			`"id1":{"name":"hot1","roles":["data_hot","data_content"],"indices":{"store":{"size_in_bytes":100}},"fs":{"data":[{"total_in_bytes":1000,"available_in_bytes":900}]}},`+
+			`"id2":{"name":"hot2","roles":["data_hot","data_content"],"indices":{"store":{"size_in_bytes":50}},"fs":{"data":[{"total_in_bytes":1000,"available_in_bytes":950}]}},`+
+			`"id3":{"name":"warm","roles":["data_warm"],"indices":{"store":{"size_in_bytes":400}}},`+
+			`"id4":{"name":"legacy","roles":["data"],"attributes":{"data":"cold"}},`+
+			`"id5":{"name":"master","roles":["master"]}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil)
+	c.shardsPerNode = true
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "tier" {
+					values[mf.GetName()+" "+l.GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	want := map[string]float64{
+		"elasticsearch_tier_nodes hot":                      2,
+		"elasticsearch_tier_nodes content":                  2,
+		"elasticsearch_tier_nodes warm":                     1,
+		"elasticsearch_tier_nodes cold":                     1,
+		"elasticsearch_tier_shards hot":                     16,
+		"elasticsearch_tier_shards warm":                    20,
+		"elasticsearch_tier_shards cold":                    2,
+		"elasticsearch_tier_store_size_bytes hot":           150,
+		"elasticsearch_tier_store_size_bytes warm":          400,
+		"elasticsearch_tier_filesystem_size_bytes hot":      2000,
+		"elasticsearch_tier_filesystem_available_bytes hot": 1850,
+	}
+	for key, value := range want {
+		if values[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, values[key])
+		}
+	}
+	for _, key := range []string{"elasticsearch_tier_store_size_bytes cold", "elasticsearch_tier_filesystem_size_bytes warm"} {
+		if _, ok := values[key]; ok {
+			t.Errorf("expected %s to be omitted without stats", key)
+		}
+	}
+
+	// the tiers aren't exported from the stats of a single node
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "_local", false, false, false, nil))
+	mfs, err = registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	for _, mf := range mfs {
+		if strings.HasPrefix(mf.GetName(), "elasticsearch_tier_") {
+			t.Errorf("expected %s to be omitted for a single node", mf.GetName())
+		}
+	}
+}
+
+func TestNodesWithoutShards(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.HasPrefix(r.URL.Path, "/_nodes/coordinator/") {
+			fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{"id2":{"name":"coordinator","roles":["ingest"],"indices":{"docs":{"count":0}}}}}`)
+			return
+		}
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","nodes":{`+
+			`"id1":{"name":"data","roles":["data_hot","ingest"],"indices":{"docs":{"count":10}}},`+
+			`"id2":{"name":"coordinator","roles":["ingest"],"indices":{"docs":{"count":0}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// the indices stats of nodes without shards are omitted, their roles not
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local", false, false, false, nil))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	docs, roles := map[string]float64{}, map[string]bool{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() != "name" {
+					continue
+				}
+				switch mf.GetName() {
+				case "elasticsearch_indices_docs":
+					docs[l.GetValue()] = m.GetGauge().GetValue()
+				case "elasticsearch_nodes_roles":
+					roles[l.GetValue()] = true
+				}
+			}
+		}
+	}
+	if len(docs) != 1 || docs["data"] != 10 {
+		t.Errorf("expected the docs of the data node only, got %v", docs)
+	}
+	if !roles["coordinator"] {
+		t.Error("expected the roles of the coordinating node")
+	}
+
+	// the indices section isn't requested once the node is known to hold
+	// no shards
+	paths = nil
+	c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, false, "coordinator", false, false, false, []string{"indices", "jvm"})
+	for i := 0; i < 2; i++ {
+		if _, err := c.fetchAndDecodeNodeStats(context.Background()); err != nil {
+			t.Fatalf("Failed to fetch node stats: %s", err)
+		}
+	}
+	if want := []string{"/_nodes/coordinator/stats/indices,jvm", "/_nodes/coordinator/stats/jvm"}; strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("expected requests %v, got %v", want, paths)
+	}
+}
@@ -0,0 +1,386 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Query declares a search whose response is exported as metrics, e.g. the
+// buckets of an aggregation
+type Query struct {
+	// Name is the part of the metric names following elasticsearch_query_
+	Name string
+	// Indices is the comma separated list of indices or patterns searched
+	Indices string
+	// Body is the JSON body of the search
+	Body string
+	// Interval is the minimum interval between two searches, the metrics of
+	// the previous search are exported in between. They are kept by the
+	// Queries collector, so collectors built per scrape search every time.
+	Interval time.Duration
+	Metrics  []QueryMetric
+}
+
+// QueryMetric maps values of the search response to a metric. The paths are
+// dot separated keys of the JSON objects.
+type QueryMetric struct {
+	// Name is the last part of the metric name, e.g. elasticsearch_query_<query>_<name>
+	Name string
+	Help string
+	Type prometheus.ValueType
+	// Buckets is the path of the buckets of an aggregation, e.g.
+	// aggregations.tenants.buckets. A metric is exported per bucket if set,
+	// Value and Labels are relative to the bucket then.
+	Buckets string
+	// Value is the path of the value, e.g. doc_count or hits.total.value
+	Value string
+	// Labels are the paths of the values of the labels by label name, e.g.
+	// tenant: key
+	Labels map[string]string
+}
+
+// CountQuery declares a count of the documents matching a query, exported as
+// elasticsearch_query_doc_count{name="<name>"}
+type CountQuery struct {
+	Name string
+	// Indices is the comma separated list of indices or patterns counted
+	Indices string
+	// Query is the JSON query DSL, e.g. {"range":{"@timestamp":{"gte":"now-5m"}}},
+	// all documents are counted if empty
+	Query string
+}
+
+type queryMetric struct {
+	QueryMetric
+	Desc       *prometheus.Desc
+	labelNames []string
+}
+
+type query struct {
+	Query
+	metrics []*queryMetric
+
+	mtx     sync.Mutex
+	lastRun time.Time
+	last    []prometheus.Metric
+	lastErr error
+}
+
+// Queries information struct, the metrics of the searches declared in the
+// configuration
+type Queries struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	queries []*query
+	counts  []CountQuery
+
+	docCount *prometheus.Desc
+}
+
+// NewQueries defines the Prometheus metrics of the queries and counts
+func NewQueries(logger log.Logger, client *http.Client, url *url.URL, queries []Query, counts []CountQuery) *Queries {
+	subsystem := "query"
+
+	q := &Queries{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last run of the ElasticSearch queries successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch query scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		counts: counts,
+		docCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "doc_count"),
+			"Number of documents matching the count query.",
+			[]string{"name"}, nil,
+		),
+	}
+	for _, qu := range queries {
+		e := &query{Query: qu}
+		for _, metric := range qu.Metrics {
+			labelNames := make([]string, 0, len(metric.Labels))
+			for name := range metric.Labels {
+				labelNames = append(labelNames, name)
+			}
+			sort.Strings(labelNames)
+			help := metric.Help
+			if help == "" {
+				help = fmt.Sprintf("Value %s of the query %s.", metric.Value, qu.Name)
+			}
+			e.metrics = append(e.metrics, &queryMetric{
+				QueryMetric: metric,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, subsystem, qu.Name+"_"+metric.Name),
+					help,
+					labelNames, nil,
+				),
+				labelNames: labelNames,
+			})
+		}
+		q.queries = append(q.queries, e)
+	}
+	return q
+}
+
+// Describe add Queries metrics descriptions
+func (q *Queries) Describe(ch chan<- *prometheus.Desc) {
+	for _, qu := range q.queries {
+		for _, metric := range qu.metrics {
+			ch <- metric.Desc
+		}
+	}
+	ch <- q.docCount
+	ch <- q.up
+	ch <- q.totalScrapes.Desc()
+	ch <- q.jsonParseFailures.Desc()
+}
+
+// fetchAndDecode decodes the response of Elasticsearch to the body posted to
+// api, e.g. _search, of the indices
+func (q *Queries) fetchAndDecode(ctx context.Context, indices, api, body string, data interface{}) error {
+	u := *q.url
+	u.Path = path.Join(u.Path, indices, api)
+	res, err := post(ctx, q.client, u.String(), strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to get %s of %s from %s://%s:%s%s: %s",
+			api, indices, u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(q.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := q.decodeJSON(q.logger, res.Body, "query", data); err != nil {
+		q.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("query").Inc()
+		return err
+	}
+	return nil
+}
+
+// lookupPath returns the value at the dot separated path of keys in v
+func lookupPath(v interface{}, p string) (interface{}, bool) {
+	if p == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(p, ".") {
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// queryValue converts a value of the response to the value of a metric
+func queryValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// metrics returns the metrics of the search response and the number of
+// buckets skipped as their labels repeat those of a previous bucket, which
+// would fail the whole scrape of the registry. Buckets lacking the value are
+// skipped as well.
+func (metric *queryMetric) metrics(response interface{}) ([]prometheus.Metric, int) {
+	var rows []interface{}
+	if metric.Buckets == "" {
+		rows = []interface{}{response}
+	} else {
+		buckets, _ := lookupPath(response, metric.Buckets)
+		switch buckets := buckets.(type) {
+		case []interface{}:
+			rows = buckets
+		case map[string]interface{}:
+			// keyed buckets, e.g. of filters aggregations, the key is added
+			// to the bucket
+			keys := make([]string, 0, len(buckets))
+			for key := range buckets {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if bucket, ok := buckets[key].(map[string]interface{}); ok {
+					if _, ok := bucket["key"]; !ok {
+						bucket["key"] = key
+					}
+					rows = append(rows, bucket)
+				}
+			}
+		}
+	}
+
+	var metrics []prometheus.Metric
+	seen := make(map[string]bool, len(rows))
+	duplicates := 0
+	for _, row := range rows {
+		v, _ := lookupPath(row, metric.Value)
+		value, ok := queryValue(v)
+		if !ok {
+			continue
+		}
+		labels := make([]string, 0, len(metric.labelNames))
+		for _, name := range metric.labelNames {
+			label, ok := lookupPath(row, metric.Labels[name])
+			if !ok || label == nil {
+				labels = append(labels, "")
+				continue
+			}
+			if f, ok := label.(float64); ok {
+				// numeric keys, e.g. of histograms, without exponent
+				labels = append(labels, strconv.FormatFloat(f, 'f', -1, 64))
+				continue
+			}
+			labels = append(labels, fmt.Sprint(label))
+		}
+		key := strings.Join(labels, "\xff")
+		if seen[key] {
+			duplicates++
+			continue
+		}
+		seen[key] = true
+		metrics = append(metrics, prometheus.MustNewConstMetric(metric.Desc, metric.Type, value, labels...))
+	}
+	return metrics, duplicates
+}
+
+// run returns the metrics of the query, searching again once its interval
+// elapsed since the previous search. Metrics whose labels aren't unique are
+// skipped and fail the query, the others are returned along with the error.
+func (q *Queries) run(ctx context.Context, qu *query) ([]prometheus.Metric, error) {
+	qu.mtx.Lock()
+	defer qu.mtx.Unlock()
+	if !qu.lastRun.IsZero() && time.Since(qu.lastRun) < qu.Interval {
+		return qu.last, qu.lastErr
+	}
+
+	var response interface{}
+	if err := q.fetchAndDecode(ctx, qu.Indices, "_search", qu.Body, &response); err != nil {
+		return nil, err
+	}
+	var (
+		metrics []prometheus.Metric
+		err     error
+	)
+	for _, metric := range qu.metrics {
+		m, duplicates := metric.metrics(response)
+		if duplicates > 0 {
+			err = fmt.Errorf("metric %s: skipped %d buckets with duplicate labels, the labels must identify the buckets", metric.Name, duplicates)
+		}
+		metrics = append(metrics, m...)
+	}
+	qu.lastRun = time.Now()
+	qu.last, qu.lastErr = metrics, err
+	return metrics, err
+}
+
+// Collect gets Queries metric values
+func (q *Queries) Collect(ch chan<- prometheus.Metric) {
+	_ = q.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects Queries metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape, the
+// metrics of the other queries are collected regardless.
+func (q *Queries) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	q.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(q.up, prometheus.GaugeValue, up)
+		ch <- q.totalScrapes
+		ch <- q.jsonParseFailures
+	}()
+
+	var scrapeErr error
+	for _, qu := range q.queries {
+		metrics, err := q.run(ctx, qu)
+		if err != nil {
+			_ = level.Warn(q.logger).Log(
+				"msg", "failed to run query",
+				"query", qu.Name,
+				"err", err,
+			)
+			scrapeErr = err
+		}
+		for _, m := range metrics {
+			ch <- m
+		}
+	}
+	for _, count := range q.counts {
+		body := "{}"
+		if count.Query != "" {
+			body = `{"query":` + count.Query + `}`
+		}
+		var response struct {
+			Count int64 `json:"count"`
+		}
+		if err := q.fetchAndDecode(ctx, count.Indices, "_count", body, &response); err != nil {
+			_ = level.Warn(q.logger).Log(
+				"msg", "failed to run count query",
+				"query", count.Name,
+				"err", err,
+			)
+			scrapeErr = err
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(q.docCount, prometheus.GaugeValue, float64(response.Count), count.Name)
+	}
+	if scrapeErr == nil {
+		up = 1
+	}
+	return scrapeErr
+}
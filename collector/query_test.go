@@ -0,0 +1,192 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestQueries(t *testing.T) {
+	searches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/logs-*/_search" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != `{"size":0}` {
+			t.Errorf("unexpected body %s", body)
+		}
+		searches++
+		fmt.Fprintln(w, `{"hits":{"total":{"value":30}},"aggregations":{`+
+			`"tenants":{"buckets":[{"key":"a","doc_count":20},{"key":"b","doc_count":10}]},`+
+			`"days":{"buckets":[{"key":1700000000000,"doc_count":5}]},`+
+			`"levels":{"buckets":{"error":{"doc_count":2},"warn":{"doc_count":3}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewQueries(log.NewNopLogger(), http.DefaultClient, u, []Query{{
+		Name:     "logs",
+		Indices:  "logs-*",
+		Body:     `{"size":0}`,
+		Interval: time.Hour,
+		Metrics: []QueryMetric{
+			{Name: "docs", Type: prometheus.GaugeValue, Value: "hits.total.value"},
+			{Name: "tenant_docs", Type: prometheus.GaugeValue, Buckets: "aggregations.tenants.buckets", Value: "doc_count", Labels: map[string]string{"tenant": "key"}},
+			{Name: "day_docs", Type: prometheus.GaugeValue, Buckets: "aggregations.days.buckets", Value: "doc_count", Labels: map[string]string{"day": "key"}},
+			{Name: "level_docs", Type: prometheus.GaugeValue, Buckets: "aggregations.levels.buckets", Value: "doc_count", Labels: map[string]string{"level": "key"}},
+			{Name: "missing", Type: prometheus.GaugeValue, Value: "aggregations.missing.value"},
+		},
+	}}, nil))
+
+	for i := 0; i < 2; i++ {
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %s", err)
+		}
+		values := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				key := mf.GetName()
+				for _, l := range m.Label {
+					key += " " + l.GetValue()
+				}
+				values[key] = m.GetGauge().GetValue()
+			}
+		}
+		for key, want := range map[string]float64{
+			"elasticsearch_query_logs_docs":                   30,
+			"elasticsearch_query_logs_tenant_docs a":          20,
+			"elasticsearch_query_logs_tenant_docs b":          10,
+			"elasticsearch_query_logs_day_docs 1700000000000": 5,
+			"elasticsearch_query_logs_level_docs error":       2,
+			"elasticsearch_query_logs_level_docs warn":        3,
+			"elasticsearch_query_up":                          1,
+		} {
+			if got, ok := values[key]; !ok || got != want {
+				t.Errorf("expected %s to be %v, got %v", key, want, got)
+			}
+		}
+		if _, ok := values["elasticsearch_query_logs_missing"]; ok {
+			t.Error("expected missing values to be omitted")
+		}
+	}
+	// the second scrape is within the interval of the query
+	if searches != 1 {
+		t.Errorf("expected 1 search, got %d", searches)
+	}
+}
+
+func TestCountQueries(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/logs-*/_count":
+			if string(body) != `{"query":{"term":{"level":"error"}}}` {
+				t.Errorf("unexpected body %s", body)
+			}
+			fmt.Fprintln(w, `{"count":7,"_shards":{"total":1}}`)
+		case "/metrics-*/_count":
+			if string(body) != `{}` {
+				t.Errorf("unexpected body %s", body)
+			}
+			fmt.Fprintln(w, `{"count":1000}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewQueries(log.NewNopLogger(), http.DefaultClient, u, nil, []CountQuery{
+		{Name: "errors", Indices: "logs-*", Query: `{"term":{"level":"error"}}`},
+		{Name: "metrics", Indices: "metrics-*"},
+		{Name: "missing", Indices: "missing"},
+	}))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_query_doc_count errors":  7,
+		"elasticsearch_query_doc_count metrics": 1000,
+		"elasticsearch_query_up":                0,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, got)
+		}
+	}
+	if _, ok := values["elasticsearch_query_doc_count missing"]; ok {
+		t.Error("expected the failed count to be omitted")
+	}
+}
+
+func TestQueriesDuplicateLabels(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"aggregations":{"hosts":{"buckets":[`+
+			`{"key":["a","x"],"doc_count":1,"host":{"name":"a"}},`+
+			`{"key":["a","y"],"doc_count":2,"host":{"name":"a"}},`+
+			`{"key":["b","x"],"doc_count":3,"host":{"name":"b"}}]}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewQueries(log.NewNopLogger(), http.DefaultClient, u, []Query{{
+		Name:    "hosts",
+		Indices: "logs-*",
+		Metrics: []QueryMetric{
+			{Name: "docs", Type: prometheus.GaugeValue, Buckets: "aggregations.hosts.buckets", Value: "doc_count", Labels: map[string]string{"host": "host.name"}},
+		},
+	}}, nil))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_query_hosts_docs a": 1,
+		"elasticsearch_query_hosts_docs b": 3,
+		"elasticsearch_query_up":           0,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, got)
+		}
+	}
+}
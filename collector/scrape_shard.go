@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// ScrapeShard is the share of the targets or nodes scraped by one of several
+// exporter replicas, given as <index>/<count>, e.g. 2/5 for the second of five
+// replicas. Keys are assigned by jump consistent hashing, so that changing the
+// number of replicas moves as few keys as possible. A nil ScrapeShard owns all
+// keys.
+type ScrapeShard struct {
+	Index int
+	Count int
+}
+
+// ParseScrapeShard parses a shard given as <index>/<count>, the index starting
+// at 1. An empty string yields nil.
+func ParseScrapeShard(s string) (*ScrapeShard, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid shard %q, expected <index>/<count>", s)
+	}
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard index %q: %s", parts[0], err)
+	}
+	count, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard count %q: %s", parts[1], err)
+	}
+	if count < 1 || index < 1 || index > count {
+		return nil, fmt.Errorf("invalid shard %q, the index must be between 1 and the count", s)
+	}
+	return &ScrapeShard{Index: index, Count: count}, nil
+}
+
+// Owns reports whether key, e.g. a node ID, is assigned to the shard
+func (s *ScrapeShard) Owns(key string) bool {
+	if s == nil || s.Count <= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return jumpHash(h.Sum64(), s.Count) == s.Index-1
+}
+
+// String returns the shard as <index>/<count>
+func (s *ScrapeShard) String() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// jumpHash returns the bucket of key among buckets, see "A Fast, Minimal
+// Memory, Consistent Hash Algorithm" by Lamping and Veach
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseScrapeShard(t *testing.T) {
+	s, err := ParseScrapeShard("2/5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Index != 2 || s.Count != 5 || s.String() != "2/5" {
+		t.Errorf("unexpected shard %+v", s)
+	}
+	if s, err := ParseScrapeShard(""); s != nil || err != nil {
+		t.Errorf("expected no shard, got %+v, %v", s, err)
+	}
+	for _, invalid := range []string{"2", "0/5", "6/5", "a/5", "1/b", "1/0", "1/2/3"} {
+		if _, err := ParseScrapeShard(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestScrapeShardOwns(t *testing.T) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("node-%d", i)
+	}
+	owners := func(count int) map[string]int {
+		owner := make(map[string]int, len(keys))
+		for _, key := range keys {
+			for index := 1; index <= count; index++ {
+				if (&ScrapeShard{Index: index, Count: count}).Owns(key) {
+					if _, ok := owner[key]; ok {
+						t.Fatalf("key %s owned by several shards of %d", key, count)
+					}
+					owner[key] = index
+				}
+			}
+			if _, ok := owner[key]; !ok {
+				t.Fatalf("key %s owned by no shard of %d", key, count)
+			}
+		}
+		return owner
+	}
+
+	four, five := owners(4), owners(5)
+	perShard := map[int]int{}
+	moved := 0
+	for _, key := range keys {
+		perShard[five[key]]++
+		if four[key] != five[key] {
+			moved++
+			if five[key] != 5 {
+				t.Errorf("key %s moved between existing shards", key)
+			}
+		}
+	}
+	for index, n := range perShard {
+		if n < 150 || n > 250 {
+			t.Errorf("expected about 200 keys in shard %d, got %d", index, n)
+		}
+	}
+	// a fifth replica takes about a fifth of the keys
+	if moved < 150 || moved > 250 {
+		t.Errorf("expected about 200 keys to move, got %d", moved)
+	}
+
+	var unsharded *ScrapeShard
+	if !unsharded.Owns("node-1") {
+		t.Error("expected a nil shard to own every key")
+	}
+}
@@ -0,0 +1,197 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Security information struct, an inventory of the realms and API keys of the
+// cluster
+type Security struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+	// expiryWindow is the window of the API keys counted as expiring
+	expiryWindow time.Duration
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	enabled, realms                *prometheus.Desc
+	activeAPIKeys, expiringAPIKeys *prometheus.Desc
+}
+
+// NewSecurity defines Security Prometheus metrics. API keys expiring within
+// expiryWindow are counted as expiring.
+func NewSecurity(logger log.Logger, client *http.Client, url *url.URL, expiryWindow time.Duration) *Security {
+	subsystem := "security"
+
+	return &Security{
+		logger:       logger,
+		client:       client,
+		url:          url,
+		expiryWindow: expiryWindow,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch security endpoints successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch security scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		enabled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "enabled"),
+			"Whether the security features are enabled.",
+			nil, nil,
+		),
+		realms: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "realms"),
+			"Number of realms configured by type.",
+			[]string{"type"}, nil,
+		),
+		activeAPIKeys: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "api_keys_active"),
+			"Number of API keys neither invalidated nor expired.",
+			nil, nil,
+		),
+		expiringAPIKeys: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "api_keys_expiring"),
+			fmt.Sprintf("Number of active API keys expiring within %s.", expiryWindow),
+			nil, nil,
+		),
+	}
+}
+
+// Describe add Security metrics descriptions
+func (s *Security) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.enabled
+	ch <- s.realms
+	ch <- s.activeAPIKeys
+	ch <- s.expiringAPIKeys
+	ch <- s.up
+	ch <- s.totalScrapes.Desc()
+	ch <- s.jsonParseFailures.Desc()
+}
+
+// apiKeyQuery returns the query counting the active API keys and, by the
+// expiring aggregation, those expiring within the expiry window. The
+// aggregations of the query API key API require Elasticsearch 8.5.
+func (s *Security) apiKeyQuery() string {
+	return fmt.Sprintf(`{"size":0,"query":{"bool":{"filter":[{"term":{"invalidated":false}}],`+
+		`"should":[{"range":{"expiration":{"gt":"now"}}},{"bool":{"must_not":[{"exists":{"field":"expiration"}}]}}],"minimum_should_match":1}},`+
+		`"aggs":{"expiring":{"filter":{"range":{"expiration":{"lte":"now+%ds"}}}}}}`, int64(s.expiryWindow/time.Second))
+}
+
+// fetchAndDecode decodes the response of Elasticsearch to a GET request for p
+// or, with body, to a POST request
+func (s *Security) fetchAndDecode(ctx context.Context, p, query string, body io.Reader, data interface{}) error {
+	u := *s.url
+	u.Path = path.Join(u.Path, p)
+	u.RawQuery = query
+	var (
+		res *http.Response
+		err error
+	)
+	if body != nil {
+		res, err = post(ctx, s.client, u.String(), body)
+	} else {
+		res, err = get(ctx, s.client, u.String())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get %s from %s://%s:%s%s: %s",
+			p, u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(s.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := s.decodeJSON(s.logger, res.Body, "security", data); err != nil {
+		s.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("security").Inc()
+		return err
+	}
+	return nil
+}
+
+// Collect gets Security metric values
+func (s *Security) Collect(ch chan<- prometheus.Metric) {
+	_ = s.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects Security metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape. The API
+// keys are only queried if the security features are enabled.
+func (s *Security) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	s.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(s.up, prometheus.GaugeValue, up)
+		ch <- s.totalScrapes
+		ch <- s.jsonParseFailures
+	}()
+
+	var usage securityUsageResponse
+	if err := s.fetchAndDecode(ctx, "/_xpack/usage", "filter_path=security.enabled,security.realms", nil, &usage); err != nil {
+		_ = level.Warn(s.logger).Log(
+			"msg", "failed to fetch and decode security usage",
+			"err", err,
+		)
+		return err
+	}
+
+	var keys apiKeyQueryResponse
+	if usage.Security.Enabled {
+		if err := s.fetchAndDecode(ctx, "/_security/_query/api_key", "", strings.NewReader(s.apiKeyQuery()), &keys); err != nil {
+			_ = level.Warn(s.logger).Log(
+				"msg", "failed to fetch and decode api keys",
+				"err", err,
+			)
+			return err
+		}
+	}
+	up = 1
+
+	var enabled float64
+	if usage.Security.Enabled {
+		enabled = 1
+	}
+	ch <- prometheus.MustNewConstMetric(s.enabled, prometheus.GaugeValue, enabled)
+	if !usage.Security.Enabled {
+		return nil
+	}
+	for realmType, realms := range usage.Security.Realms {
+		ch <- prometheus.MustNewConstMetric(s.realms, prometheus.GaugeValue, float64(len(realms.Name)), realmType)
+	}
+	ch <- prometheus.MustNewConstMetric(s.activeAPIKeys, prometheus.GaugeValue, float64(keys.Total))
+	ch <- prometheus.MustNewConstMetric(s.expiringAPIKeys, prometheus.GaugeValue, float64(keys.Aggregations.Expiring.DocCount))
+	return nil
+}
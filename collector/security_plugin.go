@@ -0,0 +1,144 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// securityPluginHealthResponse is a representation of the health API of the
+// OpenSearch security plugin
+type securityPluginHealthResponse struct {
+	Message *string `json:"message"`
+	Mode    string  `json:"mode"`
+	Status  string  `json:"status"`
+}
+
+// SecurityPlugin information struct, the health of the security plugin of
+// OpenSearch
+type SecurityPlugin struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	healthy *prometheus.Desc
+}
+
+// NewSecurityPlugin defines Security Plugin Prometheus metrics
+func NewSecurityPlugin(logger log.Logger, client *http.Client, url *url.URL) *SecurityPlugin {
+	subsystem := "security_plugin"
+
+	return &SecurityPlugin{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the OpenSearch security plugin health endpoint successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total OpenSearch security plugin scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		healthy: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "healthy"),
+			"Whether the security plugin reports the status UP, by mode, e.g. strict.",
+			[]string{"mode"}, nil,
+		),
+	}
+}
+
+// Describe add Security Plugin metrics descriptions
+func (s *SecurityPlugin) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.healthy
+	ch <- s.up
+	ch <- s.totalScrapes.Desc()
+	ch <- s.jsonParseFailures.Desc()
+}
+
+// fetchAndDecodeHealth decodes the health of the security plugin, which
+// responds with 503 Service Unavailable while it isn't initialized
+func (s *SecurityPlugin) fetchAndDecodeHealth(ctx context.Context) (securityPluginHealthResponse, error) {
+	var shr securityPluginHealthResponse
+
+	u := *s.url
+	u.Path = path.Join(u.Path, "/_plugins/_security/health")
+	res, err := get(ctx, s.client, u.String())
+	if err != nil {
+		return shr, fmt.Errorf("failed to get security plugin health from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(s.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusServiceUnavailable {
+		return shr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := s.decodeJSON(s.logger, res.Body, "security_plugin", &shr); err != nil {
+		s.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("security_plugin").Inc()
+		return shr, err
+	}
+	return shr, nil
+}
+
+// Collect gets Security Plugin metric values
+func (s *SecurityPlugin) Collect(ch chan<- prometheus.Metric) {
+	_ = s.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects SecurityPlugin metrics, aborting the request to
+// OpenSearch once ctx is done. It returns the error of the scrape.
+func (s *SecurityPlugin) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	s.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(s.up, prometheus.GaugeValue, up)
+		ch <- s.totalScrapes
+		ch <- s.jsonParseFailures
+	}()
+
+	shr, err := s.fetchAndDecodeHealth(ctx)
+	if err != nil {
+		_ = level.Warn(s.logger).Log(
+			"msg", "failed to fetch and decode security plugin health",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	var healthy float64
+	if strings.EqualFold(shr.Status, "UP") {
+		healthy = 1
+	}
+	ch <- prometheus.MustNewConstMetric(s.healthy, prometheus.GaugeValue, healthy, shr.Mode)
+	return nil
+}
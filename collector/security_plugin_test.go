@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSecurityPlugin(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		code    int
+		body    string
+		up      float64
+		healthy map[string]float64
+	}{
+		{
+			name:    "up",
+			code:    http.StatusOK,
+			body:    `{"message":null,"mode":"strict","status":"UP"}`,
+			up:      1,
+			healthy: map[string]float64{"strict": 1},
+		},
+		{
+			name:    "not initialized",
+			code:    http.StatusServiceUnavailable,
+			body:    `{"message":"Not initialized","mode":"strict","status":"DOWN"}`,
+			up:      1,
+			healthy: map[string]float64{"strict": 0},
+		},
+		{
+			name:    "error",
+			code:    http.StatusInternalServerError,
+			body:    `{}`,
+			up:      0,
+			healthy: map[string]float64{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/_plugins/_security/health" {
+					t.Errorf("unexpected request %s", r.URL)
+				}
+				w.WriteHeader(tc.code)
+				fmt.Fprintln(w, tc.body)
+			}))
+			defer ts.Close()
+			u, err := url.Parse(ts.URL)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %s", err)
+			}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(NewSecurityPlugin(log.NewNopLogger(), http.DefaultClient, u))
+			mfs, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("Failed to gather: %s", err)
+			}
+
+			healthy := map[string]float64{}
+			for _, mf := range mfs {
+				for _, m := range mf.Metric {
+					switch mf.GetName() {
+					case "elasticsearch_security_plugin_up":
+						if got := m.GetGauge().GetValue(); got != tc.up {
+							t.Errorf("expected up %v, got %v", tc.up, got)
+						}
+					case "elasticsearch_security_plugin_healthy":
+						healthy[m.Label[0].GetValue()] = m.GetGauge().GetValue()
+					}
+				}
+			}
+			if fmt.Sprint(healthy) != fmt.Sprint(tc.healthy) {
+				t.Errorf("expected healthy %v, got %v", tc.healthy, healthy)
+			}
+		})
+	}
+}
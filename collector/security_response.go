@@ -0,0 +1,29 @@
+package collector
+
+// securityUsageResponse is a representation of the security section of the
+// Elasticsearch X-Pack usage API
+type securityUsageResponse struct {
+	Security struct {
+		Enabled bool                           `json:"enabled"`
+		Realms  map[string]securityRealmsUsage `json:"realms"`
+	} `json:"security"`
+}
+
+// securityRealmsUsage is the usage of a realm type, the names of the realms
+// are only reported for enabled types
+type securityRealmsUsage struct {
+	Available bool     `json:"available"`
+	Enabled   bool     `json:"enabled"`
+	Name      []string `json:"name"`
+}
+
+// apiKeyQueryResponse is a representation of the Elasticsearch query API key
+// API, without the keys themselves
+type apiKeyQueryResponse struct {
+	Total        int64 `json:"total"`
+	Aggregations struct {
+		Expiring struct {
+			DocCount int64 `json:"doc_count"`
+		} `json:"expiring"`
+	} `json:"aggregations"`
+}
@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSecurity(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_xpack/usage":
+			fmt.Fprintln(w, `{"security":{"enabled":true,"realms":{`+
+				`"native":{"available":true,"enabled":true,"name":["native1"]},`+
+				`"ldap":{"available":true,"enabled":true,"name":["ldap1","ldap2"]},`+
+				`"saml":{"available":true,"enabled":false}}}}`)
+		case "/_security/_query/api_key":
+			if r.Method != http.MethodPost {
+				t.Errorf("unexpected method %s", r.Method)
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			query = string(body)
+			fmt.Fprintln(w, `{"total":42,"count":0,"api_keys":[],"aggregations":{"expiring":{"doc_count":3}}}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewSecurity(log.NewNopLogger(), http.DefaultClient, u, 72*time.Hour))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	if !strings.Contains(query, `"now+259200s"`) {
+		t.Errorf("expected the expiry window in the query %s", query)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_security_up":                1,
+		"elasticsearch_security_enabled":           1,
+		"elasticsearch_security_realms native":     1,
+		"elasticsearch_security_realms ldap":       2,
+		"elasticsearch_security_realms saml":       0,
+		"elasticsearch_security_api_keys_active":   42,
+		"elasticsearch_security_api_keys_expiring": 3,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, got)
+		}
+	}
+}
+
+func TestSecurityDisabled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_xpack/usage" {
+			t.Errorf("unexpected request %s with security disabled", r.URL)
+		}
+		fmt.Fprintln(w, `{"security":{"enabled":false}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewSecurity(log.NewNopLogger(), http.DefaultClient, u, time.Hour))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "elasticsearch_security_enabled":
+			if v := mf.Metric[0].GetGauge().GetValue(); v != 0 {
+				t.Errorf("expected security to be disabled, got %v", v)
+			}
+		case "elasticsearch_security_realms", "elasticsearch_security_api_keys_active", "elasticsearch_security_api_keys_expiring":
+			t.Errorf("unexpected metric %s with security disabled", mf.GetName())
+		}
+	}
+}
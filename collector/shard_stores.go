@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ShardStores information struct, the nodes holding copies of the shards of
+// red and yellow indices, e.g. to tell which node to bring back after
+// primaries became unassigned
+type ShardStores struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	info *prometheus.Desc
+}
+
+// NewShardStores defines Shard Stores Prometheus metrics
+func NewShardStores(logger log.Logger, client *http.Client, url *url.URL) *ShardStores {
+	subsystem := "shard_store"
+
+	return &ShardStores{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch shard stores endpoint successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch shard stores scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "info"),
+			"Copy of a shard of a red or yellow index found on a node, with its allocation and the type of the exception opening it if any.",
+			[]string{"index", "shard", "node", "node_id", "allocation", "store_exception"}, nil,
+		),
+	}
+}
+
+// Describe add Shard Stores metrics descriptions
+func (s *ShardStores) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.info
+	ch <- s.up
+	ch <- s.totalScrapes.Desc()
+	ch <- s.jsonParseFailures.Desc()
+}
+
+func (s *ShardStores) fetchAndDecodeShardStores(ctx context.Context) (shardStoresResponse, error) {
+	var ssr shardStoresResponse
+
+	u := *s.url
+	u.Path = path.Join(u.Path, "/_shard_stores")
+	// green indices are skipped by Elasticsearch, the response of a healthy
+	// cluster is empty
+	u.RawQuery = "status=red,yellow"
+	res, err := get(ctx, s.client, u.String())
+	if err != nil {
+		return ssr, fmt.Errorf("failed to get shard stores from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(s.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return ssr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := s.decodeJSON(s.logger, res.Body, "shard_stores", &ssr); err != nil {
+		s.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("shard_stores").Inc()
+		return ssr, err
+	}
+	return ssr, nil
+}
+
+// Collect gets Shard Stores metric values
+func (s *ShardStores) Collect(ch chan<- prometheus.Metric) {
+	_ = s.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects ShardStores metrics, aborting the request to
+// Elasticsearch once ctx is done. It returns the error of the scrape.
+func (s *ShardStores) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	s.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(s.up, prometheus.GaugeValue, up)
+		ch <- s.totalScrapes
+		ch <- s.jsonParseFailures
+	}()
+
+	ssr, err := s.fetchAndDecodeShardStores(ctx)
+	if err != nil {
+		_ = level.Warn(s.logger).Log(
+			"msg", "failed to fetch and decode shard stores",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	for index, indexStores := range ssr.Indices {
+		for shard, shardStores := range indexStores.Shards {
+			for _, store := range shardStores.Stores {
+				ch <- prometheus.MustNewConstMetric(s.info, prometheus.GaugeValue, 1,
+					index, shard, store.Node.Name, store.NodeID, store.Allocation, store.StoreException)
+			}
+		}
+	}
+	return nil
+}
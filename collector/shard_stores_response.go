@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// shardStoresResponse is a representation of the Elasticsearch shard stores
+// API, the copies of the shards found on the nodes by index and shard number
+type shardStoresResponse struct {
+	Indices map[string]struct {
+		Shards map[string]struct {
+			Stores []shardStore `json:"stores"`
+		} `json:"shards"`
+	} `json:"indices"`
+}
+
+// shardStore is a copy of a shard on a node. Elasticsearch reports the node
+// keyed by its id next to the attributes of the copy.
+type shardStore struct {
+	NodeID         string
+	Node           shardStoreNode
+	AllocationID   string
+	Allocation     string
+	StoreException string
+}
+
+type shardStoreNode struct {
+	Name string `json:"name"`
+}
+
+// UnmarshalJSON decodes the copy of a shard, the only key besides the known
+// attributes is the id of the node
+func (s *shardStore) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		var err error
+		switch key {
+		case "allocation_id":
+			err = json.Unmarshal(value, &s.AllocationID)
+		case "allocation":
+			err = json.Unmarshal(value, &s.Allocation)
+		case "store_exception":
+			var exception struct {
+				Type string `json:"type"`
+			}
+			err = json.Unmarshal(value, &exception)
+			s.StoreException = exception.Type
+		default:
+			s.NodeID = key
+			err = json.Unmarshal(value, &s.Node)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode %s of shard store: %s", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestShardStores(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_shard_stores" || r.URL.Query().Get("status") != "red,yellow" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprintln(w, `{"indices":{"logs-1":{"shards":{"0":{"stores":[`+
+			`{"sPa3OgxLSYGvQ4oPs-Tajw":{"name":"node-1","ephemeral_id":"x","transport_address":"127.0.0.1:9300","attributes":{}},`+
+			`"allocation_id":"2iNySv_OQVePRX-yaRH_lQ","allocation":"primary"},`+
+			`{"JRsWpE8BRyiAdS4XvJ-dYg":{"name":"node-2","ephemeral_id":"y","transport_address":"127.0.0.2:9300","attributes":{}},`+
+			`"allocation_id":"0k5ckSvUT2yKbnpSQLtEMw","allocation":"unused",`+
+			`"store_exception":{"type":"corrupt_index_exception","reason":"checksum failed"}}]}}}}}`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewShardStores(log.NewNopLogger(), http.DefaultClient, u))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			labels := []string{mf.GetName()}
+			for _, l := range m.Label {
+				labels = append(labels, l.GetName()+"="+l.GetValue())
+			}
+			values[strings.Join(labels, " ")] = m.GetGauge().GetValue()
+		}
+	}
+	for _, key := range []string{
+		"elasticsearch_shard_store_up",
+		"elasticsearch_shard_store_info allocation=primary index=logs-1 node=node-1 node_id=sPa3OgxLSYGvQ4oPs-Tajw shard=0 store_exception=",
+		"elasticsearch_shard_store_info allocation=unused index=logs-1 node=node-2 node_id=JRsWpE8BRyiAdS4XvJ-dYg shard=0 store_exception=corrupt_index_exception",
+	} {
+		if v, ok := values[key]; !ok || v != 1 {
+			t.Errorf("expected %s to be 1, got %v", key, v)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"sync"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -42,14 +44,36 @@ type Snapshots struct {
 	logger log.Logger
 	client *http.Client
 	url    *url.URL
+	decoder
 
-	up                              prometheus.Gauge
+	up                              *prometheus.Desc
 	totalScrapes, jsonParseFailures prometheus.Counter
 
 	snapshotMetrics   []*snapshotMetric
 	repositoryMetrics []*repositoryMetric
+
+	// sizes exports the sizes of the snapshots by repository and policy,
+	// taken from the status of every snapshot. The sizes of completed
+	// snapshots don't change, so they're only requested once per
+	// collector; collectors built per scrape, e.g. by /probe, request them
+	// on every scrape.
+	sizes     bool
+	mtx       sync.Mutex
+	sizeCache map[string]snapshotSize
+
+	repositorySize, latestIncrementalSize, latestTotalSize *prometheus.Desc
+}
+
+// snapshotSize is the size of the files a snapshot added to the repository
+// and the size of all files it references
+type snapshotSize struct {
+	incremental, total float64
 }
 
+// snapshotStatusBatch is the number of snapshots whose status is requested at
+// once, bounding the length of the URL
+const snapshotStatusBatch = 50
+
 // NewSnapshots defines Snapshots Prometheus metrics
 func NewSnapshots(logger log.Logger, client *http.Client, url *url.URL) *Snapshots {
 	return &Snapshots{
@@ -57,10 +81,11 @@ func NewSnapshots(logger log.Logger, client *http.Client, url *url.URL) *Snapsho
 		client: client,
 		url:    url,
 
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "snapshot_stats", "up"),
-			Help: "Was the last scrape of the ElasticSearch snapshots endpoint successful.",
-		}),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "snapshot_stats", "up"),
+			"Was the last scrape of the ElasticSearch snapshots endpoint successful.",
+			nil, nil,
+		),
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: prometheus.BuildFQName(namespace, "snapshot_stats", "total_scrapes"),
 			Help: "Current total ElasticSearch snapshots scrapes.",
@@ -69,6 +94,21 @@ func NewSnapshots(logger log.Logger, client *http.Client, url *url.URL) *Snapsho
 			Name: prometheus.BuildFQName(namespace, "snapshot_stats", "json_parse_failures"),
 			Help: "Number of errors while parsing JSON.",
 		}),
+		repositorySize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "snapshot_stats", "repository_size_bytes"),
+			"Sum of the incremental sizes of the completed snapshots in the repository by policy, approximately the storage they use",
+			[]string{"repository", "policy"}, nil,
+		),
+		latestIncrementalSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "snapshot_stats", "latest_snapshot_incremental_size_bytes"),
+			"Size of the files the latest completed snapshot of the policy added to the repository",
+			[]string{"repository", "policy"}, nil,
+		),
+		latestTotalSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "snapshot_stats", "latest_snapshot_total_size_bytes"),
+			"Size of all files the latest completed snapshot of the policy references",
+			[]string{"repository", "policy"}, nil,
+		),
 		snapshotMetrics: []*snapshotMetric{
 			{
 				Type: prometheus.GaugeValue,
@@ -192,13 +232,16 @@ func (s *Snapshots) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range s.snapshotMetrics {
 		ch <- metric.Desc
 	}
-	ch <- s.up.Desc()
+	ch <- s.repositorySize
+	ch <- s.latestIncrementalSize
+	ch <- s.latestTotalSize
+	ch <- s.up
 	ch <- s.totalScrapes.Desc()
 	ch <- s.jsonParseFailures.Desc()
 }
 
-func (s *Snapshots) getAndParseURL(u *url.URL, data interface{}) error {
-	res, err := s.client.Get(u.String())
+func (s *Snapshots) getAndParseURL(ctx context.Context, u *url.URL, data interface{}) error {
+	res, err := get(ctx, s.client, u.String())
 	if err != nil {
 		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -218,20 +261,21 @@ func (s *Snapshots) getAndParseURL(u *url.URL, data interface{}) error {
 		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(data); err != nil {
+	if err := s.decodeJSON(s.logger, res.Body, "snapshots", data); err != nil {
 		s.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("snapshots").Inc()
 		return err
 	}
 	return nil
 }
 
-func (s *Snapshots) fetchAndDecodeSnapshotsStats() (map[string]SnapshotStatsResponse, error) {
+func (s *Snapshots) fetchAndDecodeSnapshotsStats(ctx context.Context) (map[string]SnapshotStatsResponse, error) {
 	mssr := make(map[string]SnapshotStatsResponse)
 
 	u := *s.url
 	u.Path = path.Join(u.Path, "/_snapshot")
 	var srr SnapshotRepositoriesResponse
-	err := s.getAndParseURL(&u, &srr)
+	err := s.getAndParseURL(ctx, &u, &srr)
 	if err != nil {
 		return nil, err
 	}
@@ -239,7 +283,7 @@ func (s *Snapshots) fetchAndDecodeSnapshotsStats() (map[string]SnapshotStatsResp
 		u := *s.url
 		u.Path = path.Join(u.Path, "/_snapshot", repository, "/_all")
 		var ssr SnapshotStatsResponse
-		err := s.getAndParseURL(&u, &ssr)
+		err := s.getAndParseURL(ctx, &u, &ssr)
 		if err != nil {
 			continue
 		}
@@ -249,29 +293,129 @@ func (s *Snapshots) fetchAndDecodeSnapshotsStats() (map[string]SnapshotStatsResp
 	return mssr, nil
 }
 
+// fetchSnapshotSizes returns the sizes of the completed snapshots of the
+// repository by uuid, requesting the status of the snapshots not cached yet
+func (s *Snapshots) fetchSnapshotSizes(ctx context.Context, repository string, snapshots []SnapshotStatDataResponse) (map[string]snapshotSize, error) {
+	sizes := make(map[string]snapshotSize, len(snapshots))
+	var missing []string
+	s.mtx.Lock()
+	for _, snapshot := range snapshots {
+		if snapshot.State == "IN_PROGRESS" {
+			continue
+		}
+		if size, ok := s.sizeCache[snapshot.UUID]; ok {
+			sizes[snapshot.UUID] = size
+			continue
+		}
+		missing = append(missing, snapshot.Snapshot)
+	}
+	s.mtx.Unlock()
+
+	for len(missing) > 0 {
+		batch := missing
+		if len(batch) > snapshotStatusBatch {
+			batch = batch[:snapshotStatusBatch]
+		}
+		missing = missing[len(batch):]
+
+		u := *s.url
+		u.Path = path.Join(u.Path, "/_snapshot", repository, strings.Join(batch, ","), "/_status")
+		var ssr snapshotStatusResponse
+		if err := s.getAndParseURL(ctx, &u, &ssr); err != nil {
+			return nil, err
+		}
+		// the batches fetched are cached right away, so that a failing
+		// batch doesn't discard them
+		s.mtx.Lock()
+		if s.sizeCache == nil {
+			s.sizeCache = make(map[string]snapshotSize)
+		}
+		for _, status := range ssr.Snapshots {
+			size := snapshotSize{
+				incremental: float64(status.Stats.Incremental.SizeInBytes),
+				total:       float64(status.Stats.Total.SizeInBytes),
+			}
+			sizes[status.UUID] = size
+			s.sizeCache[status.UUID] = size
+		}
+		s.mtx.Unlock()
+	}
+	return sizes, nil
+}
+
+// collectSizes collects the sizes of the snapshots of the repository by
+// policy, snapshots taken without a policy have an empty policy label
+func (s *Snapshots) collectSizes(ctx context.Context, ch chan<- prometheus.Metric, repository string, snapshots []SnapshotStatDataResponse) error {
+	sizes, err := s.fetchSnapshotSizes(ctx, repository, snapshots)
+	if err != nil {
+		return err
+	}
+	repositorySizes := map[string]float64{}
+	latest := map[string]snapshotSize{}
+	// the snapshots are ordered by start time, the last one of a policy is
+	// the latest
+	for _, snapshot := range snapshots {
+		size, ok := sizes[snapshot.UUID]
+		if !ok {
+			continue
+		}
+		policy := snapshot.Metadata.Policy
+		repositorySizes[policy] += size.incremental
+		latest[policy] = size
+	}
+	for policy, size := range repositorySizes {
+		ch <- prometheus.MustNewConstMetric(s.repositorySize, prometheus.GaugeValue, size, repository, policy)
+		ch <- prometheus.MustNewConstMetric(s.latestIncrementalSize, prometheus.GaugeValue, latest[policy].incremental, repository, policy)
+		ch <- prometheus.MustNewConstMetric(s.latestTotalSize, prometheus.GaugeValue, latest[policy].total, repository, policy)
+	}
+	return nil
+}
+
 // Collect gets Snapshots metric values
 func (s *Snapshots) Collect(ch chan<- prometheus.Metric) {
+	_ = s.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects Snapshots metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape, failing
+// to fetch the snapshot sizes of a repository fails the scrape while the other
+// metrics are collected regardless.
+func (s *Snapshots) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
 	s.totalScrapes.Inc()
 	defer func() {
-		ch <- s.up
+		ch <- prometheus.MustNewConstMetric(s.up, prometheus.GaugeValue, up)
 		ch <- s.totalScrapes
 		ch <- s.jsonParseFailures
 	}()
 
 	// indices
-	snapshotsStatsResp, err := s.fetchAndDecodeSnapshotsStats()
+	snapshotsStatsResp, err := s.fetchAndDecodeSnapshotsStats(ctx)
 	if err != nil {
-		s.up.Set(0)
 		_ = level.Warn(s.logger).Log(
 			"msg", "failed to fetch and decode snapshot stats",
 			"err", err,
 		)
-		return
+		return err
+	}
+
+	if s.sizes {
+		s.pruneSizeCache(snapshotsStatsResp)
 	}
-	s.up.Set(1)
 
 	// Snapshots stats
+	var scrapeErr error
 	for repositoryName, snapshotStats := range snapshotsStatsResp {
+		if s.sizes {
+			if err := s.collectSizes(ctx, ch, repositoryName, snapshotStats.Snapshots); err != nil {
+				_ = level.Warn(s.logger).Log(
+					"msg", "failed to fetch and decode snapshot sizes",
+					"repository", repositoryName,
+					"err", err,
+				)
+				scrapeErr = fmt.Errorf("failed to fetch the snapshot sizes of repository %s: %s", repositoryName, err)
+			}
+		}
 		for _, metric := range s.repositoryMetrics {
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
@@ -294,4 +438,25 @@ func (s *Snapshots) Collect(ch chan<- prometheus.Metric) {
 			)
 		}
 	}
+	if scrapeErr == nil {
+		up = 1
+	}
+	return scrapeErr
+}
+
+// pruneSizeCache drops the sizes of the deleted snapshots from the cache
+func (s *Snapshots) pruneSizeCache(snapshotsStats map[string]SnapshotStatsResponse) {
+	uuids := map[string]bool{}
+	for _, snapshotStats := range snapshotsStats {
+		for _, snapshot := range snapshotStats.Snapshots {
+			uuids[snapshot.UUID] = true
+		}
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for uuid := range s.sizeCache {
+		if !uuids[uuid] {
+			delete(s.sizeCache, uuid)
+		}
+	}
 }
@@ -26,6 +26,27 @@ type SnapshotStatDataResponse struct {
 		Failed     int64 `json:"failed"`
 		Successful int64 `json:"successful"`
 	} `json:"shards"`
+	// Metadata names the snapshot lifecycle policy which took the snapshot
+	Metadata struct {
+		Policy string `json:"policy"`
+	} `json:"metadata"`
+}
+
+// snapshotStatusResponse is a representation of the snapshot status API, the
+// sizes of the files of the snapshots
+type snapshotStatusResponse struct {
+	Snapshots []struct {
+		Snapshot string `json:"snapshot"`
+		UUID     string `json:"uuid"`
+		Stats    struct {
+			Incremental struct {
+				SizeInBytes int64 `json:"size_in_bytes"`
+			} `json:"incremental"`
+			Total struct {
+				SizeInBytes int64 `json:"size_in_bytes"`
+			} `json:"total"`
+		} `json:"stats"`
+	} `json:"snapshots"`
 }
 
 // SnapshotRepositoriesResponse is a representation snapshots repositories
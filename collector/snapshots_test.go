@@ -1,13 +1,17 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestSnapshots(t *testing.T) {
@@ -45,7 +49,7 @@ func TestSnapshots(t *testing.T) {
 			t.Fatalf("Failed to parse URL: %s", err)
 		}
 		s := NewSnapshots(log.NewNopLogger(), http.DefaultClient, u)
-		stats, err := s.fetchAndDecodeSnapshotsStats()
+		stats, err := s.fetchAndDecodeSnapshotsStats(context.Background())
 		if err != nil {
 			t.Fatalf("Failed to fetch or decode snapshots stats: %s", err)
 		}
@@ -71,3 +75,128 @@ func TestSnapshots(t *testing.T) {
 	}
 
 }
+
+func TestSnapshotSizes(t *testing.T) {
+	var statusRequests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_snapshot":
+			fmt.Fprint(w, `{"backups":{"type":"fs","settings":{"location":"/tmp/backups"}}}`)
+		case "/_snapshot/backups/_all":
+			fmt.Fprint(w, `{"snapshots":[
+				{"snapshot":"nightly-1","uuid":"a","state":"SUCCESS","metadata":{"policy":"nightly"}},
+				{"snapshot":"manual","uuid":"b","state":"SUCCESS"},
+				{"snapshot":"nightly-2","uuid":"c","state":"SUCCESS","metadata":{"policy":"nightly"}},
+				{"snapshot":"nightly-3","uuid":"d","state":"IN_PROGRESS","metadata":{"policy":"nightly"}}
+			]}`)
+		case "/_snapshot/backups/nightly-1,manual,nightly-2/_status":
+			statusRequests = append(statusRequests, r.URL.Path)
+			fmt.Fprint(w, `{"snapshots":[
+				{"snapshot":"nightly-1","uuid":"a","stats":{"incremental":{"size_in_bytes":1000},"total":{"size_in_bytes":1000}}},
+				{"snapshot":"manual","uuid":"b","stats":{"incremental":{"size_in_bytes":50},"total":{"size_in_bytes":1050}}},
+				{"snapshot":"nightly-2","uuid":"c","stats":{"incremental":{"size_in_bytes":200},"total":{"size_in_bytes":1100}}}
+			]}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	s := NewSnapshots(log.NewNopLogger(), http.DefaultClient, u)
+	s.sizes = true
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(s)
+	for scrape := 0; scrape < 2; scrape++ {
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %s", err)
+		}
+		values := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				labels := []string{mf.GetName()}
+				for _, l := range m.Label {
+					labels = append(labels, l.GetName()+"="+l.GetValue())
+				}
+				values[strings.Join(labels, " ")] = m.GetGauge().GetValue()
+			}
+		}
+		for key, expected := range map[string]float64{
+			"elasticsearch_snapshot_stats_repository_size_bytes policy=nightly repository=backups":                  1200,
+			"elasticsearch_snapshot_stats_repository_size_bytes policy= repository=backups":                         50,
+			"elasticsearch_snapshot_stats_latest_snapshot_incremental_size_bytes policy=nightly repository=backups": 200,
+			"elasticsearch_snapshot_stats_latest_snapshot_total_size_bytes policy=nightly repository=backups":       1100,
+		} {
+			if v, ok := values[key]; !ok || v != expected {
+				t.Errorf("expected %s to be %v, got %v", key, expected, v)
+			}
+		}
+	}
+	// the sizes of completed snapshots are cached
+	if len(statusRequests) != 1 {
+		t.Errorf("expected the status to be requested once, got %v", statusRequests)
+	}
+}
+
+func TestSnapshotSizesFailedBatch(t *testing.T) {
+	var snapshots, statuses, names []string
+	for n := 0; n <= snapshotStatusBatch; n++ {
+		snapshots = append(snapshots, fmt.Sprintf(`{"snapshot":"s%d","uuid":"u%d","state":"SUCCESS"}`, n, n))
+		statuses = append(statuses, fmt.Sprintf(`{"snapshot":"s%d","uuid":"u%d","stats":{"incremental":{"size_in_bytes":%d}}}`, n, n, n))
+		names = append(names, fmt.Sprintf("s%d", n))
+	}
+	first := "/_snapshot/backups/" + strings.Join(names[:snapshotStatusBatch], ",") + "/_status"
+	second := "/_snapshot/backups/" + names[snapshotStatusBatch] + "/_status"
+	var statusRequests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_snapshot":
+			fmt.Fprint(w, `{"backups":{"type":"fs","settings":{"location":"/tmp/backups"}}}`)
+		case "/_snapshot/backups/_all":
+			fmt.Fprint(w, `{"snapshots":[`+strings.Join(snapshots, ",")+`]}`)
+		case first:
+			statusRequests = append(statusRequests, "first")
+			fmt.Fprint(w, `{"snapshots":[`+strings.Join(statuses[:snapshotStatusBatch], ",")+`]}`)
+		case second:
+			statusRequests = append(statusRequests, "second")
+			// the second batch fails on the first scrape only
+			if len(statusRequests) == 2 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"snapshots":[`+statuses[snapshotStatusBatch]+`]}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	s := NewSnapshots(log.NewNopLogger(), http.DefaultClient, u)
+	s.sizes = true
+	ch := make(chan prometheus.Metric, 100)
+	go func() {
+		for range ch {
+		}
+	}()
+	defer close(ch)
+	if err := s.CollectContext(context.Background(), ch); err == nil {
+		t.Error("expected the failed batch to fail the scrape")
+	}
+	if err := s.CollectContext(context.Background(), ch); err != nil {
+		t.Errorf("expected the second scrape to succeed, got %s", err)
+	}
+	// the first batch was cached despite the failure of the second one
+	if expected := []string{"first", "second", "second"}; !reflect.DeepEqual(statusRequests, expected) {
+		t.Errorf("expected the status requests %v, got %v", expected, statusRequests)
+	}
+}
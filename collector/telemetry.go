@@ -0,0 +1,15 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// JSONParseFailures counts the JSON parse failures of all collectors by
+// collector. It is part of the self-telemetry of the exporter.
+var JSONParseFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "elasticsearch_exporter_json_parse_failures_total",
+		Help: "Number of errors while parsing JSON responses of Elasticsearch.",
+	},
+	[]string{"collector"},
+)
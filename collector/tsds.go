@@ -0,0 +1,202 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TSDS information struct, the time bounds of the backing indices of time
+// series data streams
+type TSDS struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	startTime, endTime            *prometheus.Desc
+	backingIndices, outsideBounds *prometheus.Desc
+}
+
+// NewTSDS defines TSDS Prometheus metrics
+func NewTSDS(logger log.Logger, client *http.Client, url *url.URL) *TSDS {
+	subsystem := "tsds"
+	indexLabels := []string{"data_stream", "index"}
+
+	return &TSDS{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch time series data streams successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch time series data streams scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		startTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "index_start_time_seconds"),
+			"Earliest time of the documents accepted by the backing index.",
+			indexLabels, nil,
+		),
+		endTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "index_end_time_seconds"),
+			"Time the documents accepted by the backing index must be earlier than.",
+			indexLabels, nil,
+		),
+		backingIndices: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "backing_indices"),
+			"Number of backing indices of the time series data stream with time bounds.",
+			[]string{"data_stream"}, nil,
+		),
+		outsideBounds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "indices_outside_bounds"),
+			"Number of backing indices of the time series data stream not starting at the end time of the preceding backing index, i.e. leaving a gap or overlapping.",
+			[]string{"data_stream"}, nil,
+		),
+	}
+}
+
+// Describe add TSDS metrics descriptions
+func (t *TSDS) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.startTime
+	ch <- t.endTime
+	ch <- t.backingIndices
+	ch <- t.outsideBounds
+	ch <- t.up
+	ch <- t.totalScrapes.Desc()
+	ch <- t.jsonParseFailures.Desc()
+}
+
+func (t *TSDS) getAndParseURL(ctx context.Context, u *url.URL, data interface{}) error {
+	res, err := get(ctx, t.client, u.String())
+	if err != nil {
+		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(t.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := t.decodeJSON(t.logger, res.Body, "tsds", data); err != nil {
+		t.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("tsds").Inc()
+		return err
+	}
+	return nil
+}
+
+func (t *TSDS) fetchAndDecodeDataStreams(ctx context.Context) (dataStreamsResponse, error) {
+	u := *t.url
+	u.Path = path.Join(u.Path, "/_data_stream")
+	u.RawQuery = "expand_wildcards=all&filter_path=data_streams.name,data_streams.indices.index_name"
+	var dsr dataStreamsResponse
+	err := t.getAndParseURL(ctx, &u, &dsr)
+	return dsr, err
+}
+
+func (t *TSDS) fetchAndDecodeTimeSeriesSettings(ctx context.Context) (timeSeriesSettingsResponse, error) {
+	u := *t.url
+	u.Path = path.Join(u.Path, "/_all/_settings/index.time_series.*")
+	u.RawQuery = "flat_settings=true&expand_wildcards=all"
+	var tsr timeSeriesSettingsResponse
+	err := t.getAndParseURL(ctx, &u, &tsr)
+	return tsr, err
+}
+
+// Collect gets TSDS metric values
+func (t *TSDS) Collect(ch chan<- prometheus.Metric) {
+	_ = t.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects TSDS metrics, aborting the requests to
+// Elasticsearch once ctx is done. It returns the error of the scrape. Data
+// streams without time series backing indices are omitted, as are backing
+// indices created before a data stream switched to the time series mode.
+func (t *TSDS) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	t.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(t.up, prometheus.GaugeValue, up)
+		ch <- t.totalScrapes
+		ch <- t.jsonParseFailures
+	}()
+
+	dsr, err := t.fetchAndDecodeDataStreams(ctx)
+	if err != nil {
+		_ = level.Warn(t.logger).Log(
+			"msg", "failed to fetch and decode data streams",
+			"err", err,
+		)
+		return err
+	}
+	tsr, err := t.fetchAndDecodeTimeSeriesSettings(ctx)
+	if err != nil {
+		_ = level.Warn(t.logger).Log(
+			"msg", "failed to fetch and decode time series settings",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	for _, ds := range dsr.DataStreams {
+		var (
+			indices, outside int
+			previousEnd      time.Time
+		)
+		for _, index := range ds.Indices {
+			settings := tsr[index.IndexName].Settings
+			start, err := time.Parse(time.RFC3339Nano, settings["index.time_series.start_time"])
+			if err != nil {
+				continue
+			}
+			end, err := time.Parse(time.RFC3339Nano, settings["index.time_series.end_time"])
+			if err != nil {
+				continue
+			}
+			if indices > 0 && !start.Equal(previousEnd) {
+				outside++
+			}
+			indices++
+			previousEnd = end
+			ch <- prometheus.MustNewConstMetric(t.startTime, prometheus.GaugeValue, float64(start.UnixNano())/1e9, ds.Name, index.IndexName)
+			ch <- prometheus.MustNewConstMetric(t.endTime, prometheus.GaugeValue, float64(end.UnixNano())/1e9, ds.Name, index.IndexName)
+		}
+		if indices == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(t.backingIndices, prometheus.GaugeValue, float64(indices), ds.Name)
+		ch <- prometheus.MustNewConstMetric(t.outsideBounds, prometheus.GaugeValue, float64(outside), ds.Name)
+	}
+	return nil
+}
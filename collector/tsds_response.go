@@ -0,0 +1,18 @@
+package collector
+
+// dataStreamsResponse is a representation of the Elasticsearch data streams
+// API, the backing indices are ordered by generation
+type dataStreamsResponse struct {
+	DataStreams []struct {
+		Name    string `json:"name"`
+		Indices []struct {
+			IndexName string `json:"index_name"`
+		} `json:"indices"`
+	} `json:"data_streams"`
+}
+
+// timeSeriesSettingsResponse is a representation of the flat time series
+// settings of the indices by index name, e.g. index.time_series.start_time
+type timeSeriesSettingsResponse map[string]struct {
+	Settings map[string]string `json:"settings"`
+}
@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTSDS(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_data_stream":
+			fmt.Fprintln(w, `{"data_streams":[`+
+				`{"name":"metrics","indices":[{"index_name":".ds-metrics-1"},{"index_name":".ds-metrics-2"},{"index_name":".ds-metrics-3"},{"index_name":".ds-metrics-4"}]},`+
+				`{"name":"logs","indices":[{"index_name":".ds-logs-1"}]}]}`)
+		case "/_all/_settings/index.time_series.*":
+			fmt.Fprintln(w, `{".ds-metrics-1":{"settings":{}},`+
+				`".ds-metrics-2":{"settings":{"index.time_series.start_time":"2024-01-01T00:00:00.000Z","index.time_series.end_time":"2024-01-01T02:00:00.000Z"}},`+
+				`".ds-metrics-3":{"settings":{"index.time_series.start_time":"2024-01-01T02:00:00.000Z","index.time_series.end_time":"2024-01-01T04:00:00.000Z"}},`+
+				`".ds-metrics-4":{"settings":{"index.time_series.start_time":"2024-01-01T05:00:00.000Z","index.time_series.end_time":"2024-01-01T07:00:00.000Z"}},`+
+				`".ds-logs-1":{"settings":{}}}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewTSDS(log.NewNopLogger(), http.DefaultClient, u))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			key := mf.GetName()
+			for _, l := range m.Label {
+				key += " " + l.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue()
+		}
+	}
+	for key, want := range map[string]float64{
+		"elasticsearch_tsds_up": 1,
+		"elasticsearch_tsds_index_start_time_seconds metrics .ds-metrics-2": 1704067200,
+		"elasticsearch_tsds_index_end_time_seconds metrics .ds-metrics-3":   1704081600,
+		"elasticsearch_tsds_backing_indices metrics":                        3,
+		"elasticsearch_tsds_indices_outside_bounds metrics":                 1,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, got)
+		}
+	}
+	for _, key := range []string{
+		"elasticsearch_tsds_index_start_time_seconds metrics .ds-metrics-1",
+		"elasticsearch_tsds_backing_indices logs",
+	} {
+		if _, ok := values[key]; ok {
+			t.Errorf("expected %s to be omitted", key)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UnreplicatedShards information struct, the number of shards every node holds
+// the only active copy of, e.g. to tell whether a node can be taken down
+// without losing data or availability
+type UnreplicatedShards struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	shards *prometheus.Desc
+}
+
+// NewUnreplicatedShards defines Unreplicated Shards Prometheus metrics
+func NewUnreplicatedShards(logger log.Logger, client *http.Client, url *url.URL) *UnreplicatedShards {
+	subsystem := "unreplicated_shards"
+
+	return &UnreplicatedShards{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch cat shards endpoint successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch cat shards scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		shards: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "node", "unreplicated_shards"),
+			"Number of shards without another active copy in the cluster on the node, 0 if the node can be taken down without losing a shard.",
+			[]string{"node"}, nil,
+		),
+	}
+}
+
+// catShard is a copy of a shard as listed by the cat shards API
+type catShard struct {
+	Index string `json:"index"`
+	Shard string `json:"shard"`
+	State string `json:"state"`
+	Node  string `json:"node"`
+}
+
+// active reports whether the copy serves requests. A relocating copy does
+// until the relocation completed.
+func (s catShard) active() bool {
+	return s.State == "STARTED" || s.State == "RELOCATING"
+}
+
+// Describe add Unreplicated Shards metrics descriptions
+func (s *UnreplicatedShards) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.shards
+	ch <- s.up
+	ch <- s.totalScrapes.Desc()
+	ch <- s.jsonParseFailures.Desc()
+}
+
+func (s *UnreplicatedShards) fetchAndDecodeShards(ctx context.Context) ([]catShard, error) {
+	var shards []catShard
+
+	u := *s.url
+	u.Path = path.Join(u.Path, "/_cat/shards")
+	u.RawQuery = "format=json&h=index,shard,state,node"
+	res, err := get(ctx, s.client, u.String())
+	if err != nil {
+		return shards, fmt.Errorf("failed to get shards from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(s.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return shards, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := s.decodeJSON(s.logger, res.Body, "unreplicated_shards", &shards); err != nil {
+		s.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("unreplicated_shards").Inc()
+		return shards, err
+	}
+	return shards, nil
+}
+
+// Collect gets Unreplicated Shards metric values
+func (s *UnreplicatedShards) Collect(ch chan<- prometheus.Metric) {
+	_ = s.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects UnreplicatedShards metrics, aborting the request to
+// Elasticsearch once ctx is done. It returns the error of the scrape.
+func (s *UnreplicatedShards) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	s.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(s.up, prometheus.GaugeValue, up)
+		ch <- s.totalScrapes
+		ch <- s.jsonParseFailures
+	}()
+
+	shards, err := s.fetchAndDecodeShards(ctx)
+	if err != nil {
+		_ = level.Warn(s.logger).Log(
+			"msg", "failed to fetch and decode shards",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	// copies counts the active copies of every shard, keyed by index and
+	// shard number
+	copies := map[[2]string]int{}
+	for _, shard := range shards {
+		if shard.active() {
+			copies[[2]string{shard.Index, shard.Shard}]++
+		}
+	}
+	// every node holding an active copy is exported, so that 0 tells that
+	// the node is safe to take down
+	unreplicated := map[string]float64{}
+	for _, shard := range shards {
+		if !shard.active() || shard.Node == "" {
+			continue
+		}
+		node := shard.Node
+		// the node of a relocating copy reads "source -> ip id target"
+		if i := strings.Index(node, " -> "); i >= 0 {
+			node = node[:i]
+		}
+		count := unreplicated[node]
+		if copies[[2]string{shard.Index, shard.Shard}] == 1 {
+			count++
+		}
+		unreplicated[node] = count
+	}
+	for node, count := range unreplicated {
+		ch <- prometheus.MustNewConstMetric(s.shards, prometheus.GaugeValue, count, node)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestUnreplicatedShards(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_cat/shards" || r.URL.Query().Get("format") != "json" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprintln(w, `[
+			{"index":"logs","shard":"0","state":"STARTED","node":"node-1"},
+			{"index":"logs","shard":"0","state":"STARTED","node":"node-2"},
+			{"index":"logs","shard":"1","state":"STARTED","node":"node-2"},
+			{"index":"logs","shard":"1","state":"INITIALIZING","node":"node-3"},
+			{"index":"metrics","shard":"0","state":"RELOCATING","node":"node-1 -> 127.0.0.3 JRsWpE8BRyiAdS4XvJ-dYg node-3"},
+			{"index":"metrics","shard":"1","state":"UNASSIGNED","node":null}
+		]`)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewUnreplicatedShards(log.NewNopLogger(), http.DefaultClient, u))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "elasticsearch_node_unreplicated_shards" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			values[m.Label[0].GetValue()] = m.GetGauge().GetValue()
+		}
+	}
+	// node-3 holds no active copy and isn't exported
+	if expected := map[string]float64{"node-1": 1, "node-2": 1}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
@@ -0,0 +1,186 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// esqlAllClients is the key of the ES|QL queries of all clients, which is
+// skipped as the sum of the other clients
+const esqlAllClients = "_all"
+
+// Usage information struct, the usage of the ES|QL and Search Application
+// features of Elasticsearch 8.11+
+type Usage struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+	decoder
+
+	up                              *prometheus.Desc
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	esqlEnabled, esqlQueries, esqlFailedQueries, esqlCommands *prometheus.Desc
+	searchApplications, analyticsCollections                  *prometheus.Desc
+}
+
+// NewUsage defines Usage Prometheus metrics
+func NewUsage(logger log.Logger, client *http.Client, url *url.URL) *Usage {
+	subsystem := "usage"
+
+	return &Usage{
+		logger: logger,
+		client: client,
+		url:    url,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "up"),
+			"Was the last scrape of the ElasticSearch usage endpoint successful.",
+			nil, nil,
+		),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
+			Help: "Current total ElasticSearch usage scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+
+		esqlEnabled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "esql", "enabled"),
+			"Whether ES|QL is enabled.",
+			nil, nil,
+		),
+		esqlQueries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "esql", "queries_total"),
+			"Number of ES|QL queries by client.",
+			[]string{"client"}, nil,
+		),
+		esqlFailedQueries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "esql", "queries_failed_total"),
+			"Number of failed ES|QL queries by client.",
+			[]string{"client"}, nil,
+		),
+		esqlCommands: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "esql", "commands_total"),
+			"Number of ES|QL queries using the command.",
+			[]string{"command"}, nil,
+		),
+		searchApplications: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "search_applications", "count"),
+			"Number of search applications.",
+			nil, nil,
+		),
+		analyticsCollections: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "analytics_collections", "count"),
+			"Number of behavioral analytics collections.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe add Usage metrics descriptions
+func (us *Usage) Describe(ch chan<- *prometheus.Desc) {
+	ch <- us.esqlEnabled
+	ch <- us.esqlQueries
+	ch <- us.esqlFailedQueries
+	ch <- us.esqlCommands
+	ch <- us.searchApplications
+	ch <- us.analyticsCollections
+	ch <- us.up
+	ch <- us.totalScrapes.Desc()
+	ch <- us.jsonParseFailures.Desc()
+}
+
+func (us *Usage) fetchAndDecodeUsage(ctx context.Context) (usageResponse, error) {
+	var ur usageResponse
+
+	u := *us.url
+	u.Path = path.Join(u.Path, "/_xpack/usage")
+	u.RawQuery = "filter_path=esql,enterprise_search"
+	res, err := get(ctx, us.client, u.String())
+	if err != nil {
+		return ur, fmt.Errorf("failed to get usage from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(us.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return ur, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	if err := us.decodeJSON(us.logger, res.Body, "usage", &ur); err != nil {
+		us.jsonParseFailures.Inc()
+		JSONParseFailures.WithLabelValues("usage").Inc()
+		return ur, err
+	}
+	return ur, nil
+}
+
+// Collect gets Usage metric values
+func (us *Usage) Collect(ch chan<- prometheus.Metric) {
+	_ = us.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects Usage metrics, aborting the request to
+// Elasticsearch once ctx is done. It returns the error of the scrape. The
+// metrics of features unknown to the version of Elasticsearch are omitted.
+func (us *Usage) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var up float64
+	us.totalScrapes.Inc()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(us.up, prometheus.GaugeValue, up)
+		ch <- us.totalScrapes
+		ch <- us.jsonParseFailures
+	}()
+
+	ur, err := us.fetchAndDecodeUsage(ctx)
+	if err != nil {
+		_ = level.Warn(us.logger).Log(
+			"msg", "failed to fetch and decode usage",
+			"err", err,
+		)
+		return err
+	}
+	up = 1
+
+	if esql := ur.ESQL; esql != nil {
+		var enabled float64
+		if esql.Enabled {
+			enabled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(us.esqlEnabled, prometheus.GaugeValue, enabled)
+		for client, stats := range esql.Queries {
+			if client == esqlAllClients {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(us.esqlQueries, prometheus.CounterValue, float64(stats.Total), client)
+			ch <- prometheus.MustNewConstMetric(us.esqlFailedQueries, prometheus.CounterValue, float64(stats.Failed), client)
+		}
+		for command, count := range esql.Features {
+			ch <- prometheus.MustNewConstMetric(us.esqlCommands, prometheus.CounterValue, float64(count), command)
+		}
+	}
+	if search := ur.EnterpriseSearch; search != nil {
+		ch <- prometheus.MustNewConstMetric(us.searchApplications, prometheus.GaugeValue, float64(search.SearchApplications.Count))
+		ch <- prometheus.MustNewConstMetric(us.analyticsCollections, prometheus.GaugeValue, float64(search.AnalyticsCollections.Count))
+	}
+	return nil
+}
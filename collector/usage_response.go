@@ -0,0 +1,34 @@
+package collector
+
+// usageResponse is a representation of the sections of the Elasticsearch
+// X-Pack usage API of features added in 8.11, the sections are missing in
+// earlier versions
+type usageResponse struct {
+	ESQL             *esqlUsage             `json:"esql"`
+	EnterpriseSearch *enterpriseSearchUsage `json:"enterprise_search"`
+}
+
+// esqlUsage is the usage of ES|QL, the queries are counted by client, e.g.
+// rest or kibana, and the commands used by name
+type esqlUsage struct {
+	Enabled  bool                           `json:"enabled"`
+	Features map[string]int64               `json:"features"`
+	Queries  map[string]esqlUsageQueryStats `json:"queries"`
+}
+
+type esqlUsageQueryStats struct {
+	Total  int64 `json:"total"`
+	Failed int64 `json:"failed"`
+}
+
+// enterpriseSearchUsage is the usage of the search applications and
+// behavioral analytics
+type enterpriseSearchUsage struct {
+	Enabled            bool `json:"enabled"`
+	SearchApplications struct {
+		Count int64 `json:"count"`
+	} `json:"search_applications"`
+	AnalyticsCollections struct {
+		Count int64 `json:"count"`
+	} `json:"analytics_collections"`
+}
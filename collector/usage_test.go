@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestUsage(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		response string
+		want     map[string]float64
+		missing  []string
+	}{
+		{
+			name: "8.11",
+			response: `{"esql":{"available":true,"enabled":true,"features":{"from":12,"stats":5,"where":7},` +
+				`"queries":{"rest":{"total":10,"failed":2},"kibana":{"total":4,"failed":0},"_all":{"total":14,"failed":2}}},` +
+				`"enterprise_search":{"available":true,"enabled":true,"search_applications":{"count":3},"analytics_collections":{"count":1}}}`,
+			want: map[string]float64{
+				"elasticsearch_usage_up":                       1,
+				"elasticsearch_esql_enabled":                   1,
+				"elasticsearch_esql_queries_total rest":        10,
+				"elasticsearch_esql_queries_failed_total rest": 2,
+				"elasticsearch_esql_queries_total kibana":      4,
+				"elasticsearch_esql_commands_total stats":      5,
+				"elasticsearch_search_applications_count":      3,
+				"elasticsearch_analytics_collections_count":    1,
+			},
+			missing: []string{"elasticsearch_esql_queries_total _all"},
+		},
+		{
+			name:     "8.10",
+			response: `{}`,
+			want: map[string]float64{
+				"elasticsearch_usage_up": 1,
+			},
+			missing: []string{"elasticsearch_esql_enabled", "elasticsearch_search_applications_count"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/_xpack/usage" || r.URL.Query().Get("filter_path") == "" {
+					t.Errorf("unexpected request %s", r.URL)
+				}
+				fmt.Fprintln(w, tc.response)
+			}))
+			defer ts.Close()
+			u, err := url.Parse(ts.URL)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %s", err)
+			}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(NewUsage(log.NewNopLogger(), http.DefaultClient, u))
+			mfs, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("Failed to gather: %s", err)
+			}
+
+			values := map[string]float64{}
+			for _, mf := range mfs {
+				for _, m := range mf.Metric {
+					key := mf.GetName()
+					for _, l := range m.Label {
+						key += " " + l.GetValue()
+					}
+					values[key] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+				}
+			}
+			for key, want := range tc.want {
+				if got, ok := values[key]; !ok || got != want {
+					t.Errorf("expected %s to be %v, got %v", key, want, got)
+				}
+			}
+			for _, key := range tc.missing {
+				if _, ok := values[key]; ok {
+					t.Errorf("expected %s to be omitted", key)
+				}
+			}
+		})
+	}
+}
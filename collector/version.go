@@ -0,0 +1,30 @@
+package collector
+
+import (
+	"github.com/blang/semver"
+)
+
+// versionRange restricts a metric to the Elasticsearch versions reporting
+// it, so that stats missing on a version aren't exported as zero. Unset
+// bounds are open.
+type versionRange struct {
+	// Since is the first version reporting the metric
+	Since string
+	// Until is the first version no longer reporting the metric
+	Until string
+}
+
+// contains reports whether v reports the metric. All metrics are exported
+// as long as the version is unknown.
+func (r versionRange) contains(v *semver.Version) bool {
+	if v == nil {
+		return true
+	}
+	if r.Since != "" && v.LT(semver.MustParse(r.Since)) {
+		return false
+	}
+	if r.Until != "" && v.GTE(semver.MustParse(r.Until)) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// communityMetricNames maps the names of the metrics named differently by
+// the prometheus-community/elasticsearch_exporter to the community names
+var communityMetricNames = map[string]string{
+	"elasticsearch_indices_shared_docs":          "elasticsearch_indices_shards_docs",
+	"elasticsearch_process_cpu_time_seconds_sum": "elasticsearch_process_cpu_seconds_total",
+}
+
+// communityNamesGatherer wraps g so that the metrics of communityMetricNames
+// are gathered under both names, e.g. while migrating dashboards and alerts
+// from the community exporter
+func communityNamesGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		present := make(map[string]bool, len(mfs))
+		for _, mf := range mfs {
+			present[mf.GetName()] = true
+		}
+		for _, mf := range mfs {
+			alias, ok := communityMetricNames[mf.GetName()]
+			if !ok || present[alias] {
+				continue
+			}
+			amf := proto.Clone(mf).(*dto.MetricFamily)
+			amf.Name = proto.String(alias)
+			mfs = append(mfs, amf)
+		}
+		sort.Slice(mfs, func(i, j int) bool { return mfs[i].GetName() < mfs[j].GetName() })
+		return mfs, err
+	})
+}
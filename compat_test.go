@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCommunityNames(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	cpu := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "elasticsearch_process_cpu_time_seconds_sum",
+		Help: "Process CPU time in seconds",
+	}, []string{"type"})
+	cpu.WithLabelValues("user").Add(42)
+	registry.MustRegister(cpu)
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "elasticsearch_node_stats_up", Help: "up"}))
+
+	tcs := []struct {
+		exclude string
+		want    []string
+	}{
+		{"", []string{"elasticsearch_node_stats_up", "elasticsearch_process_cpu_seconds_total", "elasticsearch_process_cpu_time_seconds_sum"}},
+		// the native name is dropped once dashboards are migrated
+		{"elasticsearch_process_cpu_time_seconds_sum", []string{"elasticsearch_node_stats_up", "elasticsearch_process_cpu_seconds_total"}},
+	}
+	for _, tc := range tcs {
+		f, err := newMetricFilter("", tc.exclude)
+		if err != nil {
+			t.Fatalf("failed to create filter: %s", err)
+		}
+		f.communityNames = true
+		mfs, err := f.gatherer(registry).Gather()
+		if err != nil {
+			t.Fatalf("failed to gather: %s", err)
+		}
+		var got []string
+		for _, mf := range mfs {
+			got = append(got, mf.GetName())
+			if mf.GetName() == "elasticsearch_process_cpu_seconds_total" {
+				if v := mf.Metric[0].GetCounter().GetValue(); v != 42 {
+					t.Errorf("expected the alias to have the value 42, got %v", v)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("exclude=%q: expected %v, got %v", tc.exclude, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,901 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the content of the exporter configuration file. Every setting that
+// is available as command line flag can be given in the file as well; flags
+// and environment variables take precedence over the file.
+type Config struct {
+	Web WebConfig `yaml:"web"`
+	ES  ESConfig  `yaml:"es"`
+	Log LogConfig `yaml:"log"`
+
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Indices     IndicesConfig     `yaml:"indices"`
+	Snapshots   SnapshotsConfig   `yaml:"snapshots"`
+	Discovery   DiscoveryConfig   `yaml:"discovery"`
+	Output      OutputConfig      `yaml:"output"`
+	RemoteWrite RemoteWriteConfig `yaml:"remote_write"`
+	// LeaderElection elects the replica writing Output or RemoteWrite
+	LeaderElection LeaderElectionConfig `yaml:"leader_election"`
+	// Labels are attached to every exported metric
+	Labels map[string]string `yaml:"labels"`
+	// Shard is the share of the nodes and targets scraped by this replica
+	Shard string `yaml:"shard"`
+
+	// Clusters are named Elasticsearch clusters which can be scraped via
+	// /probe?cluster=<name>
+	Clusters []ClusterConfig `yaml:"clusters"`
+	// AuthModules holds named credentials which can be referenced by clusters
+	// and /probe requests via the auth_module parameter
+	AuthModules map[string]AuthModule `yaml:"auth_modules"`
+}
+
+// WebConfig mirrors the web.* flags
+type WebConfig struct {
+	ListenAddress    string   `yaml:"listen_address"`
+	TelemetryPath    string   `yaml:"telemetry_path"`
+	AllowedCIDRs     []string `yaml:"allowed_cidrs"`
+	TLSCert          string   `yaml:"tls_cert"`
+	TLSPrivateKey    string   `yaml:"tls_private_key"`
+	TLSClientCA      string   `yaml:"tls_client_ca"`
+	ShutdownTimeout  string   `yaml:"shutdown_timeout"`
+	EnablePprof      *bool    `yaml:"enable_pprof"`
+	EnableLastScrape *bool    `yaml:"enable_last_scrape"`
+	TimeoutOffset    string   `yaml:"timeout_offset"`
+	MaxRequests      *int     `yaml:"max_requests"`
+}
+
+// ESConfig mirrors the es.* flags
+type ESConfig struct {
+	URI                  string            `yaml:"uri"`
+	DNSRefreshInterval   string            `yaml:"dns_refresh_interval"`
+	Timeout              string            `yaml:"timeout"`
+	Timeouts             map[string]string `yaml:"timeouts"`
+	Intervals            map[string]string `yaml:"intervals"`
+	Retries              *int              `yaml:"retries"`
+	RetryBackoff         string            `yaml:"retry_backoff"`
+	MaxResponseSize      string            `yaml:"max_response_size"`
+	Compression          *bool             `yaml:"compression"`
+	HTTP2                *bool             `yaml:"http2"`
+	TLSSessionCacheSize  *int              `yaml:"tls_session_cache_size"`
+	StrictParsing        *bool             `yaml:"strict_parsing"`
+	BreakerThreshold     *int              `yaml:"breaker_threshold"`
+	BreakerCooldown      string            `yaml:"breaker_cooldown"`
+	Concurrency          *int              `yaml:"concurrency"`
+	All                  *bool             `yaml:"all"`
+	Node                 string            `yaml:"node"`
+	Sniff                *bool             `yaml:"sniff"`
+	NodeStatsSections    string            `yaml:"node_stats_sections"`
+	LegacyMillisMetrics  *bool             `yaml:"legacy_millis_metrics"`
+	DerivedLatencies     *bool             `yaml:"derived_latencies"`
+	HotSpots             *bool             `yaml:"hot_spots"`
+	NodeShards           *bool             `yaml:"node_shards"`
+	APIKeyExpiryWindow   string            `yaml:"api_key_expiry_window"`
+	AuditLogIndexPattern string            `yaml:"audit_log_index_pattern"`
+	ClusterLabel         string            `yaml:"cluster_label"`
+	ClusterUUIDLabel     *bool             `yaml:"cluster_uuid_label"`
+	MinInterval          string            `yaml:"min_interval"`
+	Timestamps           *bool             `yaml:"timestamps"`
+	FixtureDir           string            `yaml:"fixture_dir"`
+	FixtureMode          string            `yaml:"fixture_mode"`
+	ClusterInfoInterval  string            `yaml:"clusterinfo_interval"`
+	CA                   string            `yaml:"ca"`
+	ClientPrivateKey     string            `yaml:"client_private_key"`
+	ClientCert           string            `yaml:"client_cert"`
+	PasswordFile         string            `yaml:"password_file"`
+	APIKeyFile           string            `yaml:"api_key_file"`
+	TLSKeyPasswordFile   string            `yaml:"tls_key_password_file"`
+	SSLSkipVerify        *bool             `yaml:"ssl_skip_verify"`
+	Collectors           CollectorsConfig  `yaml:"collectors"`
+	// Headers are sent with every request to es.uri, they have no flag
+	Headers map[string]string `yaml:"headers"`
+	// Cat declares metrics of cat APIs, it has no flag
+	Cat []CatEndpointConfig `yaml:"cat"`
+	// Queries declares metrics of searches, it has no flag
+	Queries []QueryConfig `yaml:"queries"`
+	// Counts declares counts of documents, it has no flag
+	Counts []CountQueryConfig `yaml:"counts"`
+}
+
+// MetricsConfig mirrors the metrics.* flags
+type MetricsConfig struct {
+	Include        string `yaml:"include"`
+	Exclude        string `yaml:"exclude"`
+	CommunityNames *bool  `yaml:"community_names"`
+}
+
+// IndicesConfig mirrors the indices.* flags
+type IndicesConfig struct {
+	IncludeHidden *bool  `yaml:"include_hidden"`
+	ShardLatency  *bool  `yaml:"shard_latency"`
+	TopN          *int   `yaml:"top_n"`
+	TopBy         string `yaml:"top_by"`
+	// Patterns aggregate the stats of the matching indices, they have no
+	// flag
+	Patterns []IndexPatternConfig `yaml:"patterns"`
+}
+
+// IndexPatternConfig aggregates the stats of the indices matching Pattern,
+// see collector.IndexPattern
+type IndexPatternConfig struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+func (p IndexPatternConfig) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	// _other is the index of the indices beyond indices.top-n
+	if p.Name == "_other" {
+		return fmt.Errorf("name %q is reserved", p.Name)
+	}
+	if p.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	if _, err := path.Match(p.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %s", p.Pattern, err)
+	}
+	return nil
+}
+
+// indexPatterns returns the index patterns of the file for the Indices
+// collector
+func (c *Config) indexPatterns() []collector.IndexPattern {
+	var patterns []collector.IndexPattern
+	for _, p := range c.Indices.Patterns {
+		patterns = append(patterns, collector.IndexPattern{Name: p.Name, Pattern: p.Pattern})
+	}
+	return patterns
+}
+
+// SnapshotsConfig mirrors the snapshots.* flags
+type SnapshotsConfig struct {
+	Sizes *bool `yaml:"sizes"`
+}
+
+// DiscoveryConfig mirrors the discovery.* flags
+type DiscoveryConfig struct {
+	// Clusters scrapes the clusters of the file along with es.uri
+	Clusters        *bool                     `yaml:"clusters"`
+	RefreshInterval string                    `yaml:"refresh_interval"`
+	AuthModule      string                    `yaml:"auth_module"`
+	Kubernetes      KubernetesDiscoveryConfig `yaml:"kubernetes"`
+	Consul          ConsulDiscoveryConfig     `yaml:"consul"`
+}
+
+// KubernetesDiscoveryConfig mirrors the discovery.kubernetes.* flags
+type KubernetesDiscoveryConfig struct {
+	Selector  string `yaml:"selector"`
+	Namespace string `yaml:"namespace"`
+	Role      string `yaml:"role"`
+	Port      *int   `yaml:"port"`
+	Scheme    string `yaml:"scheme"`
+	APIServer string `yaml:"api_server"`
+}
+
+// ConsulDiscoveryConfig mirrors the discovery.consul.* flags
+type ConsulDiscoveryConfig struct {
+	Service    string `yaml:"service"`
+	Tag        string `yaml:"tag"`
+	Datacenter string `yaml:"datacenter"`
+	Server     string `yaml:"server"`
+	Token      string `yaml:"token"`
+	TokenFile  string `yaml:"token_file"`
+	Scheme     string `yaml:"scheme"`
+}
+
+// OutputConfig mirrors the output.* flags
+type OutputConfig struct {
+	File     string `yaml:"file"`
+	Interval string `yaml:"interval"`
+}
+
+// RemoteWriteConfig mirrors the remote-write.* flags
+type RemoteWriteConfig struct {
+	URL             string `yaml:"url"`
+	Interval        string `yaml:"interval"`
+	Timeout         string `yaml:"timeout"`
+	BearerToken     string `yaml:"bearer_token"`
+	BearerTokenFile string `yaml:"bearer_token_file"`
+}
+
+// LeaderElectionConfig mirrors the leader-election.* flags
+type LeaderElectionConfig struct {
+	Lease         string `yaml:"lease"`
+	Namespace     string `yaml:"namespace"`
+	Identity      string `yaml:"identity"`
+	LeaseDuration string `yaml:"lease_duration"`
+	APIServer     string `yaml:"api_server"`
+}
+
+// LogConfig mirrors the log.* flags
+type LogConfig struct {
+	Level         string `yaml:"level"`
+	Format        string `yaml:"format"`
+	Output        string `yaml:"output"`
+	DedupInterval string `yaml:"dedup_interval"`
+}
+
+// CollectorsConfig toggles the optional collectors. Unset toggles keep their
+// default.
+type CollectorsConfig struct {
+	Indices         *bool `yaml:"indices"`
+	IndicesSettings *bool `yaml:"indices_settings"`
+	ClusterSettings *bool `yaml:"cluster_settings"`
+	Shards          *bool `yaml:"shards"`
+	Snapshots       *bool `yaml:"snapshots"`
+	DesiredBalance  *bool `yaml:"desired_balance"`
+	Security        *bool `yaml:"security"`
+	ShardStores     *bool `yaml:"shard_stores"`
+	Usage           *bool `yaml:"usage"`
+	ML              *bool `yaml:"ml"`
+	Downsampling    *bool `yaml:"downsampling"`
+	TSDS            *bool `yaml:"tsds"`
+	ISM             *bool `yaml:"ism"`
+	KNN             *bool `yaml:"knn"`
+	SecurityPlugin  *bool `yaml:"security_plugin"`
+
+	UnreplicatedShards *bool `yaml:"unreplicated_shards"`
+}
+
+// CatEndpointConfig declares the metrics of a cat API, see
+// collector.CatEndpoint
+type CatEndpointConfig struct {
+	Name    string            `yaml:"name"`
+	Path    string            `yaml:"path"`
+	Params  map[string]string `yaml:"params"`
+	Labels  []string          `yaml:"labels"`
+	Metrics []CatMetricConfig `yaml:"metrics"`
+}
+
+// CatMetricConfig maps a column of a cat API to a metric, its type is gauge
+// or counter, gauge if empty
+type CatMetricConfig struct {
+	Column string `yaml:"column"`
+	Name   string `yaml:"name"`
+	Help   string `yaml:"help"`
+	Type   string `yaml:"type"`
+}
+
+// catNameRE matches the names of cat endpoints and metrics, which become part
+// of the metric names
+var catNameRE = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// catLabelRE matches the label columns, whose dots are replaced by
+// underscores
+var catLabelRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.]*$`)
+
+func (e CatEndpointConfig) validate() error {
+	if !catNameRE.MatchString(e.Name) {
+		return fmt.Errorf("invalid name %q", e.Name)
+	}
+	if e.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	for _, column := range e.Labels {
+		if !catLabelRE.MatchString(column) {
+			return fmt.Errorf("invalid label column %q", column)
+		}
+	}
+	if len(e.Metrics) == 0 {
+		return fmt.Errorf("metrics are required")
+	}
+	names := make(map[string]bool, len(e.Metrics))
+	for _, m := range e.Metrics {
+		if m.Column == "" {
+			return fmt.Errorf("metric %q: column is required", m.Name)
+		}
+		if !catNameRE.MatchString(m.Name) {
+			return fmt.Errorf("metric of column %q: invalid name %q", m.Column, m.Name)
+		}
+		if names[m.Name] {
+			return fmt.Errorf("metric %q: defined more than once", m.Name)
+		}
+		names[m.Name] = true
+		if m.Type != "" && m.Type != "gauge" && m.Type != "counter" {
+			return fmt.Errorf("metric %q: invalid type %q, valid types are gauge and counter", m.Name, m.Type)
+		}
+	}
+	return nil
+}
+
+// catEndpoints returns the cat endpoints of the file for the Cat collector
+func (c *Config) catEndpoints() []collector.CatEndpoint {
+	var endpoints []collector.CatEndpoint
+	for _, e := range c.ES.Cat {
+		endpoint := collector.CatEndpoint{
+			Name:   e.Name,
+			Path:   strings.Trim(e.Path, "/"),
+			Params: e.Params,
+			Labels: e.Labels,
+		}
+		for _, m := range e.Metrics {
+			metric := collector.CatMetric{Column: m.Column, Name: m.Name, Help: m.Help, Type: prometheus.GaugeValue}
+			if m.Type == "counter" {
+				metric.Type = prometheus.CounterValue
+			}
+			endpoint.Metrics = append(endpoint.Metrics, metric)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// QueryConfig declares the metrics of a search, see collector.Query
+type QueryConfig struct {
+	Name     string              `yaml:"name"`
+	Indices  string              `yaml:"indices"`
+	Body     string              `yaml:"body"`
+	Interval string              `yaml:"interval"`
+	Metrics  []QueryMetricConfig `yaml:"metrics"`
+}
+
+// QueryMetricConfig maps values of the search response to a metric, see
+// collector.QueryMetric
+type QueryMetricConfig struct {
+	Name    string            `yaml:"name"`
+	Help    string            `yaml:"help"`
+	Type    string            `yaml:"type"`
+	Buckets string            `yaml:"buckets"`
+	Value   string            `yaml:"value"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// labelNameRE matches valid label names
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (q QueryConfig) validate() error {
+	if !catNameRE.MatchString(q.Name) {
+		return fmt.Errorf("invalid name %q", q.Name)
+	}
+	if q.Indices == "" {
+		return fmt.Errorf("indices are required")
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(q.Body), &body); err != nil {
+		return fmt.Errorf("invalid body: %s", err)
+	}
+	if q.Interval != "" {
+		if _, err := time.ParseDuration(q.Interval); err != nil {
+			return fmt.Errorf("invalid interval: %s", err)
+		}
+	}
+	if len(q.Metrics) == 0 {
+		return fmt.Errorf("metrics are required")
+	}
+	names := make(map[string]bool, len(q.Metrics))
+	for _, m := range q.Metrics {
+		if !catNameRE.MatchString(m.Name) {
+			return fmt.Errorf("metric of value %q: invalid name %q", m.Value, m.Name)
+		}
+		if names[m.Name] {
+			return fmt.Errorf("metric %q: defined more than once", m.Name)
+		}
+		names[m.Name] = true
+		if m.Value == "" {
+			return fmt.Errorf("metric %q: value is required", m.Name)
+		}
+		if m.Type != "" && m.Type != "gauge" && m.Type != "counter" {
+			return fmt.Errorf("metric %q: invalid type %q, valid types are gauge and counter", m.Name, m.Type)
+		}
+		for label := range m.Labels {
+			if !labelNameRE.MatchString(label) {
+				return fmt.Errorf("metric %q: invalid label name %q", m.Name, label)
+			}
+		}
+	}
+	return nil
+}
+
+// queries returns the queries of the file for the Queries collector
+func (c *Config) queries() []collector.Query {
+	var queries []collector.Query
+	for _, q := range c.ES.Queries {
+		// validated by loadConfig
+		interval, _ := time.ParseDuration(q.Interval)
+		query := collector.Query{
+			Name:     q.Name,
+			Indices:  q.Indices,
+			Body:     q.Body,
+			Interval: interval,
+		}
+		for _, m := range q.Metrics {
+			metric := collector.QueryMetric{
+				Name:    m.Name,
+				Help:    m.Help,
+				Type:    prometheus.GaugeValue,
+				Buckets: m.Buckets,
+				Value:   m.Value,
+				Labels:  m.Labels,
+			}
+			if m.Type == "counter" {
+				metric.Type = prometheus.CounterValue
+			}
+			query.Metrics = append(query.Metrics, metric)
+		}
+		queries = append(queries, query)
+	}
+	return queries
+}
+
+// CountQueryConfig declares a count of the documents matching a query, see
+// collector.CountQuery
+type CountQueryConfig struct {
+	Name    string `yaml:"name"`
+	Indices string `yaml:"indices"`
+	Query   string `yaml:"query"`
+}
+
+func (q CountQueryConfig) validate() error {
+	if q.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if q.Indices == "" {
+		return fmt.Errorf("indices are required")
+	}
+	if q.Query != "" {
+		var query map[string]interface{}
+		if err := json.Unmarshal([]byte(q.Query), &query); err != nil {
+			return fmt.Errorf("invalid query: %s", err)
+		}
+	}
+	return nil
+}
+
+// countQueries returns the counts of the file for the Queries collector
+func (c *Config) countQueries() []collector.CountQuery {
+	var counts []collector.CountQuery
+	for _, q := range c.ES.Counts {
+		counts = append(counts, collector.CountQuery{Name: q.Name, Indices: q.Indices, Query: q.Query})
+	}
+	return counts
+}
+
+// ClusterConfig defines a named Elasticsearch cluster
+type ClusterConfig struct {
+	Name string `yaml:"name"`
+	URI  string `yaml:"uri"`
+	// AuthModule references an entry of Config.AuthModules. Alternatively the
+	// credentials can be given inline.
+	AuthModule string           `yaml:"auth_module"`
+	Auth       AuthModule       `yaml:",inline"`
+	Collectors CollectorsConfig `yaml:"collectors"`
+	// ClusterLabel replaces the cluster label of the cluster's metrics
+	ClusterLabel string `yaml:"cluster_label"`
+	// Metrics filters the cluster's metrics in addition to metrics.include
+	// and metrics.exclude
+	Metrics ClusterMetricsConfig `yaml:"metrics"`
+}
+
+// ClusterMetricsConfig defines the metrics of a cluster, like the
+// metrics.include and metrics.exclude flags
+type ClusterMetricsConfig struct {
+	Include string `yaml:"include"`
+	Exclude string `yaml:"exclude"`
+}
+
+// filter returns the filter of the cluster's metrics, nil if it has none
+func (cl ClusterConfig) filter() (*metricFilter, error) {
+	if cl.Metrics.Include == "" && cl.Metrics.Exclude == "" {
+		return nil, nil
+	}
+	return newMetricFilter(cl.Metrics.Include, cl.Metrics.Exclude)
+}
+
+// AuthModule defines how to authenticate against an Elasticsearch target
+type AuthModule struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	APIKey   string `yaml:"api_key"`
+	// PasswordFile and APIKeyFile are read on every request instead
+	PasswordFile string    `yaml:"password_file"`
+	APIKeyFile   string    `yaml:"api_key_file"`
+	TLS          TLSConfig `yaml:"tls"`
+	// Headers are sent with every request, e.g. to authenticate against a
+	// proxy in front of Elasticsearch
+	Headers map[string]string `yaml:"headers"`
+}
+
+// TLSConfig defines the TLS settings for an Elasticsearch connection
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	KeyPasswordFile    string `yaml:"key_password_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// loadConfig reads and validates the configuration file at path. An empty path
+// yields an empty configuration.
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+func (am AuthModule) validate() error {
+	if (am.APIKey != "" || am.APIKeyFile != "") && (am.Username != "" || am.Password != "" || am.PasswordFile != "") {
+		return fmt.Errorf("api_key and username/password are mutually exclusive")
+	}
+	if am.APIKey != "" && am.APIKeyFile != "" {
+		return fmt.Errorf("api_key and api_key_file are mutually exclusive")
+	}
+	if am.Password != "" && am.PasswordFile != "" {
+		return fmt.Errorf("password and password_file are mutually exclusive")
+	}
+	if am.PasswordFile != "" && am.Username == "" {
+		return fmt.Errorf("password_file requires username")
+	}
+	if (am.TLS.CertFile == "") != (am.TLS.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	return validateHeaders(am.Headers)
+}
+
+func (am AuthModule) isEmpty() bool {
+	return am.Username == "" && am.Password == "" && am.APIKey == "" && am.PasswordFile == "" &&
+		am.APIKeyFile == "" && am.TLS == TLSConfig{} && len(am.Headers) == 0
+}
+
+// validateHeaders checks the names and values of extra request headers
+func validateHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value of header %q", name)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	for name, am := range c.AuthModules {
+		if err := am.validate(); err != nil {
+			return fmt.Errorf("auth module %q: %s", name, err)
+		}
+	}
+	if am := c.Discovery.AuthModule; am != "" {
+		if _, ok := c.AuthModules[am]; !ok {
+			return fmt.Errorf("discovery: unknown auth module %q", am)
+		}
+	}
+	if err := validateHeaders(c.ES.Headers); err != nil {
+		return fmt.Errorf("es: %s", err)
+	}
+	patternNames := make(map[string]bool, len(c.Indices.Patterns))
+	for i, p := range c.Indices.Patterns {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("index pattern #%d: %s", i+1, err)
+		}
+		if patternNames[p.Name] {
+			return fmt.Errorf("index pattern %q: defined more than once", p.Name)
+		}
+		patternNames[p.Name] = true
+	}
+	catNames := make(map[string]bool, len(c.ES.Cat))
+	// the metrics of the cat collector itself, the names of the cat metrics
+	// are <endpoint>_<metric> and mustn't clash with them or each other
+	catMetricNames := map[string]bool{"up": true, "total_scrapes": true, "json_parse_failures": true}
+	for i, e := range c.ES.Cat {
+		if err := e.validate(); err != nil {
+			return fmt.Errorf("cat endpoint #%d: %s", i+1, err)
+		}
+		if catNames[e.Name] {
+			return fmt.Errorf("cat endpoint %q: defined more than once", e.Name)
+		}
+		catNames[e.Name] = true
+		for _, m := range e.Metrics {
+			name := e.Name + "_" + m.Name
+			if catMetricNames[name] {
+				return fmt.Errorf("cat endpoint %q: metric name elasticsearch_cat_%s is already taken", e.Name, name)
+			}
+			catMetricNames[name] = true
+		}
+	}
+	queryNames := make(map[string]bool, len(c.ES.Queries))
+	for i, q := range c.ES.Queries {
+		if err := q.validate(); err != nil {
+			return fmt.Errorf("query #%d: %s", i+1, err)
+		}
+		if queryNames[q.Name] {
+			return fmt.Errorf("query %q: defined more than once", q.Name)
+		}
+		queryNames[q.Name] = true
+	}
+	countNames := make(map[string]bool, len(c.ES.Counts))
+	for i, q := range c.ES.Counts {
+		if err := q.validate(); err != nil {
+			return fmt.Errorf("count #%d: %s", i+1, err)
+		}
+		if countNames[q.Name] {
+			return fmt.Errorf("count %q: defined more than once", q.Name)
+		}
+		countNames[q.Name] = true
+	}
+	names := make(map[string]bool, len(c.Clusters))
+	for i, cl := range c.Clusters {
+		if cl.Name == "" {
+			return fmt.Errorf("cluster #%d: name is required", i+1)
+		}
+		if names[cl.Name] {
+			return fmt.Errorf("cluster %q: defined more than once", cl.Name)
+		}
+		names[cl.Name] = true
+		if cl.URI == "" {
+			return fmt.Errorf("cluster %q: uri is required", cl.Name)
+		}
+		if cl.AuthModule != "" {
+			if !cl.Auth.isEmpty() {
+				return fmt.Errorf("cluster %q: auth_module and inline credentials are mutually exclusive", cl.Name)
+			}
+			if _, ok := c.AuthModules[cl.AuthModule]; !ok {
+				return fmt.Errorf("cluster %q: unknown auth module %q", cl.Name, cl.AuthModule)
+			}
+		}
+		if err := cl.Auth.validate(); err != nil {
+			return fmt.Errorf("cluster %q: %s", cl.Name, err)
+		}
+		if _, err := cl.filter(); err != nil {
+			return fmt.Errorf("cluster %q: %s", cl.Name, err)
+		}
+	}
+	return nil
+}
+
+// cluster returns the cluster with the given name along with its resolved
+// credentials
+func (c *Config) cluster(name string) (ClusterConfig, AuthModule, bool) {
+	for _, cl := range c.Clusters {
+		if cl.Name == name {
+			if cl.AuthModule != "" {
+				return cl, c.AuthModules[cl.AuthModule], true
+			}
+			return cl, cl.Auth, true
+		}
+	}
+	return ClusterConfig{}, AuthModule{}, false
+}
+
+// flagValues returns the settings of the file keyed by the name of the
+// corresponding command line flag
+func (c *Config) flagValues() map[string]string {
+	values := make(map[string]string)
+	setString := func(flag, value string) {
+		if value != "" {
+			values[flag] = value
+		}
+	}
+	setBool := func(flag string, value *bool) {
+		if value != nil {
+			values[flag] = strconv.FormatBool(*value)
+		}
+	}
+	setInt := func(flag string, value *int) {
+		if value != nil {
+			values[flag] = strconv.Itoa(*value)
+		}
+	}
+
+	setString("web.listen-address", c.Web.ListenAddress)
+	setString("web.telemetry-path", c.Web.TelemetryPath)
+	setString("web.allowed-cidrs", strings.Join(c.Web.AllowedCIDRs, ","))
+	setString("web.tls-cert", c.Web.TLSCert)
+	setString("web.tls-private-key", c.Web.TLSPrivateKey)
+	setString("web.tls-client-ca", c.Web.TLSClientCA)
+	setString("web.shutdown-timeout", c.Web.ShutdownTimeout)
+	setBool("web.enable-pprof", c.Web.EnablePprof)
+	setBool("web.enable-last-scrape", c.Web.EnableLastScrape)
+	setString("web.timeout-offset", c.Web.TimeoutOffset)
+	setInt("web.max-requests", c.Web.MaxRequests)
+
+	setString("es.uri", c.ES.URI)
+	setString("es.dns-refresh-interval", c.ES.DNSRefreshInterval)
+	setString("es.timeout", c.ES.Timeout)
+	setString("es.timeouts", formatLabels(c.ES.Timeouts))
+	setString("es.intervals", formatLabels(c.ES.Intervals))
+	setInt("es.retries", c.ES.Retries)
+	setString("es.retry-backoff", c.ES.RetryBackoff)
+	setString("es.max-response-size", c.ES.MaxResponseSize)
+	setBool("es.compression", c.ES.Compression)
+	setBool("es.http2", c.ES.HTTP2)
+	setInt("es.tls-session-cache-size", c.ES.TLSSessionCacheSize)
+	setBool("es.strict-parsing", c.ES.StrictParsing)
+	setInt("es.breaker-threshold", c.ES.BreakerThreshold)
+	setString("es.breaker-cooldown", c.ES.BreakerCooldown)
+	setInt("es.concurrency", c.ES.Concurrency)
+	setBool("es.all", c.ES.All)
+	setString("es.node", c.ES.Node)
+	setBool("es.sniff", c.ES.Sniff)
+	setString("es.node-stats-sections", c.ES.NodeStatsSections)
+	setBool("es.legacy-millis-metrics", c.ES.LegacyMillisMetrics)
+	setBool("es.derived-latencies", c.ES.DerivedLatencies)
+	setBool("es.hot-spots", c.ES.HotSpots)
+	setBool("es.node-shards", c.ES.NodeShards)
+	setString("es.api-key-expiry-window", c.ES.APIKeyExpiryWindow)
+	setString("es.audit-log-index-pattern", c.ES.AuditLogIndexPattern)
+	setString("es.cluster-label", c.ES.ClusterLabel)
+	setBool("es.cluster-uuid-label", c.ES.ClusterUUIDLabel)
+	setString("es.min-interval", c.ES.MinInterval)
+	setBool("es.timestamps", c.ES.Timestamps)
+	setString("es.fixture-dir", c.ES.FixtureDir)
+	setString("es.fixture-mode", c.ES.FixtureMode)
+	setString("es.clusterinfo.interval", c.ES.ClusterInfoInterval)
+	setString("es.ca", c.ES.CA)
+	setString("es.client-private-key", c.ES.ClientPrivateKey)
+	setString("es.client-cert", c.ES.ClientCert)
+	setString("es.password-file", c.ES.PasswordFile)
+	setString("es.api-key-file", c.ES.APIKeyFile)
+	setString("tls.key-password-file", c.ES.TLSKeyPasswordFile)
+	setBool("es.ssl-skip-verify", c.ES.SSLSkipVerify)
+	setBool("es.indices", c.ES.Collectors.Indices)
+	setBool("es.indices_settings", c.ES.Collectors.IndicesSettings)
+	setBool("es.cluster_settings", c.ES.Collectors.ClusterSettings)
+	setBool("es.shards", c.ES.Collectors.Shards)
+	setBool("es.snapshots", c.ES.Collectors.Snapshots)
+	setBool("es.desired_balance", c.ES.Collectors.DesiredBalance)
+	setBool("es.security", c.ES.Collectors.Security)
+	setBool("es.shard_stores", c.ES.Collectors.ShardStores)
+	setBool("es.unreplicated_shards", c.ES.Collectors.UnreplicatedShards)
+	setBool("es.usage", c.ES.Collectors.Usage)
+	setBool("es.ml", c.ES.Collectors.ML)
+	setBool("es.downsampling", c.ES.Collectors.Downsampling)
+	setBool("es.tsds", c.ES.Collectors.TSDS)
+	setBool("es.ism", c.ES.Collectors.ISM)
+	setBool("es.knn", c.ES.Collectors.KNN)
+	setBool("es.security_plugin", c.ES.Collectors.SecurityPlugin)
+
+	setString("metrics.include", c.Metrics.Include)
+	setString("metrics.exclude", c.Metrics.Exclude)
+	setBool("metrics.community-names", c.Metrics.CommunityNames)
+
+	setBool("indices.include-hidden", c.Indices.IncludeHidden)
+	setBool("indices.shard-latency", c.Indices.ShardLatency)
+	setInt("indices.top-n", c.Indices.TopN)
+	setString("indices.top-by", c.Indices.TopBy)
+
+	setBool("snapshots.sizes", c.Snapshots.Sizes)
+
+	setBool("discovery.clusters", c.Discovery.Clusters)
+	setString("discovery.kubernetes.selector", c.Discovery.Kubernetes.Selector)
+	setString("discovery.kubernetes.namespace", c.Discovery.Kubernetes.Namespace)
+	setString("discovery.kubernetes.role", c.Discovery.Kubernetes.Role)
+	setInt("discovery.kubernetes.port", c.Discovery.Kubernetes.Port)
+	setString("discovery.kubernetes.scheme", c.Discovery.Kubernetes.Scheme)
+	setString("discovery.kubernetes.api-server", c.Discovery.Kubernetes.APIServer)
+	setString("discovery.consul.service", c.Discovery.Consul.Service)
+	setString("discovery.consul.tag", c.Discovery.Consul.Tag)
+	setString("discovery.consul.datacenter", c.Discovery.Consul.Datacenter)
+	setString("discovery.consul.server", c.Discovery.Consul.Server)
+	setString("discovery.consul.token", c.Discovery.Consul.Token)
+	setString("discovery.consul.token-file", c.Discovery.Consul.TokenFile)
+	setString("discovery.consul.scheme", c.Discovery.Consul.Scheme)
+	setString("discovery.refresh-interval", c.Discovery.RefreshInterval)
+	setString("discovery.auth-module", c.Discovery.AuthModule)
+
+	setString("output.file", c.Output.File)
+	setString("output.interval", c.Output.Interval)
+
+	setString("remote-write.url", c.RemoteWrite.URL)
+	setString("remote-write.interval", c.RemoteWrite.Interval)
+	setString("remote-write.timeout", c.RemoteWrite.Timeout)
+	setString("remote-write.bearer-token", c.RemoteWrite.BearerToken)
+	setString("remote-write.bearer-token-file", c.RemoteWrite.BearerTokenFile)
+
+	setString("leader-election.lease", c.LeaderElection.Lease)
+	setString("leader-election.namespace", c.LeaderElection.Namespace)
+	setString("leader-election.identity", c.LeaderElection.Identity)
+	setString("leader-election.lease-duration", c.LeaderElection.LeaseDuration)
+	setString("leader-election.api-server", c.LeaderElection.APIServer)
+
+	setString("labels", formatLabels(c.Labels))
+	setString("shard", c.Shard)
+
+	setString("log.level", c.Log.Level)
+	setString("log.format", c.Log.Format)
+	setString("log.output", c.Log.Output)
+	setString("log.dedup-interval", c.Log.DedupInterval)
+
+	return values
+}
+
+// envPrefix prefixes the environment variables mirroring every flag
+const envPrefix = "ES_EXPORTER_"
+
+// flagEnvar returns the name of the ES_EXPORTER_* environment variable of the
+// flag with the given name, e.g. ES_EXPORTER_ES_URI for es.uri
+func flagEnvar(name string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+}
+
+// explicitFlags returns the names of the flags given in args
+func explicitFlags(app *kingpin.Application, args []string) (map[string]bool, error) {
+	ctx, err := app.ParseContext(args)
+	if err != nil {
+		return nil, err
+	}
+	explicit := make(map[string]bool)
+	for _, element := range ctx.Elements {
+		if flag, ok := element.Clause.(*kingpin.FlagClause); ok {
+			explicit[flag.Model().Name] = true
+		}
+	}
+	return explicit, nil
+}
+
+// applyEnvFlags sets all flags of app which weren't given in args from their
+// ES_EXPORTER_* environment variable, which takes precedence over the legacy
+// environment variable of the flag.
+func applyEnvFlags(app *kingpin.Application, args []string) error {
+	explicit, err := explicitFlags(app, args)
+	if err != nil {
+		return err
+	}
+	for _, flag := range app.Model().Flags {
+		value := os.Getenv(flagEnvar(flag.Name))
+		if value == "" || explicit[flag.Name] {
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %s", value, flagEnvar(flag.Name), err)
+		}
+	}
+	return nil
+}
+
+// applyConfigFlags sets all flags of app from cfg which were neither given in
+// args nor via an environment variable.
+func applyConfigFlags(app *kingpin.Application, args []string, cfg *Config) error {
+	explicit, err := explicitFlags(app, args)
+	if err != nil {
+		return err
+	}
+
+	values := cfg.flagValues()
+	for _, flag := range app.Model().Flags {
+		value, ok := values[flag.Name]
+		if !ok || explicit[flag.Name] {
+			continue
+		}
+		if flag.Envar != "" && os.Getenv(flag.Envar) != "" {
+			continue
+		}
+		if os.Getenv(flagEnvar(flag.Name)) != "" {
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %s", value, flag.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const testConfig = `
+es:
+  uri: http://config:9200
+  timeout: 30s
+  all: true
+  collectors:
+    snapshots: true
+  cat:
+    - name: recovery
+      path: /recovery
+      params:
+        bytes: b
+      labels: [index, shard]
+      metrics:
+        - column: bytes_recovered
+          name: recovered_bytes_total
+          type: counter
+  queries:
+    - name: tenants
+      indices: logs-*
+      interval: 5m
+      body: '{"size":0,"aggs":{"tenants":{"terms":{"field":"tenant"}}}}'
+      metrics:
+        - name: docs
+          buckets: aggregations.tenants.buckets
+          value: doc_count
+          labels:
+            tenant: key
+  counts:
+    - name: errors_5m
+      indices: logs-*
+      query: '{"range":{"@timestamp":{"gte":"now-5m"}}}'
+log:
+  level: debug
+clusters:
+  - name: prod
+    uri: https://prod:9200
+    auth_module: prod
+    collectors:
+      indices: true
+  - name: staging
+    uri: https://staging:9200
+    username: exporter
+    password: secret
+auth_modules:
+  prod:
+    api_key: key
+`
+
+func writeTestConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "elasticsearch_exporter")
+	if err != nil {
+		t.Fatalf("failed to create config file: %s", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("failed to write config file: %s", err)
+	}
+	return f.Name()
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeTestConfig(t, testConfig)
+	defer os.Remove(path)
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	cluster, am, ok := cfg.cluster("prod")
+	if !ok || cluster.URI != "https://prod:9200" || am.APIKey != "key" {
+		t.Errorf("auth module of cluster prod wasn't resolved: %+v %+v", cluster, am)
+	}
+	if _, am, _ := cfg.cluster("staging"); am.Username != "exporter" {
+		t.Errorf("inline credentials of cluster staging weren't parsed: %+v", am)
+	}
+
+	endpoints := cfg.catEndpoints()
+	if len(endpoints) != 1 || endpoints[0].Path != "recovery" || endpoints[0].Metrics[0].Type != prometheus.CounterValue {
+		t.Errorf("unexpected cat endpoints %+v", endpoints)
+	}
+	if counts := cfg.countQueries(); len(counts) != 1 || counts[0].Name != "errors_5m" {
+		t.Errorf("unexpected counts %+v", counts)
+	}
+	queries := cfg.queries()
+	if len(queries) != 1 || queries[0].Interval != 5*time.Minute || queries[0].Metrics[0].Labels["tenant"] != "key" {
+		t.Errorf("unexpected queries %+v", queries)
+	}
+
+	invalid := map[string]string{
+		"count query":         "es:\n  counts:\n    - name: a\n      indices: b\n      query: '{'\n",
+		"duplicate count":     "es:\n  counts:\n    - {name: a, indices: b}\n    - {name: a, indices: c}\n",
+		"query body":          "es:\n  queries:\n    - name: a\n      indices: b\n      body: '{'\n      metrics:\n        - {name: c, value: d}\n",
+		"query label name":    "es:\n  queries:\n    - name: a\n      indices: b\n      body: '{}'\n      metrics:\n        - {name: c, value: d, labels: {e-f: key}}\n",
+		"query interval":      "es:\n  queries:\n    - name: a\n      indices: b\n      body: '{}'\n      interval: 5\n      metrics:\n        - {name: c, value: d}\n",
+		"cat without metrics": "es:\n  cat:\n    - name: a\n      path: recovery\n",
+		"cat metric type":     "es:\n  cat:\n    - name: a\n      path: recovery\n      metrics:\n        - {column: b, name: b, type: histogram}\n",
+		"cat metric clash":    "es:\n  cat:\n    - name: a\n      path: recovery\n      metrics:\n        - {column: b, name: b_c}\n    - name: a_b\n      path: shards\n      metrics:\n        - {column: c, name: c}\n",
+		"cat up":              "es:\n  cat:\n    - name: total\n      path: recovery\n      metrics:\n        - {column: b, name: scrapes}\n",
+		"cat metric name":     "es:\n  cat:\n    - name: a\n      path: recovery\n      metrics:\n        - {column: b, name: b-c}\n",
+		"unknown field":       "es:\n  foo: bar\n",
+		"unknown auth module": "clusters:\n  - name: a\n    uri: http://a\n    auth_module: b\n",
+		"missing uri":         "clusters:\n  - name: a\n",
+		"duplicate cluster":   "clusters:\n  - name: a\n    uri: http://a\n  - name: a\n    uri: http://b\n",
+		"key and password":    "auth_modules:\n  a:\n    api_key: x\n    password: y\n",
+		"key file and user":   "auth_modules:\n  a:\n    api_key_file: x\n    username: y\n",
+		"password and file":   "auth_modules:\n  a:\n    username: x\n    password: y\n    password_file: z\n",
+		"password file only":  "auth_modules:\n  a:\n    password_file: z\n",
+		"cluster metrics":     "clusters:\n  - name: a\n    uri: http://a\n    metrics:\n      include: '('\n",
+		"header name":         "es:\n  headers:\n    'X Token': a\n",
+		"cluster header":      "clusters:\n  - name: a\n    uri: http://a\n    headers:\n      X-Token: \"a\\nb\"\n",
+		"index pattern":       "indices:\n  patterns:\n    - {name: logs, pattern: 'logs-['}\n",
+		"index pattern name":  "indices:\n  patterns:\n    - {pattern: 'logs-*'}\n",
+		"index pattern other": "indices:\n  patterns:\n    - {name: _other, pattern: 'logs-*'}\n",
+		"duplicate pattern":   "indices:\n  patterns:\n    - {name: logs, pattern: 'logs-*'}\n    - {name: logs, pattern: 'log-*'}\n",
+	}
+	for name, content := range invalid {
+		path := writeTestConfig(t, content)
+		if _, err := loadConfig(path); err == nil {
+			t.Errorf("%s: expected config to be rejected", name)
+		}
+		os.Remove(path)
+	}
+}
+
+func TestApplyConfigFlags(t *testing.T) {
+	path := writeTestConfig(t, testConfig)
+	defer os.Remove(path)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+
+	app := kingpin.New("test", "")
+	uri := app.Flag("es.uri", "").Default("http://localhost:9200").String()
+	timeout := app.Flag("es.timeout", "").Default("5s").Duration()
+	all := app.Flag("es.all", "").Default("false").Bool()
+	snapshots := app.Flag("es.snapshots", "").Default("false").Bool()
+	logLevel := app.Flag("log.level", "").Default("info").Envar("TEST_APPLY_LOG_LEVEL").String()
+
+	os.Setenv("TEST_APPLY_LOG_LEVEL", "warn")
+	defer os.Unsetenv("TEST_APPLY_LOG_LEVEL")
+
+	args := []string{"--es.uri=http://flag:9200"}
+	if _, err := app.Parse(args); err != nil {
+		t.Fatalf("failed to parse flags: %s", err)
+	}
+	if err := applyConfigFlags(app, args, cfg); err != nil {
+		t.Fatalf("failed to apply config: %s", err)
+	}
+
+	if *uri != "http://flag:9200" {
+		t.Errorf("command line flag should take precedence, got %s", *uri)
+	}
+	if *logLevel != "warn" {
+		t.Errorf("environment variable should take precedence, got %s", *logLevel)
+	}
+	if *timeout != 30*time.Second || !*all || !*snapshots {
+		t.Errorf("config values weren't applied: timeout=%s all=%t snapshots=%t", *timeout, *all, *snapshots)
+	}
+}
+
+func TestReloadableConfig(t *testing.T) {
+	path := writeTestConfig(t, testConfig)
+	defer os.Remove(path)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	r := newReloadableConfig(log.NewNopLogger(), path, cfg)
+
+	if err := ioutil.WriteFile(path, []byte(strings.Replace(testConfig, "auth_modules:", "  - name: new\n    uri: http://new:9200\nauth_modules:", 1)), 0644); err != nil {
+		t.Fatalf("failed to update config file: %s", err)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/-/reload", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET to be rejected, got status %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/-/reload", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected reload to succeed, got status %d", rec.Code)
+	}
+	if _, _, ok := r.Get().cluster("new"); !ok {
+		t.Errorf("reloaded config doesn't contain the new cluster")
+	}
+
+	for _, content := range []string{
+		"invalid: [\n",
+		// settings besides clusters and auth modules require a restart
+		strings.Replace(testConfig, "timeout: 30s", "timeout: 10s", 1),
+	} {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to update config file: %s", err)
+		}
+		if err := r.Reload(); err == nil {
+			t.Errorf("expected reload of %q to fail", content)
+		}
+		if _, _, ok := r.Get().cluster("new"); !ok {
+			t.Errorf("failed reload must keep the previous config")
+		}
+	}
+}
+
+func TestApplyEnvFlags(t *testing.T) {
+	app := kingpin.New("test", "")
+	uri := app.Flag("es.uri", "").Default("http://localhost:9200").Envar("TEST_ENV_ES_URI").String()
+	timeout := app.Flag("es.timeout", "").Default("5s").Duration()
+	indices := app.Flag("es.indices_settings", "").Default("false").Bool()
+	minInterval := app.Flag("es.min-interval", "").Default("0s").Duration()
+
+	for k, v := range map[string]string{
+		"TEST_ENV_ES_URI":                 "http://legacy:9200",
+		"ES_EXPORTER_ES_URI":              "http://env:9200",
+		"ES_EXPORTER_ES_TIMEOUT":          "10s",
+		"ES_EXPORTER_ES_INDICES_SETTINGS": "true",
+		"ES_EXPORTER_ES_MIN_INTERVAL":     "1m",
+	} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	args := []string{"--es.timeout=20s"}
+	if _, err := app.Parse(args); err != nil {
+		t.Fatalf("failed to parse flags: %s", err)
+	}
+	if err := applyEnvFlags(app, args); err != nil {
+		t.Fatalf("failed to apply environment: %s", err)
+	}
+	if *uri != "http://env:9200" {
+		t.Errorf("ES_EXPORTER_ES_URI should take precedence over the legacy variable, got %s", *uri)
+	}
+	if *timeout != 20*time.Second {
+		t.Errorf("command line flag should take precedence, got %s", *timeout)
+	}
+	if !*indices || *minInterval != time.Minute {
+		t.Errorf("environment values weren't applied: indices_settings=%t min-interval=%s", *indices, *minInterval)
+	}
+
+	os.Setenv("ES_EXPORTER_ES_TIMEOUT", "soon")
+	if err := applyEnvFlags(app, nil); err == nil {
+		t.Error("expected error for invalid value")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// consulDiscoverer discovers the healthy instances of a service in the Consul
+// catalog
+type consulDiscoverer struct {
+	client *http.Client
+	server *url.URL
+	token  string
+	// tokenFile is read on every request instead of token if set
+	tokenFile  string
+	service    string
+	tag        string
+	datacenter string
+	scheme     string
+	// template provides the settings of the discovered targets
+	template target
+}
+
+func newConsulDiscoverer(server, token, service, tag, datacenter, scheme string, template target) (*consulDiscoverer, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Consul server: %s", err)
+	}
+	return &consulDiscoverer{
+		client:     &http.Client{},
+		server:     u,
+		token:      token,
+		service:    service,
+		tag:        tag,
+		datacenter: datacenter,
+		scheme:     scheme,
+		template:   template,
+	}, nil
+}
+
+// consulServiceEntry is the subset of an entry of the Consul health API
+// response the discoverer needs
+type consulServiceEntry struct {
+	Node struct {
+		Node    string
+		Address string
+	}
+	Service struct {
+		ID      string
+		Address string
+		Port    int
+	}
+}
+
+func (d *consulDiscoverer) discover(ctx context.Context) ([]target, error) {
+	u := *d.server
+	u.Path = "/v1/health/service/" + d.service
+	query := url.Values{"passing": {"true"}}
+	if d.tag != "" {
+		query.Set("tag", d.tag)
+	}
+	if d.datacenter != "" {
+		query.Set("dc", d.datacenter)
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	token := d.token
+	if d.tokenFile != "" {
+		if token, err = readSecretFile(d.tokenFile); err != nil {
+			return nil, err
+		}
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	res, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances of %s: %s", d.service, err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list instances of %s: HTTP Request failed with code %d", d.service, res.StatusCode)
+	}
+
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(res.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode instances of %s: %s", d.service, err)
+	}
+
+	targets := make([]target, 0, len(entries))
+	for _, entry := range entries {
+		// the service address defaults to the address of the node
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		t := d.template
+		t.name = entry.Node.Node + "/" + entry.Service.ID
+		t.url = &url.URL{Scheme: d.scheme, Host: net.JoinHostPort(host, strconv.Itoa(entry.Service.Port))}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+func (d *consulDiscoverer) String() string {
+	return "consul"
+}
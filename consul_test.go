@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConsulDiscoverer(t *testing.T) {
+	var path, tag, token string
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, tag, token = r.URL.Path, r.URL.Query().Get("tag"), r.Header.Get("X-Consul-Token")
+		fmt.Fprint(w, `[
+			{"Node":{"Node":"es-1","Address":"10.0.0.1"},"Service":{"ID":"elasticsearch","Address":"","Port":9200}},
+			{"Node":{"Node":"es-2","Address":"10.0.0.2"},"Service":{"ID":"elasticsearch","Address":"10.1.0.2","Port":9201}}
+		]`)
+	}))
+	defer consul.Close()
+
+	d, err := newConsulDiscoverer(consul.URL, "secret", "elasticsearch", "prod", "", "http", target{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := d.discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/health/service/elasticsearch" || tag != "prod" || token != "secret" {
+		t.Errorf("unexpected request of %s with tag %q and token %q", path, tag, token)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 targets, got %d", len(targets))
+	}
+	if got := targets[0]; got.name != "es-1/elasticsearch" || got.url.String() != "http://10.0.0.1:9200" {
+		t.Errorf("unexpected target %s at %s", got.name, got.url)
+	}
+	if got := targets[1]; got.url.String() != "http://10.1.0.2:9201" {
+		t.Errorf("expected service address to take precedence, got %s", got.url)
+	}
+}
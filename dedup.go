@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// dedupLogger suppresses repeated warnings and errors, e.g. the failures of
+// every scrape of every Prometheus replica while Elasticsearch is down. A
+// message is logged at most once per interval, along with the number of
+// repetitions suppressed since it was last logged.
+type dedupLogger struct {
+	next     log.Logger
+	interval time.Duration
+
+	mtx  sync.Mutex
+	seen map[string]*dedupEntry
+}
+
+type dedupEntry struct {
+	logged     time.Time
+	suppressed int
+}
+
+// newDedupLogger wraps next in a dedupLogger, an interval of 0 disables the
+// deduplication
+func newDedupLogger(next log.Logger, interval time.Duration) log.Logger {
+	if interval <= 0 {
+		return next
+	}
+	return &dedupLogger{next: next, interval: interval, seen: map[string]*dedupEntry{}}
+}
+
+// Log implements the log.Logger interface
+func (l *dedupLogger) Log(keyvals ...interface{}) error {
+	key, ok := dedupKey(keyvals)
+	if !ok {
+		return l.next.Log(keyvals...)
+	}
+
+	now := time.Now()
+	l.mtx.Lock()
+	e, found := l.seen[key]
+	if found && now.Sub(e.logged) < l.interval {
+		e.suppressed++
+		l.mtx.Unlock()
+		return nil
+	}
+	suppressed := 0
+	if found {
+		suppressed = e.suppressed
+	}
+	l.seen[key] = &dedupEntry{logged: now}
+	// forget messages which haven't been repeated for a while
+	for k, e := range l.seen {
+		if now.Sub(e.logged) >= 2*l.interval {
+			delete(l.seen, k)
+		}
+	}
+	l.mtx.Unlock()
+
+	if suppressed > 0 {
+		keyvals = append(keyvals, "suppressed", suppressed)
+	}
+	return l.next.Log(keyvals...)
+}
+
+// dedupKey returns the key identifying repetitions of the warning or error
+// keyvals. The timestamp and caller are ignored. ok is false for other levels.
+func dedupKey(keyvals []interface{}) (key string, ok bool) {
+	var b strings.Builder
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		k, v := keyvals[i], keyvals[i+1]
+		if k == level.Key() {
+			ok = v == level.WarnValue() || v == level.ErrorValue()
+		}
+		if k == "ts" || k == "caller" {
+			continue
+		}
+		fmt.Fprintf(&b, "%v=%v ", k, v)
+	}
+	return b.String(), ok
+}
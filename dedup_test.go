@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+type recordingLogger struct {
+	records [][]interface{}
+}
+
+func (r *recordingLogger) Log(keyvals ...interface{}) error {
+	r.records = append(r.records, keyvals)
+	return nil
+}
+
+func TestDedupLogger(t *testing.T) {
+	rec := &recordingLogger{}
+	dl := newDedupLogger(rec, 50*time.Millisecond)
+	logger := log.With(dl, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller)
+
+	for i := 0; i < 3; i++ {
+		_ = level.Warn(logger).Log("msg", "failed to fetch", "err", "connection refused")
+		_ = level.Info(logger).Log("msg", "info is never suppressed")
+	}
+	_ = level.Warn(logger).Log("msg", "failed to fetch", "err", "timeout")
+	if len(rec.records) != 5 {
+		t.Fatalf("expected 5 records, got %d: %v", len(rec.records), rec.records)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	_ = level.Warn(logger).Log("msg", "failed to fetch", "err", "connection refused")
+	if len(rec.records) != 6 {
+		t.Fatalf("expected the repetition to be logged after the interval, got %d records", len(rec.records))
+	}
+	last := rec.records[5]
+	if k, v := last[len(last)-2], last[len(last)-1]; k != "suppressed" || v != 2 {
+		t.Errorf("expected 2 suppressed repetitions, got %v=%v", k, v)
+	}
+
+	if l := newDedupLogger(rec, 0); l != log.Logger(rec) {
+		t.Error("expected an interval of 0 to disable the deduplication")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// discoverer finds Elasticsearch targets, e.g. via the Kubernetes API
+type discoverer interface {
+	// discover returns the current targets
+	discover(ctx context.Context) ([]target, error)
+	// String names the discoverer in logs
+	String() string
+}
+
+// targetSet holds the targets found by its discoverers. The targets of a
+// discoverer are kept if a refresh fails.
+type targetSet struct {
+	logger      log.Logger
+	discoverers []discoverer
+	interval    time.Duration
+	timeout     time.Duration
+	// shard restricts the targets to those assigned to this replica of the
+	// exporter by name, nil keeps all targets
+	shard *collector.ScrapeShard
+
+	mtx     sync.RWMutex
+	targets map[string][]target
+}
+
+func newTargetSet(logger log.Logger, interval, timeout time.Duration, discoverers ...discoverer) *targetSet {
+	return &targetSet{
+		logger:      logger,
+		discoverers: discoverers,
+		interval:    interval,
+		timeout:     timeout,
+		targets:     make(map[string][]target),
+	}
+}
+
+// run refreshes the targets on every interval until ctx is cancelled. The
+// first refresh completes before run returns.
+func (s *targetSet) run(ctx context.Context) {
+	s.refresh(ctx)
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.refresh(ctx)
+			}
+		}
+	}()
+}
+
+func (s *targetSet) refresh(ctx context.Context) {
+	for _, d := range s.discoverers {
+		dctx, cancel := context.WithTimeout(ctx, s.timeout)
+		targets, err := d.discover(dctx)
+		cancel()
+		if err != nil {
+			_ = level.Warn(s.logger).Log(
+				"msg", "failed to discover targets",
+				"discoverer", d.String(),
+				"err", err,
+			)
+			continue
+		}
+		_ = level.Debug(s.logger).Log(
+			"msg", "discovered targets",
+			"discoverer", d.String(),
+			"targets", len(targets),
+		)
+		s.mtx.Lock()
+		s.targets[d.String()] = targets
+		s.mtx.Unlock()
+	}
+}
+
+// get returns the targets of all discoverers owned by the shard. A nil set has
+// no targets.
+func (s *targetSet) get() []target {
+	if s == nil {
+		return nil
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var targets []target
+	for _, d := range s.discoverers {
+		for _, t := range s.targets[d.String()] {
+			if s.shard.Owns(t.name) {
+				targets = append(targets, t)
+			}
+		}
+	}
+	return targets
+}
+
+// configDiscoverer returns the clusters of the configuration file
+type configDiscoverer struct {
+	config *reloadableConfig
+	// template provides the collectors of the clusters
+	template target
+}
+
+func (d *configDiscoverer) discover(ctx context.Context) ([]target, error) {
+	config := d.config.Get()
+	targets := make([]target, 0, len(config.Clusters))
+	for _, cl := range config.Clusters {
+		u, err := parseTargetURI(cl.URI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse uri of cluster %q: %s", cl.Name, err)
+		}
+		filter, err := cl.filter()
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics of cluster %q: %s", cl.Name, err)
+		}
+		_, auth, _ := config.cluster(cl.Name)
+		targets = append(targets, target{
+			name:         cl.Name,
+			url:          u,
+			auth:         auth,
+			collectors:   d.template.collectors.with(cl.Collectors),
+			clusterLabel: cl.ClusterLabel,
+			filter:       filter,
+		})
+	}
+	return targets, nil
+}
+
+func (d *configDiscoverer) String() string {
+	return "config"
+}
+
+// gatherTargets scrapes the targets concurrently with p. The metrics of every
+// target get its name as target label, errors are logged.
+func gatherTargets(ctx context.Context, p *probeHandler, targets []target) prometheus.Gatherers {
+	gatherers := make(prometheus.Gatherers, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			var (
+				mfs []*dto.MetricFamily
+				err error
+			)
+			registry, done, err := p.registry(ctx, t)
+			if err == nil {
+				g := labelsGatherer(prometheus.Labels{"target": t.name}, clusterLabelGatherer(t.clusterLabel, t.filter.gatherer(registry)))
+				mfs, err = g.Gather()
+				done()
+			}
+			if err != nil {
+				_ = level.Warn(p.logger).Log(
+					"msg", "failed to scrape target",
+					"target", t.name,
+					"err", err,
+				)
+			}
+			// a failing target must not fail the scrape of the others
+			gatherers[i] = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+				return mfs, nil
+			})
+		}(i, t)
+	}
+	wg.Wait()
+	return gatherers
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type staticDiscoverer []target
+
+func (d staticDiscoverer) discover(ctx context.Context) ([]target, error) {
+	return d, nil
+}
+
+func (d staticDiscoverer) String() string {
+	return "static"
+}
+
+func TestScrapeHandlerTargets(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `{"name":"node-1","cluster_name":"discovered","cluster_uuid":"abc","version":{"number":"6.8.0","lucene_version":"7.7.0"}}`)
+		case "/_cluster/health":
+			fmt.Fprint(w, `{"cluster_name":"discovered","status":"green","number_of_nodes":1}`)
+		default:
+			fmt.Fprint(w, `{"cluster_name":"discovered","nodes":{}}`)
+		}
+	}))
+	defer es.Close()
+	u, _ := url.Parse(es.URL)
+	filter, _ := newMetricFilter("", "elasticsearch_cluster_health_status")
+
+	targets := newTargetSet(log.NewNopLogger(), time.Minute, time.Second, staticDiscoverer{
+		{name: "a", url: u},
+		{name: "b", url: u},
+		{name: "c", url: u, filter: filter},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	targets.run(ctx)
+
+	h := &scrapeHandler{
+		logger:   log.NewNopLogger(),
+		gatherer: prometheus.NewRegistry(),
+		filter:   &metricFilter{},
+		targets:  targets,
+		probe: &probeHandler{
+			logger:  log.NewNopLogger(),
+			timeout: 5 * time.Second,
+			node:    "_local",
+		},
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	body, _ := ioutil.ReadAll(rec.Body)
+	for _, name := range []string{"a", "b"} {
+		want := `elasticsearch_cluster_health_status{cluster="discovered",color="green",target="` + name + `"} 1`
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics of target %s missing", name)
+		}
+	}
+	if strings.Contains(string(body), `elasticsearch_cluster_health_status{cluster="discovered",color="green",target="c"}`) {
+		t.Error("expected the filter of target c to drop its cluster health status")
+	}
+	if !strings.Contains(string(body), `elasticsearch_cluster_health_number_of_nodes{cluster="discovered",target="c"} 1`) {
+		t.Error("expected the filter of target c to keep the other metrics")
+	}
+}
+
+func TestTargetSetShard(t *testing.T) {
+	var discovered staticDiscoverer
+	for i := 0; i < 20; i++ {
+		discovered = append(discovered, target{name: fmt.Sprintf("cluster-%d", i)})
+	}
+	owner := map[string]int{}
+	for index := 1; index <= 3; index++ {
+		targets := newTargetSet(log.NewNopLogger(), time.Minute, time.Second, discovered)
+		targets.shard = &collector.ScrapeShard{Index: index, Count: 3}
+		targets.refresh(context.Background())
+		for _, tg := range targets.get() {
+			if _, ok := owner[tg.name]; ok {
+				t.Errorf("target %s scraped by several shards", tg.name)
+			}
+			owner[tg.name] = index
+		}
+	}
+	if len(owner) != len(discovered) {
+		t.Errorf("expected every target to be scraped by one shard, got %v", owner)
+	}
+}
+
+func TestConfigDiscoverer(t *testing.T) {
+	indices := true
+	d := &configDiscoverer{
+		config: newReloadableConfig(log.NewNopLogger(), "", &Config{
+			AuthModules: map[string]AuthModule{
+				"prod": {APIKey: "secret"},
+			},
+			Clusters: []ClusterConfig{
+				{Name: "logging", URI: "logging-es:9200", AuthModule: "prod", ClusterLabel: "logs"},
+				{Name: "search", URI: "https://search-es:9200", Collectors: CollectorsConfig{Indices: &indices}, Metrics: ClusterMetricsConfig{Exclude: "elasticsearch_indices_segment_.*"}},
+			},
+		}),
+		template: target{collectors: enabledCollectors{snapshots: true}},
+	}
+	targets, err := d.discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 targets, got %d", len(targets))
+	}
+	logging, search := targets[0], targets[1]
+	if logging.name != "logging" || logging.url.String() != "http://logging-es:9200" || logging.auth.APIKey != "secret" || logging.clusterLabel != "logs" {
+		t.Errorf("unexpected target %+v", logging)
+	}
+	if !search.collectors.indices || !search.collectors.snapshots || logging.collectors.indices {
+		t.Errorf("expected collectors of the clusters to override the defaults, got %+v and %+v", logging.collectors, search.collectors)
+	}
+	if logging.filter != nil || search.filter == nil || search.filter.keep("elasticsearch_indices_segment_count") {
+		t.Errorf("expected the metrics of the search cluster to be filtered, got %+v and %+v", logging.filter, search.filter)
+	}
+}
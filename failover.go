@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// parseURIs parses a comma separated list of Elasticsearch URIs
+func parseURIs(s string) ([]*url.URL, error) {
+	var urls []*url.URL
+	for _, uri := range strings.Split(s, ",") {
+		uri = strings.TrimSpace(uri)
+		if uri == "" {
+			continue
+		}
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, err
+		}
+		if isDNSURI(u) {
+			if _, _, err := dnsScheme(u); err != nil {
+				return nil, err
+			}
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no URI given")
+	}
+	return urls, nil
+}
+
+// isDNSURI reports whether the endpoints of u are resolved via DNS, e.g.
+// dns+srv://_es._tcp.example.com or dns+a+https://es.example.com:9200
+func isDNSURI(u *url.URL) bool {
+	return strings.HasPrefix(u.Scheme, "dns+")
+}
+
+// dnsScheme returns the record type and the scheme of the endpoints of the DNS
+// URI u
+func dnsScheme(u *url.URL) (record, scheme string, err error) {
+	parts := strings.Split(u.Scheme, "+")
+	scheme = "http"
+	if len(parts) == 3 {
+		scheme = parts[2]
+	}
+	if len(parts) < 2 || len(parts) > 3 || (parts[1] != "srv" && parts[1] != "a") || (scheme != "http" && scheme != "https") {
+		return "", "", fmt.Errorf("invalid scheme %q, must be dns+srv or dns+a, optionally followed by +https", u.Scheme)
+	}
+	return parts[1], scheme, nil
+}
+
+// primaryURL returns the URL the collectors send their requests to. DNS URIs
+// are replaced by an URL of their name, which is rewritten to the resolved
+// endpoints by the failoverRoundTripper.
+func primaryURL(u *url.URL) *url.URL {
+	if !isDNSURI(u) {
+		return u
+	}
+	_, scheme, _ := dnsScheme(u)
+	primary := *u
+	primary.Scheme = scheme
+	return &primary
+}
+
+// dialAddrKey is the context key of the dialAddr of a request
+type dialAddrKey struct{}
+
+// dialAddr is the address connected to for the requests to host
+type dialAddr struct {
+	host, addr string
+}
+
+// resolvedDialer returns a dialer connecting to the address of the dialAddr of
+// the request instead of its host, falling back to dial. Connections to a
+// proxy aren't redirected.
+func resolvedDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if d, ok := ctx.Value(dialAddrKey{}).(dialAddr); ok && d.host == addr {
+			return dial(ctx, network, d.addr)
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// failoverRoundTripper sends the requests for the first endpoint to the
+// endpoint which answered last. If an endpoint can't be reached, the request
+// fails over to the next one. Requests are only failed over on transport
+// errors, Elasticsearch errors are passed on as they are.
+type failoverRoundTripper struct {
+	logger log.Logger
+	// uris are the configured URIs, DNS URIs are resolved to the endpoints
+	uris    []*url.URL
+	primary *url.URL
+	next    http.RoundTripper
+
+	lookupSRV  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mtx       sync.Mutex
+	resolved  map[*url.URL][]*url.URL
+	endpoints []*url.URL
+	current   int
+	// names are the host names of the endpoints resolved from A records,
+	// which their requests keep as Host and TLS server name
+	names map[*url.URL]string
+}
+
+// newFailoverRoundTripper returns next if there is only a single endpoint
+func newFailoverRoundTripper(logger log.Logger, uris []*url.URL, next http.RoundTripper) http.RoundTripper {
+	if len(uris) < 2 && !isDNSURI(uris[0]) {
+		return next
+	}
+	rt := &failoverRoundTripper{
+		logger:     logger,
+		uris:       uris,
+		primary:    primaryURL(uris[0]),
+		next:       next,
+		lookupSRV:  net.DefaultResolver.LookupSRV,
+		lookupHost: net.DefaultResolver.LookupHost,
+		resolved:   make(map[*url.URL][]*url.URL),
+	}
+	for _, u := range uris {
+		if !isDNSURI(u) {
+			rt.endpoints = append(rt.endpoints, u)
+		}
+	}
+	return rt
+}
+
+// run resolves the DNS URIs, and re-resolves them on every interval until ctx
+// is cancelled
+func (rt *failoverRoundTripper) run(ctx context.Context, interval time.Duration) {
+	if !rt.hasDNS() {
+		return
+	}
+	rt.resolve(ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				rt.resolve(ctx)
+			}
+		}
+	}()
+}
+
+func (rt *failoverRoundTripper) hasDNS() bool {
+	for _, u := range rt.uris {
+		if isDNSURI(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve replaces the endpoints by the addresses the DNS URIs resolve to. The
+// previous addresses of a DNS URI are kept if it can't be resolved.
+func (rt *failoverRoundTripper) resolve(ctx context.Context) {
+	for _, u := range rt.uris {
+		if !isDNSURI(u) {
+			continue
+		}
+		resolved, err := rt.lookup(ctx, u)
+		if err != nil {
+			_ = level.Warn(rt.logger).Log(
+				"msg", "failed to resolve Elasticsearch endpoints",
+				"uri", u.Host,
+				"err", err,
+			)
+			continue
+		}
+		rt.mtx.Lock()
+		rt.resolved[u] = resolved
+		rt.mtx.Unlock()
+	}
+
+	rt.mtx.Lock()
+	defer rt.mtx.Unlock()
+	current := ""
+	if len(rt.endpoints) > 0 {
+		current = rt.endpoints[rt.current].Host
+	}
+	var endpoints []*url.URL
+	names := map[*url.URL]string{}
+	for _, u := range rt.uris {
+		if isDNSURI(u) {
+			endpoints = append(endpoints, rt.resolved[u]...)
+			if record, _, _ := dnsScheme(u); record == "a" {
+				for _, e := range rt.resolved[u] {
+					names[e] = net.JoinHostPort(u.Hostname(), e.Port())
+				}
+			}
+		} else {
+			endpoints = append(endpoints, u)
+		}
+	}
+	rt.endpoints = endpoints
+	rt.names = names
+	rt.current = 0
+	// stick to the current endpoint if it's still there
+	for i, e := range endpoints {
+		if e.Host == current {
+			rt.current = i
+			break
+		}
+	}
+}
+
+// lookup returns the endpoints of the DNS URI u, sorted by address
+func (rt *failoverRoundTripper) lookup(ctx context.Context, u *url.URL) ([]*url.URL, error) {
+	record, scheme, err := dnsScheme(u)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	switch record {
+	case "srv":
+		_, srvs, err := rt.lookupSRV(ctx, "", "", u.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			hosts = append(hosts, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+		}
+	case "a":
+		port := u.Port()
+		if port == "" {
+			port = "9200"
+		}
+		addrs, err := rt.lookupHost(ctx, u.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			hosts = append(hosts, net.JoinHostPort(addr, port))
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no records found")
+	}
+	sort.Strings(hosts)
+
+	endpoints := make([]*url.URL, 0, len(hosts))
+	for _, host := range hosts {
+		endpoint := *u
+		endpoint.Scheme = scheme
+		endpoint.Host = host
+		endpoints = append(endpoints, &endpoint)
+	}
+	return endpoints, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *failoverRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests to other hosts, e.g. sniffed nodes, aren't failed over
+	if req.URL.Host != rt.primary.Host {
+		return rt.next.RoundTrip(req)
+	}
+
+	rt.mtx.Lock()
+	start := rt.current
+	endpoints := rt.endpoints
+	names := rt.names
+	rt.mtx.Unlock()
+
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoint of %s resolved", rt.primary.Host)
+	}
+
+	var err error
+	for i := 0; i < len(endpoints); i++ {
+		idx := (start + i) % len(endpoints)
+		var res *http.Response
+		res, err = rt.next.RoundTrip(rt.rewrite(req, endpoints[idx], names[endpoints[idx]]))
+		if err == nil {
+			if idx != start {
+				rt.mtx.Lock()
+				// the endpoints may have been re-resolved in the meantime
+				if idx < len(rt.endpoints) && rt.endpoints[idx] == endpoints[idx] {
+					rt.current = idx
+				}
+				rt.mtx.Unlock()
+				_ = level.Warn(rt.logger).Log(
+					"msg", "failed over to another Elasticsearch endpoint",
+					"endpoint", endpoints[idx].Host,
+				)
+			}
+			return res, nil
+		}
+		if req.Context().Err() != nil || req.Body != nil {
+			break
+		}
+		_ = level.Debug(rt.logger).Log(
+			"msg", "Elasticsearch endpoint unreachable",
+			"endpoint", endpoints[idx].Host,
+			"err", err,
+		)
+	}
+	return nil, err
+}
+
+// rewrite returns a copy of req sent to endpoint instead of the first endpoint.
+// If name isn't empty, the request is sent to name and connects to the address
+// of endpoint, so that TLS verifies the certificate of name.
+func (rt *failoverRoundTripper) rewrite(req *http.Request, endpoint *url.URL, name string) *http.Request {
+	primary := rt.primary
+	if endpoint == primary {
+		return req
+	}
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Scheme = endpoint.Scheme
+	u.Host = endpoint.Host
+	u.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + strings.TrimPrefix(strings.TrimPrefix(u.Path, strings.TrimSuffix(primary.Path, "/")), "/")
+	u.RawPath = ""
+	r.URL = &u
+	r.Host = ""
+	if name != "" {
+		u.Host = name
+		r = r.WithContext(context.WithValue(req.Context(), dialAddrKey{}, dialAddr{host: name, addr: endpoint.Host}))
+	}
+	if endpoint.User != nil {
+		r.Header = make(http.Header, len(req.Header))
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+		password, _ := endpoint.User.Password()
+		r.SetBasicAuth(endpoint.User.Username(), password)
+	}
+	return r
+}
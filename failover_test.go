@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestFailoverRoundTripper(t *testing.T) {
+	var gotPath, gotUser string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotUser, _, _ = r.BasicAuth()
+	}))
+	defer es.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	downURL := down.URL
+	down.Close()
+
+	urls, err := parseURIs(downURL + "/prefix, http://second:secret@" + es.Listener.Addr().String() + "/other")
+	if err != nil {
+		t.Fatalf("failed to parse URIs: %s", err)
+	}
+	rt := newFailoverRoundTripper(log.NewNopLogger(), urls, http.DefaultTransport).(*failoverRoundTripper)
+	client := &http.Client{Transport: rt}
+
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(downURL + "/prefix/_cluster/health")
+		if err != nil {
+			t.Fatalf("request %d failed: %s", i, err)
+		}
+		_ = res.Body.Close()
+		if gotPath != "/other/_cluster/health" {
+			t.Errorf("request %d: expected path /other/_cluster/health, got %s", i, gotPath)
+		}
+		if gotUser != "second" {
+			t.Errorf("request %d: expected credentials of the second endpoint, got user %q", i, gotUser)
+		}
+	}
+	if rt.current != 1 {
+		t.Errorf("expected second endpoint to be current, got %d", rt.current)
+	}
+
+	if _, err := parseURIs(" , "); err == nil {
+		t.Errorf("expected error for empty URI list")
+	}
+}
+
+func TestFailoverRoundTripperDNS(t *testing.T) {
+	var gotPath string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+	}))
+	defer es.Close()
+	esURL, _ := url.Parse(es.URL)
+	port, _ := strconv.Atoi(esURL.Port())
+
+	urls, err := parseURIs("dns+srv://_es._tcp.example.com/prefix")
+	if err != nil {
+		t.Fatalf("failed to parse URIs: %s", err)
+	}
+	rt := newFailoverRoundTripper(log.NewNopLogger(), urls, http.DefaultTransport).(*failoverRoundTripper)
+	records := []*net.SRV{{Target: "127.0.0.2.", Port: 1}}
+	rt.lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_es._tcp.example.com" {
+			t.Errorf("unexpected lookup of %s", name)
+		}
+		return "", records, nil
+	}
+	client := &http.Client{Transport: rt}
+	primary := primaryURL(urls[0]).String()
+	if primary != "http://_es._tcp.example.com/prefix" {
+		t.Fatalf("unexpected primary URL %s", primary)
+	}
+
+	if _, err := client.Get(primary + "/_cluster/health"); err == nil {
+		t.Fatal("expected request to fail before the URI is resolved")
+	}
+
+	rt.resolve(context.Background())
+	if _, err := client.Get(primary + "/_cluster/health"); err == nil {
+		t.Fatal("expected request to unreachable endpoint to fail")
+	}
+
+	// the topology changed
+	records = []*net.SRV{{Target: "127.0.0.2.", Port: 1}, {Target: "127.0.0.1.", Port: uint16(port)}}
+	rt.resolve(context.Background())
+	res, err := client.Get(primary + "/_cluster/health")
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	_ = res.Body.Close()
+	if gotPath != "/prefix/_cluster/health" {
+		t.Errorf("expected path /prefix/_cluster/health, got %s", gotPath)
+	}
+	if got := rt.endpoints[rt.current].Host; got != esURL.Host {
+		t.Errorf("expected %s to be current, got %s", esURL.Host, got)
+	}
+
+	for _, uri := range []string{"dns+mx://example.com", "dns+srv+ftp://example.com"} {
+		if _, err := parseURIs(uri); err == nil {
+			t.Errorf("expected error for %s", uri)
+		}
+	}
+}
+
+func TestFailoverRoundTripperDNSA(t *testing.T) {
+	var gotHost, gotServerName string
+	es := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost, gotServerName = r.Host, r.TLS.ServerName
+	}))
+	defer es.Close()
+	esURL, _ := url.Parse(es.URL)
+
+	// the certificate of the test server is valid for example.com
+	urls, err := parseURIs("dns+a+https://example.com:" + esURL.Port())
+	if err != nil {
+		t.Fatalf("failed to parse URIs: %s", err)
+	}
+	transport := es.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = resolvedDialer((&net.Dialer{}).DialContext)
+	rt := newFailoverRoundTripper(log.NewNopLogger(), urls, transport).(*failoverRoundTripper)
+	rt.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return []string{esURL.Hostname()}, nil
+	}
+	rt.resolve(context.Background())
+
+	res, err := (&http.Client{Transport: rt}).Get(primaryURL(urls[0]).String() + "/_cluster/health")
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	_ = res.Body.Close()
+	if expected := "example.com:" + esURL.Port(); gotHost != expected {
+		t.Errorf("expected host %s, got %s", expected, gotHost)
+	}
+	if gotServerName != "example.com" {
+		t.Errorf("expected server name example.com, got %s", gotServerName)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricFilter drops metric families by name before exposition. Both
+// expressions are anchored; an empty include expression keeps all metrics.
+type metricFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+	// communityNames exports the metrics named differently by the community
+	// exporter under both names. The expressions apply to both.
+	communityNames bool
+}
+
+func newMetricFilter(include, exclude string) (*metricFilter, error) {
+	f := &metricFilter{}
+	var err error
+	if include != "" {
+		if f.include, err = regexp.Compile("^(?:" + include + ")$"); err != nil {
+			return nil, fmt.Errorf("invalid metrics.include expression: %s", err)
+		}
+	}
+	if exclude != "" {
+		if f.exclude, err = regexp.Compile("^(?:" + exclude + ")$"); err != nil {
+			return nil, fmt.Errorf("invalid metrics.exclude expression: %s", err)
+		}
+	}
+	return f, nil
+}
+
+// keep reports whether the metric family with the given name is exported
+func (f *metricFilter) keep(name string) bool {
+	if f.include != nil && !f.include.MatchString(name) {
+		return false
+	}
+	return f.exclude == nil || !f.exclude.MatchString(name)
+}
+
+// gatherer wraps g so that only metric families passing the filter are gathered
+func (f *metricFilter) gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	if f == nil {
+		return g
+	}
+	if f.communityNames {
+		g = communityNamesGatherer(g)
+	}
+	if f.include == nil && f.exclude == nil {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		filtered := mfs[:0]
+		for _, mf := range mfs {
+			if f.keep(mf.GetName()) {
+				filtered = append(filtered, mf)
+			}
+		}
+		return filtered, err
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricFilter(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	for _, name := range []string{
+		"elasticsearch_cluster_health_status",
+		"elasticsearch_indices_docs",
+		"elasticsearch_indices_segment_count",
+		"elasticsearch_node_stats_up",
+	} {
+		registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: name}))
+	}
+
+	tcs := []struct {
+		include, exclude string
+		want             []string
+	}{
+		{"", "", []string{"elasticsearch_cluster_health_status", "elasticsearch_indices_docs", "elasticsearch_indices_segment_count", "elasticsearch_node_stats_up"}},
+		{"elasticsearch_indices_.*", "", []string{"elasticsearch_indices_docs", "elasticsearch_indices_segment_count"}},
+		{"", "elasticsearch_indices_.*", []string{"elasticsearch_cluster_health_status", "elasticsearch_node_stats_up"}},
+		{"elasticsearch_indices_.*", "elasticsearch_indices_segment_.*", []string{"elasticsearch_indices_docs"}},
+		// expressions are anchored
+		{"indices", "", nil},
+	}
+	for _, tc := range tcs {
+		f, err := newMetricFilter(tc.include, tc.exclude)
+		if err != nil {
+			t.Fatalf("failed to create filter: %s", err)
+		}
+		mfs, err := f.gatherer(registry).Gather()
+		if err != nil {
+			t.Fatalf("failed to gather: %s", err)
+		}
+		var got []string
+		for _, mf := range mfs {
+			got = append(got, mf.GetName())
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("include=%q exclude=%q: expected %v, got %v", tc.include, tc.exclude, tc.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("include=%q exclude=%q: expected %v, got %v", tc.include, tc.exclude, tc.want, got)
+				break
+			}
+		}
+	}
+
+	if _, err := newMetricFilter("(", ""); err == nil {
+		t.Errorf("expected error for invalid expression")
+	}
+}
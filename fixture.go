@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// fixtureModes are the valid values of es.fixture-mode
+var fixtureModes = []string{"record", "replay"}
+
+// unsafeFixtureChars are replaced in the file names of fixtures
+var unsafeFixtureChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fixtureRoundTripper records the responses of Elasticsearch to a directory
+// or replays them from it without sending the requests, so that the metrics
+// of a cluster can be reproduced without access to it.
+type fixtureRoundTripper struct {
+	logger log.Logger
+	dir    string
+	record bool
+	next   http.RoundTripper
+}
+
+// newFixtureRoundTripper returns next if dir is empty. Responses are recorded
+// from next in mode record and replayed in mode replay.
+func newFixtureRoundTripper(logger log.Logger, dir, mode string, next http.RoundTripper) (http.RoundTripper, error) {
+	if dir == "" {
+		return next, nil
+	}
+	switch mode {
+	case "record":
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	case "replay":
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid mode %q, valid modes are %s", mode, strings.Join(fixtureModes, ", "))
+	}
+	return &fixtureRoundTripper{logger: logger, dir: dir, record: mode == "record", next: next}, nil
+}
+
+// fixtureName returns the file name of the fixture of req. The host, e.g. of
+// a sniffed node, and the query parameters are part of the name as they
+// change the response.
+func fixtureName(req *http.Request) string {
+	name := req.Method + " " + req.URL.Host + " " + strings.Trim(req.URL.Path, "/")
+	if q := req.URL.Query().Encode(); q != "" {
+		name += " " + q
+	}
+	return strings.Trim(unsafeFixtureChars.ReplaceAllString(name, "_"), "_") + ".json"
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *fixtureRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := filepath.Join(rt.dir, fixtureName(req))
+	if !rt.record {
+		return rt.replay(req, path)
+	}
+	res, err := rt.next.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		// only successful responses are recorded, replaying the others
+		// fails like a missing fixture
+		return res, err
+	}
+	res.Body = &fixtureBody{ReadCloser: res.Body, logger: rt.logger, path: path}
+	return res, nil
+}
+
+// replay returns the fixture at path, a 404 response if it doesn't exist
+func (rt *fixtureRoundTripper) replay(req *http.Request, path string) (*http.Response, error) {
+	body, err := ioutil.ReadFile(path)
+	status := http.StatusOK
+	if os.IsNotExist(err) {
+		_ = level.Debug(rt.logger).Log(
+			"msg", "no fixture for request",
+			"path", req.URL.Path,
+			"fixture", path,
+		)
+		status = http.StatusNotFound
+		body = []byte(`{"error":"no fixture recorded","status":404}`)
+	} else if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// fixtureBody writes the response to its fixture once it was read completely
+type fixtureBody struct {
+	io.ReadCloser
+	logger log.Logger
+	path   string
+	buf    bytes.Buffer
+	once   sync.Once
+}
+
+func (b *fixtureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.once.Do(b.write)
+	}
+	return n, err
+}
+
+func (b *fixtureBody) Close() error {
+	// partially read responses aren't recorded
+	b.once.Do(func() {})
+	return b.ReadCloser.Close()
+}
+
+// write replaces the fixture atomically, so that a concurrent replay never
+// reads a partial fixture. Concurrent recordings of the same fixture write
+// temporary files of their own.
+func (b *fixtureBody) write() {
+	err := b.writeTemp()
+	if err != nil {
+		_ = level.Warn(b.logger).Log(
+			"msg", "failed to record fixture",
+			"fixture", b.path,
+			"err", err,
+		)
+	}
+}
+
+// writeTemp writes the response to a temporary file next to the fixture and
+// renames it to the fixture
+func (b *fixtureBody) writeTemp() error {
+	f, err := ioutil.TempFile(filepath.Dir(b.path), "."+filepath.Base(b.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(b.buf.Bytes())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, b.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
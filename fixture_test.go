@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestFixtureName(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://localhost:9200/_nodes/_local/stats?level=shards&human=false", nil)
+	if name, want := fixtureName(req), "GET_localhost_9200__nodes__local_stats_human_false_level_shards.json"; name != want {
+		t.Errorf("expected %s, got %s", want, name)
+	}
+	req = httptest.NewRequest("GET", "http://localhost:9200/", nil)
+	if name, want := fixtureName(req), "GET_localhost_9200.json"; name != want {
+		t.Errorf("expected %s, got %s", want, name)
+	}
+}
+
+func TestFixtureRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatalf("failed to create dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_snapshot" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"cluster_name":"elasticsearch"}`)
+	}))
+
+	get := func(rt http.RoundTripper, path string) (int, string) {
+		res, err := (&http.Client{Transport: rt}).Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("failed to get %s: %s", path, err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", path, err)
+		}
+		return res.StatusCode, string(body)
+	}
+
+	if _, err := newFixtureRoundTripper(log.NewNopLogger(), dir, "rewind", http.DefaultTransport); err == nil {
+		t.Error("expected an error for an invalid mode")
+	}
+	record, err := newFixtureRoundTripper(log.NewNopLogger(), dir, "record", http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %s", err)
+	}
+	get(record, "/_cluster/health")
+	get(record, "/_snapshot")
+	ts.Close()
+
+	replay, err := newFixtureRoundTripper(log.NewNopLogger(), dir, "replay", http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("failed to create replayer: %s", err)
+	}
+	if status, body := get(replay, "/_cluster/health"); status != http.StatusOK || body != `{"cluster_name":"elasticsearch"}` {
+		t.Errorf("unexpected replay: %d %s", status, body)
+	}
+	// failed responses aren't recorded
+	if status, _ := get(replay, "/_snapshot"); status != http.StatusNotFound {
+		t.Errorf("expected 404 for an unrecorded request, got %d", status)
+	}
+}
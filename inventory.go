@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// writeMetricInventory writes the name, type, number of series, label names
+// and help of every family of mfs to w as a table, to audit the cardinality
+// of the exported metrics
+func writeMetricInventory(w io.Writer, mfs []*dto.MetricFamily) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tSERIES\tLABELS\tHELP")
+	for _, mf := range mfs {
+		names := map[string]bool{}
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				names[l.GetName()] = true
+			}
+		}
+		labels := make([]string, 0, len(names))
+		for name := range names {
+			labels = append(labels, name)
+		}
+		sort.Strings(labels)
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n",
+			mf.GetName(),
+			strings.ToLower(mf.GetType().String()),
+			len(mf.Metric),
+			strings.Join(labels, ","),
+			mf.GetHelp(),
+		)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWriteMetricInventory(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "elasticsearch_index_docs", Help: "Docs of the index"}, []string{"index", "cluster"})
+	gauge.WithLabelValues("a", "prod").Set(1)
+	gauge.WithLabelValues("b", "prod").Set(2)
+	registry.MustRegister(gauge, prometheus.NewCounter(prometheus.CounterOpts{Name: "elasticsearch_requests_total", Help: "Requests"}))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeMetricInventory(&buf, mfs); err != nil {
+		t.Fatalf("failed to write inventory: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 metrics, got %q", buf.String())
+	}
+	for i, want := range [][]string{
+		{"NAME", "TYPE", "SERIES", "LABELS", "HELP"},
+		{"elasticsearch_index_docs", "gauge", "2", "cluster,index", "Docs", "of", "the", "index"},
+		{"elasticsearch_requests_total", "counter", "1", "Requests"},
+	} {
+		if got := strings.Fields(lines[i]); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("line %d: expected %v, got %v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubernetesAPI sends requests to the Kubernetes API server
+type kubernetesAPI struct {
+	client    *http.Client
+	apiServer *url.URL
+	// tokenFile is re-read on every request since service account tokens are
+	// rotated
+	tokenFile string
+}
+
+// newKubernetesAPI returns a client of the given API server. An empty
+// apiServer uses the in-cluster configuration of the service account.
+func newKubernetesAPI(apiServer string) (*kubernetesAPI, error) {
+	api := &kubernetesAPI{client: &http.Client{}}
+	if apiServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in a Kubernetes cluster, the API server must be given")
+		}
+		apiServer = "https://" + net.JoinHostPort(host, port)
+		rootCAs, err := loadCertificatesFrom(kubernetesServiceAccountDir + "/ca.crt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the CA of the API server: %s", err)
+		}
+		api.client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: rootCAs},
+			Proxy:           http.ProxyFromEnvironment,
+		}
+		api.tokenFile = kubernetesServiceAccountDir + "/token"
+	}
+	u, err := url.Parse(apiServer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse API server: %s", err)
+	}
+	api.apiServer = u
+	return api, nil
+}
+
+// do sends a request with the JSON body, if not nil, to the path and query of
+// the API server
+func (api *kubernetesAPI) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	u := *api.apiServer
+	u.Path = path
+	u.RawQuery = query.Encode()
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if api.tokenFile != "" {
+		token, err := ioutil.ReadFile(api.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token: %s", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	return api.client.Do(req.WithContext(ctx))
+}
+
+// kubernetesDiscoverer discovers the pods or services matching a label
+// selector via the Kubernetes API
+type kubernetesDiscoverer struct {
+	api       *kubernetesAPI
+	namespace string
+	selector  string
+	role      string
+	scheme    string
+	port      int
+	// template provides the settings of the discovered targets
+	template target
+}
+
+// newKubernetesDiscoverer returns a discoverer for the given API server. An
+// empty apiServer uses the in-cluster configuration of the service account,
+// an empty namespace lists all namespaces.
+func newKubernetesDiscoverer(apiServer, namespace, selector, role, scheme string, port int, template target) (*kubernetesDiscoverer, error) {
+	if role != "pod" && role != "service" {
+		return nil, fmt.Errorf("invalid role %q, must be pod or service", role)
+	}
+	api, err := newKubernetesAPI(apiServer)
+	if err != nil {
+		return nil, err
+	}
+	return &kubernetesDiscoverer{
+		api:       api,
+		namespace: namespace,
+		selector:  selector,
+		role:      role,
+		scheme:    scheme,
+		port:      port,
+		template:  template,
+	}, nil
+}
+
+// kubernetesObjectList is the subset of a Kubernetes pod or service list
+// response the discoverer needs
+type kubernetesObjectList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Status struct {
+			Phase string `json:"phase"`
+			PodIP string `json:"podIP"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+func (d *kubernetesDiscoverer) discover(ctx context.Context) ([]target, error) {
+	path := "/api/v1"
+	if d.namespace != "" {
+		path += "/namespaces/" + d.namespace
+	}
+	path += "/" + d.role + "s"
+	res, err := d.api.do(ctx, http.MethodGet, path, url.Values{"labelSelector": {d.selector}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %ss: %s", d.role, err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list %ss: HTTP Request failed with code %d", d.role, res.StatusCode)
+	}
+
+	var list kubernetesObjectList
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode %s list: %s", d.role, err)
+	}
+
+	var targets []target
+	for _, item := range list.Items {
+		host := item.Metadata.Name + "." + item.Metadata.Namespace + ".svc"
+		if d.role == "pod" {
+			// pods which aren't running can't be scraped
+			if item.Status.Phase != "Running" || item.Status.PodIP == "" {
+				continue
+			}
+			host = item.Status.PodIP
+		}
+		t := d.template
+		t.name = item.Metadata.Namespace + "/" + item.Metadata.Name
+		t.url = &url.URL{Scheme: d.scheme, Host: net.JoinHostPort(host, strconv.Itoa(d.port))}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+func (d *kubernetesDiscoverer) String() string {
+	return "kubernetes"
+}
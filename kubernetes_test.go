@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKubernetesDiscoverer(t *testing.T) {
+	var path, selector string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, selector = r.URL.Path, r.URL.Query().Get("labelSelector")
+		fmt.Fprint(w, `{"items":[
+			{"metadata":{"name":"es-0","namespace":"logging"},"status":{"phase":"Running","podIP":"10.0.0.1"}},
+			{"metadata":{"name":"es-1","namespace":"logging"},"status":{"phase":"Pending"}}
+		]}`)
+	}))
+	defer api.Close()
+
+	d, err := newKubernetesDiscoverer(api.URL, "logging", "app=elasticsearch", "pod", "https", 9200, target{auth: AuthModule{APIKey: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := d.discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v1/namespaces/logging/pods" || selector != "app=elasticsearch" {
+		t.Errorf("unexpected request of %s with selector %q", path, selector)
+	}
+	if len(targets) != 1 {
+		t.Fatalf("expected only the running pod to be discovered, got %d targets", len(targets))
+	}
+	if got := targets[0]; got.name != "logging/es-0" || got.url.String() != "https://10.0.0.1:9200" || got.auth.APIKey != "secret" {
+		t.Errorf("unexpected target %s at %s", got.name, got.url)
+	}
+
+	d, err = newKubernetesDiscoverer(api.URL, "", "app=elasticsearch", "service", "http", 9200, target{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err = d.discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v1/services" {
+		t.Errorf("expected services of all namespaces to be listed, got %s", path)
+	}
+	if len(targets) != 2 || targets[1].url.String() != "http://es-1.logging.svc:9200" {
+		t.Errorf("unexpected service targets %v", targets)
+	}
+
+	if _, err := newKubernetesDiscoverer(api.URL, "", "", "node", "http", 9200, target{}); err == nil {
+		t.Error("expected invalid role to be rejected")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// parseLabels parses a comma separated list of name=value pairs
+func parseLabels(s string) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid label %q, expected name=value", pair)
+		}
+		name := strings.TrimSpace(kv[0])
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("label %q given more than once", name)
+		}
+		labels[name] = strings.TrimSpace(kv[1])
+	}
+	return labels, nil
+}
+
+// formatLabels is the inverse of parseLabels
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// labelsGatherer wraps g so that the given labels are attached to every
+// gathered metric. Labels already present on a metric are kept as they are.
+func labelsGatherer(labels prometheus.Labels, g prometheus.Gatherer) prometheus.Gatherer {
+	if len(labels) == 0 {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				m.Label = addLabels(m.Label, labels)
+			}
+		}
+		return mfs, err
+	})
+}
+
+func addLabels(pairs []*dto.LabelPair, labels prometheus.Labels) []*dto.LabelPair {
+	present := make(map[string]bool, len(pairs))
+	for _, lp := range pairs {
+		present[lp.GetName()] = true
+	}
+	for name, value := range labels {
+		if !present[name] {
+			pairs = append(pairs, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].GetName() < pairs[j].GetName() })
+	return pairs
+}
+
+// clusterLabelGatherer wraps g so that the cluster label of every gathered
+// metric is replaced by alias. The name reported by Elasticsearch is kept in
+// the cluster_name label.
+func clusterLabelGatherer(alias string, g prometheus.Gatherer) prometheus.Gatherer {
+	if alias == "" {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				for _, lp := range m.Label {
+					if lp.GetName() == "cluster" {
+						m.Label = addLabels(m.Label, prometheus.Labels{"cluster_name": lp.GetValue()})
+						lp.Value = proto.String(alias)
+						break
+					}
+				}
+			}
+		}
+		return mfs, err
+	})
+}
+
+// clusterUUIDGatherer wraps g so that the UUID of the cluster returned by uuid
+// is attached as cluster_uuid label to every gathered metric with a cluster
+// label, e.g. to tell apart clusters of the same name. Metrics are left as
+// they are while the UUID is unknown, and if uuid is nil.
+func clusterUUIDGatherer(uuid func() string, g prometheus.Gatherer) prometheus.Gatherer {
+	if uuid == nil {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		clusterUUID := uuid()
+		if clusterUUID == "" {
+			return mfs, err
+		}
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				for _, lp := range m.Label {
+					if lp.GetName() == "cluster" {
+						m.Label = addLabels(m.Label, prometheus.Labels{"cluster_uuid": clusterUUID})
+						break
+					}
+				}
+			}
+		}
+		return mfs, err
+	})
+}
+
+// exportGatherer applies the metric filter, the cluster alias and the static
+// labels to g
+func exportGatherer(g prometheus.Gatherer, filter *metricFilter, clusterLabel string, labels prometheus.Labels) prometheus.Gatherer {
+	return labelsGatherer(labels, clusterLabelGatherer(clusterLabel, filter.gatherer(g)))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels("env=prod, region=eu-west-1,empty=")
+	if err != nil {
+		t.Fatalf("failed to parse labels: %s", err)
+	}
+	want := prometheus.Labels{"env": "prod", "region": "eu-west-1", "empty": ""}
+	if len(labels) != len(want) {
+		t.Fatalf("expected %v, got %v", want, labels)
+	}
+	for name, value := range want {
+		if labels[name] != value {
+			t.Errorf("expected %s=%q, got %q", name, value, labels[name])
+		}
+	}
+	if got := formatLabels(labels); got != "empty=,env=prod,region=eu-west-1" {
+		t.Errorf("unexpected formatted labels %q", got)
+	}
+
+	for _, invalid := range []string{"env", "1env=prod", "__name__=foo", "env=a,env=b"} {
+		if _, err := parseLabels(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestLabelsGatherer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test", Help: "test"}, []string{"cluster"})
+	gauge.WithLabelValues("elasticsearch").Set(1)
+	registry.MustRegister(gauge)
+
+	mfs, err := labelsGatherer(prometheus.Labels{"env": "prod", "cluster": "override"}, registry).Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+	labels := mfs[0].Metric[0].Label
+	if len(labels) != 2 {
+		t.Fatalf("expected 2 labels, got %v", labels)
+	}
+	if labels[0].GetName() != "cluster" || labels[0].GetValue() != "elasticsearch" {
+		t.Errorf("existing label must not be overridden, got %v", labels[0])
+	}
+	if labels[1].GetName() != "env" || labels[1].GetValue() != "prod" {
+		t.Errorf("expected env=prod, got %v", labels[1])
+	}
+}
+
+func TestClusterLabelGatherer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test", Help: "test"}, []string{"cluster"})
+	gauge.WithLabelValues("elasticsearch").Set(1)
+	registry.MustRegister(gauge)
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "up", Help: "up"}))
+
+	mfs, err := clusterLabelGatherer("prod-logging", registry).Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+	for _, mf := range mfs {
+		labels := mf.Metric[0].Label
+		switch mf.GetName() {
+		case "test":
+			if len(labels) != 2 ||
+				labels[0].GetName() != "cluster" || labels[0].GetValue() != "prod-logging" ||
+				labels[1].GetName() != "cluster_name" || labels[1].GetValue() != "elasticsearch" {
+				t.Errorf("unexpected labels %v", labels)
+			}
+		case "up":
+			if len(labels) != 0 {
+				t.Errorf("metrics without cluster label must be kept as they are, got %v", labels)
+			}
+		}
+	}
+}
+
+func TestClusterUUIDGatherer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test", Help: "test"}, []string{"cluster"})
+	gauge.WithLabelValues("elasticsearch").Set(1)
+	registry.MustRegister(gauge)
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "up", Help: "up"}))
+
+	uuid := ""
+	g := clusterUUIDGatherer(func() string { return uuid }, registry)
+	mfs, err := g.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "test" && len(mf.Metric[0].Label) != 1 {
+			t.Errorf("metrics must be kept as they are while the uuid is unknown, got %v", mf.Metric[0].Label)
+		}
+	}
+
+	uuid = "3qps7bcWTqyzV49ApmPVfw"
+	mfs, err = g.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+	for _, mf := range mfs {
+		labels := mf.Metric[0].Label
+		switch mf.GetName() {
+		case "test":
+			if len(labels) != 2 ||
+				labels[0].GetName() != "cluster" || labels[0].GetValue() != "elasticsearch" ||
+				labels[1].GetName() != "cluster_uuid" || labels[1].GetValue() != uuid {
+				t.Errorf("unexpected labels %v", labels)
+			}
+		case "up":
+			if len(labels) != 0 {
+				t.Errorf("metrics without cluster label must be kept as they are, got %v", labels)
+			}
+		}
+	}
+}
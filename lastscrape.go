@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// lastScrapeBodyLimit is the maximum number of bytes recorded of a response
+const lastScrapeBodyLimit = 1 << 20
+
+// lastScrape records the latest response of every Elasticsearch API for the
+// /debug/last-scrape endpoint
+type lastScrape struct {
+	mtx   sync.Mutex
+	calls map[string]*recordedCall
+}
+
+// recordedCall is a request to Elasticsearch and its response
+type recordedCall struct {
+	Method   string    `json:"method"`
+	URL      string    `json:"url"`
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration_seconds"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	// Body is the raw response, JSON bodies are embedded as they are
+	Body      json.RawMessage `json:"body,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+func newLastScrape() *lastScrape {
+	return &lastScrape{calls: make(map[string]*recordedCall)}
+}
+
+func (l *lastScrape) record(call *recordedCall) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.calls[call.Method+" "+call.URL] = call
+}
+
+// roundTripper returns a RoundTripper recording the requests sent via next. A
+// nil lastScrape returns next.
+func (l *lastScrape) roundTripper(next http.RoundTripper) http.RoundTripper {
+	if l == nil {
+		return next
+	}
+	return &recordingRoundTripper{last: l, next: next}
+}
+
+// ServeHTTP implements the http.Handler interface
+func (l *lastScrape) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mtx.Lock()
+	calls := make([]*recordedCall, 0, len(l.calls))
+	for _, call := range l.calls {
+		calls = append(calls, call)
+	}
+	l.mtx.Unlock()
+	sort.Slice(calls, func(i, j int) bool { return calls[i].URL < calls[j].URL })
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(calls)
+}
+
+type recordingRoundTripper struct {
+	last *lastScrape
+	next http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// credentials must not show up on the debug endpoint
+	u := *req.URL
+	u.User = nil
+	call := &recordedCall{
+		Method:  req.Method,
+		URL:     u.String(),
+		Started: time.Now(),
+	}
+	res, err := rt.next.RoundTrip(req)
+	if err != nil {
+		call.Duration = time.Since(call.Started).Seconds()
+		call.Error = err.Error()
+		rt.last.record(call)
+		return nil, err
+	}
+	call.Status = res.StatusCode
+	res.Body = &recordingBody{ReadCloser: res.Body, call: call, last: rt.last}
+	return res, nil
+}
+
+// recordingBody records the response body as it is read by the collector
+type recordingBody struct {
+	io.ReadCloser
+	call *recordedCall
+	last *lastScrape
+	buf  bytes.Buffer
+	once sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := lastScrapeBodyLimit - b.buf.Len(); room > 0 {
+		if n > room {
+			b.call.Truncated = true
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p[:n])
+		}
+	} else if n > 0 {
+		b.call.Truncated = true
+	}
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) done() {
+	b.once.Do(func() {
+		b.call.Duration = time.Since(b.call.Started).Seconds()
+		body := b.buf.Bytes()
+		if !b.call.Truncated && json.Valid(body) {
+			b.call.Body = json.RawMessage(body)
+		} else if len(body) > 0 {
+			// non JSON and truncated bodies are embedded as string
+			b.call.Body, _ = json.Marshal(string(body))
+		}
+		b.last.record(b.call)
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLastScrape(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_cluster/health":
+			fmt.Fprint(w, `{"status":"green"}`)
+		case "/large":
+			fmt.Fprint(w, strings.Repeat("x", lastScrapeBodyLimit+1))
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer es.Close()
+
+	last := newLastScrape()
+	client := &http.Client{Transport: last.roundTripper(http.DefaultTransport)}
+	for _, path := range []string{"/_cluster/health", "/large", "/missing"} {
+		res, err := client.Get(strings.Replace(es.URL, "http://", "http://user:secret@", 1) + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+	}
+	if _, err := client.Get("http://127.0.0.1:1/"); err == nil {
+		t.Fatal("expected request to closed port to fail")
+	}
+
+	rec := httptest.NewRecorder()
+	last.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/last-scrape", nil))
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Error("credentials must not be exposed")
+	}
+	var calls []recordedCall
+	if err := json.Unmarshal(rec.Body.Bytes(), &calls); err != nil {
+		t.Fatalf("failed to decode calls: %s", err)
+	}
+	if len(calls) != 4 {
+		t.Fatalf("expected 4 calls, got %d", len(calls))
+	}
+	byPath := make(map[string]recordedCall)
+	for _, call := range calls {
+		byPath[call.URL[strings.LastIndex(call.URL, "/"):]] = call
+	}
+	if call := byPath["/health"]; call.Status != 200 || !strings.Contains(string(call.Body), `"status": "green"`) {
+		t.Errorf("unexpected call %+v", call)
+	}
+	if call := byPath["/large"]; !call.Truncated || len(call.Body) < lastScrapeBodyLimit {
+		t.Errorf("expected large body to be truncated, got %d bytes", len(call.Body))
+	}
+	if call := byPath["/missing"]; call.Status != 404 || string(call.Body) != `"not found\n"` {
+		t.Errorf("unexpected call %+v", call)
+	}
+	if call := byPath["/"]; call.Error == "" {
+		t.Errorf("expected error of failed call, got %+v", call)
+	}
+}
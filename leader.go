@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// leaseTimeFormat is the format of the MicroTime fields of a Lease
+const leaseTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// lease is the subset of a coordination.k8s.io/v1 Lease the elector needs
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec leaseSpec `json:"spec"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions"`
+}
+
+// leaseElector elects a single leader among the replicas of the exporter via
+// a Kubernetes Lease, e.g. so that only one replica pushes the metrics. The
+// leader renews the lease every third of its duration, the other replicas
+// take it over once it wasn't renewed for its duration. Like client-go, the
+// expiry is measured with the local clock from the time a change of the
+// lease was last observed, so the clocks of the replicas needn't agree.
+type leaseElector struct {
+	logger    log.Logger
+	api       *kubernetesAPI
+	namespace string
+	name      string
+	identity  string
+	duration  time.Duration
+	now       func() time.Time
+
+	mtx sync.Mutex
+	// observed is the spec of the lease as of the latest request and
+	// observedAt the time it last changed
+	observed   leaseSpec
+	observedAt time.Time
+	// renewedAt is the time the replica last renewed the lease as leader
+	renewedAt time.Time
+	isLeader  bool
+}
+
+// newLeaseElector returns an elector for the lease of the given name. An empty
+// apiServer uses the in-cluster configuration of the service account, an
+// empty leaseNamespace that of the service account and an empty identity the
+// hostname, i.e. the name of the pod.
+func newLeaseElector(logger log.Logger, apiServer, leaseNamespace, name, identity string, duration time.Duration) (*leaseElector, error) {
+	if duration < 3*time.Second {
+		return nil, fmt.Errorf("invalid lease duration %s, must be at least 3s", duration)
+	}
+	api, err := newKubernetesAPI(apiServer)
+	if err != nil {
+		return nil, err
+	}
+	if leaseNamespace == "" {
+		ns, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the namespace of the service account: %s", err)
+		}
+		leaseNamespace = strings.TrimSpace(string(ns))
+	}
+	if identity == "" {
+		if identity, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get the hostname as identity: %s", err)
+		}
+	}
+	return &leaseElector{
+		logger:    logger,
+		api:       api,
+		namespace: leaseNamespace,
+		name:      name,
+		identity:  identity,
+		duration:  duration,
+		now:       time.Now,
+	}, nil
+}
+
+func (e *leaseElector) path() string {
+	return "/apis/coordination.k8s.io/v1/namespaces/" + e.namespace + "/leases"
+}
+
+// leading reports whether the replica holds the lease. A nil elector always
+// leads.
+func (e *leaseElector) leading() bool {
+	if e == nil {
+		return true
+	}
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.isLeader
+}
+
+// run tries to acquire or renew the lease every third of its duration until
+// ctx is cancelled. The first attempt completes before run returns.
+func (e *leaseElector) run(ctx context.Context) {
+	e.tick(ctx)
+	go func() {
+		ticker := time.NewTicker(e.duration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.tick(ctx)
+			}
+		}
+	}()
+}
+
+func (e *leaseElector) tick(ctx context.Context) {
+	tctx, cancel := context.WithTimeout(ctx, e.duration/3)
+	err := e.tryAcquireOrRenew(tctx)
+	cancel()
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if err != nil {
+		_ = level.Warn(e.logger).Log(
+			"msg", "failed to acquire or renew the lease",
+			"lease", e.name,
+			"err", err,
+		)
+		// the other replicas take over once the lease expired, stop leading
+		// before
+		if e.isLeader && e.now().Sub(e.renewedAt) >= e.duration*2/3 {
+			e.isLeader = false
+			_ = level.Info(e.logger).Log("msg", "lost the leadership", "lease", e.name)
+		}
+	}
+}
+
+// tryAcquireOrRenew creates the lease or updates it if the replica holds it or
+// it expired. Losing a race for the lease against another replica isn't an
+// error.
+func (e *leaseElector) tryAcquireOrRenew(ctx context.Context) error {
+	now := e.now()
+	res, err := e.api.do(ctx, http.MethodGet, e.path()+"/"+e.name, nil, nil)
+	if err != nil {
+		return err
+	}
+	var l lease
+	if res.StatusCode == http.StatusOK {
+		err = json.NewDecoder(res.Body).Decode(&l)
+	}
+	_ = res.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode the lease: %s", err)
+	}
+
+	spec := leaseSpec{
+		HolderIdentity:       e.identity,
+		LeaseDurationSeconds: int(e.duration / time.Second),
+		AcquireTime:          now.UTC().Format(leaseTimeFormat),
+		RenewTime:            now.UTC().Format(leaseTimeFormat),
+	}
+	method, path := http.MethodPut, e.path()+"/"+e.name
+	switch res.StatusCode {
+	case http.StatusOK:
+		e.mtx.Lock()
+		if l.Spec != e.observed {
+			e.observed, e.observedAt = l.Spec, now
+		}
+		expiry := e.observedAt.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second)
+		e.mtx.Unlock()
+		if holder := l.Spec.HolderIdentity; holder != "" && holder != e.identity && now.Before(expiry) {
+			e.setLeader(false, l.Spec.HolderIdentity)
+			return nil
+		}
+		if l.Spec.HolderIdentity == e.identity {
+			spec.AcquireTime = l.Spec.AcquireTime
+			spec.LeaseTransitions = l.Spec.LeaseTransitions
+		} else {
+			spec.LeaseTransitions = l.Spec.LeaseTransitions + 1
+		}
+	case http.StatusNotFound:
+		method, path = http.MethodPost, e.path()
+		l.APIVersion, l.Kind = "coordination.k8s.io/v1", "Lease"
+		l.Metadata.Name, l.Metadata.Namespace = e.name, e.namespace
+	default:
+		return fmt.Errorf("failed to get the lease: HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	// the resource version of the lease fails the update with a conflict if
+	// another replica updated it in the meantime
+	l.Spec = spec
+	res, err = e.api.do(ctx, method, path, nil, &l)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		e.mtx.Lock()
+		e.observed, e.observedAt, e.renewedAt = spec, now, now
+		e.mtx.Unlock()
+		e.setLeader(true, e.identity)
+		return nil
+	case http.StatusConflict:
+		e.setLeader(false, "")
+		return nil
+	default:
+		return fmt.Errorf("failed to update the lease: HTTP Request failed with code %d", res.StatusCode)
+	}
+}
+
+// setLeader records whether the replica leads and logs changes
+func (e *leaseElector) setLeader(leader bool, holder string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if leader == e.isLeader {
+		return
+	}
+	e.isLeader = leader
+	if leader {
+		_ = level.Info(e.logger).Log("msg", "became the leader", "lease", e.name, "identity", e.identity)
+	} else {
+		_ = level.Info(e.logger).Log("msg", "lost the leadership", "lease", e.name, "holder", holder)
+	}
+}
+
+// release gives up the lease if the replica holds it, so that another replica
+// takes over without waiting for it to expire
+func (e *leaseElector) release(ctx context.Context) error {
+	if !e.leading() {
+		return nil
+	}
+	res, err := e.api.do(ctx, http.MethodGet, e.path()+"/"+e.name, nil, nil)
+	if err != nil {
+		return err
+	}
+	var l lease
+	if res.StatusCode == http.StatusOK {
+		err = json.NewDecoder(res.Body).Decode(&l)
+	} else {
+		err = fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+	_ = res.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to get the lease: %s", err)
+	}
+	if l.Spec.HolderIdentity != e.identity {
+		return nil
+	}
+	l.Spec.HolderIdentity = ""
+	res, err = e.api.do(ctx, http.MethodPut, e.path()+"/"+e.name, nil, &l)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to release the lease: HTTP Request failed with code %d", res.StatusCode)
+	}
+	e.setLeader(false, "")
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// fakeLeaseAPI stores a single Lease and rejects updates of outdated versions
+// like the API server
+type fakeLeaseAPI struct {
+	mtx     sync.Mutex
+	lease   *lease
+	version int
+}
+
+func (f *fakeLeaseAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	const path = "/apis/coordination.k8s.io/v1/namespaces/monitoring/leases"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == path+"/exporter":
+		if f.lease == nil {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(f.lease)
+	case r.Method == http.MethodPost && r.URL.Path == path:
+		if f.lease != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.store(w, r, http.StatusCreated)
+	case r.Method == http.MethodPut && r.URL.Path == path+"/exporter":
+		var l lease
+		_ = json.NewDecoder(r.Body).Decode(&l)
+		if f.lease == nil || l.Metadata.ResourceVersion != f.lease.Metadata.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.lease = &l
+		f.version++
+		f.lease.Metadata.ResourceVersion = strconv.Itoa(f.version)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeLeaseAPI) store(w http.ResponseWriter, r *http.Request, code int) {
+	var l lease
+	_ = json.NewDecoder(r.Body).Decode(&l)
+	f.version++
+	l.Metadata.ResourceVersion = strconv.Itoa(f.version)
+	f.lease = &l
+	w.WriteHeader(code)
+}
+
+func TestLeaseElector(t *testing.T) {
+	api := &fakeLeaseAPI{}
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+	elector := func(identity string) *leaseElector {
+		e, err := newLeaseElector(log.NewNopLogger(), ts.URL, "monitoring", "exporter", identity, 15*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.now = clock
+		return e
+	}
+	a, b := elector("a"), elector("b")
+	ctx := context.Background()
+
+	if err := a.tryAcquireOrRenew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.tryAcquireOrRenew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !a.leading() || b.leading() {
+		t.Fatalf("expected a to acquire the lease, a: %t, b: %t", a.leading(), b.leading())
+	}
+
+	// a renews the lease, b doesn't take it over
+	now = now.Add(10 * time.Second)
+	if err := a.tryAcquireOrRenew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(10 * time.Second)
+	if err := b.tryAcquireOrRenew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !a.leading() || b.leading() {
+		t.Fatalf("expected a to keep the renewed lease, a: %t, b: %t", a.leading(), b.leading())
+	}
+
+	// a stops renewing, b takes over once the lease expired
+	now = now.Add(16 * time.Second)
+	if err := b.tryAcquireOrRenew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.tryAcquireOrRenew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if a.leading() || !b.leading() {
+		t.Fatalf("expected b to take over the expired lease, a: %t, b: %t", a.leading(), b.leading())
+	}
+	if api.lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("expected 1 transition, got %d", api.lease.Spec.LeaseTransitions)
+	}
+
+	// b releases the lease, a acquires it at once
+	if err := b.release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.tryAcquireOrRenew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !a.leading() || b.leading() {
+		t.Fatalf("expected a to acquire the released lease, a: %t, b: %t", a.leading(), b.leading())
+	}
+
+	var unelected *leaseElector
+	if !unelected.leading() {
+		t.Error("expected a nil elector to lead")
+	}
+}
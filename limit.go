@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// responseLimitRoundTripper fails responses of Elasticsearch larger than
+// maxSize bytes, so that a huge stats response can't exhaust the memory of
+// the exporter.
+type responseLimitRoundTripper struct {
+	maxSize int64
+	next    http.RoundTripper
+}
+
+// newResponseLimitRoundTripper returns next if maxSize isn't positive
+func newResponseLimitRoundTripper(maxSize int64, next http.RoundTripper) http.RoundTripper {
+	if maxSize <= 0 {
+		return next
+	}
+	return &responseLimitRoundTripper{maxSize: maxSize, next: next}
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *responseLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// fail early if the size is known, chunked responses fail once the limit
+	// is reached while they are decoded
+	if res.ContentLength > rt.maxSize {
+		_ = res.Body.Close()
+		return nil, errResponseTooLarge(req, rt.maxSize)
+	}
+	res.Body = &limitedBody{ReadCloser: res.Body, remaining: rt.maxSize, err: errResponseTooLarge(req, rt.maxSize)}
+	return res, nil
+}
+
+func errResponseTooLarge(req *http.Request, maxSize int64) error {
+	return fmt.Errorf("response of %s exceeds the maximum size of %d bytes", req.URL.Path, maxSize)
+}
+
+// limitedBody returns err once more than remaining bytes are read
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	err       error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, b.err
+	}
+	// read a byte more than allowed to detect bodies exceeding the limit
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = -1
+		return n, b.err
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
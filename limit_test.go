@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseLimitRoundTripper(t *testing.T) {
+	body := `{"status":"` + strings.Repeat("x", 100) + `"}`
+	tcs := []struct {
+		maxSize int64
+		chunked bool
+		fail    bool
+	}{
+		{maxSize: 0, fail: false},
+		{maxSize: int64(len(body)), fail: false},
+		{maxSize: int64(len(body)), chunked: true, fail: false},
+		{maxSize: 50, fail: true},
+		{maxSize: 50, chunked: true, fail: true},
+	}
+	for _, tc := range tcs {
+		es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.chunked {
+				// flushing before writing the body omits the Content-Length
+				w.(http.Flusher).Flush()
+			}
+			_, _ = w.Write([]byte(body))
+		}))
+
+		client := &http.Client{Transport: newResponseLimitRoundTripper(tc.maxSize, http.DefaultTransport)}
+		res, err := client.Get(es.URL)
+		if err == nil {
+			var v map[string]string
+			err = json.NewDecoder(res.Body).Decode(&v)
+			_ = res.Body.Close()
+		}
+		es.Close()
+
+		if fail := err != nil; fail != tc.fail {
+			t.Errorf("%+v: expected failure %t, got error %v", tc, tc.fail, err)
+		}
+		if tc.fail && err != nil && !strings.Contains(err.Error(), "exceeds the maximum size of 50 bytes") {
+			t.Errorf("%+v: unexpected error %s", tc, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -9,7 +10,7 @@ import (
 	"strings"
 )
 
-func getLogger(loglevel, logoutput, logfmt string) log.Logger {
+func getLogger(loglevel, logoutput, logfmt string, dedupInterval time.Duration) log.Logger {
 	var out *os.File
 	switch strings.ToLower(logoutput) {
 	case "stderr":
@@ -47,6 +48,7 @@ func getLogger(loglevel, logoutput, logfmt string) log.Logger {
 		loglevelFilterOpt = level.AllowInfo()
 	}
 	logger = level.NewFilter(logger, loglevelFilterOpt)
+	logger = newDedupLogger(logger, dedupInterval)
 	logger = log.With(logger,
 		"ts", log.DefaultTimestampUTC,
 		"caller", log.DefaultCaller,
@@ -2,10 +2,10 @@ package main
 
 import (
 	"net/http"
-	"net/url"
+	"net/http/pprof"
 	"os"
 	"os/signal"
-	"time"
+	"syscall"
 
 	"context"
 
@@ -13,49 +13,185 @@ import (
 	"github.com/justwatchcom/elasticsearch_exporter/collector"
 	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/version"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
+const namespace = "elasticsearch_exporter"
+
 func main() {
 	var (
 		Name          = "elasticsearch_exporter"
 		listenAddress = kingpin.Flag("web.listen-address",
-			"Address to listen on for web interface and telemetry.").
+			"Address to listen on for web interface and telemetry. unix:///path/to/socket listens on a Unix domain socket, systemd on the socket passed by systemd socket activation.").
 			Default(":9114").Envar("WEB_LISTEN_ADDRESS").String()
 		metricsPath = kingpin.Flag("web.telemetry-path",
 			"Path under which to expose metrics.").
 			Default("/metrics").Envar("WEB_TELEMETRY_PATH").String()
 		esURI = kingpin.Flag("es.uri",
-			"HTTP API address of an Elasticsearch node.").
+			"HTTP API address of an Elasticsearch node. Multiple comma separated addresses of the same cluster can be given to fail over if a node is down. dns+srv:// and dns+a:// URIs are resolved to the addresses of the nodes, unix:// URIs address a Unix domain socket.").
 			Default("http://localhost:9200").Envar("ES_URI").String()
+		esDNSRefreshInterval = kingpin.Flag("es.dns-refresh-interval",
+			"Interval of re-resolving dns+srv:// and dns+a:// URIs given in es.uri.").
+			Default("30s").Envar("ES_DNS_REFRESH_INTERVAL").Duration()
 		esTimeout = kingpin.Flag("es.timeout",
 			"Timeout for trying to get stats from Elasticsearch.").
 			Default("5s").Envar("ES_TIMEOUT").Duration()
+		esTimeouts = kingpin.Flag("es.timeouts",
+			"Comma separated list of collector=timeout pairs overriding es.timeout for single collectors, e.g. indices=60s.").
+			Default("").Envar("ES_TIMEOUTS").String()
+		esIntervals = kingpin.Flag("es.intervals",
+			"Comma separated list of collector=interval pairs, the collector is collected at most once per interval and serves its last metrics in between, e.g. snapshots=5m. Applies to the collectors of es.uri only, /probe and discovered targets are collected on every scrape.").
+			Default("").Envar("ES_INTERVALS").String()
+		esRetries = kingpin.Flag("es.retries",
+			"Number of retries of requests to Elasticsearch failing with timeouts, connection errors or status 429, 502, 503 or 504.").
+			Default("0").Envar("ES_RETRIES").Int()
+		esRetryBackoff = kingpin.Flag("es.retry-backoff",
+			"Backoff before the first retry of a request to Elasticsearch, doubled for every further retry.").
+			Default("100ms").Envar("ES_RETRY_BACKOFF").Duration()
+		esCompression = kingpin.Flag("es.compression",
+			"Request gzip compressed responses from Elasticsearch, which requires http.compression to be enabled in Elasticsearch.").
+			Default("true").Envar("ES_COMPRESSION").Bool()
+		esHTTP2 = kingpin.Flag("es.http2",
+			"Negotiate HTTP/2 with Elasticsearch or proxies in front of it supporting it via TLS.").
+			Default("false").Envar("ES_HTTP2").Bool()
+		esTLSSessionCacheSize = kingpin.Flag("es.tls-session-cache-size",
+			"Number of servers whose TLS sessions are cached to resume them with new connections. 0 disables session resumption.").
+			Default("64").Envar("ES_TLS_SESSION_CACHE_SIZE").Int()
+		esMaxResponseSize = kingpin.Flag("es.max-response-size",
+			"Maximum size of a response of Elasticsearch, e.g. 256MB. Larger responses fail the scrape of the collector. 0 disables the limit.").
+			Default("0").Envar("ES_MAX_RESPONSE_SIZE").Bytes()
+		esStrictParsing = kingpin.Flag("es.strict-parsing",
+			"Count the fields of the responses of Elasticsearch the exporter doesn't know in elasticsearch_exporter_json_unknown_fields_total and log them at debug level.").
+			Default("false").Envar("ES_STRICT_PARSING").Bool()
+		esBreakerThreshold = kingpin.Flag("es.breaker-threshold",
+			"Number of consecutive failures after which a collector is disabled for es.breaker-cooldown. 0 never disables collectors.").
+			Default("0").Envar("ES_BREAKER_THRESHOLD").Int()
+		esBreakerCooldown = kingpin.Flag("es.breaker-cooldown",
+			"Period for which a collector is disabled after es.breaker-threshold consecutive failures.").
+			Default("5m").Envar("ES_BREAKER_COOLDOWN").Duration()
+		esConcurrency = kingpin.Flag("es.concurrency",
+			"Maximum number of collectors querying Elasticsearch at once. 0 collects all collectors at once.").
+			Default("4").Envar("ES_CONCURRENCY").Int()
 		esAllNodes = kingpin.Flag("es.all",
 			"Export stats for all nodes in the cluster. If used, this flag will override the flag es.node.").
 			Default("false").Envar("ES_ALL").Bool()
+		esAllNodesAlias = kingpin.Flag("es.all-nodes",
+			"Alias of es.all. Export stats for all nodes in the cluster instead of the _local node.").
+			Default("false").Envar("ES_ALL_NODES").Bool()
 		esNode = kingpin.Flag("es.node",
 			"Node's name of which metrics should be exposed.").
 			Default("_local").Envar("ES_NODE").String()
+		esSniff = kingpin.Flag("es.sniff",
+			"Discover the nodes of the cluster via /_nodes/http and fetch the stats of every node from the node itself. Overrides es.all and es.node.").
+			Default("false").Envar("ES_SNIFF").Bool()
+		esNodeStatsSections = kingpin.Flag("es.node-stats-sections",
+			"Comma separated sections of the node stats to request, e.g. jvm,os,fs. Empty requests all exported sections: indices,os,fs,thread_pool,jvm,breaker,http,transport,process,discovery,repositories,indexing_pressure. The indices section is skipped for nodes holding no shards.").
+			Default("").Envar("ES_NODE_STATS_SECTIONS").String()
 		esExportIndices = kingpin.Flag("es.indices",
 			"Export stats for indices in the cluster.").
 			Default("false").Envar("ES_INDICES").Bool()
+		indicesIncludeHidden = kingpin.Flag("indices.include-hidden",
+			"Export the per-index metrics of hidden and dot-prefixed system indices as well.").
+			Default("false").Envar("INDICES_INCLUDE_HIDDEN").Bool()
+		indicesShardLatency = kingpin.Flag("indices.shard-latency",
+			"Export the search and indexing times of every shard along with the metrics of es.indices or es.shards.").
+			Default("false").Envar("INDICES_SHARD_LATENCY").Bool()
+		indicesTopN = kingpin.Flag("indices.top-n",
+			"Export the per-index metrics only of the first N indices ordered by indices.top-by and aggregate the others into the index _other. 0 exports all indices.").
+			Default("0").Envar("INDICES_TOP_N").Int()
+		indicesTopBy = kingpin.Flag("indices.top-by",
+			"Order of the indices of indices.top-n, store_size or indexing_rate.").
+			Default("store_size").Envar("INDICES_TOP_BY").String()
 		esExportIndicesSettings = kingpin.Flag("es.indices_settings",
 			"Export stats for settings of all indices of the cluster.").
 			Default("false").Envar("ES_INDICES_SETTINGS").Bool()
 		esExportClusterSettings = kingpin.Flag("es.cluster_settings",
 			"Export stats for cluster settings.").
 			Default("false").Envar("ES_CLUSTER_SETTINGS").Bool()
+		esExportDesiredBalance = kingpin.Flag("es.desired_balance",
+			"Export the view of the shard balancer of Elasticsearch 8.6+ on the cluster.").
+			Default("false").Envar("ES_DESIRED_BALANCE").Bool()
+		esExportSecurity = kingpin.Flag("es.security",
+			"Export the number of configured realms and of active and expiring API keys, see es.api-key-expiry-window.").
+			Default("false").Envar("ES_SECURITY").Bool()
+		esExportShardStores = kingpin.Flag("es.shard_stores",
+			"Export the nodes holding copies of the shards of red and yellow indices.").
+			Default("false").Envar("ES_SHARD_STORES").Bool()
+		esExportUnreplicatedShards = kingpin.Flag("es.unreplicated_shards",
+			"Export the number of shards every node holds the only active copy of.").
+			Default("false").Envar("ES_UNREPLICATED_SHARDS").Bool()
+		esExportUsage = kingpin.Flag("es.usage",
+			"Export the usage of ES|QL and Search Applications of Elasticsearch 8.11+.").
+			Default("false").Envar("ES_USAGE").Bool()
+		esExportML = kingpin.Flag("es.ml",
+			"Export the inference stats of the trained models and the state of their deployments.").
+			Default("false").Envar("ES_ML").Bool()
+		esExportDownsampling = kingpin.Flag("es.downsampling",
+			"Export the status and documents of the downsampled indices of time series data streams and the stats of the rollup jobs.").
+			Default("false").Envar("ES_DOWNSAMPLING").Bool()
+		esExportTSDS = kingpin.Flag("es.tsds",
+			"Export the time bounds of the backing indices of time series data streams.").
+			Default("false").Envar("ES_TSDS").Bool()
+		esExportISM = kingpin.Flag("es.ism",
+			"Export the number of indices by ISM policy and state of OpenSearch clusters.").
+			Default("false").Envar("ES_ISM").Bool()
+		esExportKNN = kingpin.Flag("es.knn",
+			"Export the k-NN graph memory and cache stats of the nodes of OpenSearch clusters.").
+			Default("false").Envar("ES_KNN").Bool()
+		esExportSecurityPlugin = kingpin.Flag("es.security_plugin",
+			"Export the health of the security plugin of OpenSearch clusters.").
+			Default("false").Envar("ES_SECURITY_PLUGIN").Bool()
+		esAPIKeyExpiryWindow = kingpin.Flag("es.api-key-expiry-window",
+			"Window of the API keys exported as expiring by es.security.").
+			Default("168h").Envar("ES_API_KEY_EXPIRY_WINDOW").Duration()
+		esAuditLogIndexPattern = kingpin.Flag("es.audit-log-index-pattern",
+			"Index pattern of the security audit log shipped to Elasticsearch, e.g. filebeat-*. If set, the time since the newest audit event is exported.").
+			Default("").Envar("ES_AUDIT_LOG_INDEX_PATTERN").String()
 		esExportShards = kingpin.Flag("es.shards",
 			"Export stats for shards in the cluster (implies --es.indices).").
 			Default("false").Envar("ES_SHARDS").Bool()
+		esLegacyMillisMetrics = kingpin.Flag("es.legacy-millis-metrics",
+			"Export durations in milliseconds under their former names along with the _seconds metrics.").
+			Default("true").Envar("ES_LEGACY_MILLIS_METRICS").Bool()
+		esDerivedLatencies = kingpin.Flag("es.derived-latencies",
+			"Export the average latencies of indexing, search, get, refresh and flush operations of every node between two scrapes.").
+			Default("false").Envar("ES_DERIVED_LATENCIES").Bool()
+		esHotSpots = kingpin.Flag("es.hot-spots",
+			"Export the ratios of the indexing and search rates and of the store size of every node to the mean of the nodes holding shards, requires es.all or es.sniff.").
+			Default("false").Envar("ES_HOT_SPOTS").Bool()
+		esNodeShards = kingpin.Flag("es.node-shards",
+			"Export the number of shards allocated to every node and data tier from the cat allocation API, one more request to the cluster per scrape.").
+			Default("false").Envar("ES_NODE_SHARDS").Bool()
 		esExportSnapshots = kingpin.Flag("es.snapshots",
 			"Export stats for the cluster snapshots.").
 			Default("false").Envar("ES_SNAPSHOTS").Bool()
+		snapshotsSizes = kingpin.Flag("snapshots.sizes",
+			"Export the sizes of the snapshots by repository and policy along with the metrics of es.snapshots, requesting the status of every new snapshot.").
+			Default("false").Envar("SNAPSHOTS_SIZES").Bool()
 		esClusterInfoInterval = kingpin.Flag("es.clusterinfo.interval",
 			"Cluster info update interval for the cluster label").
 			Default("5m").Envar("ES_CLUSTERINFO_INTERVAL").Duration()
+		esClusterUUIDLabel = kingpin.Flag("es.cluster-uuid-label",
+			"Attach the UUID of the cluster as cluster_uuid label to the metrics with a cluster label, to tell apart clusters of the same name.").
+			Default("false").Envar("ES_CLUSTER_UUID_LABEL").Bool()
+		esClusterLabel = kingpin.Flag("es.cluster-label",
+			"Value of the cluster label, replacing the cluster name reported by Elasticsearch, which is kept in the cluster_name label.").
+			Default("").Envar("ES_CLUSTER_LABEL").String()
+		esMinInterval = kingpin.Flag("es.min-interval",
+			"Minimum interval between scrapes of Elasticsearch. Scrapes within the interval are served from a cache. Concurrent scrapes share a single scrape of Elasticsearch regardless.").
+			Default("0s").Envar("ES_MIN_INTERVAL").Duration()
+		esFixtureDir = kingpin.Flag("es.fixture-dir",
+			"Directory the responses of Elasticsearch are recorded to or replayed from, see es.fixture-mode. Disabled if empty.").
+			Default("").Envar("ES_FIXTURE_DIR").String()
+		esFixtureMode = kingpin.Flag("es.fixture-mode",
+			"Mode of es.fixture-dir. Valid modes are record, which records the responses of es.uri, and replay, which serves the recorded responses without a cluster.").
+			Default("replay").Envar("ES_FIXTURE_MODE").String()
+		esTimestamps = kingpin.Flag("es.timestamps",
+			"Attach the time of the scrape of Elasticsearch to its metrics, so that metrics served from the cache can be detected as stale.").
+			Default("false").Envar("ES_TIMESTAMPS").Bool()
 		esCA = kingpin.Flag("es.ca",
 			"Path to PEM file that contains trusted Certificate Authorities for the Elasticsearch connection.").
 			Default("").Envar("ES_CA").String()
@@ -65,9 +201,150 @@ func main() {
 		esClientCert = kingpin.Flag("es.client-cert",
 			"Path to PEM file that contains the corresponding cert for the private key to connect to Elasticsearch.").
 			Default("").Envar("ES_CLIENT_CERT").String()
+		esPasswordFile = kingpin.Flag("es.password-file",
+			"Path to a file containing the password of the user given in es.uri, read on every request.").
+			Default("").Envar("ES_PASSWORD_FILE").String()
+		esAPIKeyFile = kingpin.Flag("es.api-key-file",
+			"Path to a file containing the API key to authenticate against Elasticsearch, read on every request.").
+			Default("").Envar("ES_API_KEY_FILE").String()
+		tlsKeyPasswordFile = kingpin.Flag("tls.key-password-file",
+			"Path to a file containing the password of the encrypted es.client-private-key, read on every TLS handshake.").
+			Default("").Envar("TLS_KEY_PASSWORD_FILE").String()
 		esInsecureSkipVerify = kingpin.Flag("es.ssl-skip-verify",
 			"Skip SSL verification when connecting to Elasticsearch.").
 			Default("false").Envar("ES_SSL_SKIP_VERIFY").Bool()
+		webAllowedCIDRs = kingpin.Flag("web.allowed-cidrs",
+			"Comma separated list of CIDR ranges which are allowed to scrape the exporter. Empty allows all.").
+			Default("").Envar("WEB_ALLOWED_CIDRS").String()
+		webTLSCert = kingpin.Flag("web.tls-cert",
+			"Path to PEM file that contains the certificate to serve the web interface and telemetry over TLS.").
+			Default("").Envar("WEB_TLS_CERT").String()
+		webTLSPrivateKey = kingpin.Flag("web.tls-private-key",
+			"Path to PEM file that contains the private key for web.tls-cert.").
+			Default("").Envar("WEB_TLS_PRIVATE_KEY").String()
+		webTLSClientCA = kingpin.Flag("web.tls-client-ca",
+			"Path to PEM file that contains the CAs to verify client certificates against. If set, clients must present a valid certificate.").
+			Default("").Envar("WEB_TLS_CLIENT_CA").String()
+		metricsInclude = kingpin.Flag("metrics.include",
+			"Regular expression of metric names to export. Empty exports all metrics.").
+			Default("").Envar("METRICS_INCLUDE").String()
+		metricsExclude = kingpin.Flag("metrics.exclude",
+			"Regular expression of metric names to drop, applied after metrics.include.").
+			Default("").Envar("METRICS_EXCLUDE").String()
+		metricsCommunityNames = kingpin.Flag("metrics.community-names",
+			"Also export the metrics named differently by the prometheus-community/elasticsearch_exporter under the community names.").
+			Default("false").Envar("METRICS_COMMUNITY_NAMES").Bool()
+		constLabels = kingpin.Flag("labels",
+			"Comma separated list of name=value labels to attach to every exported metric.").
+			Default("").Envar("LABELS").String()
+		webEnablePprof = kingpin.Flag("web.enable-pprof",
+			"Expose the Go profiling endpoints under /debug/pprof/.").
+			Default("false").Envar("WEB_ENABLE_PPROF").Bool()
+		webEnableLastScrape = kingpin.Flag("web.enable-last-scrape",
+			"Expose the raw responses and timings of the latest requests to Elasticsearch under /debug/last-scrape.").
+			Default("false").Envar("WEB_ENABLE_LAST_SCRAPE").Bool()
+		webTimeoutOffset = kingpin.Flag("web.timeout-offset",
+			"Offset to subtract from the scrape timeout announced by Prometheus, bounding the requests to Elasticsearch.").
+			Default("0.5s").Envar("WEB_TIMEOUT_OFFSET").Duration()
+		webMaxRequests = kingpin.Flag("web.max-requests",
+			"Maximum number of scrapes of /metrics and /probe served at once. Further scrapes are answered with 503. 0 disables the limit.").
+			Default("40").Envar("WEB_MAX_REQUESTS").Int()
+		webShutdownTimeout = kingpin.Flag("web.shutdown-timeout",
+			"Maximum time to wait for in-flight scrapes to complete on shutdown.").
+			Default("10s").Envar("WEB_SHUTDOWN_TIMEOUT").Duration()
+		discoveryKubernetesSelector = kingpin.Flag("discovery.kubernetes.selector",
+			"Label selector of the Kubernetes pods or services to discover and scrape along with es.uri, e.g. app=elasticsearch. Empty disables the discovery.").
+			Default("").Envar("DISCOVERY_KUBERNETES_SELECTOR").String()
+		discoveryKubernetesNamespace = kingpin.Flag("discovery.kubernetes.namespace",
+			"Namespace to discover Kubernetes pods or services in. Empty discovers all namespaces.").
+			Default("").Envar("DISCOVERY_KUBERNETES_NAMESPACE").String()
+		discoveryKubernetesRole = kingpin.Flag("discovery.kubernetes.role",
+			"Kind of Kubernetes objects to discover, pod or service.").
+			Default("pod").Envar("DISCOVERY_KUBERNETES_ROLE").String()
+		discoveryKubernetesPort = kingpin.Flag("discovery.kubernetes.port",
+			"HTTP port of the discovered Elasticsearch pods or services.").
+			Default("9200").Envar("DISCOVERY_KUBERNETES_PORT").Int()
+		discoveryKubernetesScheme = kingpin.Flag("discovery.kubernetes.scheme",
+			"Scheme of the discovered Elasticsearch pods or services.").
+			Default("http").Envar("DISCOVERY_KUBERNETES_SCHEME").String()
+		discoveryKubernetesAPIServer = kingpin.Flag("discovery.kubernetes.api-server",
+			"Address of the Kubernetes API server. Empty uses the in-cluster service account.").
+			Default("").Envar("DISCOVERY_KUBERNETES_API_SERVER").String()
+		discoveryConsulService = kingpin.Flag("discovery.consul.service",
+			"Name of the Consul service whose healthy instances are discovered and scraped along with es.uri. Empty disables the discovery.").
+			Default("").Envar("DISCOVERY_CONSUL_SERVICE").String()
+		discoveryConsulTag = kingpin.Flag("discovery.consul.tag",
+			"Tag the discovered Consul service instances must have.").
+			Default("").Envar("DISCOVERY_CONSUL_TAG").String()
+		discoveryConsulDatacenter = kingpin.Flag("discovery.consul.datacenter",
+			"Consul datacenter to discover service instances in. Empty uses the datacenter of the agent.").
+			Default("").Envar("DISCOVERY_CONSUL_DATACENTER").String()
+		discoveryConsulServer = kingpin.Flag("discovery.consul.server",
+			"Address of the Consul agent.").
+			Default("http://localhost:8500").Envar("DISCOVERY_CONSUL_SERVER").String()
+		discoveryConsulToken = kingpin.Flag("discovery.consul.token",
+			"ACL token to authenticate against Consul.").
+			Default("").Envar("DISCOVERY_CONSUL_TOKEN").String()
+		discoveryConsulTokenFile = kingpin.Flag("discovery.consul.token-file",
+			"Path to a file containing the ACL token to authenticate against Consul, read on every request.").
+			Default("").Envar("DISCOVERY_CONSUL_TOKEN_FILE").String()
+		discoveryConsulScheme = kingpin.Flag("discovery.consul.scheme",
+			"Scheme of the discovered Elasticsearch instances.").
+			Default("http").Envar("DISCOVERY_CONSUL_SCHEME").String()
+		discoveryClusters = kingpin.Flag("discovery.clusters",
+			"Scrape the clusters of the config file concurrently along with es.uri, labeled with their name.").
+			Default("false").Envar("DISCOVERY_CLUSTERS").Bool()
+		discoveryRefreshInterval = kingpin.Flag("discovery.refresh-interval",
+			"Interval of refreshing the discovered targets.").
+			Default("1m").Envar("DISCOVERY_REFRESH_INTERVAL").Duration()
+		discoveryAuthModule = kingpin.Flag("discovery.auth-module",
+			"Name of the auth module of the config file to authenticate against discovered targets.").
+			Default("").Envar("DISCOVERY_AUTH_MODULE").String()
+		shard = kingpin.Flag("shard",
+			"Share of the nodes of es.all or es.sniff and of the discovered targets scraped by this replica, as <index>/<count>, e.g. 2/5 for the second of five replicas.").
+			Default("").Envar("SHARD").String()
+		outputFile = kingpin.Flag("output.file",
+			"Write the metrics of es.uri to this file on every output.interval instead of serving them via HTTP, e.g. for the textfile collector of the node exporter.").
+			Default("").Envar("OUTPUT_FILE").String()
+		outputInterval = kingpin.Flag("output.interval",
+			"Interval of writing the metrics to output.file.").
+			Default("1m").Envar("OUTPUT_INTERVAL").Duration()
+		remoteWriteURL = kingpin.Flag("remote-write.url",
+			"Push the metrics of es.uri to this Prometheus remote write endpoint on every remote-write.interval instead of serving them via HTTP.").
+			Default("").Envar("REMOTE_WRITE_URL").String()
+		remoteWriteInterval = kingpin.Flag("remote-write.interval",
+			"Interval of pushing the metrics to remote-write.url.").
+			Default("1m").Envar("REMOTE_WRITE_INTERVAL").Duration()
+		remoteWriteTimeout = kingpin.Flag("remote-write.timeout",
+			"Timeout of the requests to remote-write.url.").
+			Default("30s").Envar("REMOTE_WRITE_TIMEOUT").Duration()
+		remoteWriteBearerToken = kingpin.Flag("remote-write.bearer-token",
+			"Bearer token to authenticate against remote-write.url.").
+			Default("").Envar("REMOTE_WRITE_BEARER_TOKEN").String()
+		remoteWriteBearerTokenFile = kingpin.Flag("remote-write.bearer-token-file",
+			"Path to a file containing the bearer token to authenticate against remote-write.url, read on every write.").
+			Default("").Envar("REMOTE_WRITE_BEARER_TOKEN_FILE").String()
+		leaderElectionLease = kingpin.Flag("leader-election.lease",
+			"Name of the Kubernetes Lease electing the replica which writes output.file or pushes to remote-write.url, empty disables the election.").
+			Default("").Envar("LEADER_ELECTION_LEASE").String()
+		leaderElectionNamespace = kingpin.Flag("leader-election.namespace",
+			"Namespace of the Lease, defaults to that of the service account.").
+			Default("").Envar("LEADER_ELECTION_NAMESPACE").String()
+		leaderElectionIdentity = kingpin.Flag("leader-election.identity",
+			"Identity of the replica in the Lease, defaults to the hostname, i.e. the name of the pod.").
+			Default("").Envar("LEADER_ELECTION_IDENTITY").String()
+		leaderElectionLeaseDuration = kingpin.Flag("leader-election.lease-duration",
+			"Duration after which another replica takes over the Lease if the leader didn't renew it.").
+			Default("15s").Envar("LEADER_ELECTION_LEASE_DURATION").Duration()
+		leaderElectionAPIServer = kingpin.Flag("leader-election.api-server",
+			"URL of the Kubernetes API server, defaults to the in-cluster configuration.").
+			Default("").Envar("LEADER_ELECTION_API_SERVER").String()
+		once = kingpin.Flag("once",
+			"Collect the metrics of es.uri once, write them to stdout and exit. Exits with status 1 if a collector fails.").
+			Default("false").Envar("ONCE").Bool()
+		configFile = kingpin.Flag("config.file",
+			"Path to the YAML configuration file. Flags and environment variables take precedence over the file.").
+			Default("").Envar("CONFIG_FILE").String()
 		logLevel = kingpin.Flag("log.level",
 			"Sets the loglevel. Valid levels are debug, info, warn, error").
 			Default("info").Envar("LOG_LEVEL").String()
@@ -77,15 +354,68 @@ func main() {
 		logOutput = kingpin.Flag("log.output",
 			"Sets the log output. Valid outputs are stdout and stderr").
 			Default("stdout").Envar("LOG_OUTPUT").String()
+		logDedupInterval = kingpin.Flag("log.dedup-interval",
+			"Interval repeated warnings and errors are logged at most once per, along with the number of suppressed repetitions. 0 logs every repetition.").
+			Default("5m").Envar("LOG_DEDUP_INTERVAL").Duration()
 	)
 
+	kingpin.Command("serve", "Export the metrics of Elasticsearch, the default command.").Default()
+	checkConfigCmd := kingpin.Command("check-config", "Check the flags and the config file and exit non-zero on problems, e.g. before a rollout.")
+	checkConfigDryRun := checkConfigCmd.Flag("dry-run",
+		"Connect to es.uri and every cluster of the config file as well.").Bool()
+	listMetricsCmd := kingpin.Command("list-metrics", "Scrape es.uri once and print the name, type, number of series, labels and help of every metric it would export.")
+
 	kingpin.Version(version.Print(Name))
 	kingpin.CommandLine.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
+
+	// the ES_EXPORTER_* environment variables may set config.file as well
+	envErr := applyEnvFlags(kingpin.CommandLine, os.Args[1:])
+	var (
+		config    *Config
+		configErr error
+	)
+	if envErr == nil {
+		config, configErr = loadConfig(*configFile)
+		if configErr == nil {
+			configErr = applyConfigFlags(kingpin.CommandLine, os.Args[1:], config)
+		}
+	}
+
+	if *once || command == listMetricsCmd.FullCommand() {
+		// stdout is reserved for the metrics
+		*logOutput = "stderr"
+	}
+	logger := getLogger(*logLevel, *logOutput, *logFormat, *logDedupInterval)
+
+	if envErr != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to apply environment variables",
+			"err", envErr,
+		)
+		os.Exit(1)
+	}
+	if configErr != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to load config file",
+			"err", configErr,
+		)
+		os.Exit(1)
+	}
 
-	logger := getLogger(*logLevel, *logOutput, *logFormat)
+	if *esAllNodesAlias {
+		*esAllNodes = true
+	}
 
-	esURL, err := url.Parse(*esURI)
+	esURLs, err := parseURIs(*esURI)
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to parse es.uri",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+	esSocket, err := unixSocket(esURLs)
 	if err != nil {
 		_ = level.Error(logger).Log(
 			"msg", "failed to parse es.uri",
@@ -93,57 +423,311 @@ func main() {
 		)
 		os.Exit(1)
 	}
+	if *esDNSRefreshInterval <= 0 {
+		_ = level.Error(logger).Log(
+			"msg", "es.dns-refresh-interval must be positive",
+			"interval", *esDNSRefreshInterval,
+		)
+		os.Exit(1)
+	}
+	// the collectors use the first URI, requests fail over to the others
+	esURL := primaryURL(esURLs[0])
+	if *esPasswordFile != "" && *esAPIKeyFile != "" {
+		_ = level.Error(logger).Log(
+			"msg", "es.password-file and es.api-key-file are mutually exclusive",
+		)
+		os.Exit(1)
+	}
+	if *esPasswordFile != "" && esURL.User == nil {
+		_ = level.Error(logger).Log(
+			"msg", "es.password-file requires the user in es.uri, e.g. http://exporter@localhost:9200",
+		)
+		os.Exit(1)
+	}
+
+	allowedCIDRs, err := parseCIDRs(*webAllowedCIDRs)
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to parse web.allowed-cidrs",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+
+	filter, err := newMetricFilter(*metricsInclude, *metricsExclude)
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to parse metric filters",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+	filter.communityNames = *metricsCommunityNames
+
+	nodeStatsSections, err := collector.ParseNodeStatsSections(*esNodeStatsSections)
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to parse es.node-stats-sections",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+
+	scrapeShard, err := collector.ParseScrapeShard(*shard)
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to parse shard",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+
+	labels, err := parseLabels(*constLabels)
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to parse labels",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+
+	timeouts, err := parseCollectorTimeouts(*esTimeouts)
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to parse es.timeouts",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+
+	intervals, err := parseCollectorIntervals(*esIntervals)
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to parse es.intervals",
+			"err", err,
+		)
+		os.Exit(1)
+	}
 
 	// returns nil if not provided and falls back to simple TCP.
-	tlsConfig := createTLSConfig(*esCA, *esClientCert, *esClientPrivateKey, *esInsecureSkipVerify)
+	tlsConfig := createTLSConfig(*esCA, *esClientCert, *esClientPrivateKey, *tlsKeyPasswordFile, *esInsecureSkipVerify)
+	// the sessions are shared by es.uri and the targets of /probe
+	sessionCache := newSessionCache(*esTLSSessionCacheSize)
+	tlsConfig.ClientSessionCache = sessionCache
+
+	// self-telemetry of the exporter
+	exporterMetrics := newExporterMetrics(logger)
+	prometheus.MustRegister(exporterMetrics)
 
+	// the requests of every collector are bound by its own timeout, the
+	// client's timeout merely caps them
+	transport := newTransport(tlsConfig, *esCompression, *esHTTP2)
+	// the endpoints of dns+a URIs are connected to by address
+	transport.DialContext = resolvedDialer(transport.DialContext)
+	var next http.RoundTripper = transport
+	if esSocket != "" {
+		next = newUnixSocketRoundTripper(esSocket, newTransport(tlsConfig, *esCompression, *esHTTP2), transport)
+	}
+	if *esPasswordFile != "" {
+		// the password replaces that of the user of every URI
+		next = &passwordFileRoundTripper{passwordFile: *esPasswordFile, next: next}
+	}
+	next = newHeaderRoundTripper(config.ES.Headers, next)
+	failover := newFailoverRoundTripper(logger, esURLs, next)
+	fixtures, err := newFixtureRoundTripper(logger, *esFixtureDir, *esFixtureMode, failover)
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to set up es.fixture-dir",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+	// the responses of Elasticsearch are recorded for debugging if enabled
+	var last *lastScrape
+	if *webEnableLastScrape {
+		last = newLastScrape()
+	}
 	httpClient := &http.Client{
-		Timeout: *esTimeout,
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-			Proxy:           http.ProxyFromEnvironment,
-		},
+		Timeout:   timeouts.max(*esTimeout),
+		Transport: exporterMetrics.roundTripper(newResponseLimitRoundTripper(int64(*esMaxResponseSize), newRetryRoundTripper(logger, *esRetries, *esRetryBackoff, last.roundTripper(fixtures)))),
 	}
+	if *esAPIKeyFile != "" {
+		httpClient.Transport = &apiKeyRoundTripper{apiKeyFile: *esAPIKeyFile, next: httpClient.Transport}
+	}
+
+	// create a context that is cancelled on SIGKILL
+	ctx, cancel := context.WithCancel(context.Background())
 
-	// version metric
+	// resolve the endpoints of dns+ URIs before the first request
+	if rt, ok := failover.(*failoverRoundTripper); ok {
+		rt.run(ctx, *esDNSRefreshInterval)
+	}
+
+	// build info metric, elasticsearch_exporter_build_info
 	versionMetric := version.NewCollector(Name)
 	prometheus.MustRegister(versionMetric)
 
 	// cluster info retriever
 	clusterInfoRetriever := clusterinfo.New(logger, httpClient, esURL, *esClusterInfoInterval)
 
-	prometheus.MustRegister(collector.NewClusterHealth(logger, httpClient, esURL))
-	prometheus.MustRegister(collector.NewNodes(logger, httpClient, esURL, *esAllNodes, *esNode))
-
-	if *esExportIndices || *esExportShards {
-		iC := collector.NewIndices(logger, httpClient, esURL, *esExportShards)
-		prometheus.MustRegister(iC)
-		if registerErr := clusterInfoRetriever.RegisterConsumer(iC); registerErr != nil {
-			_ = level.Error(logger).Log("msg", "failed to register indices collector in cluster info")
-			os.Exit(1)
-		}
+	// the collectors are registered per scrape, see scrapeHandler. The pool is
+	// shared by concurrent scrapes.
+	pool := newCollectorPool(*esConcurrency)
+	esCollector, err := collector.NewElasticsearchCollector(collector.Config{
+		Logger:               logger,
+		Client:               httpClient,
+		URL:                  esURL,
+		AllNodes:             *esAllNodes,
+		Node:                 *esNode,
+		Sniff:                *esSniff,
+		Shard:                scrapeShard,
+		NodeStatsSections:    nodeStatsSections,
+		LegacyMillisMetrics:  *esLegacyMillisMetrics,
+		DerivedLatencies:     *esDerivedLatencies,
+		HotSpots:             *esHotSpots,
+		NodeShards:           *esNodeShards,
+		Indices:              *esExportIndices,
+		Shards:               *esExportShards,
+		IncludeHiddenIndices: *indicesIncludeHidden,
+		IndexPatterns:        config.indexPatterns(),
+		ShardLatency:         *indicesShardLatency,
+		TopIndices:           *indicesTopN,
+		TopIndicesBy:         *indicesTopBy,
+		SnapshotSizes:        *snapshotsSizes,
+		Snapshots:            *esExportSnapshots,
+		ClusterSettings:      *esExportClusterSettings,
+		IndicesSettings:      *esExportIndicesSettings,
+		DesiredBalance:       *esExportDesiredBalance,
+		Security:             *esExportSecurity,
+		ShardStores:          *esExportShardStores,
+		UnreplicatedShards:   *esExportUnreplicatedShards,
+		Usage:                *esExportUsage,
+		ML:                   *esExportML,
+		Downsampling:         *esExportDownsampling,
+		TSDS:                 *esExportTSDS,
+		ISM:                  *esExportISM,
+		KNN:                  *esExportKNN,
+		SecurityPlugin:       *esExportSecurityPlugin,
+		APIKeyExpiryWindow:   *esAPIKeyExpiryWindow,
+		AuditLogIndexPattern: *esAuditLogIndexPattern,
+		CatEndpoints:         config.catEndpoints(),
+		Queries:              config.queries(),
+		CountQueries:         config.countQueries(),
+		StrictParsing:        *esStrictParsing,
+		UnknownFields:        exporterMetrics.unknownFieldsCounter(),
+		Wrap: func(name string, c prometheus.Collector) prometheus.Collector {
+			c = pool.wrap(exporterMetrics.instrument(name, withTimeout(timeouts.get(name, *esTimeout), c)))
+			return withInterval(intervals[name], withBreaker(logger, name, *esBreakerThreshold, *esBreakerCooldown, exporterMetrics, c))
+		},
+	})
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to create collectors",
+			"err", err,
+		)
+		os.Exit(1)
 	}
-
-	if *esExportSnapshots {
-		prometheus.MustRegister(collector.NewSnapshots(logger, httpClient, esURL))
+	// the nodes and indices collectors adapt to the version of Elasticsearch
+	if registerErr := esCollector.RegisterConsumers(clusterInfoRetriever); registerErr != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to register collectors in cluster info",
+			"err", registerErr,
+		)
+		os.Exit(1)
+	}
+	esCollectors := []prometheus.Collector{esCollector}
+	// clusterUUID returns the UUID attached as cluster_uuid label, if enabled
+	var clusterUUID func() string
+	if *esClusterUUIDLabel {
+		clusterUUID = esCollector.ClusterUUID
 	}
 
-	if *esExportClusterSettings {
-		prometheus.MustRegister(collector.NewClusterSettings(logger, httpClient, esURL))
+	// the config file can be reloaded via SIGHUP or the /-/reload endpoint
+	reloadable := newReloadableConfig(logger, *configFile, config)
+	prometheus.MustRegister(reloadable)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			_ = reloadable.Reload()
+		}
+	}()
+
+	// the probe handler scrapes the targets of /probe and of the discovery
+	probe := &probeHandler{
+		logger:               logger,
+		config:               reloadable,
+		timeout:              *esTimeout,
+		timeouts:             timeouts,
+		retries:              *esRetries,
+		retryBackoff:         *esRetryBackoff,
+		maxResponseSize:      int64(*esMaxResponseSize),
+		compression:          *esCompression,
+		http2:                *esHTTP2,
+		sessionCache:         sessionCache,
+		concurrency:          *esConcurrency,
+		allNodes:             *esAllNodes,
+		node:                 *esNode,
+		sniff:                *esSniff,
+		nodeStatsSections:    nodeStatsSections,
+		includeHiddenIndices: *indicesIncludeHidden,
+		indexPatterns:        config.indexPatterns(),
+		shardLatency:         *indicesShardLatency,
+		topIndices:           *indicesTopN,
+		topIndicesBy:         *indicesTopBy,
+		snapshotSizes:        *snapshotsSizes,
+		apiKeyExpiryWindow:   *esAPIKeyExpiryWindow,
+		auditLogIndexPattern: *esAuditLogIndexPattern,
+		catEndpoints:         config.catEndpoints(),
+		queries:              config.queries(),
+		countQueries:         config.countQueries(),
+		legacyMillis:         *esLegacyMillisMetrics,
+		strictParsing:        *esStrictParsing,
+		filter:               filter,
+		labels:               labels,
+		clusterLabel:         *esClusterLabel,
+		clusterUUIDLabel:     *esClusterUUIDLabel,
+		metrics:              exporterMetrics,
+		timeoutOffset:        *webTimeoutOffset,
+		collectors: enabledCollectors{
+			indices:         *esExportIndices,
+			shards:          *esExportShards,
+			snapshots:       *esExportSnapshots,
+			clusterSettings: *esExportClusterSettings,
+			indicesSettings: *esExportIndicesSettings,
+			desiredBalance:  *esExportDesiredBalance,
+			security:        *esExportSecurity,
+			shardStores:     *esExportShardStores,
+			unreplicated:    *esExportUnreplicatedShards,
+			usage:           *esExportUsage,
+			ml:              *esExportML,
+			downsampling:    *esExportDownsampling,
+			tsds:            *esExportTSDS,
+			ism:             *esExportISM,
+			knn:             *esExportKNN,
+			securityPlugin:  *esExportSecurityPlugin,
+		},
 	}
 
-	if *esExportIndicesSettings {
-		prometheus.MustRegister(collector.NewIndicesSettings(logger, httpClient, esURL))
+	if command == checkConfigCmd.FullCommand() {
+		problems := checkConfig(ctx, logger, config, probe, clusterInfoRetriever, *checkConfigDryRun)
+		cancel()
+		if problems > 0 {
+			_ = level.Error(logger).Log(
+				"msg", "config check failed",
+				"problems", problems,
+			)
+			os.Exit(1)
+		}
+		_ = level.Info(logger).Log("msg", "config check passed")
+		os.Exit(0)
 	}
 
 	// create a http server
 	server := &http.Server{}
 
-	// create a context that is cancelled on SIGKILL
-	ctx, cancel := context.WithCancel(context.Background())
-
 	// start the cluster info retriever
-	switch runErr := clusterInfoRetriever.Run(ctx); runErr {
+	switch runErr := clusterInfoRetriever.Run(withCollectorName(ctx, "clusterinfo")); runErr {
 	case nil:
 		_ = level.Info(logger).Log(
 			"msg", "started cluster info retriever",
@@ -159,8 +743,209 @@ func main() {
 	// register cluster info retriever as prometheus collector
 	prometheus.MustRegister(clusterInfoRetriever)
 
-	mux := http.DefaultServeMux
-	mux.Handle(*metricsPath, prometheus.Handler())
+	// collect gathers the metrics of es.uri for --once and --output.file
+	collect := func() ([]*dto.MetricFamily, error) {
+		return gatherOnce(ctx, append(esCollectors, clusterInfoRetriever), func(g prometheus.Gatherer) prometheus.Gatherer {
+			return exportGatherer(clusterUUIDGatherer(clusterUUID, g), filter, *esClusterLabel, labels)
+		})
+	}
+
+	if command == listMetricsCmd.FullCommand() {
+		mfs, err := collect()
+		if writeErr := writeMetricInventory(os.Stdout, mfs); writeErr != nil {
+			_ = level.Error(logger).Log(
+				"msg", "failed to write metrics",
+				"err", writeErr,
+			)
+			os.Exit(1)
+		}
+		cancel()
+		if err != nil {
+			_ = level.Error(logger).Log(
+				"msg", "failed to collect metrics, the list is incomplete",
+				"err", err,
+			)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *once {
+		mfs, err := collect()
+		if writeErr := writeMetrics(os.Stdout, mfs); writeErr != nil {
+			_ = level.Error(logger).Log(
+				"msg", "failed to write metrics",
+				"err", writeErr,
+			)
+			os.Exit(1)
+		}
+		cancel()
+		if err != nil {
+			_ = level.Error(logger).Log(
+				"msg", "failed to collect metrics",
+				"err", err,
+			)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *leaderElectionLease != "" && *outputFile == "" && *remoteWriteURL == "" {
+		_ = level.Error(logger).Log("msg", "leader-election.lease requires output.file or remote-write.url")
+		os.Exit(1)
+	}
+
+	// the metrics are pushed instead of being served via HTTP
+	if *outputFile != "" || *remoteWriteURL != "" {
+		if *outputFile != "" && *remoteWriteURL != "" {
+			_ = level.Error(logger).Log("msg", "output.file and remote-write.url are mutually exclusive")
+			os.Exit(1)
+		}
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-stop
+			cancel()
+		}()
+
+		// only the leader of several replicas pushes the metrics
+		var elector *leaseElector
+		if *leaderElectionLease != "" {
+			elector, err = newLeaseElector(logger, *leaderElectionAPIServer, *leaderElectionNamespace,
+				*leaderElectionLease, *leaderElectionIdentity, *leaderElectionLeaseDuration)
+			if err != nil {
+				_ = level.Error(logger).Log(
+					"msg", "failed to set up leader election",
+					"err", err,
+				)
+				os.Exit(1)
+			}
+			elector.run(ctx)
+		}
+
+		if *outputFile != "" {
+			_ = level.Info(logger).Log(
+				"msg", "writing metrics to file",
+				"path", *outputFile,
+				"interval", (*outputInterval).String(),
+			)
+			exportEvery(ctx, logger, *outputInterval, elector, collect, func(mfs []*dto.MetricFamily) error {
+				return writeMetricsFile(*outputFile, mfs)
+			})
+		} else {
+			_ = level.Info(logger).Log(
+				"msg", "pushing metrics via remote write",
+				"url", *remoteWriteURL,
+				"interval", (*remoteWriteInterval).String(),
+			)
+			writer := &remoteWriter{
+				client:          &http.Client{Timeout: *remoteWriteTimeout},
+				url:             *remoteWriteURL,
+				bearerToken:     *remoteWriteBearerToken,
+				bearerTokenFile: *remoteWriteBearerTokenFile,
+			}
+			exportEvery(ctx, logger, *remoteWriteInterval, elector, collect, func(mfs []*dto.MetricFamily) error {
+				// the last metrics are still pushed on shutdown
+				return writer.write(context.Background(), mfs)
+			})
+		}
+		if elector != nil {
+			// another replica takes over without waiting for the lease to
+			// expire
+			releaseCtx, releaseCancel := context.WithTimeout(context.Background(), *leaderElectionLeaseDuration/3)
+			if err := elector.release(releaseCtx); err != nil {
+				_ = level.Warn(logger).Log(
+					"msg", "failed to release the lease",
+					"err", err,
+				)
+			}
+			releaseCancel()
+		}
+		os.Exit(0)
+	}
+
+	// discovered targets are scraped along with es.uri
+	template := target{collectors: probe.collectors}
+	if *discoveryAuthModule != "" {
+		if _, ok := config.AuthModules[*discoveryAuthModule]; !ok {
+			_ = level.Error(logger).Log(
+				"msg", "unknown discovery.auth-module",
+				"auth_module", *discoveryAuthModule,
+			)
+			os.Exit(1)
+		}
+		// the credentials are looked up on every scrape, see target.authModule
+		template.authModule = *discoveryAuthModule
+	}
+	var discoverers []discoverer
+	if *discoveryClusters {
+		discoverers = append(discoverers, &configDiscoverer{config: reloadable, template: template})
+	}
+	if *discoveryKubernetesSelector != "" {
+		k8s, err := newKubernetesDiscoverer(*discoveryKubernetesAPIServer, *discoveryKubernetesNamespace, *discoveryKubernetesSelector,
+			*discoveryKubernetesRole, *discoveryKubernetesScheme, *discoveryKubernetesPort, template)
+		if err != nil {
+			_ = level.Error(logger).Log(
+				"msg", "failed to set up Kubernetes discovery",
+				"err", err,
+			)
+			os.Exit(1)
+		}
+		discoverers = append(discoverers, k8s)
+	}
+	if *discoveryConsulService != "" {
+		consul, err := newConsulDiscoverer(*discoveryConsulServer, *discoveryConsulToken, *discoveryConsulService,
+			*discoveryConsulTag, *discoveryConsulDatacenter, *discoveryConsulScheme, template)
+		if err != nil {
+			_ = level.Error(logger).Log(
+				"msg", "failed to set up Consul discovery",
+				"err", err,
+			)
+			os.Exit(1)
+		}
+		consul.tokenFile = *discoveryConsulTokenFile
+		discoverers = append(discoverers, consul)
+	}
+	var targets *targetSet
+	if len(discoverers) > 0 {
+		targets = newTargetSet(logger, *discoveryRefreshInterval, *esTimeout, discoverers...)
+		targets.shard = scrapeShard
+		targets.run(ctx)
+	}
+
+	// a dedicated mux keeps handlers registered on http.DefaultServeMux by
+	// imported packages (e.g. net/http/pprof) off the listener
+	mux := http.NewServeMux()
+	if *webEnablePprof {
+		mux.Handle("/debug/pprof/", allowlistHandler(logger, allowedCIDRs, http.HandlerFunc(pprof.Index)))
+		mux.Handle("/debug/pprof/cmdline", allowlistHandler(logger, allowedCIDRs, http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("/debug/pprof/profile", allowlistHandler(logger, allowedCIDRs, http.HandlerFunc(pprof.Profile)))
+		mux.Handle("/debug/pprof/symbol", allowlistHandler(logger, allowedCIDRs, http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("/debug/pprof/trace", allowlistHandler(logger, allowedCIDRs, http.HandlerFunc(pprof.Trace)))
+	}
+	if last != nil {
+		mux.Handle("/debug/last-scrape", allowlistHandler(logger, allowedCIDRs, last))
+	}
+	// the scrapes of /metrics and /probe share the limit
+	limiter := newRequestLimiter(*webMaxRequests)
+	mux.Handle(*metricsPath, allowlistHandler(logger, allowedCIDRs, limiter.handler(logger, promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		&scrapeHandler{
+			logger:        logger,
+			gatherer:      prometheus.DefaultGatherer,
+			collectors:    esCollectors,
+			timeoutOffset: *webTimeoutOffset,
+			filter:        filter,
+			clusterLabel:  *esClusterLabel,
+			clusterUUID:   clusterUUID,
+			labels:        labels,
+			cache:         newScrapeCache(*esMinInterval, *esTimestamps),
+			targets:       targets,
+			probe:         probe,
+		},
+	))))
+	mux.Handle("/probe", allowlistHandler(logger, allowedCIDRs, limiter.handler(logger, probe)))
+
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, err = w.Write([]byte(`<html>
 			<head><title>Elasticsearch Exporter</title></head>
@@ -177,21 +962,60 @@ func main() {
 		}
 	})
 
-	// health endpoint
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+	// reload endpoint
+	mux.Handle("/-/reload", allowlistHandler(logger, allowedCIDRs, reloadable))
+
+	// health endpoints
+	healthy := func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusOK), http.StatusOK)
-	})
+	}
+	mux.HandleFunc("/healthz", healthy)
+	mux.HandleFunc("/-/healthy", healthy)
+
+	// readiness endpoint, ready as soon as the last cluster info call succeeded
+	mux.Handle("/-/ready", readyHandler(clusterInfoRetriever))
 
 	server.Handler = mux
-	server.Addr = *listenAddress
+
+	listener, err := listen(*listenAddress)
+	if err != nil {
+		_ = level.Error(logger).Log(
+			"msg", "failed to listen",
+			"addr", *listenAddress,
+			"err", err,
+		)
+		os.Exit(1)
+	}
+
+	if len(*webTLSCert) > 0 || len(*webTLSPrivateKey) > 0 || len(*webTLSClientCA) > 0 {
+		webTLSConfig, err := createWebTLSConfig(*webTLSCert, *webTLSPrivateKey, *webTLSClientCA)
+		if err != nil {
+			_ = level.Error(logger).Log(
+				"msg", "failed to create web TLS config",
+				"err", err,
+			)
+			os.Exit(1)
+		}
+		server.TLSConfig = webTLSConfig
+	}
 
 	_ = level.Info(logger).Log(
 		"msg", "starting elasticsearch_exporter",
 		"addr", *listenAddress,
+		"version", version.Info(),
+		"build_context", version.BuildContext(),
 	)
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil {
+		var err error
+		if server.TLSConfig != nil {
+			// certificates are already part of server.TLSConfig
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		// http.ErrServerClosed is returned once a graceful shutdown started
+		if err != nil && err != http.ErrServerClosed {
 			_ = level.Error(logger).Log(
 				"msg", "http server quit",
 				"err", err,
@@ -201,13 +1025,22 @@ func main() {
 	}()
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	sig := <-c
+	_ = level.Info(logger).Log(
+		"msg", "shutting down",
+		"signal", sig.String(),
+		"timeout", (*webShutdownTimeout).String(),
+	)
 
-	// create a context for graceful http server shutdown
-	srvCtx, srvCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// stop accepting new scrapes and wait for in-flight scrapes to complete
+	srvCtx, srvCancel := context.WithTimeout(context.Background(), *webShutdownTimeout)
 	defer srvCancel()
-	<-c
-	_ = level.Info(logger).Log("msg", "shutting down")
-	_ = server.Shutdown(srvCtx)
+	if err := server.Shutdown(srvCtx); err != nil {
+		_ = level.Warn(logger).Log(
+			"msg", "in-flight scrapes didn't complete before the shutdown timeout",
+			"err", err,
+		)
+	}
 	cancel()
 }
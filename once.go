@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// errorCollector records the first error of the collections of c bound to ctx
+type errorCollector struct {
+	ctx context.Context
+	c   prometheus.Collector
+
+	mtx sync.Mutex
+	err error
+}
+
+// Describe implements the prometheus.Collector interface
+func (e *errorCollector) Describe(ch chan<- *prometheus.Desc) {
+	e.c.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (e *errorCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := collector.CollectWithContext(e.ctx, e.c, ch); err != nil {
+		e.mtx.Lock()
+		if e.err == nil {
+			e.err = err
+		}
+		e.mtx.Unlock()
+	}
+}
+
+// gatherOnce collects the metrics of the collectors once, gathered through
+// export. The metrics collected so far are returned along with the first
+// error of a collector.
+func gatherOnce(ctx context.Context, collectors []prometheus.Collector, export func(prometheus.Gatherer) prometheus.Gatherer) ([]*dto.MetricFamily, error) {
+	registry := prometheus.NewRegistry()
+	recorders := make([]*errorCollector, 0, len(collectors))
+	for _, c := range collectors {
+		e := &errorCollector{ctx: ctx, c: c}
+		if err := registry.Register(e); err != nil {
+			return nil, err
+		}
+		recorders = append(recorders, e)
+	}
+	mfs, err := export(registry).Gather()
+	if err != nil {
+		return mfs, err
+	}
+	for _, e := range recorders {
+		if e.err != nil {
+			return mfs, e.err
+		}
+	}
+	return mfs, nil
+}
+
+// writeMetrics writes mfs to w in the text exposition format
+func writeMetrics(w io.Writer, mfs []*dto.MetricFamily) error {
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMetricsFile atomically replaces the file at path by mfs in the text
+// exposition format, so that readers never see a partially written file
+func writeMetricsFile(path string, mfs []*dto.MetricFamily) error {
+	// the temporary file must be on the same file system to be renamed
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	if err := writeMetrics(f, mfs); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// exportEvery passes the metrics returned by collect to export on every
+// interval until ctx is cancelled. Intervals in which the replica doesn't lead
+// the election are skipped.
+func exportEvery(ctx context.Context, logger log.Logger, interval time.Duration, elector *leaseElector, collect func() ([]*dto.MetricFamily, error), export func([]*dto.MetricFamily) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if elector.leading() {
+			mfs, err := collect()
+			if err != nil {
+				_ = level.Warn(logger).Log(
+					"msg", "failed to collect metrics",
+					"err", err,
+				)
+			}
+			if err := export(mfs); err != nil {
+				_ = level.Error(logger).Log(
+					"msg", "failed to export metrics",
+					"err", err,
+				)
+			}
+		} else {
+			_ = level.Debug(logger).Log("msg", "skipped the export, another replica leads")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
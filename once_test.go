@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGatherOnce(t *testing.T) {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge."})
+	gauge.Set(42)
+	export := func(g prometheus.Gatherer) prometheus.Gatherer {
+		return labelsGatherer(prometheus.Labels{"env": "test"}, g)
+	}
+
+	mfs, err := gatherOnce(context.Background(), []prometheus.Collector{gauge, &failingCollector{}}, export)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, mfs); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `test_gauge{env="test"} 42`) {
+		t.Errorf("gauge missing in output:\n%s", buf.String())
+	}
+
+	mfs, err = gatherOnce(context.Background(), []prometheus.Collector{gauge, &failingCollector{err: errors.New("unavailable")}}, export)
+	if err == nil || err.Error() != "unavailable" {
+		t.Errorf("expected error of the failing collector, got %v", err)
+	}
+	if len(mfs) != 1 {
+		t.Errorf("expected metrics of the other collectors, got %d families", len(mfs))
+	}
+}
+
+func TestWriteMetricsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticsearch_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "es.prom")
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge."})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(gauge)
+	for _, value := range []float64{1, 2} {
+		gauge.Set(value)
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeMetricsFile(path, mfs); err != nil {
+			t.Fatalf("failed to write metrics file: %s", err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "test_gauge 2") {
+		t.Errorf("expected file to contain the last metrics, got:\n%s", content)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("expected temporary files to be removed, got %d files", len(files))
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// acceptsOpenMetrics reports whether the client asked for the OpenMetrics
+// text format in its Accept header
+func acceptsOpenMetrics(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && mediaType == "application/openmetrics-text" {
+			return true
+		}
+	}
+	return false
+}
+
+// serveMetrics writes the metrics of g in the format negotiated with the
+// client. OpenMetrics is served if requested, the Prometheus formats
+// otherwise.
+func serveMetrics(w http.ResponseWriter, r *http.Request, g prometheus.Gatherer) {
+	if !acceptsOpenMetrics(r) {
+		promhttp.HandlerFor(g, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+		return
+	}
+	mfs, err := g.Gather()
+	if err != nil && len(mfs) == 0 {
+		http.Error(w, "An error has occurred during metrics gathering:\n\n"+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", openMetricsContentType)
+	_ = writeOpenMetrics(w, mfs)
+}
+
+// writeOpenMetrics writes mfs in the OpenMetrics text format to w. The
+// optional _created samples are omitted, as Elasticsearch doesn't report when
+// its counters were created.
+func writeOpenMetrics(w io.Writer, mfs []*dto.MetricFamily) error {
+	bw := bufio.NewWriter(w)
+	for _, mf := range mfs {
+		writeOpenMetricsFamily(bw, mf)
+	}
+	_, _ = bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+func writeOpenMetricsFamily(w *bufio.Writer, mf *dto.MetricFamily) {
+	name := mf.GetName()
+	typ := "unknown"
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		typ = "counter"
+		// the samples of a counter are suffixed with _total
+		name = strings.TrimSuffix(name, "_total")
+	case dto.MetricType_GAUGE:
+		typ = "gauge"
+	case dto.MetricType_SUMMARY:
+		typ = "summary"
+	case dto.MetricType_HISTOGRAM:
+		typ = "histogram"
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+	if mf.GetHelp() != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, escapeOpenMetrics(mf.GetHelp(), false))
+	}
+
+	for _, m := range mf.Metric {
+		labels := m.Label
+		sample := func(suffix string, value float64, extra ...string) {
+			writeOpenMetricsSample(w, name+suffix, labels, value, extra...)
+		}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			sample("_total", m.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			sample("", m.GetGauge().GetValue())
+		case dto.MetricType_SUMMARY:
+			for _, q := range m.GetSummary().Quantile {
+				sample("", q.GetValue(), "quantile", formatOpenMetricsFloat(q.GetQuantile()))
+			}
+			sample("_sum", m.GetSummary().GetSampleSum())
+			sample("_count", float64(m.GetSummary().GetSampleCount()))
+		case dto.MetricType_HISTOGRAM:
+			infSeen := false
+			for _, b := range m.GetHistogram().Bucket {
+				infSeen = infSeen || math.IsInf(b.GetUpperBound(), 1)
+				sample("_bucket", float64(b.GetCumulativeCount()), "le", formatOpenMetricsFloat(b.GetUpperBound()))
+			}
+			if !infSeen {
+				sample("_bucket", float64(m.GetHistogram().GetSampleCount()), "le", "+Inf")
+			}
+			sample("_sum", m.GetHistogram().GetSampleSum())
+			sample("_count", float64(m.GetHistogram().GetSampleCount()))
+		default:
+			sample("", m.GetUntyped().GetValue())
+		}
+	}
+}
+
+func writeOpenMetricsSample(w *bufio.Writer, name string, labels []*dto.LabelPair, value float64, extra ...string) {
+	_, _ = w.WriteString(name)
+	pairs := make([]string, 0, len(labels)+len(extra)/2)
+	for _, lp := range labels {
+		pairs = append(pairs, lp.GetName()+`="`+escapeOpenMetrics(lp.GetValue(), true)+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeOpenMetrics(extra[i+1], true)+`"`)
+	}
+	if len(pairs) > 0 {
+		_, _ = w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	_, _ = w.WriteString(" " + formatOpenMetricsFloat(value) + "\n")
+}
+
+func formatOpenMetricsFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// escapeOpenMetrics escapes backslashes and line feeds, and double quotes in
+// label values
+func escapeOpenMetrics(s string, quote bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
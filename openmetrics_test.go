@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_requests_total", Help: "Test counter."}, []string{"path"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test \\ gauge."})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(counter, gauge)
+	counter.WithLabelValues(`a"b`).Add(3)
+	gauge.Set(1.5)
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeOpenMetrics(&buf, mfs); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE test_requests counter\n",
+		"# HELP test_requests Test counter.\n",
+		`test_requests_total{path="a\"b"} 3` + "\n",
+		"# TYPE test_gauge gauge\n",
+		`# HELP test_gauge Test \\ gauge.` + "\n",
+		"test_gauge 1.5\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("expected output to end with # EOF:\n%s", out)
+	}
+	if strings.Contains(out, "_created") {
+		t.Errorf("expected no _created samples:\n%s", out)
+	}
+}
+
+func TestServeMetricsNegotiation(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "Test counter."}))
+
+	tcs := map[string]string{
+		"": "text/plain; version=0.0.4",
+		"application/openmetrics-text; version=1.0.0":                  "application/openmetrics-text",
+		"text/plain;q=0.5, application/openmetrics-text;version=0.0.1": "application/openmetrics-text",
+	}
+	for accept, want := range tcs {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		serveMetrics(rec, req, registry)
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), want) {
+			t.Errorf("Accept %q: expected content type %s, got %s", accept, want, rec.Header().Get("Content-Type"))
+		}
+	}
+}
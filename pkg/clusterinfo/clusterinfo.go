@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -25,7 +26,9 @@ var (
 	ErrConsumerAlreadyRegistered = errors.New("consumer already registered")
 	// ErrInitialCallTimeout is returned if the initial clusterinfo call timed out
 	ErrInitialCallTimeout = errors.New("initial cluster info call timed out")
-	initialTimeout        = 10 * time.Second
+	// ErrNotRetrieved is returned by LastError before the first cluster info call
+	ErrNotRetrieved = errors.New("cluster info not retrieved yet")
+	initialTimeout  = 10 * time.Second
 )
 
 type consumer interface {
@@ -48,6 +51,9 @@ type Retriever struct {
 	up                    *prometheus.GaugeVec
 	lastUpstreamSuccessTs *prometheus.GaugeVec
 	lastUpstreamErrorTs   *prometheus.GaugeVec
+
+	mtx     sync.RWMutex
+	lastErr error
 }
 
 // New creates a new Retriever
@@ -59,6 +65,7 @@ func New(logger log.Logger, client *http.Client, u *url.URL, interval time.Durat
 		url:              u,
 		interval:         interval,
 		sync:             make(chan struct{}, 1),
+		lastErr:          ErrNotRetrieved,
 		versionMetric: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: prometheus.BuildFQName(namespace, subsystem, "version_info"),
@@ -71,6 +78,7 @@ func New(logger log.Logger, client *http.Client, u *url.URL, interval time.Durat
 				"build_hash",
 				"version",
 				"lucene_version",
+				"distribution",
 			},
 		),
 		up: prometheus.NewGaugeVec(
@@ -132,10 +140,39 @@ func (r *Retriever) updateMetrics(res *Response) {
 		res.Version.BuildHash,
 		res.Version.Number.String(),
 		res.Version.LuceneVersion.String(),
+		res.Version.GetDistribution(),
 	)
 	r.lastUpstreamSuccessTs.WithLabelValues(url).Set(float64(time.Now().Unix()))
 }
 
+// Fetch retrieves the cluster info once and updates the metrics accordingly.
+// The request is aborted once ctx is done. Registered consumers are not
+// notified.
+func (r *Retriever) Fetch(ctx context.Context) (*Response, error) {
+	res, err := r.fetchAndDecodeClusterInfo(ctx)
+	r.setLastError(err)
+	if err != nil {
+		r.updateMetrics(nil)
+		return nil, err
+	}
+	r.updateMetrics(res)
+	return res, nil
+}
+
+// LastError returns the error of the last cluster info call, nil if it
+// succeeded
+func (r *Retriever) LastError() error {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.lastErr
+}
+
+func (r *Retriever) setLastError(err error) {
+	r.mtx.Lock()
+	r.lastErr = err
+	r.mtx.Unlock()
+}
+
 // Update triggers an external cluster info label update
 func (r *Retriever) Update() {
 	r.sync <- struct{}{}
@@ -169,7 +206,8 @@ func (r *Retriever) Run(ctx context.Context) error {
 				_ = level.Info(r.logger).Log(
 					"msg", "providing consumers with updated cluster info label",
 				)
-				res, err := r.fetchAndDecodeClusterInfo()
+				res, err := r.fetchAndDecodeClusterInfo(ctx)
+				r.setLastError(err)
 				if err != nil {
 					_ = level.Error(r.logger).Log(
 						"msg", "failed to retrieve cluster info from ES",
@@ -243,12 +281,16 @@ func (r *Retriever) Run(ctx context.Context) error {
 	}
 }
 
-func (r *Retriever) fetchAndDecodeClusterInfo() (*Response, error) {
+func (r *Retriever) fetchAndDecodeClusterInfo(ctx context.Context) (*Response, error) {
 	var response *Response
 	u := *r.url
 	u.Path = path.Join(r.url.Path, "/")
 
-	res, err := r.client.Get(u.String())
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.client.Do(req.WithContext(ctx))
 	if err != nil {
 		_ = level.Error(r.logger).Log(
 			"msg", "failed to get cluster info",
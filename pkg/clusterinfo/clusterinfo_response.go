@@ -4,6 +4,18 @@ import (
 	"github.com/blang/semver"
 )
 
+const (
+	// DistributionElasticsearch is the distribution of clusters not reporting
+	// one, i.e. of Elasticsearch
+	DistributionElasticsearch = "elasticsearch"
+	// DistributionOpenSearch is the distribution reported by OpenSearch
+	DistributionOpenSearch = "opensearch"
+)
+
+// openSearchCompatibleVersion is the version of Elasticsearch OpenSearch was
+// forked from, the APIs of OpenSearch are compatible to
+var openSearchCompatibleVersion = semver.MustParse("7.10.2")
+
 // Response is the cluster info retrievable from the / endpoint
 type Response struct {
 	Name        string      `json:"name"`
@@ -20,4 +32,31 @@ type VersionInfo struct {
 	BuildDate     string         `json:"build_date"`
 	BuildSnapshot bool           `json:"build_snapshot"`
 	LuceneVersion semver.Version `json:"lucene_version"`
+	// Distribution is only reported by forks of Elasticsearch, e.g. opensearch
+	Distribution string `json:"distribution,omitempty"`
+}
+
+// GetDistribution returns the distribution of the cluster, elasticsearch if
+// it doesn't report one
+func (v VersionInfo) GetDistribution() string {
+	if v.Distribution == "" {
+		return DistributionElasticsearch
+	}
+	return v.Distribution
+}
+
+// IsOpenSearch reports whether the cluster is an OpenSearch cluster
+func (v VersionInfo) IsOpenSearch() bool {
+	return v.Distribution == DistributionOpenSearch
+}
+
+// CompatibleVersion returns the version of Elasticsearch whose APIs the
+// cluster supports, e.g. to tell which stats it reports. That's the version
+// of Elasticsearch OpenSearch was forked from for OpenSearch clusters, whose
+// own versions restarted at 1.0.0.
+func (v VersionInfo) CompatibleVersion() semver.Version {
+	if v.IsOpenSearch() {
+		return openSearchCompatibleVersion
+	}
+	return v.Number
 }
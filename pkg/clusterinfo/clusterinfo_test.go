@@ -2,6 +2,7 @@ package clusterinfo
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -147,7 +148,7 @@ func TestRetriever_fetchAndDecodeClusterInfo(t *testing.T) {
 		t.Skipf("internal test error: %s", err)
 	}
 	retriever := New(log.NewNopLogger(), mockES.Client(), u, 0)
-	ci, err := retriever.fetchAndDecodeClusterInfo()
+	ci, err := retriever.fetchAndDecodeClusterInfo(context.Background())
 	if err != nil {
 		t.Fatalf("failed to retrieve cluster info: %s", err)
 	}
@@ -157,6 +158,33 @@ func TestRetriever_fetchAndDecodeClusterInfo(t *testing.T) {
 	}
 }
 
+func TestRetriever_FetchCancelled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	blockingES := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer blockingES.Close()
+	u, err := url.Parse(blockingES.URL)
+	if err != nil {
+		t.Fatalf("internal test error: %s", err)
+	}
+	retriever := New(log.NewNopLogger(), blockingES.Client(), u, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := retriever.Fetch(ctx); err == nil {
+		t.Fatal("expected the cancelled fetch to fail")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("fetch wasn't aborted on cancellation, took %s", d)
+	}
+}
+
 func TestRetriever_Run(t *testing.T) {
 	// setup mock ES
 	mockES := httptest.NewServer(mockES{})
@@ -194,3 +222,24 @@ func TestRetriever_Run(t *testing.T) {
 	default:
 	}
 }
+
+func TestVersionInfoOpenSearch(t *testing.T) {
+	var ci Response
+	if err := json.Unmarshal([]byte(`{"cluster_name":"opensearch","version":{"distribution":"opensearch","number":"2.11.0","lucene_version":"9.7.0"}}`), &ci); err != nil {
+		t.Fatalf("failed to decode cluster info: %s", err)
+	}
+	if !ci.Version.IsOpenSearch() || ci.Version.GetDistribution() != DistributionOpenSearch {
+		t.Errorf("expected an OpenSearch cluster, got %+v", ci.Version)
+	}
+	if v := ci.Version.CompatibleVersion(); !v.Equals(semver.MustParse("7.10.2")) {
+		t.Errorf("expected OpenSearch to be compatible to 7.10.2, got %s", v)
+	}
+
+	es := VersionInfo{Number: semver.MustParse(versionNumber)}
+	if es.IsOpenSearch() || es.GetDistribution() != DistributionElasticsearch {
+		t.Errorf("expected an Elasticsearch cluster, got %+v", es)
+	}
+	if v := es.CompatibleVersion(); !v.Equals(es.Number) {
+		t.Errorf("expected Elasticsearch to be compatible to its version, got %s", v)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectorPool bounds the number of collectors querying Elasticsearch at
+// once. The registry collects all collectors concurrently, so that a scrape
+// takes about as long as its slowest collector, which can overload small
+// clusters when many collectors are enabled.
+type collectorPool chan struct{}
+
+// newCollectorPool returns a pool of size slots, nil if size isn't positive
+func newCollectorPool(size int) collectorPool {
+	if size <= 0 {
+		return nil
+	}
+	return make(collectorPool, size)
+}
+
+// wrap returns c taking a slot of the pool while collecting. A nil pool
+// returns c.
+func (p collectorPool) wrap(c prometheus.Collector) prometheus.Collector {
+	if p == nil {
+		return c
+	}
+	return &pooledCollector{pool: p, c: c}
+}
+
+type pooledCollector struct {
+	pool collectorPool
+	c    prometheus.Collector
+}
+
+// Describe implements the prometheus.Collector interface
+func (p *pooledCollector) Describe(ch chan<- *prometheus.Desc) {
+	p.c.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (p *pooledCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = p.CollectContext(context.Background(), ch)
+}
+
+// CollectContext implements the collector.ContextCollector interface
+func (p *pooledCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	select {
+	case p.pool <- struct{}{}:
+		defer func() { <-p.pool }()
+	case <-ctx.Done():
+		// the collector still reports itself down with the cancelled context
+	}
+	return collector.CollectWithContext(ctx, p.c, ch)
+}
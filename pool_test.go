@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// slowCollector records how many of its instances collect at once
+type slowCollector struct {
+	desc *prometheus.Desc
+
+	mtx     *sync.Mutex
+	running *int
+	max     *int
+}
+
+func (s *slowCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.desc
+}
+
+func (s *slowCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = s.CollectContext(context.Background(), ch)
+}
+
+func (s *slowCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	s.mtx.Lock()
+	*s.running++
+	if *s.running > *s.max {
+		*s.max = *s.running
+	}
+	s.mtx.Unlock()
+
+	up := 1.0
+	select {
+	case <-time.After(20 * time.Millisecond):
+	case <-ctx.Done():
+		up = 0
+	}
+
+	s.mtx.Lock()
+	*s.running--
+	s.mtx.Unlock()
+	ch <- prometheus.MustNewConstMetric(s.desc, prometheus.GaugeValue, up)
+	return ctx.Err()
+}
+
+func TestCollectorPool(t *testing.T) {
+	var (
+		mtx          sync.Mutex
+		running, max int
+	)
+	names := []string{"a", "b", "c", "d", "e", "f"}
+
+	tcs := []struct {
+		size int
+		want int
+	}{
+		{size: 2, want: 2},
+		{size: 0, want: len(names)},
+	}
+	for _, tc := range tcs {
+		max = 0
+		pool := newCollectorPool(tc.size)
+		registry := prometheus.NewRegistry()
+		for _, name := range names {
+			registry.MustRegister(pool.wrap(&slowCollector{
+				desc:    prometheus.NewDesc(name+"_up", name, nil, nil),
+				mtx:     &mtx,
+				running: &running,
+				max:     &max,
+			}))
+		}
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("size %d: failed to gather: %s", tc.size, err)
+		}
+		if len(mfs) != len(names) {
+			t.Errorf("size %d: expected %d metrics, got %d", tc.size, len(names), len(mfs))
+		}
+		if max != tc.want {
+			t.Errorf("size %d: expected %d collectors at once, got %d", tc.size, tc.want, max)
+		}
+	}
+}
+
+func TestCollectorPoolCancelled(t *testing.T) {
+	var (
+		mtx          sync.Mutex
+		running, max int
+	)
+	pool := newCollectorPool(1)
+	// the only slot is taken, e.g. by a concurrent scrape
+	pool <- struct{}{}
+	defer func() { <-pool }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c := pool.wrap(&slowCollector{
+		desc:    prometheus.NewDesc("test_up", "test", nil, nil),
+		mtx:     &mtx,
+		running: &running,
+		max:     &max,
+	})
+	ch := make(chan prometheus.Metric, 1)
+	if err := collector.CollectWithContext(ctx, c, ch); err == nil {
+		t.Error("expected the cancelled collection to fail")
+	}
+	if len(ch) != 1 {
+		t.Error("expected the collector to report itself down")
+	}
+}
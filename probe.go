@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// enabledCollectors holds which of the optional collectors are enabled
+type enabledCollectors struct {
+	indices         bool
+	shards          bool
+	snapshots       bool
+	clusterSettings bool
+	indicesSettings bool
+	desiredBalance  bool
+	security        bool
+	shardStores     bool
+	unreplicated    bool
+	usage           bool
+	ml              bool
+	downsampling    bool
+	tsds            bool
+	ism             bool
+	knn             bool
+	securityPlugin  bool
+}
+
+// with returns a copy of e with all toggles overridden which are set in c
+func (e enabledCollectors) with(c CollectorsConfig) enabledCollectors {
+	override := func(v *bool, target *bool) {
+		if v != nil {
+			*target = *v
+		}
+	}
+	override(c.Indices, &e.indices)
+	override(c.Shards, &e.shards)
+	override(c.Snapshots, &e.snapshots)
+	override(c.ClusterSettings, &e.clusterSettings)
+	override(c.IndicesSettings, &e.indicesSettings)
+	override(c.DesiredBalance, &e.desiredBalance)
+	override(c.Security, &e.security)
+	override(c.ShardStores, &e.shardStores)
+	override(c.UnreplicatedShards, &e.unreplicated)
+	override(c.Usage, &e.usage)
+	override(c.ML, &e.ml)
+	override(c.Downsampling, &e.downsampling)
+	override(c.TSDS, &e.tsds)
+	override(c.ISM, &e.ism)
+	override(c.KNN, &e.knn)
+	override(c.SecurityPlugin, &e.securityPlugin)
+	return e
+}
+
+// probeHandler scrapes the Elasticsearch cluster given by the target parameter
+// on demand, similar to the blackbox exporter. Credentials for the target are
+// taken from the auth module named by the auth_module parameter. Alternatively
+// a cluster of the configuration file can be scraped via the cluster parameter.
+type probeHandler struct {
+	logger   log.Logger
+	config   *reloadableConfig
+	timeout  time.Duration
+	timeouts collectorTimeouts
+	// retries and retryBackoff configure the retries of failed requests
+	retries      int
+	retryBackoff time.Duration
+	// maxResponseSize limits the size of the responses of Elasticsearch
+	maxResponseSize int64
+	// compression requests gzip compressed responses
+	compression bool
+	// http2 negotiates HTTP/2 with the targets
+	http2 bool
+	// sessionCache resumes the TLS sessions of the targets across probes
+	sessionCache tls.ClientSessionCache
+	// concurrency bounds the collectors querying a target at once
+	concurrency int
+	allNodes    bool
+	node        string
+	sniff       bool
+	// nodeStatsSections are the sections of the node stats requested
+	nodeStatsSections []string
+	// includeHiddenIndices exports the hidden and system indices
+	includeHiddenIndices bool
+	// indexPatterns aggregate the stats of the matching indices
+	indexPatterns []collector.IndexPattern
+	// shardLatency exports the search and indexing times of every shard
+	shardLatency bool
+	// topIndices limits the per-index metrics to the top indices by
+	// topIndicesBy
+	topIndices   int
+	topIndicesBy string
+	// indexTotals keep the indexing operations ordering the top indices by
+	// indexing rate across the probes of a target, keyed by its URL. Those of
+	// targets not probed for indexTotalsRetention are dropped.
+	indexTotalsMtx sync.Mutex
+	indexTotals    map[string]*probeIndexTotals
+	// snapshotSizes exports the sizes of the snapshots
+	snapshotSizes bool
+	// apiKeyExpiryWindow is the window of the API keys counted as expiring
+	apiKeyExpiryWindow time.Duration
+	// clusterUUIDLabel attaches the cluster_uuid label to the metrics with a
+	// cluster label
+	clusterUUIDLabel bool
+	// auditLogIndexPattern enables the audit log lag if not empty
+	auditLogIndexPattern string
+	// catEndpoints are the cat APIs declared in the config file
+	catEndpoints []collector.CatEndpoint
+	// queries and countQueries are the searches declared in the config file
+	queries      []collector.Query
+	countQueries []collector.CountQuery
+	// legacyMillis exports durations in milliseconds under their former names
+	legacyMillis bool
+	// strictParsing counts the fields of the responses unknown to the
+	// collectors
+	strictParsing bool
+	filter        *metricFilter
+	labels        prometheus.Labels
+	// clusterLabel is the alias for the cluster label of targets not
+	// overriding it in their cluster config
+	clusterLabel string
+	metrics      *exporterMetrics
+	// timeoutOffset is subtracted from the scrape timeout announced by
+	// Prometheus
+	timeoutOffset time.Duration
+	collectors    enabledCollectors
+}
+
+// target is an Elasticsearch cluster scraped on demand
+type target struct {
+	// name identifies the target in the target label of discovered targets
+	name         string
+	url          *url.URL
+	auth         AuthModule
+	collectors   enabledCollectors
+	clusterLabel string
+	// filter applies to the metrics of the target before the global one
+	filter *metricFilter
+	// authModule names the auth module of the config file replacing auth,
+	// looked up on every scrape so that reloads of the config file apply
+	authModule string
+}
+
+// parseTargetURI parses the URI of a target, which defaults to HTTP
+func parseTargetURI(uri string) (*url.URL, error) {
+	if !strings.Contains(uri, "://") {
+		uri = "http://" + uri
+	}
+	return url.Parse(uri)
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h *probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	config := h.config.Get()
+	params := r.URL.Query()
+	uri := params.Get("target")
+	t := target{
+		collectors:   h.collectors,
+		clusterLabel: h.clusterLabel,
+	}
+	if name := params.Get("cluster"); name != "" {
+		cluster, clusterAuth, ok := config.cluster(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown cluster %q", name), http.StatusBadRequest)
+			return
+		}
+		uri = cluster.URI
+		t.auth = clusterAuth
+		t.collectors = t.collectors.with(cluster.Collectors)
+		if cluster.ClusterLabel != "" {
+			t.clusterLabel = cluster.ClusterLabel
+		}
+		var err error
+		if t.filter, err = cluster.filter(); err != nil {
+			http.Error(w, fmt.Sprintf("invalid metrics of cluster %q: %s", name, err), http.StatusBadRequest)
+			return
+		}
+	}
+	if uri == "" {
+		http.Error(w, "target or cluster parameter is missing", http.StatusBadRequest)
+		return
+	}
+	var err error
+	t.url, err = parseTargetURI(uri)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse target: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if name := params.Get("auth_module"); name != "" {
+		var ok bool
+		t.auth, ok = config.AuthModules[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown auth module %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := scrapeContext(r, h.timeoutOffset)
+	defer cancel()
+
+	registry, done, err := h.registry(ctx, t)
+	if err != nil {
+		_ = level.Error(h.logger).Log(
+			"msg", "failed to set up probe",
+			"err", err,
+		)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer done()
+
+	serveMetrics(w, r, exportGatherer(t.filter.gatherer(registry), h.filter, t.clusterLabel, h.labels))
+}
+
+// client returns the client of t with its credentials resolved, along with the
+// URL of t including its basic auth credentials. The connections of the
+// returned transport are only used by the client.
+func (h *probeHandler) client(t target) (*http.Client, *url.URL, *http.Transport, error) {
+	if t.authModule != "" {
+		auth, ok := h.config.Get().AuthModules[t.authModule]
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("unknown auth module %q", t.authModule)
+		}
+		t.auth = auth
+	}
+	u := *t.url
+	if t.auth.Username != "" {
+		u.User = url.UserPassword(t.auth.Username, t.auth.Password)
+	}
+
+	tlsConfig, err := createAuthModuleTLSConfig(t.auth.TLS)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create TLS config for %s: %s", u.Host, err)
+	}
+	tlsConfig.ClientSessionCache = h.sessionCache
+	transport := newTransport(tlsConfig, h.compression, h.http2)
+	var next http.RoundTripper = transport
+	if t.auth.PasswordFile != "" {
+		next = &passwordFileRoundTripper{passwordFile: t.auth.PasswordFile, next: transport}
+	}
+	next = newHeaderRoundTripper(t.auth.Headers, next)
+
+	httpClient := &http.Client{
+		Timeout:   h.timeouts.max(h.timeout),
+		Transport: h.metrics.roundTripper(newResponseLimitRoundTripper(h.maxResponseSize, newRetryRoundTripper(h.logger, h.retries, h.retryBackoff, next))),
+	}
+	if t.auth.APIKey != "" || t.auth.APIKeyFile != "" {
+		httpClient.Transport = &apiKeyRoundTripper{apiKey: t.auth.APIKey, apiKeyFile: t.auth.APIKeyFile, next: httpClient.Transport}
+	}
+	return httpClient, &u, transport, nil
+}
+
+// indexTotalsRetention is the time the indexing operations of a probed target
+// are kept after its last probe, a few scrape intervals
+const indexTotalsRetention = 10 * time.Minute
+
+// probeIndexTotals are the indexing operations of a probed target along with
+// the time of its last probe
+type probeIndexTotals struct {
+	totals   *collector.IndexTotals
+	lastUsed time.Time
+}
+
+// targetIndexTotals returns the indexing operations of the indices of t as of
+// its previous probe, if the top indices are ordered by indexing rate
+func (h *probeHandler) targetIndexTotals(t target) *collector.IndexTotals {
+	if h.topIndices == 0 || h.topIndicesBy != collector.TopIndicesByIndexingRate {
+		return nil
+	}
+	h.indexTotalsMtx.Lock()
+	defer h.indexTotalsMtx.Unlock()
+	now := time.Now()
+	// any client reaching /probe may probe other targets, so the totals of
+	// targets no longer probed are dropped to bound the memory
+	for key, totals := range h.indexTotals {
+		if now.Sub(totals.lastUsed) > indexTotalsRetention {
+			delete(h.indexTotals, key)
+		}
+	}
+	key := t.url.String()
+	totals, ok := h.indexTotals[key]
+	if !ok {
+		if h.indexTotals == nil {
+			h.indexTotals = map[string]*probeIndexTotals{}
+		}
+		totals = &probeIndexTotals{totals: &collector.IndexTotals{}}
+		h.indexTotals[key] = totals
+	}
+	totals.lastUsed = now
+	return totals.totals
+}
+
+// registry returns a registry with the collectors of t, whose requests are
+// bound to ctx. done releases the connections to t once the registry has been
+// gathered.
+func (h *probeHandler) registry(ctx context.Context, t target) (gatherer prometheus.Gatherer, done func(), err error) {
+	httpClient, u, transport, err := h.client(t)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger := log.With(h.logger, "target", u.Host)
+	registry := prometheus.NewRegistry()
+	clusterInfoRetriever := clusterinfo.New(logger, httpClient, u, 0)
+	clusterInfo, err := clusterInfoRetriever.Fetch(withCollectorName(ctx, "clusterinfo"))
+	if err != nil {
+		_ = level.Warn(logger).Log(
+			"msg", "failed to retrieve cluster info for probe",
+			"err", err,
+		)
+	}
+	registry.MustRegister(clusterInfoRetriever)
+
+	pool := newCollectorPool(h.concurrency)
+	esCollector, err := collector.NewElasticsearchCollector(collector.Config{
+		Logger:               logger,
+		Client:               httpClient,
+		URL:                  u,
+		AllNodes:             h.allNodes,
+		Node:                 h.node,
+		Sniff:                h.sniff,
+		NodeStatsSections:    h.nodeStatsSections,
+		LegacyMillisMetrics:  h.legacyMillis,
+		IncludeHiddenIndices: h.includeHiddenIndices,
+		IndexPatterns:        h.indexPatterns,
+		ShardLatency:         h.shardLatency,
+		TopIndices:           h.topIndices,
+		TopIndicesBy:         h.topIndicesBy,
+		IndexTotals:          h.targetIndexTotals(t),
+		SnapshotSizes:        h.snapshotSizes,
+		Indices:              t.collectors.indices,
+		Shards:               t.collectors.shards,
+		Snapshots:            t.collectors.snapshots,
+		ClusterSettings:      t.collectors.clusterSettings,
+		IndicesSettings:      t.collectors.indicesSettings,
+		DesiredBalance:       t.collectors.desiredBalance,
+		Security:             t.collectors.security,
+		ShardStores:          t.collectors.shardStores,
+		UnreplicatedShards:   t.collectors.unreplicated,
+		Usage:                t.collectors.usage,
+		ML:                   t.collectors.ml,
+		Downsampling:         t.collectors.downsampling,
+		TSDS:                 t.collectors.tsds,
+		ISM:                  t.collectors.ism,
+		KNN:                  t.collectors.knn,
+		SecurityPlugin:       t.collectors.securityPlugin,
+		APIKeyExpiryWindow:   h.apiKeyExpiryWindow,
+		AuditLogIndexPattern: h.auditLogIndexPattern,
+		CatEndpoints:         h.catEndpoints,
+		Queries:              h.queries,
+		CountQueries:         h.countQueries,
+		StrictParsing:        h.strictParsing,
+		UnknownFields:        h.metrics.unknownFieldsCounter(),
+		Wrap: func(name string, c prometheus.Collector) prometheus.Collector {
+			return pool.wrap(h.metrics.instrument(name, withTimeout(h.timeouts.get(name, h.timeout), c)))
+		},
+	})
+	if err != nil {
+		transport.CloseIdleConnections()
+		return nil, nil, err
+	}
+	esCollector.SetClusterInfo(clusterInfo)
+	registry.MustRegister(&boundCollector{ctx: ctx, c: esCollector})
+
+	gatherer = registry
+	if h.clusterUUIDLabel {
+		gatherer = clusterUUIDGatherer(esCollector.ClusterUUID, registry)
+	}
+	// the transport is only used for this probe, don't keep its connections open
+	return gatherer, transport.CloseIdleConnections, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+)
+
+func TestProbeHandler(t *testing.T) {
+	var authHeader string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `{"name":"node-1","cluster_name":"probed","cluster_uuid":"abc","version":{"number":"6.8.0","lucene_version":"7.7.0"}}`)
+		case "/_cluster/health":
+			fmt.Fprint(w, `{"cluster_name":"probed","status":"green","number_of_nodes":1}`)
+		default:
+			fmt.Fprint(w, `{"cluster_name":"probed","nodes":{}}`)
+		}
+	}))
+	defer es.Close()
+
+	h := &probeHandler{
+		logger: log.NewNopLogger(),
+		config: newReloadableConfig(log.NewNopLogger(), "", &Config{
+			AuthModules: map[string]AuthModule{
+				"key": {APIKey: "secret"},
+			},
+			Clusters: []ClusterConfig{
+				{Name: "named", URI: es.URL, Auth: AuthModule{APIKey: "inline"}},
+			},
+		}),
+		timeout: 5 * time.Second,
+		node:    "_local",
+	}
+
+	tcs := map[string]int{
+		"":                                   http.StatusBadRequest,
+		"?target=" + url.QueryEscape(es.URL): http.StatusOK,
+		"?target=" + url.QueryEscape(es.URL) + "&auth_module=missing": http.StatusBadRequest,
+		"?target=" + url.QueryEscape(es.URL) + "&auth_module=key":     http.StatusOK,
+		"?cluster=named":   http.StatusOK,
+		"?cluster=missing": http.StatusBadRequest,
+	}
+	for query, want := range tcs {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/probe"+query, nil))
+		if rec.Code != want {
+			t.Errorf("%q: expected status %d, got %d", query, want, rec.Code)
+			continue
+		}
+		if want != http.StatusOK {
+			continue
+		}
+		body, _ := ioutil.ReadAll(rec.Body)
+		if !strings.Contains(string(body), `elasticsearch_cluster_health_status{cluster="probed",color="green"} 1`) {
+			t.Errorf("%q: cluster health of target missing in probe output", query)
+		}
+		if strings.Contains(query, "auth_module=key") && authHeader != "ApiKey secret" {
+			t.Errorf("%q: expected API key to be sent, got %q", query, authHeader)
+		}
+		if strings.Contains(query, "cluster=named") && authHeader != "ApiKey inline" {
+			t.Errorf("%q: expected inline API key to be sent, got %q", query, authHeader)
+		}
+	}
+}
+
+func TestProbeHandlerAuthModuleReload(t *testing.T) {
+	var authHeader string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+	}))
+	defer es.Close()
+	u, err := url.Parse(es.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+
+	config := newReloadableConfig(log.NewNopLogger(), "", &Config{
+		AuthModules: map[string]AuthModule{"discovery": {APIKey: "old"}},
+	})
+	h := &probeHandler{logger: log.NewNopLogger(), config: config, timeout: 5 * time.Second}
+	// discovered targets name the auth module, which may change by reloads
+	tgt := target{url: u, authModule: "discovery"}
+	for _, key := range []string{"old", "new"} {
+		config.mtx.Lock()
+		config.config = &Config{AuthModules: map[string]AuthModule{"discovery": {APIKey: key}}}
+		config.mtx.Unlock()
+		client, cu, _, err := h.client(tgt)
+		if err != nil {
+			t.Fatalf("failed to create client: %s", err)
+		}
+		res, err := client.Get(cu.String())
+		if err != nil {
+			t.Fatalf("request failed: %s", err)
+		}
+		res.Body.Close()
+		if authHeader != "ApiKey "+key {
+			t.Errorf("expected API key %q to be sent, got %q", key, authHeader)
+		}
+	}
+
+	config.mtx.Lock()
+	config.config = &Config{}
+	config.mtx.Unlock()
+	if _, _, _, err := h.client(tgt); err == nil {
+		t.Error("expected an error for a removed auth module")
+	}
+}
+
+func TestProbeHandlerIndexTotals(t *testing.T) {
+	h := &probeHandler{topIndices: 10, topIndicesBy: collector.TopIndicesByIndexingRate}
+	a := target{url: &url.URL{Scheme: "http", Host: "a:9200"}}
+	b := target{url: &url.URL{Scheme: "http", Host: "b:9200"}}
+
+	totals := h.targetIndexTotals(a)
+	if h.targetIndexTotals(a) != totals {
+		t.Error("expected the probes of a target to share its totals")
+	}
+	// the totals of targets no longer probed are dropped
+	h.indexTotals[a.url.String()].lastUsed = time.Now().Add(-indexTotalsRetention - time.Minute)
+	h.targetIndexTotals(b)
+	if _, ok := h.indexTotals[a.url.String()]; ok || len(h.indexTotals) != 1 {
+		t.Errorf("expected only the totals of the recent target to be kept, got %v", h.indexTotals)
+	}
+}
+
+func TestProbeHandlerCompression(t *testing.T) {
+	var gzipped bool
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gzipped = strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+		body := `{"cluster_name":"probed","nodes":{}}`
+		if r.URL.Path == "/_cluster/health" {
+			body = `{"cluster_name":"probed","status":"green","number_of_nodes":1}`
+		}
+		if !gzipped {
+			fmt.Fprint(w, body)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		fmt.Fprint(gw, body)
+		_ = gw.Close()
+	}))
+	defer es.Close()
+
+	for _, compression := range []bool{false, true} {
+		h := &probeHandler{
+			logger:      log.NewNopLogger(),
+			config:      newReloadableConfig(log.NewNopLogger(), "", &Config{}),
+			timeout:     5 * time.Second,
+			node:        "_local",
+			compression: compression,
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/probe?target="+url.QueryEscape(es.URL), nil))
+		if gzipped != compression {
+			t.Errorf("compression=%t: gzip requested: %t", compression, gzipped)
+		}
+		body, _ := ioutil.ReadAll(rec.Body)
+		if !strings.Contains(string(body), `elasticsearch_cluster_health_status{cluster="probed",color="green"} 1`) {
+			t.Errorf("compression=%t: cluster health of target missing in probe output", compression)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reloadableConfig holds the current configuration and replaces it when the
+// configuration file is reloaded. Clusters, including their collectors, and
+// auth modules take effect immediately, also for the targets discovered with
+// discovery.auth-module; the other settings, e.g. the collector toggles of es,
+// require a restart, so reloads changing them are rejected.
+type reloadableConfig struct {
+	logger log.Logger
+	path   string
+
+	mtx    sync.RWMutex
+	config *Config
+
+	lastReloadSuccessful   prometheus.Gauge
+	lastReloadSuccessfulTs prometheus.Gauge
+}
+
+func newReloadableConfig(logger log.Logger, path string, config *Config) *reloadableConfig {
+	r := &reloadableConfig{
+		logger: logger,
+		path:   path,
+		config: config,
+		lastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "config", "last_reload_successful"),
+			Help: "Whether the last configuration reload attempt was successful.",
+		}),
+		lastReloadSuccessfulTs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "config", "last_reload_success_timestamp_seconds"),
+			Help: "Timestamp of the last successful configuration reload.",
+		}),
+	}
+	r.lastReloadSuccessful.Set(1)
+	r.lastReloadSuccessfulTs.SetToCurrentTime()
+	return r
+}
+
+// Get returns the current configuration
+func (r *reloadableConfig) Get() *Config {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.config
+}
+
+// restartSettings returns a copy of c without the clusters and auth modules,
+// i.e. the settings taking effect after a restart only
+func (c *Config) restartSettings() Config {
+	settings := *c
+	settings.Clusters = nil
+	settings.AuthModules = nil
+	return settings
+}
+
+// Reload re-reads the configuration file. The current configuration is kept if
+// the file is invalid or changes settings requiring a restart.
+func (r *reloadableConfig) Reload() error {
+	config, err := loadConfig(r.path)
+	if err == nil && !reflect.DeepEqual(r.Get().restartSettings(), config.restartSettings()) {
+		err = fmt.Errorf("settings other than clusters and auth_modules changed, they require a restart")
+	}
+	if err != nil {
+		r.lastReloadSuccessful.Set(0)
+		_ = level.Error(r.logger).Log(
+			"msg", "failed to reload config file",
+			"err", err,
+		)
+		return err
+	}
+
+	r.mtx.Lock()
+	r.config = config
+	r.mtx.Unlock()
+
+	r.lastReloadSuccessful.Set(1)
+	r.lastReloadSuccessfulTs.Set(float64(time.Now().Unix()))
+	_ = level.Info(r.logger).Log(
+		"msg", "reloaded config file",
+		"file", r.path,
+	)
+	return nil
+}
+
+// ServeHTTP implements the /-/reload endpoint
+func (r *reloadableConfig) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "only POST or PUT requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.Reload(); err != nil {
+		http.Error(w, "failed to reload config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusOK), http.StatusOK)
+}
+
+// Describe implements the prometheus.Collector interface
+func (r *reloadableConfig) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.lastReloadSuccessful.Desc()
+	ch <- r.lastReloadSuccessfulTs.Desc()
+}
+
+// Collect implements the prometheus.Collector interface
+func (r *reloadableConfig) Collect(ch chan<- prometheus.Metric) {
+	ch <- r.lastReloadSuccessful
+	ch <- r.lastReloadSuccessfulTs
+}
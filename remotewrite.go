@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+)
+
+// writeRequest is the prometheus.WriteRequest message of the remote write
+// protocol, limited to the fields the exporter sends
+type writeRequest struct {
+	Timeseries []*timeSeries `protobuf:"bytes,1,rep,name=timeseries"`
+}
+
+func (m *writeRequest) Reset()         { *m = writeRequest{} }
+func (m *writeRequest) String() string { return proto.CompactTextString(m) }
+func (*writeRequest) ProtoMessage()    {}
+
+// timeSeries is the prometheus.TimeSeries message of the remote write protocol
+type timeSeries struct {
+	Labels  []*labelPair `protobuf:"bytes,1,rep,name=labels"`
+	Samples []*sample    `protobuf:"bytes,2,rep,name=samples"`
+}
+
+func (m *timeSeries) Reset()         { *m = timeSeries{} }
+func (m *timeSeries) String() string { return proto.CompactTextString(m) }
+func (*timeSeries) ProtoMessage()    {}
+
+// labelPair is the prometheus.Label message of the remote write protocol
+type labelPair struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *labelPair) Reset()         { *m = labelPair{} }
+func (m *labelPair) String() string { return proto.CompactTextString(m) }
+func (*labelPair) ProtoMessage()    {}
+
+// sample is the prometheus.Sample message of the remote write protocol
+type sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3"`
+}
+
+func (m *sample) Reset()         { *m = sample{} }
+func (m *sample) String() string { return proto.CompactTextString(m) }
+func (*sample) ProtoMessage()    {}
+
+// toTimeSeries converts mfs to time series with a single sample at timestamp
+// ts in milliseconds. Summaries and histograms are split into their series
+// like in the text exposition format.
+func toTimeSeries(mfs []*dto.MetricFamily, ts int64) []*timeSeries {
+	var series []*timeSeries
+	add := func(name string, m *dto.Metric, value float64, extra ...string) {
+		labels := []*labelPair{{Name: "__name__", Value: name}}
+		for _, lp := range m.Label {
+			labels = append(labels, &labelPair{Name: lp.GetName(), Value: lp.GetValue()})
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			labels = append(labels, &labelPair{Name: extra[i], Value: extra[i+1]})
+		}
+		// the receivers expect the labels sorted by name
+		sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+		series = append(series, &timeSeries{
+			Labels:  labels,
+			Samples: []*sample{{Value: value, Timestamp: ts}},
+		})
+	}
+	formatFloat := func(f float64) string {
+		if math.IsInf(f, 1) {
+			return "+Inf"
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.GetSummary().Quantile {
+					add(name, m, q.GetValue(), "quantile", formatFloat(q.GetQuantile()))
+				}
+				add(name+"_sum", m, m.GetSummary().GetSampleSum())
+				add(name+"_count", m, float64(m.GetSummary().GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				for _, b := range m.GetHistogram().Bucket {
+					add(name+"_bucket", m, float64(b.GetCumulativeCount()), "le", formatFloat(b.GetUpperBound()))
+				}
+				add(name+"_bucket", m, float64(m.GetHistogram().GetSampleCount()), "le", "+Inf")
+				add(name+"_sum", m, m.GetHistogram().GetSampleSum())
+				add(name+"_count", m, float64(m.GetHistogram().GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+// remoteWriter pushes metrics to a Prometheus remote write endpoint, e.g. of
+// Mimir, Thanos or VictoriaMetrics
+type remoteWriter struct {
+	client      *http.Client
+	url         string
+	bearerToken string
+	// bearerTokenFile is read on every write instead of bearerToken if set
+	bearerTokenFile string
+}
+
+// write sends mfs as samples of the current time
+func (w *remoteWriter) write(ctx context.Context, mfs []*dto.MetricFamily) error {
+	ts := time.Now().UnixNano() / int64(time.Millisecond)
+	data, err := proto.Marshal(&writeRequest{Timeseries: toTimeSeries(mfs, ts)})
+	if err != nil {
+		return fmt.Errorf("failed to encode write request: %s", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "elasticsearch_exporter/"+version.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	bearerToken := w.bearerToken
+	if w.bearerTokenFile != "" {
+		if bearerToken, err = readSecretFile(w.bearerTokenFile); err != nil {
+			return err
+		}
+	}
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+	if req.URL.User != nil {
+		password, _ := req.URL.User.Password()
+		req.SetBasicAuth(req.URL.User.Username(), password)
+	}
+
+	res, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to send write request: %s", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("remote write failed with code %d: %s", res.StatusCode, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRemoteWriter(t *testing.T) {
+	var (
+		got     writeRequest
+		headers http.Header
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		compressed, _ := ioutil.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("failed to decompress request: %s", err)
+		}
+		if err := proto.Unmarshal(data, &got); err != nil {
+			t.Errorf("failed to decode request: %s", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge."}, []string{"zone"})
+	gauge.WithLabelValues("a").Set(42)
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "test_summary", Help: "Test summary.", Objectives: map[float64]float64{0.5: 0.05}})
+	summary.Observe(1)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(gauge, summary)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &remoteWriter{client: &http.Client{Timeout: time.Second}, url: receiver.URL, bearerToken: "secret"}
+	if err := w.write(context.Background(), mfs); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+	if headers.Get("Content-Encoding") != "snappy" || headers.Get("Authorization") != "Bearer secret" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+
+	series := make(map[string]float64)
+	for _, ts := range got.Timeseries {
+		var key bytes.Buffer
+		for _, l := range ts.Labels {
+			key.WriteString(l.Name + "=" + l.Value + ",")
+		}
+		if len(ts.Samples) != 1 || ts.Samples[0].Timestamp == 0 {
+			t.Errorf("expected a single sample with timestamp for %s", key.String())
+			continue
+		}
+		series[key.String()] = ts.Samples[0].Value
+	}
+	want := map[string]float64{
+		"__name__=test_gauge,zone=a,":         42,
+		"__name__=test_summary,quantile=0.5,": 1,
+		"__name__=test_summary_sum,":          1,
+		"__name__=test_summary_count,":        1,
+	}
+	for key, value := range want {
+		if got, ok := series[key]; !ok || got != value {
+			t.Errorf("expected series %s with value %v, got %v", key, value, got)
+		}
+	}
+	if len(series) != len(want) {
+		t.Errorf("expected %d series, got %v", len(want), series)
+	}
+
+	receiver.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	})
+	if err := w.write(context.Background(), mfs); err == nil {
+		t.Error("expected error for rejected request")
+	}
+}
+
+func TestWriteRequestEncoding(t *testing.T) {
+	// field 1 (labels) of the time series containing field 1 (name) and 2 (value)
+	data, err := proto.Marshal(&timeSeries{Labels: []*labelPair{{Name: "a", Value: "b"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x0a, 0x06, 0x0a, 0x01, 'a', 0x12, 0x01, 'b'}
+	if !bytes.Equal(data, want) {
+		t.Errorf("expected encoding %x, got %x", want, data)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// retryRoundTripper retries requests failing with transient errors, i.e.
+// transport errors like timeouts and the status codes 429, 502, 503 and 504,
+// with exponential backoff. Only requests without body are retried.
+type retryRoundTripper struct {
+	logger  log.Logger
+	retries int
+	backoff time.Duration
+	next    http.RoundTripper
+}
+
+// newRetryRoundTripper returns next if no retries are requested
+func newRetryRoundTripper(logger log.Logger, retries int, backoff time.Duration, next http.RoundTripper) http.RoundTripper {
+	if retries <= 0 {
+		return next
+	}
+	return &retryRoundTripper{logger: logger, retries: retries, backoff: backoff, next: next}
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := rt.backoff
+	for attempt := 0; ; attempt++ {
+		res, err := rt.next.RoundTrip(req)
+		if attempt >= rt.retries || req.Body != nil || !retryable(res, err) {
+			return res, err
+		}
+		if err == nil {
+			// drain the body so that the connection can be reused
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+		_ = level.Debug(rt.logger).Log(
+			"msg", "retrying request to Elasticsearch",
+			"path", req.URL.Path,
+			"attempt", attempt+1,
+			"backoff", backoff.String(),
+		)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
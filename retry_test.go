@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestRetryRoundTripper(t *testing.T) {
+	tcs := []struct {
+		failures int
+		status   int
+		retries  int
+		want     int
+		requests int
+	}{
+		{failures: 2, status: http.StatusServiceUnavailable, retries: 2, want: http.StatusOK, requests: 3},
+		{failures: 2, status: http.StatusTooManyRequests, retries: 1, want: http.StatusTooManyRequests, requests: 2},
+		{failures: 1, status: http.StatusForbidden, retries: 3, want: http.StatusForbidden, requests: 1},
+		{failures: 1, status: http.StatusServiceUnavailable, retries: 0, want: http.StatusServiceUnavailable, requests: 1},
+	}
+	for _, tc := range tcs {
+		requests := 0
+		es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests <= tc.failures {
+				http.Error(w, "failure", tc.status)
+			}
+		}))
+
+		client := &http.Client{Transport: newRetryRoundTripper(log.NewNopLogger(), tc.retries, time.Millisecond, http.DefaultTransport)}
+		res, err := client.Get(es.URL)
+		if err != nil {
+			t.Fatalf("request failed: %s", err)
+		}
+		_ = res.Body.Close()
+		es.Close()
+
+		if res.StatusCode != tc.want {
+			t.Errorf("%+v: expected status %d, got %d", tc, tc.want, res.StatusCode)
+		}
+		if requests != tc.requests {
+			t.Errorf("%+v: expected %d requests, got %d", tc, tc.requests, requests)
+		}
+	}
+}
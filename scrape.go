@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/golang/protobuf/proto"
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// scrapeTimeoutHeader is set by Prometheus to the scrape timeout in seconds
+const scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// scrapeContext returns the context for the scrape request r. If Prometheus
+// announced its scrape timeout, the context is cancelled offset before it, so
+// that the collected metrics can still be sent in time.
+func scrapeContext(r *http.Request, offset time.Duration) (context.Context, context.CancelFunc) {
+	v := r.Header.Get(scrapeTimeoutHeader)
+	if v == "" {
+		return context.WithCancel(r.Context())
+	}
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > offset {
+		timeout -= offset
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// boundCollector binds the scrapes of a collector to a context
+type boundCollector struct {
+	ctx context.Context
+	c   prometheus.Collector
+}
+
+// Describe implements the prometheus.Collector interface
+func (b *boundCollector) Describe(ch chan<- *prometheus.Desc) {
+	b.c.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (b *boundCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = collector.CollectWithContext(b.ctx, b.c, ch)
+}
+
+// scrapeHandler serves the metrics of the long-lived collectors of es.uri.
+// The collectors are registered with a new registry on every scrape to bind
+// their requests to the scrape's context.
+type scrapeHandler struct {
+	logger        log.Logger
+	gatherer      prometheus.Gatherer
+	collectors    []prometheus.Collector
+	timeoutOffset time.Duration
+	filter        *metricFilter
+	clusterLabel  string
+	// clusterUUID returns the UUID attached as cluster_uuid label, nil if
+	// it's disabled
+	clusterUUID func() string
+	labels      prometheus.Labels
+	// cache coalesces concurrent scrapes, it's nil if they are independent
+	cache *scrapeCache
+	// targets are discovered clusters scraped along with es.uri by probe
+	targets *targetSet
+	probe   *probeHandler
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h *scrapeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := scrapeContext(r, h.timeoutOffset)
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	for _, c := range h.collectors {
+		if err := registry.Register(&boundCollector{ctx: ctx, c: c}); err != nil {
+			_ = level.Error(h.logger).Log(
+				"msg", "failed to register collector",
+				"err", err,
+			)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var esGatherer prometheus.Gatherer = registry
+	if h.cache != nil {
+		esGatherer = h.cache.gatherer(registry)
+	}
+	gatherers := prometheus.Gatherers{clusterLabelGatherer(h.clusterLabel, clusterUUIDGatherer(h.clusterUUID, prometheus.Gatherers{h.gatherer, esGatherer}))}
+	if targets := h.targets.get(); len(targets) > 0 {
+		gatherers = append(gatherers, gatherTargets(ctx, h.probe, targets)...)
+	}
+	gatherer := exportGatherer(gatherers, h.filter, "", h.labels)
+	serveMetrics(w, r, gatherer)
+}
+
+// scrapeCache coalesces the scrapes of Elasticsearch. Concurrent scrapes
+// share the result of the one in flight, and the metrics are kept for a
+// minimum interval, so that multiple Prometheus servers don't multiply the
+// load on the cluster.
+type scrapeCache struct {
+	interval time.Duration
+	// timestamps attaches the time of the scrape to the cached metrics
+	timestamps bool
+
+	mtx  sync.Mutex
+	last time.Time
+	mfs  []*dto.MetricFamily
+	err  error
+	// running is closed once the scrape in flight finished, nil if there is
+	// none
+	running chan struct{}
+}
+
+// newScrapeCache returns a cache keeping the metrics for interval. Scrapes
+// are coalesced even if the interval is 0.
+func newScrapeCache(interval time.Duration, timestamps bool) *scrapeCache {
+	return &scrapeCache{interval: interval, timestamps: timestamps}
+}
+
+// gatherer returns a gatherer which gathers g unless the cached metrics are
+// younger than the interval. Concurrent scrapes wait for the running one and
+// share its result, even if the scrape it was bound to was cancelled.
+func (c *scrapeCache) gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		c.mtx.Lock()
+		if running := c.running; running != nil {
+			c.mtx.Unlock()
+			<-running
+			c.mtx.Lock()
+		} else if c.last.IsZero() || time.Since(c.last) >= c.interval {
+			running := make(chan struct{})
+			c.running = running
+			c.mtx.Unlock()
+
+			mfs, err := g.Gather()
+
+			c.mtx.Lock()
+			c.mfs, c.err, c.last = mfs, err, time.Now()
+			c.running = nil
+			close(running)
+		}
+		defer c.mtx.Unlock()
+		// the gathered metrics are modified during exposition, hand out copies
+		mfs := make([]*dto.MetricFamily, 0, len(c.mfs)+1)
+		ts := c.last.UnixNano() / int64(time.Millisecond)
+		for _, mf := range c.mfs {
+			mf = proto.Clone(mf).(*dto.MetricFamily)
+			if c.timestamps {
+				for _, m := range mf.Metric {
+					if m.TimestampMs == nil {
+						m.TimestampMs = proto.Int64(ts)
+					}
+				}
+			}
+			mfs = append(mfs, mf)
+		}
+		mfs = append(mfs, lastCollectFamily(c.last))
+		return mfs, c.err
+	})
+}
+
+// lastCollectFamily returns the metric family of the time of the last scrape
+// of Elasticsearch
+func lastCollectFamily(last time.Time) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name: proto.String(prometheus.BuildFQName(namespace, "", "last_collect_timestamp_seconds")),
+		Help: proto.String("Time of the last scrape of Elasticsearch, metrics served from the cache are as old."),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{
+			Gauge: &dto.Gauge{Value: proto.Float64(float64(last.UnixNano()) / 1e9)},
+		}},
+	}
+}
+
+// collectorNames are the names of the collectors as used for telemetry and
+// per-collector settings
+var collectorNames = []string{"cluster_health", "nodes", "indices", "snapshots", "cluster_settings", "indices_settings", "desired_balance", "security", "shard_stores", "unreplicated_shards", "usage", "ml", "downsampling", "tsds", "ism", "knn", "security_plugin", "audit_log", "cat", "query"}
+
+// collectorTimeouts holds the timeouts of the collectors by name
+type collectorTimeouts map[string]time.Duration
+
+// parseCollectorTimeouts parses a comma separated list of collector=duration
+// pairs
+func parseCollectorTimeouts(s string) (collectorTimeouts, error) {
+	timeouts, err := parseCollectorDurations(s, "timeout")
+	return collectorTimeouts(timeouts), err
+}
+
+// parseCollectorDurations parses a comma separated list of collector=duration
+// pairs, kind names the durations in errors
+func parseCollectorDurations(s, kind string) (map[string]time.Duration, error) {
+	durations := map[string]time.Duration{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid %s %q, expected collector=duration", kind, pair)
+		}
+		name := strings.TrimSpace(kv[0])
+		known := false
+		for _, n := range collectorNames {
+			known = known || n == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown collector %q, valid collectors are %s", name, strings.Join(collectorNames, ", "))
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for %s: %s", kind, name, err)
+		}
+		durations[name] = d
+	}
+	return durations, nil
+}
+
+// get returns the timeout of the named collector, def if it has none
+func (t collectorTimeouts) get(name string, def time.Duration) time.Duration {
+	if timeout, ok := t[name]; ok {
+		return timeout
+	}
+	return def
+}
+
+// max returns the longest timeout, at least def
+func (t collectorTimeouts) max(def time.Duration) time.Duration {
+	max := def
+	for _, timeout := range t {
+		if timeout > max {
+			max = timeout
+		}
+	}
+	return max
+}
+
+// withTimeout bounds the requests of every scrape of c to timeout
+func withTimeout(timeout time.Duration, c prometheus.Collector) prometheus.Collector {
+	return &timeoutCollector{timeout: timeout, c: c}
+}
+
+type timeoutCollector struct {
+	timeout time.Duration
+	c       prometheus.Collector
+}
+
+// Describe implements the prometheus.Collector interface
+func (t *timeoutCollector) Describe(ch chan<- *prometheus.Desc) {
+	t.c.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (t *timeoutCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = t.CollectContext(context.Background(), ch)
+}
+
+// CollectContext implements the collector.ContextCollector interface
+func (t *timeoutCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return collector.CollectWithContext(ctx, t.c, ch)
+}
+
+// collectorIntervals holds the minimum intervals between the collections of
+// the collectors by name
+type collectorIntervals map[string]time.Duration
+
+// parseCollectorIntervals parses a comma separated list of collector=duration
+// pairs
+func parseCollectorIntervals(s string) (collectorIntervals, error) {
+	intervals, err := parseCollectorDurations(s, "interval")
+	return collectorIntervals(intervals), err
+}
+
+// withInterval collects c at most once per interval, the scrapes in between
+// are served the metrics of the last successful collection. Rarely changing
+// metrics, e.g. of the snapshots, are so collected less often than those of
+// the nodes. An interval of 0 returns c. The collectors built per scrape, e.g.
+// of /probe, aren't wrapped, their metrics wouldn't outlive the scrape.
+func withInterval(interval time.Duration, c prometheus.Collector) prometheus.Collector {
+	if interval <= 0 {
+		return c
+	}
+	return &intervalCollector{interval: interval, c: c, now: time.Now}
+}
+
+type intervalCollector struct {
+	interval time.Duration
+	c        prometheus.Collector
+	now      func() time.Time
+
+	// mtx serializes the collections, so that concurrent scrapes share one
+	mtx         sync.Mutex
+	metrics     []prometheus.Metric
+	lastCollect time.Time
+}
+
+// Describe implements the prometheus.Collector interface
+func (i *intervalCollector) Describe(ch chan<- *prometheus.Desc) {
+	i.c.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (i *intervalCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = i.CollectContext(context.Background(), ch)
+}
+
+// CollectContext implements the collector.ContextCollector interface
+func (i *intervalCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	if i.lastCollect.IsZero() || i.now().Sub(i.lastCollect) >= i.interval {
+		metrics := make(chan prometheus.Metric)
+		errc := make(chan error, 1)
+		go func() {
+			errc <- collector.CollectWithContext(ctx, i.c, metrics)
+			close(metrics)
+		}()
+		var collected []prometheus.Metric
+		for m := range metrics {
+			collected = append(collected, m)
+		}
+		if err := <-errc; err != nil {
+			// the metrics of the failed collection are passed on, the next
+			// scrape collects again
+			for _, m := range collected {
+				ch <- m
+			}
+			return err
+		}
+		i.metrics, i.lastCollect = collected, i.now()
+	}
+	for _, m := range i.metrics {
+		ch <- m
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScrapeContext(t *testing.T) {
+	tcs := map[string]time.Duration{
+		"":    0,
+		"foo": 0,
+		"10":  9500 * time.Millisecond,
+		"0.2": 200 * time.Millisecond,
+	}
+	for header, want := range tcs {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if header != "" {
+			r.Header.Set(scrapeTimeoutHeader, header)
+		}
+		ctx, cancel := scrapeContext(r, 500*time.Millisecond)
+		deadline, ok := ctx.Deadline()
+		cancel()
+		if want == 0 {
+			if ok {
+				t.Errorf("%q: expected no deadline", header)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%q: expected deadline", header)
+			continue
+		}
+		if d := time.Until(deadline); d > want || d < want-100*time.Millisecond {
+			t.Errorf("%q: expected deadline in %s, got %s", header, want, d)
+		}
+	}
+}
+
+func TestScrapeHandlerTimeout(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer es.Close()
+	u, err := url.Parse(es.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+
+	h := &scrapeHandler{
+		logger:        log.NewNopLogger(),
+		gatherer:      prometheus.NewRegistry(),
+		collectors:    []prometheus.Collector{collector.NewClusterHealth(log.NewNopLogger(), http.DefaultClient, u, true)},
+		timeoutOffset: 100 * time.Millisecond,
+	}
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set(scrapeTimeoutHeader, "0.3")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	h.ServeHTTP(rec, r)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("scrape took %s despite scrape timeout", d)
+	}
+	if !strings.Contains(rec.Body.String(), "elasticsearch_cluster_health_up 0") {
+		t.Errorf("expected cluster health to be down, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestScrapeCache(t *testing.T) {
+	scrapes := 0
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "scrapes", Help: "scrapes"}, func() float64 {
+		scrapes++
+		return float64(scrapes)
+	}))
+
+	c := newScrapeCache(time.Hour, false)
+	for i := 0; i < 3; i++ {
+		mfs, err := labelsGatherer(prometheus.Labels{"env": "prod"}, c.gatherer(registry)).Gather()
+		if err != nil {
+			t.Fatalf("failed to gather: %s", err)
+		}
+		if v := mfs[0].Metric[0].GetGauge().GetValue(); v != 1 {
+			t.Errorf("scrape %d: expected cached value 1, got %v", i, v)
+		}
+		if n := len(mfs[0].Metric[0].Label); n != 1 {
+			t.Errorf("scrape %d: expected 1 label, got %d", i, n)
+		}
+	}
+
+	c.last = time.Time{}
+	mfs, err := c.gatherer(registry).Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+	if v := mfs[0].Metric[0].GetGauge().GetValue(); v != 2 {
+		t.Errorf("expected expired cache to be refreshed, got %v", v)
+	}
+}
+
+func TestScrapeCacheCoalescing(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		scrapes int
+		release = make(chan struct{})
+	)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "scrapes", Help: "scrapes"}, func() float64 {
+		<-release
+		mtx.Lock()
+		defer mtx.Unlock()
+		scrapes++
+		return float64(scrapes)
+	}))
+
+	c := newScrapeCache(0, false)
+	values := make(chan float64, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			mfs, err := c.gatherer(registry).Gather()
+			if err != nil {
+				t.Errorf("failed to gather: %s", err)
+			}
+			values <- mfs[0].Metric[0].GetGauge().GetValue()
+		}()
+	}
+	// all scrapes join the first one before it finishes
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for i := 0; i < 3; i++ {
+		if v := <-values; v != 1 {
+			t.Errorf("expected concurrent scrapes to share the first scrape, got value %v", v)
+		}
+	}
+
+	// scrapes after the first one aren't cached with an interval of 0
+	mfs, err := c.gatherer(registry).Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+	if v := mfs[0].Metric[0].GetGauge().GetValue(); v != 2 {
+		t.Errorf("expected a new scrape, got value %v", v)
+	}
+}
+
+func TestParseCollectorTimeouts(t *testing.T) {
+	timeouts, err := parseCollectorTimeouts("nodes=5s, indices=1m")
+	if err != nil {
+		t.Fatalf("failed to parse timeouts: %s", err)
+	}
+	if got := timeouts.get("nodes", time.Second); got != 5*time.Second {
+		t.Errorf("expected nodes timeout 5s, got %s", got)
+	}
+	if got := timeouts.get("snapshots", time.Second); got != time.Second {
+		t.Errorf("expected default timeout for snapshots, got %s", got)
+	}
+	if got := timeouts.max(time.Second); got != time.Minute {
+		t.Errorf("expected max timeout 1m, got %s", got)
+	}
+	for _, invalid := range []string{"nodes", "nodes=5", "unknown=5s"} {
+		if _, err := parseCollectorTimeouts(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestIntervalCollector(t *testing.T) {
+	c := &failingCollector{}
+	i := withInterval(time.Minute, c).(*intervalCollector)
+	now := time.Now()
+	i.now = func() time.Time { return now }
+	ch := make(chan prometheus.Metric, 1)
+
+	for n := 0; n < 3; n++ {
+		if err := i.CollectContext(context.Background(), ch); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if c.scrapes != 1 {
+		t.Errorf("expected 1 scrape within the interval, got %d", c.scrapes)
+	}
+
+	// failed collections aren't cached
+	now = now.Add(time.Minute)
+	c.err = errors.New("unavailable")
+	if err := i.CollectContext(context.Background(), ch); err == nil {
+		t.Error("expected the error of the collection")
+	}
+	c.err = nil
+	if err := i.CollectContext(context.Background(), ch); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if c.scrapes != 3 {
+		t.Errorf("expected the collection to be retried after the failure, got %d scrapes", c.scrapes)
+	}
+
+	if withInterval(0, c) != prometheus.Collector(c) {
+		t.Error("expected an interval of 0 to return the collector")
+	}
+	if _, err := parseCollectorIntervals("snapshots=5m,nodes"); err == nil {
+		t.Error("expected invalid intervals to be rejected")
+	}
+}
+
+func TestTimeoutCollector(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer es.Close()
+	u, err := url.Parse(es.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(withTimeout(100*time.Millisecond, collector.NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "", false, false, false, nil)))
+	start := time.Now()
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("scrape took %s despite collector timeout", d)
+	}
+}
+
+func TestScrapeCacheTimestamps(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "value", Help: "value"}))
+
+	for _, timestamps := range []bool{false, true} {
+		c := newScrapeCache(time.Hour, timestamps)
+		mfs, err := c.gatherer(registry).Gather()
+		if err != nil {
+			t.Fatalf("failed to gather: %s", err)
+		}
+		if len(mfs) != 2 {
+			t.Fatalf("expected the metric and the last collect timestamp, got %v", mfs)
+		}
+		if name := mfs[1].GetName(); name != "elasticsearch_exporter_last_collect_timestamp_seconds" {
+			t.Errorf("unexpected metric %s", name)
+		}
+		last := mfs[1].Metric[0].GetGauge().GetValue()
+		if want := float64(c.last.UnixNano()) / 1e9; last != want {
+			t.Errorf("expected last collect timestamp %v, got %v", want, last)
+		}
+		ts := mfs[0].Metric[0].TimestampMs
+		switch {
+		case !timestamps && ts != nil:
+			t.Errorf("expected no timestamp, got %d", *ts)
+		case timestamps && (ts == nil || *ts != c.last.UnixNano()/int64(time.Millisecond)):
+			t.Errorf("expected the timestamp of the scrape, got %v", ts)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// exporterMetrics is the self-telemetry of the exporter, covering the scrapes
+// of the collectors and the requests to Elasticsearch
+type exporterMetrics struct {
+	// logger logs when collectors start failing and recover
+	logger            log.Logger
+	scrapeDuration    *prometheus.SummaryVec
+	scrapes           *prometheus.CounterVec
+	scrapeErrors      *prometheus.CounterVec
+	requestFailures   *prometheus.CounterVec
+	requestDuration   *prometheus.HistogramVec
+	skippedScrapes    *prometheus.CounterVec
+	collectorDisabled *prometheus.GaugeVec
+	// unknownFields counts the unknown fields of es.strict-parsing
+	unknownFields *prometheus.CounterVec
+}
+
+func newExporterMetrics(logger log.Logger) *exporterMetrics {
+	return &exporterMetrics{
+		logger: logger,
+		scrapeDuration: prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Name: prometheus.BuildFQName(namespace, "", "scrape_duration_seconds"),
+				Help: "Duration of collector scrapes.",
+			},
+			[]string{"collector"},
+		),
+		scrapes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, "", "scrapes_total"),
+				Help: "Total number of collector scrapes.",
+			},
+			[]string{"collector"},
+		),
+		scrapeErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, "", "scrape_errors_total"),
+				Help: "Total number of failed collector scrapes.",
+			},
+			[]string{"collector"},
+		),
+		requestFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, "", "request_failures_total"),
+				Help: "Total number of failed requests to Elasticsearch by API endpoint, collector and status code.",
+			},
+			[]string{"endpoint", "collector", "code"},
+		),
+		requestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    prometheus.BuildFQName(namespace, "", "api_request_duration_seconds"),
+				Help:    "Duration of requests to Elasticsearch by API endpoint, collector and status code, including reading the response.",
+				Buckets: []float64{.01, .05, .1, .5, 1, 5, 10},
+			},
+			[]string{"endpoint", "collector", "code"},
+		),
+		skippedScrapes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, "", "collector_skipped_scrapes_total"),
+				Help: "Total number of collector scrapes skipped because the collector is disabled after consecutive failures.",
+			},
+			[]string{"collector"},
+		),
+		collectorDisabled: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "", "collector_disabled"),
+				Help: "Whether the collector is disabled for a cooldown period after consecutive failures.",
+			},
+			[]string{"collector"},
+		),
+		unknownFields: collector.NewUnknownFields(),
+	}
+}
+
+// Describe implements the prometheus.Collector interface
+func (m *exporterMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.scrapeDuration.Describe(ch)
+	m.scrapes.Describe(ch)
+	m.scrapeErrors.Describe(ch)
+	m.requestFailures.Describe(ch)
+	m.requestDuration.Describe(ch)
+	m.skippedScrapes.Describe(ch)
+	m.collectorDisabled.Describe(ch)
+	collector.JSONParseFailures.Describe(ch)
+	m.unknownFields.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (m *exporterMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.scrapeDuration.Collect(ch)
+	m.scrapes.Collect(ch)
+	m.scrapeErrors.Collect(ch)
+	m.requestFailures.Collect(ch)
+	m.requestDuration.Collect(ch)
+	m.skippedScrapes.Collect(ch)
+	m.collectorDisabled.Collect(ch)
+	collector.JSONParseFailures.Collect(ch)
+	m.unknownFields.Collect(ch)
+}
+
+// unknownFieldsCounter returns the counter of the unknown fields of the
+// responses of Elasticsearch, nil if m is nil
+func (m *exporterMetrics) unknownFieldsCounter() *prometheus.CounterVec {
+	if m == nil {
+		return nil
+	}
+	return m.unknownFields
+}
+
+// instrument wraps c so that its scrapes are counted and timed under the
+// given collector name
+func (m *exporterMetrics) instrument(name string, c prometheus.Collector) prometheus.Collector {
+	if m == nil {
+		return c
+	}
+	return &instrumentedCollector{name: name, metrics: m, next: c}
+}
+
+type instrumentedCollector struct {
+	name    string
+	metrics *exporterMetrics
+	next    prometheus.Collector
+
+	// failures counts the consecutive failed scrapes
+	mtx      sync.Mutex
+	failures int
+}
+
+// Describe implements the prometheus.Collector interface
+func (c *instrumentedCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.next.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface
+func (c *instrumentedCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = c.CollectContext(context.Background(), ch)
+}
+
+// CollectContext implements the collector.ContextCollector interface
+func (c *instrumentedCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	start := time.Now()
+	err := collector.CollectWithContext(withCollectorName(ctx, c.name), c.next, ch)
+	c.metrics.scrapes.WithLabelValues(c.name).Inc()
+	c.metrics.scrapeDuration.WithLabelValues(c.name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		c.metrics.scrapeErrors.WithLabelValues(c.name).Inc()
+	}
+	c.logTransition(err)
+	return err
+}
+
+// logTransition logs when the collector starts failing and when it recovers,
+// the failures in between are counted in scrape_errors_total
+func (c *instrumentedCollector) logTransition(err error) {
+	if c.metrics.logger == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	switch {
+	case err != nil && c.failures == 0:
+		_ = level.Warn(c.metrics.logger).Log(
+			"msg", "collector started failing",
+			"collector", c.name,
+			"err", err,
+		)
+	case err == nil && c.failures > 0:
+		_ = level.Info(c.metrics.logger).Log(
+			"msg", "collector recovered",
+			"collector", c.name,
+			"failures", c.failures,
+		)
+	}
+	if err != nil {
+		c.failures++
+	} else {
+		c.failures = 0
+	}
+}
+
+// collectorNameKey is the context key of the name of the collector issuing
+// the requests
+type collectorNameKey struct{}
+
+// withCollectorName returns a copy of ctx whose requests are labeled with the
+// name of the collector in the request metrics
+func withCollectorName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, collectorNameKey{}, name)
+}
+
+// roundTripper wraps next so that requests are timed and failed requests are
+// counted by endpoint and collector. The collector of requests issued outside
+// of the collectors is empty, and requests failing without a response are
+// counted with code "error". The endpoint is the path of the request with
+// e.g. node IDs and snapshot names replaced, see endpointTemplate.
+func (m *exporterMetrics) roundTripper(next http.RoundTripper) http.RoundTripper {
+	if m == nil {
+		return next
+	}
+	return &instrumentedRoundTripper{metrics: m, next: next}
+}
+
+type instrumentedRoundTripper struct {
+	metrics *exporterMetrics
+	next    http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *instrumentedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	name, _ := req.Context().Value(collectorNameKey{}).(string)
+	endpoint := endpointTemplate(req.URL.Path)
+	res, err := rt.next.RoundTrip(req)
+	if err != nil {
+		rt.metrics.requestFailures.WithLabelValues(endpoint, name, "error").Inc()
+		rt.metrics.requestDuration.WithLabelValues(endpoint, name, "error").Observe(time.Since(start).Seconds())
+		return res, err
+	}
+	code := strconv.Itoa(res.StatusCode)
+	if res.StatusCode >= http.StatusBadRequest {
+		rt.metrics.requestFailures.WithLabelValues(endpoint, name, code).Inc()
+	}
+	// the request is done once the response has been read
+	observer := rt.metrics.requestDuration.WithLabelValues(endpoint, name, code)
+	res.Body = &timedBody{ReadCloser: res.Body, observe: func() {
+		observer.Observe(time.Since(start).Seconds())
+	}}
+	return res, nil
+}
+
+// endpointWords are the segments of the paths of the APIs requested which
+// aren't replaced by placeholders, besides those starting with an underscore
+var endpointWords = map[string]bool{
+	"allocation": true, "api_key": true, "desired_balance": true, "explain": true, "health": true, "http": true, "indices": true, "job": true,
+	"recovery": true, "settings": true, "shards": true, "stats": true, "trained_models": true, "usage": true,
+}
+
+// endpointPlaceholders are the placeholders of the other segments by the
+// segment preceding them, {name} if none matches
+var endpointPlaceholders = map[string]string{
+	"_nodes":         "{node}",
+	"stats":          "{metric}",
+	"_snapshot":      "{repository}",
+	"{repository}":   "{snapshot}",
+	"_settings":      "{setting}",
+	"health":         "{index}",
+	"indices":        "{index}",
+	"shards":         "{index}",
+	"recovery":       "{index}",
+	"explain":        "{index}",
+	"trained_models": "{model}",
+}
+
+// endpointIndexAPIs are the APIs requested for the indices named by the
+// segment preceding them
+var endpointIndexAPIs = map[string]bool{"_search": true, "_count": true, "_stats": true, "_settings": true, "_shard_stores": true}
+
+// endpointTemplate returns the path p of a request to Elasticsearch with the
+// node IDs, index names, snapshot names and the like replaced by placeholders,
+// e.g. /_nodes/{node}/stats/{metric}, to bound the cardinality of the request
+// metrics. The API starts at the first segment starting with an underscore,
+// the segments before are the index names or the path of es.uri.
+func endpointTemplate(p string) string {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	start := -1
+	for i, s := range segments {
+		if strings.HasPrefix(s, "_") {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return "/"
+	}
+	var template []string
+	if start > 0 && endpointIndexAPIs[segments[start]] {
+		template = append(template, "{index}")
+	}
+	prev := ""
+	for _, s := range segments[start:] {
+		switch {
+		case strings.HasPrefix(s, "_") || endpointWords[s]:
+		case prev == "_cat":
+			// the cat APIs are named by the configuration of es.cat
+		case endpointPlaceholders[prev] != "":
+			s = endpointPlaceholders[prev]
+		default:
+			s = "{name}"
+		}
+		template = append(template, s)
+		prev = s
+	}
+	return "/" + strings.Join(template, "/")
+}
+
+// timedBody calls observe once it is closed
+type timedBody struct {
+	io.ReadCloser
+	once    sync.Once
+	observe func()
+}
+
+// Close implements the io.Closer interface
+func (b *timedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.observe)
+	return err
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/justwatchcom/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestExporterMetrics(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer es.Close()
+	u, err := url.Parse(es.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+
+	m := newExporterMetrics(log.NewNopLogger())
+	client := &http.Client{Transport: m.roundTripper(http.DefaultTransport)}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m)
+	registry.MustRegister(m.instrument("cluster_health", collector.NewClusterHealth(log.NewNopLogger(), client, u, true)))
+
+	// first gather scrapes the collector, second gather exposes the telemetry
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %s", err)
+	}
+	metric := func(name string) *dto.Metric {
+		for _, mf := range mfs {
+			if mf.GetName() == name {
+				return mf.Metric[0]
+			}
+		}
+		t.Fatalf("metric %s not found", name)
+		return nil
+	}
+
+	scrapes := metric("elasticsearch_exporter_scrapes_total")
+	if scrapes.GetCounter().GetValue() < 1 || scrapes.Label[0].GetValue() != "cluster_health" {
+		t.Errorf("unexpected scrapes %v", scrapes)
+	}
+	if metric("elasticsearch_exporter_scrape_duration_seconds").GetSummary().GetSampleCount() < 1 {
+		t.Errorf("expected observed scrape duration")
+	}
+	failures := metric("elasticsearch_exporter_request_failures_total")
+	if failures.GetCounter().GetValue() < 1 ||
+		failures.Label[0].GetValue() != "503" ||
+		failures.Label[1].GetValue() != "cluster_health" ||
+		failures.Label[2].GetValue() != "/_cluster/health" {
+		t.Errorf("unexpected request failures %v", failures)
+	}
+	duration := metric("elasticsearch_exporter_api_request_duration_seconds")
+	if duration.GetHistogram().GetSampleCount() < 1 ||
+		duration.Label[0].GetValue() != "503" ||
+		duration.Label[1].GetValue() != "cluster_health" ||
+		duration.Label[2].GetValue() != "/_cluster/health" {
+		t.Errorf("unexpected request duration %v", duration)
+	}
+}
+
+func TestEndpointTemplate(t *testing.T) {
+	for p, want := range map[string]string{
+		"/":                                  "/",
+		"/es/":                               "/",
+		"/_cluster/health":                   "/_cluster/health",
+		"/es/_cluster/health":                "/_cluster/health",
+		"/_nodes/stats":                      "/_nodes/stats",
+		"/_nodes/_local/stats/jvm,os":        "/_nodes/_local/stats/{metric}",
+		"/_nodes/id1,id2/stats/indices,jvm":  "/_nodes/{node}/stats/{metric}",
+		"/_nodes/http":                       "/_nodes/http",
+		"/_cat/allocation":                   "/_cat/allocation",
+		"/_cat/indices/logs-*":               "/_cat/indices/{index}",
+		"/_snapshot/backups/_all":            "/_snapshot/{repository}/_all",
+		"/_snapshot/backups/a,b/_status":     "/_snapshot/{repository}/{snapshot}/_status",
+		"/_all/_settings/index.downsample.*": "/_all/_settings/{setting}",
+		"/logs-*/_search":                    "/{index}/_search",
+		"/es/logs-*/_count":                  "/{index}/_count",
+		"/_plugins/_ism/explain":             "/_plugins/_ism/explain",
+		"/_ml/trained_models/_stats":         "/_ml/trained_models/_stats",
+		"/_internal/desired_balance":         "/_internal/desired_balance",
+		"/_security/_query/api_key":          "/_security/_query/api_key",
+	} {
+		if got := endpointTemplate(p); got != want {
+			t.Errorf("%s: expected endpoint %s, got %s", p, want, got)
+		}
+	}
+}
+
+func TestInstrumentedCollectorTransitions(t *testing.T) {
+	rec := &recordingLogger{}
+	m := newExporterMetrics(rec)
+	c := &failingCollector{err: errors.New("connection refused")}
+	ic := m.instrument("nodes", c).(*instrumentedCollector)
+
+	ch := make(chan prometheus.Metric)
+	for i := 0; i < 3; i++ {
+		_ = ic.CollectContext(context.Background(), ch)
+	}
+	c.err = nil
+	_ = ic.CollectContext(context.Background(), ch)
+	_ = ic.CollectContext(context.Background(), ch)
+
+	// the collector started failing and recovered
+	if len(rec.records) != 2 {
+		t.Fatalf("expected 2 records, got %d: %v", len(rec.records), rec.records)
+	}
+	var errs dto.Metric
+	if err := m.scrapeErrors.WithLabelValues("nodes").Write(&errs); err != nil {
+		t.Fatalf("failed to write metric: %s", err)
+	}
+	if v := errs.GetCounter().GetValue(); v != 3 {
+		t.Errorf("expected 3 scrape errors, got %v", v)
+	}
+}
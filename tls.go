@@ -3,11 +3,14 @@ package main
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 )
 
-func createTLSConfig(pemFile, pemCertFile, pemPrivateKeyFile string, insecureSkipVerify bool) *tls.Config {
+func createTLSConfig(pemFile, pemCertFile, pemPrivateKeyFile, pemPrivateKeyPasswordFile string, insecureSkipVerify bool) *tls.Config {
 	tlsConfig := tls.Config{}
 	if insecureSkipVerify {
 		// pem settings are irrelevant if we're skipping verification anyway
@@ -21,7 +24,14 @@ func createTLSConfig(pemFile, pemCertFile, pemPrivateKeyFile string, insecureSki
 		}
 		tlsConfig.RootCAs = rootCerts
 	}
-	if len(pemCertFile) > 0 && len(pemPrivateKeyFile) > 0 {
+	if len(pemCertFile) > 0 && len(pemPrivateKeyFile) > 0 && len(pemPrivateKeyPasswordFile) > 0 {
+		// the key is decrypted once to fail early, then on every handshake
+		if _, err := loadEncryptedPrivateKeyFrom(pemCertFile, pemPrivateKeyFile, pemPrivateKeyPasswordFile); err != nil {
+			log.Fatalf("Couldn't setup client authentication. Got %s.", err)
+			return nil
+		}
+		tlsConfig.GetClientCertificate = clientCertificateFrom(pemCertFile, pemPrivateKeyFile, pemPrivateKeyPasswordFile)
+	} else if len(pemCertFile) > 0 && len(pemPrivateKeyFile) > 0 {
 		clientPrivateKey, err := loadPrivateKeyFrom(pemCertFile, pemPrivateKeyFile)
 		if err != nil {
 			log.Fatalf("Couldn't setup client authentication. Got %s.", err)
@@ -32,6 +42,32 @@ func createTLSConfig(pemFile, pemCertFile, pemPrivateKeyFile string, insecureSki
 	return &tlsConfig
 }
 
+// createWebTLSConfig builds the TLS configuration of the exporter's own listener.
+// If clientCAFile is given, clients must present a certificate signed by one of
+// the CAs in that file.
+func createWebTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if len(certFile) == 0 || len(keyFile) == 0 {
+		return nil, errors.New("both web.tls-cert and web.tls-private-key are required to serve TLS")
+	}
+	cert, err := loadPrivateKeyFrom(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load server certificate: %s", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if len(clientCAFile) > 0 {
+		clientCAs, err := loadCertificatesFrom(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load client CA from %s: %s", clientCAFile, err)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
 func loadCertificatesFrom(pemFile string) (*x509.CertPool, error) {
 	caCert, err := ioutil.ReadFile(pemFile)
 	if err != nil {
@@ -49,3 +85,73 @@ func loadPrivateKeyFrom(pemCertFile, pemPrivateKeyFile string) (*tls.Certificate
 	}
 	return &privateKey, nil
 }
+
+// loadEncryptedPrivateKeyFrom is like loadPrivateKeyFrom, but decrypts the
+// private key if it is encrypted with the password read from passwordFile
+func loadEncryptedPrivateKeyFrom(pemCertFile, pemPrivateKeyFile, passwordFile string) (*tls.Certificate, error) {
+	certPEM, err := ioutil.ReadFile(pemCertFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(pemPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", pemPrivateKeyFile)
+	}
+	// only the legacy PEM encryption is supported, e.g. of openssl rsa -aes256
+	if x509.IsEncryptedPEMBlock(block) {
+		password, err := readSecretFile(passwordFile)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %s", pemPrivateKeyFile, err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der})
+	}
+	privateKey, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &privateKey, nil
+}
+
+// clientCertificateFrom loads the client certificate with its encrypted private
+// key on every handshake, so that the password file can be rotated
+func clientCertificateFrom(pemCertFile, pemPrivateKeyFile, passwordFile string) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return loadEncryptedPrivateKeyFrom(pemCertFile, pemPrivateKeyFile, passwordFile)
+	}
+}
+
+// createAuthModuleTLSConfig is like createTLSConfig, but returns an error
+// instead of exiting if the configured files can't be loaded.
+func createAuthModuleTLSConfig(c TLSConfig) (*tls.Config, error) {
+	tlsConfig := tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if len(c.CAFile) > 0 {
+		rootCerts, err := loadCertificatesFrom(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load root certificate from %s: %s", c.CAFile, err)
+		}
+		tlsConfig.RootCAs = rootCerts
+	}
+	if len(c.CertFile) > 0 && len(c.KeyFile) > 0 && len(c.KeyPasswordFile) > 0 {
+		if _, err := loadEncryptedPrivateKeyFrom(c.CertFile, c.KeyFile, c.KeyPasswordFile); err != nil {
+			return nil, fmt.Errorf("couldn't setup client authentication: %s", err)
+		}
+		tlsConfig.GetClientCertificate = clientCertificateFrom(c.CertFile, c.KeyFile, c.KeyPasswordFile)
+	} else if len(c.CertFile) > 0 && len(c.KeyFile) > 0 {
+		clientPrivateKey, err := loadPrivateKeyFrom(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't setup client authentication: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{*clientPrivateKey}
+	}
+	return &tlsConfig, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadEncryptedPrivateKeyFrom(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "exporter"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := writeSecretFile(t, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})))
+	defer os.Remove(certFile)
+	keyFile := writeSecretFile(t, string(pem.EncodeToMemory(block)))
+	defer os.Remove(keyFile)
+	passwordFile := writeSecretFile(t, "secret\n")
+	defer os.Remove(passwordFile)
+
+	if _, err := loadPrivateKeyFrom(certFile, keyFile); err == nil {
+		t.Error("expected the encrypted key to fail without password")
+	}
+	if _, err := loadEncryptedPrivateKeyFrom(certFile, keyFile, passwordFile); err != nil {
+		t.Errorf("failed to load encrypted key: %s", err)
+	}
+
+	if err := ioutil.WriteFile(passwordFile, []byte("wrong"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := createAuthModuleTLSConfig(TLSConfig{CertFile: certFile, KeyFile: keyFile, KeyPasswordFile: passwordFile})
+	if err == nil {
+		t.Errorf("expected a wrong password to be rejected, got %+v", tlsConfig)
+	}
+}
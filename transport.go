@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxIdleConnsPerHost keeps a connection per collector and the cluster info
+// retriever idle, which run concurrently against the same host
+const maxIdleConnsPerHost = 16
+
+// newTransport returns the transport of the requests to Elasticsearch. The
+// requests are bound by their context and the timeout of the client rather
+// than deadlines of the connections, so that connections are kept alive and
+// reused across scrapes. http2 negotiates HTTP/2 with servers supporting it.
+func newTransport(tlsConfig *tls.Config, compression, http2 bool) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		// Elasticsearch closes idle connections after a while, which is
+		// cheaper to notice before reusing them
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		// the transport asks for gzip and decompresses transparently
+		DisableCompression: !compression,
+		// HTTP/2 isn't attempted with a custom dialer unless forced
+		ForceAttemptHTTP2: http2,
+	}
+}
+
+// newSessionCache returns a cache of the TLS sessions of size servers, so
+// that new connections resume sessions instead of full handshakes. It is
+// shared by the transports of all targets. A size of 0 disables resumption.
+func newSessionCache(size int) tls.ClientSessionCache {
+	if size <= 0 {
+		return nil
+	}
+	return tls.NewLRUClientSessionCache(size)
+}
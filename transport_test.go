@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransportReusesConnections(t *testing.T) {
+	const concurrency = 6
+
+	var (
+		mtx   sync.Mutex
+		conns int
+		// the requests of a round are answered once all of them arrived,
+		// which forces the transport to use a connection per request
+		barrier = make(chan struct{})
+		waiting int
+	)
+	es := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		waiting++
+		if waiting == concurrency {
+			waiting = 0
+			close(barrier)
+			barrier = make(chan struct{})
+			mtx.Unlock()
+		} else {
+			b := barrier
+			mtx.Unlock()
+			<-b
+		}
+		_, _ = w.Write([]byte(`{"status":"green"}`))
+	}))
+	es.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mtx.Lock()
+			conns++
+			mtx.Unlock()
+		}
+	}
+	es.Start()
+	defer es.Close()
+
+	transport := newTransport(nil, true, false)
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+	for round := 0; round < 3; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := client.Get(es.URL)
+				if err != nil {
+					t.Errorf("request failed: %s", err)
+					return
+				}
+				_, _ = io.Copy(ioutil.Discard, res.Body)
+				_ = res.Body.Close()
+			}()
+		}
+		wg.Wait()
+		// connections are returned to the idle pool asynchronously
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if conns != concurrency {
+		t.Errorf("expected %d connections to be reused, got %d connections", concurrency, conns)
+	}
+}
+
+func TestTransportHTTP2AndSessionResumption(t *testing.T) {
+	es := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"green"}`))
+	}))
+	es.EnableHTTP2 = true
+	es.StartTLS()
+	defer es.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(es.Certificate())
+	sessionCache := newSessionCache(8)
+
+	// every probe creates its own transport, the sessions are shared
+	for i, wantResumed := range []bool{false, true} {
+		transport := newTransport(&tls.Config{RootCAs: roots, ClientSessionCache: sessionCache}, true, true)
+		client := &http.Client{Transport: transport}
+		res, err := client.Get(es.URL)
+		if err != nil {
+			t.Fatalf("request %d failed: %s", i, err)
+		}
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+		transport.CloseIdleConnections()
+
+		if res.ProtoMajor != 2 {
+			t.Errorf("request %d: expected HTTP/2, got %s", i, res.Proto)
+		}
+		if res.TLS.DidResume != wantResumed {
+			t.Errorf("request %d: expected resumed=%t, got %t", i, wantResumed, res.TLS.DidResume)
+		}
+	}
+
+	if newSessionCache(0) != nil {
+		t.Error("expected a size of 0 to disable the session cache")
+	}
+}
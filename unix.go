@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// unixSocketHost is the host of the HTTP URI replacing a unix:// URI. The
+// .invalid top level domain is reserved, so that the host can't be a real one.
+const unixSocketHost = "elasticsearch.unix.invalid"
+
+// unixSocket replaces a unix:///path/to/socket URI among uris by an HTTP URI
+// whose requests are sent to the socket by unixSocketRoundTripper. It returns
+// the path of the socket, or an empty path if there is none.
+func unixSocket(uris []*url.URL) (string, error) {
+	var path string
+	for i, u := range uris {
+		if u.Scheme != "unix" {
+			continue
+		}
+		if path != "" {
+			return "", fmt.Errorf("only a single unix:// URI is supported")
+		}
+		if u.Path == "" {
+			return "", fmt.Errorf("missing path of the socket in %s", u)
+		}
+		path = u.Path
+		uris[i] = &url.URL{Scheme: "http", Host: unixSocketHost, User: u.User}
+	}
+	return path, nil
+}
+
+// unixSocketRoundTripper sends the requests to the host of the URI returned by
+// unixSocket via a transport of its own, whose connections are dialed to the
+// socket, and all other requests via next
+type unixSocketRoundTripper struct {
+	socket *http.Transport
+	next   http.RoundTripper
+}
+
+// newUnixSocketRoundTripper returns a unixSocketRoundTripper sending the
+// requests to the socket at path via socket, which it reconfigures
+func newUnixSocketRoundTripper(path string, socket *http.Transport, next http.RoundTripper) *unixSocketRoundTripper {
+	dial := socket.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	// a proxy can't forward requests to the socket
+	socket.Proxy = nil
+	socket.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dial(ctx, "unix", path)
+	}
+	return &unixSocketRoundTripper{socket: socket, next: next}
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rt *unixSocketRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Hostname() == unixSocketHost {
+		return rt.socket.RoundTrip(req)
+	}
+	return rt.next.RoundTrip(req)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticsearch_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "es.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotPath string
+	go func() {
+		_ = http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPath = r.URL.Path
+		}))
+	}()
+	defer l.Close()
+
+	uris, err := parseURIs("unix://" + socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := unixSocket(uris)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != socket {
+		t.Errorf("expected socket %s, got %s", socket, path)
+	}
+
+	// the requests to other hosts keep the shared transport and its proxy
+	var proxied string
+	shared := &http.Transport{Proxy: func(req *http.Request) (*url.URL, error) {
+		proxied = req.URL.Host
+		return nil, nil
+	}}
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer es.Close()
+	client := &http.Client{Transport: newUnixSocketRoundTripper(path, &http.Transport{Proxy: http.ProxyFromEnvironment}, shared)}
+	res, err := client.Get(uris[0].String() + "/_cluster/health")
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	_ = res.Body.Close()
+	if gotPath != "/_cluster/health" {
+		t.Errorf("expected request of /_cluster/health, got %s", gotPath)
+	}
+	if proxied != "" {
+		t.Errorf("expected the request to the socket to bypass the shared transport, got %s", proxied)
+	}
+	res, err = client.Get(es.URL)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	_ = res.Body.Close()
+	if esURL, _ := url.Parse(es.URL); proxied != esURL.Host {
+		t.Errorf("expected the request to %s via the shared transport, got %q", esURL.Host, proxied)
+	}
+
+	uris, _ = parseURIs("unix:///a.sock,unix:///b.sock")
+	if _, err := unixSocket(uris); err == nil {
+		t.Error("expected error for multiple sockets")
+	}
+}
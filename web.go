@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
+)
+
+// parseCIDRs parses a comma separated list of CIDR ranges. Plain IP addresses
+// are accepted as well and are treated as single host ranges.
+func parseCIDRs(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", c)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// requestLimiter bounds the number of scrapes served at once
+type requestLimiter chan struct{}
+
+// newRequestLimiter returns a limiter of max concurrent requests, nil if max
+// isn't positive
+func newRequestLimiter(max int) requestLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return make(requestLimiter, max)
+}
+
+// handler answers requests beyond the limit with 503 Service Unavailable
+// rather than queueing them, Prometheus retries on its next scrape anyway. A
+// nil limiter returns next.
+func (l requestLimiter) handler(logger log.Logger, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case l <- struct{}{}:
+			defer func() { <-l }()
+			next.ServeHTTP(w, r)
+		default:
+			_ = level.Warn(logger).Log(
+				"msg", "rejected scrape exceeding web.max-requests",
+				"path", r.URL.Path,
+				"remote_addr", r.RemoteAddr,
+			)
+			http.Error(w, fmt.Sprintf("Limit of concurrent requests reached (%d), try again later.", cap(l)), http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// allowlistHandler rejects requests whose remote address isn't part of any
+// of the allowed networks. An empty allowlist permits all requests.
+func allowlistHandler(logger log.Logger, allowed []*net.IPNet, next http.Handler) http.Handler {
+	if len(allowed) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip != nil {
+			for _, n := range allowed {
+				if n.Contains(ip) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		_ = level.Debug(logger).Log(
+			"msg", "rejected request from address outside of web.allowed-cidrs",
+			"remote_addr", r.RemoteAddr,
+		)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	})
+}
+
+// readyHandler responds with 503 Service Unavailable as long as the last
+// cluster info call of r failed
+func readyHandler(r *clusterinfo.Retriever) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := r.LastError(); err != nil {
+			http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusOK), http.StatusOK)
+	})
+}
+
+// systemdListenFDsStart is the first file descriptor passed by systemd socket
+// activation
+const systemdListenFDsStart = 3
+
+// listen returns the listener of the web interface. Besides TCP addresses,
+// unix:///path/to/socket listens on a Unix domain socket and systemd uses the
+// socket passed by systemd socket activation.
+func listen(address string) (net.Listener, error) {
+	switch {
+	case address == "systemd":
+		return systemdListener()
+	case strings.HasPrefix(address, "unix://"):
+		path := strings.TrimPrefix(address, "unix://")
+		// remove the socket left over by a previous run, but no other file
+		// given by mistake
+		if fi, err := os.Lstat(path); err == nil {
+			if fi.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("%s exists and isn't a socket", path)
+			}
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	default:
+		return net.Listen("tcp", address)
+	}
+}
+
+// systemdListener returns the first socket passed via the LISTEN_FDS protocol
+// of systemd
+func systemdListener() (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("no sockets passed by systemd")
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, fmt.Errorf("no sockets passed by systemd")
+	}
+	// the variables must not be inherited by child processes
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(systemdListenFDsStart, "LISTEN_FD_3")
+	defer func() {
+		// net.FileListener duplicates the file descriptor
+		_ = f.Close()
+	}()
+	return net.FileListener(f)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/justwatchcom/elasticsearch_exporter/pkg/clusterinfo"
+)
+
+func TestAllowlistHandler(t *testing.T) {
+	allowed, err := parseCIDRs("10.0.0.0/8, 192.168.1.10,::1")
+	if err != nil {
+		t.Fatalf("failed to parse CIDRs: %s", err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := allowlistHandler(log.NewNopLogger(), allowed, ok)
+
+	tcs := map[string]int{
+		"10.1.2.3:1234":     http.StatusOK,
+		"192.168.1.10:9999": http.StatusOK,
+		"192.168.1.11:9999": http.StatusForbidden,
+		"[::1]:4321":        http.StatusOK,
+		"[::2]:4321":        http.StatusForbidden,
+		"garbage":           http.StatusForbidden,
+	}
+	for addr, want := range tcs {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: expected status %d, got %d", addr, want, rec.Code)
+		}
+	}
+
+	if _, err := parseCIDRs("10.0.0.0/33"); err == nil {
+		t.Errorf("expected error for invalid CIDR")
+	}
+}
+
+func TestRequestLimiter(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	h := newRequestLimiter(1).handler(log.NewNopLogger(), blocking)
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		done <- rec.Code
+	}()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the request beyond the limit to fail with 503, got %d", rec.Code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("expected the first request to succeed, got %d", code)
+	}
+
+	// the slot is free again
+	go func() { <-entered }()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the request after the first one to succeed, got %d", rec.Code)
+	}
+
+	if newRequestLimiter(0) != nil {
+		t.Errorf("expected no limiter for a limit of 0")
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	up := false
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"cluster_name":"elasticsearch","version":{"number":"7.3.0","lucene_version":"8.1.0"}}`))
+	}))
+	defer es.Close()
+	u, err := url.Parse(es.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+	r := clusterinfo.New(log.NewNopLogger(), http.DefaultClient, u, 0)
+	h := readyHandler(r)
+
+	for _, tc := range []struct {
+		up    bool
+		fetch bool
+		want  int
+	}{
+		{up: true, fetch: false, want: http.StatusServiceUnavailable},
+		{up: false, fetch: true, want: http.StatusServiceUnavailable},
+		{up: true, fetch: true, want: http.StatusOK},
+	} {
+		up = tc.up
+		if tc.fetch {
+			_, _ = r.Fetch(context.Background())
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/-/ready", nil))
+		if rec.Code != tc.want {
+			t.Errorf("up=%t fetch=%t: expected status %d, got %d", tc.up, tc.fetch, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticsearch_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "exporter.sock")
+
+	// a stale socket is replaced
+	for i := 0; i < 2; i++ {
+		l, err := listen("unix://" + socket)
+		if err != nil {
+			t.Fatalf("listen %d failed: %s", i, err)
+		}
+		go func() {
+			_ = http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		}()
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			t.Fatalf("failed to connect to socket: %s", err)
+		}
+		_ = conn.Close()
+		if i == 0 {
+			// leave the socket file behind like a killed process
+			l.(*net.UnixListener).SetUnlinkOnClose(false)
+		}
+		_ = l.Close()
+	}
+
+	// other files aren't removed
+	file := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(file, []byte("clusters: {}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen("unix://" + file); err == nil {
+		t.Error("expected error listening on a regular file")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("expected the file to be kept, got %s", err)
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	if _, err := listen("systemd"); err == nil {
+		t.Error("expected error without sockets passed by systemd")
+	}
+}